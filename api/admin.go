@@ -0,0 +1,101 @@
+// api/admin.go
+package api
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/outbound"
+	"proxy-api/internal/proxy"
+	"proxy-api/internal/scraper"
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+	expvar.Publish("backpressure", expvar.Func(backpressureStats))
+	expvar.Publish("connections", expvar.Func(func() interface{} {
+		return map[string]int{"open": outbound.ConnectionsInUse(), "limit": outbound.ConnectionLimit()}
+	}))
+	expvar.Publish("sources", expvar.Func(func() interface{} { return scraper.SourceHealthSnapshot() }))
+	expvar.Publish("validation", expvar.Func(func() interface{} {
+		return map[string]interface{}{"running": validationRunning.Load(), "skipped": validationSkipped.Load(), "pending": validationPending.Load()}
+	}))
+}
+
+// serveAdmin expone pprof y expvar en ADMIN_ADDRESS hasta que ctx termine
+func (s *server) serveAdmin(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/vars", s.adminVars)
+
+	srv := &http.Server{Addr: config.AdminAddress, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	log.Printf("Administración (pprof y expvar) en %s", config.AdminAddress)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Error en el puerto de administración: %v", err)
+	}
+}
+
+// transportCounts cuenta los clientes HTTP en caché: los de los proxies exitosos, por
+// sesión, y los de las peticiones directas con direcciones fijas
+func (s *server) transportCounts() interface{} {
+	proxyClients := make(map[string]int)
+	s.mtx.RLock()
+	for session, clients := range s.successfulProxies {
+		proxyClients[session] = len(clients)
+	}
+	s.mtx.RUnlock()
+
+	sessionClientsMtx.Lock()
+	directClients := len(sessionClients)
+	sessionClientsMtx.Unlock()
+
+	return map[string]interface{}{
+		"proxy_clients":  proxyClients,
+		"direct_clients": directClients,
+	}
+}
+
+// channelBacklog devuelve los mensajes pendientes de cada suscriptor de los streams,
+// que crecen cuando un cliente deja de leer
+func (s *server) channelBacklog() interface{} {
+	s.resultSubsMtx.Lock()
+	results := make([]int, 0, len(s.resultSubscribers))
+	for ch := range s.resultSubscribers {
+		results = append(results, len(ch))
+	}
+	s.resultSubsMtx.Unlock()
+
+	return map[string]interface{}{
+		"validation_progress": proxy.ProgressBacklog(),
+		"scheduled_results":   results,
+	}
+}
+
+// adminVars escribe las variables de expvar del proceso junto a las del motor, que no
+// se publican en expvar porque cada motor tiene las suyas
+func (s *server) adminVars(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n")
+	expvar.Do(func(kv expvar.KeyValue) {
+		fmt.Fprintf(w, "%q: %s,\n", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "%q: %s,\n", "transports", expvar.Func(s.transportCounts))
+	fmt.Fprintf(w, "%q: %s\n", "channels", expvar.Func(s.channelBacklog))
+	fmt.Fprintf(w, "}\n")
+}
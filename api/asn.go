@@ -0,0 +1,80 @@
+// api/asn.go
+package api
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"proxy-api/internal/asn"
+	"proxy-api/internal/config"
+)
+
+// Etiquetas de tipo de red de un proxy
+const (
+	tagDatacenter  = "datacenter"
+	tagResidential = "residential"
+)
+
+// openASNDatabase carga la base de datos de ASN si está configurada
+func openASNDatabase() {
+	if config.ASNDatabasePath == "" {
+		return
+	}
+	if err := asn.Open(config.ASNDatabasePath); err != nil {
+		log.Printf("Error al cargar la base de datos de ASN: %v", err)
+		return
+	}
+	log.Printf("Base de datos de ASN cargada desde %s", config.ASNDatabasePath)
+}
+
+// asnTags devuelve las etiquetas de ASN y tipo de red del proxy
+func asnTags(proxyAddr string) []string {
+	info, ok := asn.LookupAddress(proxyAddress(proxyAddr))
+	if !ok {
+		return nil
+	}
+	tags := []string{fmt.Sprintf("asn:%d", info.Number)}
+	if info.Datacenter {
+		return append(tags, tagDatacenter)
+	}
+	return append(tags, tagResidential)
+}
+
+// isDatacenterProxy indica si el proxy pertenece a un rango de hosting conocido
+func isDatacenterProxy(proxyAddr string) bool {
+	info, ok := asn.LookupAddress(proxyAddress(proxyAddr))
+	return ok && info.Datacenter
+}
+
+// asnKey devuelve el AS del proxy como clave de diversidad
+func asnKey(proxyAddr string) string {
+	info, ok := asn.LookupAddress(proxyAddress(proxyAddr))
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("AS%d", info.Number)
+}
+
+// preferResidential ordena los proxies dejando los de datacenter al final si la sesión lo pide
+func preferResidential(session string, proxies []string) []string {
+	cfg, _ := config.GetSession(session)
+	if !cfg.PreferResidential {
+		return proxies
+	}
+	sort.SliceStable(proxies, func(i, j int) bool {
+		return !isDatacenterProxy(proxies[i]) && isDatacenterProxy(proxies[j])
+	})
+	return proxies
+}
+
+// residentialOnly devuelve los proxies que no pertenecen a rangos de datacenter
+func residentialOnly(proxies []string) []string {
+	var residential []string
+	for _, proxyAddr := range proxies {
+		if !isDatacenterProxy(proxyAddr) {
+			residential = append(residential, proxyAddr)
+		}
+	}
+	return residential
+}
@@ -0,0 +1,117 @@
+// api/audit.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/audit"
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// clientIdentity identifica al cliente por su tenant, la cabecera x-client-id o, si no
+// existe ninguno, su dirección
+func clientIdentity(ctx context.Context) string {
+	if tenant := tenantFrom(ctx); tenant != nil {
+		return "tenant:" + tenant.Name
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get("x-client-id"); len(ids) > 0 && ids[0] != "" {
+			return ids[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
+
+// recordAudit registra la petición en el log de auditoría si está habilitado
+func (s *server) recordAudit(ctx context.Context, req *pb.Request, result *fetchResult, fetchErr error, start time.Time) {
+	if s.auditLog == nil && proxyStore == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Time:      start,
+		Session:   req.Session,
+		URL:       req.Url,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Client:    clientIdentity(ctx),
+	}
+	if result != nil {
+		entry.Proxy = config.RedactURL(result.proxy)
+		entry.Status = result.status
+		entry.Bytes = len(result.content)
+		if result.spilled != nil {
+			entry.Bytes = int(result.spilled.size)
+		}
+	}
+	if fetchErr != nil {
+		entry.Error = fetchErr.Error()
+	}
+
+	if s.auditLog != nil {
+		s.auditLog.Record(entry)
+	}
+	if proxyStore != nil {
+		if err := proxyStore.RecordAudit(entry); err != nil {
+			log.Printf("Error al guardar el registro de auditoría: %v", err)
+		}
+	}
+}
+
+// QueryAuditLog - Consulta el log de auditoría aplicando los filtros de la solicitud
+func (s *server) QueryAuditLog(ctx context.Context, req *pb.AuditQuery) (*pb.AuditQueryResponse, error) {
+	if s.auditLog == nil && proxyStore == nil {
+		return nil, fmt.Errorf("audit log is disabled")
+	}
+
+	filter := audit.Filter{
+		Session:     req.Session,
+		URLContains: req.UrlContains,
+		Proxy:       req.Proxy,
+		Client:      req.Client,
+		Status:      int(req.Status),
+		Limit:       int(req.Limit),
+	}
+	if req.Since > 0 {
+		filter.Since = time.UnixMilli(req.Since)
+	}
+	if req.Until > 0 {
+		filter.Until = time.UnixMilli(req.Until)
+	}
+
+	var entries []audit.Entry
+	var err error
+	if s.auditLog != nil {
+		entries, err = s.auditLog.Query(filter)
+	} else {
+		entries, err = proxyStore.QueryAudit(filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.AuditQueryResponse{}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, &pb.AuditEntry{
+			Timestamp: e.Time.UnixMilli(),
+			Session:   e.Session,
+			Url:       e.URL,
+			Proxy:     e.Proxy,
+			Status:    int32(e.Status),
+			Bytes:     int64(e.Bytes),
+			LatencyMs: e.LatencyMs,
+			Client:    e.Client,
+			Error:     e.Error,
+		})
+	}
+	return resp, nil
+}
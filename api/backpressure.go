@@ -0,0 +1,104 @@
+// api/backpressure.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"proxy-api/internal/config"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Trailer con el que el cliente gRPC espera antes de reintentar; negativo no reintenta
+const retryPushbackTrailer = "grpc-retry-pushback-ms"
+
+// Peticiones a destinos en curso y rechazadas por saturación desde el arranque
+var (
+	requestsInFlight  atomic.Int64
+	rejectedInFlight  atomic.Int64
+	rejectedSaturated atomic.Int64
+)
+
+// acquireRequestSlot reserva un hueco de MAX_IN_FLIGHT; devuelve false si no queda
+func acquireRequestSlot() bool {
+	if n := requestsInFlight.Add(1); config.MaxInFlight > 0 && n > int64(config.MaxInFlight) {
+		requestsInFlight.Add(-1)
+		rejectedInFlight.Add(1)
+		return false
+	}
+	return true
+}
+
+func releaseRequestSlot() {
+	requestsInFlight.Add(-1)
+}
+
+// markProxyBusy anota que un intento de la petición no se lanzó por estar el proxy al
+// límite de PROXY_HOST_CONCURRENCY
+func markProxyBusy(ctx context.Context) {
+	if attempts, ok := ctx.Value(attemptsKey{}).(*requestAttempts); ok {
+		attempts.busy.Add(1)
+	}
+}
+
+// poolSaturated indica si todos los intentos de la petición encontraron su proxy ocupado
+func poolSaturated(ctx context.Context) bool {
+	attempts, ok := ctx.Value(attemptsKey{}).(*requestAttempts)
+	return ok && attempts.busy.Load() > 0 && attempts.busy.Load() >= attempts.count.Load()
+}
+
+// setRetryPushback indica al cliente gRPC cuánto esperar antes de reintentar la llamada,
+// si tiene una política de reintentos; un retardo negativo le pide que no reintente
+func setRetryPushback(ctx context.Context, delay time.Duration) {
+	ms := "-1"
+	if delay >= 0 {
+		ms = strconv.FormatInt(delay.Milliseconds(), 10)
+	}
+	grpc.SetTrailer(ctx, metadata.Pairs(retryPushbackTrailer, ms))
+}
+
+// errBackpressure devuelve ResourceExhausted con el motivo en QuotaFailure y el tiempo
+// sugerido para reintentar en RetryInfo y en el trailer de pushback
+func errBackpressure(ctx context.Context, subject, description string) error {
+	delay := time.Duration(config.BackpressureRetryDelay) * time.Millisecond
+	setRetryPushback(ctx, delay)
+	st := status.New(codes.ResourceExhausted, description)
+	detailed, err := st.WithDetails(
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{Subject: subject, Description: description}}},
+	)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// errServerBusy es el error de una petición que no cabe en MAX_IN_FLIGHT
+func errServerBusy(ctx context.Context) error {
+	return errBackpressure(ctx, "max_in_flight", fmt.Sprintf("server has %d requests in flight, the maximum", config.MaxInFlight))
+}
+
+// errPoolSaturated es el error de una petición cuyos proxies estaban todos ocupados
+func errPoolSaturated(ctx context.Context, session string) error {
+	rejectedSaturated.Add(1)
+	return errBackpressure(ctx, "proxy_pool", fmt.Sprintf("all proxies of session '%s' are at PROXY_HOST_CONCURRENCY for this host", session))
+}
+
+// backpressureStats describe la carga y los rechazos por saturación, para /debug/vars
+func backpressureStats() interface{} {
+	return map[string]int64{
+		"in_flight":          requestsInFlight.Load(),
+		"max_in_flight":      int64(config.MaxInFlight),
+		"rejected_in_flight": rejectedInFlight.Load(),
+		"rejected_saturated": rejectedSaturated.Load(),
+	}
+}
@@ -0,0 +1,96 @@
+// api/body.go
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errBodyTooLarge indica que la respuesta supera el límite de la petición sin truncado.
+// El destino enviaría lo mismo por cualquier otro proxy, así que no es un fallo del
+// proxy: detiene la cadena de fallback y llega al cliente como FailedPrecondition.
+type errBodyTooLarge struct {
+	limit int64
+}
+
+func (e errBodyTooLarge) Error() string {
+	return fmt.Sprintf("response body exceeds %d bytes", e.limit)
+}
+
+func (e errBodyTooLarge) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
+
+// stopsChain indica si el error de un intento hace inútil probar otros proxies o etapas
+func stopsChain(err error) bool {
+	return errors.As(err, new(errBodyTooLarge)) || errors.As(err, new(errSpillDirFull))
+}
+
+// bodyLimit devuelve el tamaño máximo del cuerpo para la petición y si se trunca al superarlo.
+// El límite de la petición tiene prioridad sobre el de la sesión.
+func bodyLimit(req *pb.Request) (int64, bool) {
+	if req.MaxBodyBytes > 0 {
+		return req.MaxBodyBytes, req.TruncateBody
+	}
+	cfg, _ := config.GetSession(req.Session)
+	return cfg.MaxBodyBytes, cfg.TruncateBody || req.TruncateBody
+}
+
+// readBody lee el cuerpo de la respuesta respetando el límite de la petición. Sin
+// truncado, la lectura se aborta en cuanto se supera el límite para no gastar ancho
+// de banda del proxy. Al cancelarse ctx se cierra el cuerpo, lo que desbloquea la
+// lectura también con transportes que no la atan al contexto (HTTP/3, túneles propios).
+// Con spill_large_body, el cuerpo que supera SPILL_THRESHOLD_BYTES se escribe en disco
+// mientras se lee: spilled indica el fichero y data conserva solo los primeros bytes,
+// para las comprobaciones de CAPTCHA y de las reglas de validación.
+func readBody(ctx context.Context, body io.ReadCloser, req *pb.Request) (data []byte, truncated bool, spilled *spilledBody, err error) {
+	stop := context.AfterFunc(ctx, func() { body.Close() })
+	defer stop()
+
+	limit, truncate := bodyLimit(req)
+	var r io.Reader = body
+	if limit > 0 {
+		r = io.LimitReader(body, limit+1)
+	}
+	// Un límite por debajo del umbral deja el cuerpo siempre en memoria
+	if req.SpillLargeBody && (limit <= 0 || limit > config.SpillThreshold) {
+		data, spilled, err = readSpilling(r)
+	} else {
+		data, err = io.ReadAll(r)
+	}
+	if ctx.Err() != nil {
+		spilled.remove()
+		return nil, false, nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	size := int64(len(data))
+	if spilled != nil {
+		size = spilled.size
+	}
+	if limit <= 0 || size <= limit {
+		return data, false, spilled, nil
+	}
+	if !truncate {
+		spilled.remove()
+		return nil, false, nil, errBodyTooLarge{limit: limit}
+	}
+	if spilled == nil {
+		return data[:limit], true, nil, nil
+	}
+	if err := spilled.truncate(limit); err != nil {
+		spilled.remove()
+		return nil, false, nil, err
+	}
+	return data, true, spilled, nil
+}
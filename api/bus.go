@@ -0,0 +1,89 @@
+// api/bus.go
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/bus"
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// startBus conecta con el bus configurado y arranca sus consumidores
+func (s *server) startBus(ctx context.Context) {
+	if config.BusDriver == "" {
+		return
+	}
+
+	b, err := bus.Open(bus.Config{
+		Driver:       config.BusDriver,
+		URL:          config.BusURL,
+		RequestTopic: config.BusRequestTopic,
+		ResultTopic:  config.BusResultTopic,
+		Group:        config.BusGroup,
+	})
+	if err != nil {
+		log.Fatalf("failed to open message bus: %v", err)
+	}
+
+	for i := 0; i < config.BusConsumers; i++ {
+		go s.consumeBus(ctx, b)
+	}
+	log.Printf("Bus %s: %d consumidores de %s, resultados en %s", config.BusDriver, config.BusConsumers, config.BusRequestTopic, config.BusResultTopic)
+}
+
+// consumeBus procesa peticiones del bus, reconectando si el consumidor falla
+func (s *server) consumeBus(ctx context.Context, b bus.Bus) {
+	for ctx.Err() == nil {
+		// Sin pool las peticiones fallarían; se dejan en el bus hasta que esté listo
+		if !s.ready.Load() {
+			time.Sleep(time.Second)
+			continue
+		}
+		err := b.Consume(ctx, func(data []byte) {
+			s.handleBusJob(b, data)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Consumidor del bus detenido, se reinicia: %v", err)
+		time.Sleep(time.Second)
+	}
+}
+
+// handleBusJob ejecuta la petición recibida y publica su resultado
+func (s *server) handleBusJob(b bus.Bus, data []byte) {
+	job := &pb.BusJob{}
+	if err := protojson.Unmarshal(data, job); err != nil || job.Request == nil {
+		log.Printf("Mensaje del bus descartado, no es un BusJob válido: %v", err)
+		return
+	}
+	if job.Id == "" {
+		job.Id = newJobID()
+	}
+	job.Request.WebhookUrl = ""
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-client-id", "bus/"+job.Id))
+	resp, err := s.FetchContent(ctx, job.Request)
+	if err == nil {
+		err = offloadContent(ctx, job.Id, job.Request, resp)
+	}
+	result := &pb.ScheduledResult{Id: job.Id, Response: resp, Timestamp: time.Now().UnixMilli()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	payload, err := protojson.Marshal(result)
+	if err != nil {
+		log.Printf("Error al serializar el resultado %s: %v", job.Id, err)
+		return
+	}
+	if err := b.Publish(context.Background(), job.Id, payload); err != nil {
+		log.Printf("Error al publicar el resultado %s en el bus: %v", job.Id, err)
+	}
+}
@@ -0,0 +1,259 @@
+// api/captcha.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/captcha"
+	"proxy-api/internal/config"
+	"proxy-api/internal/events"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// captchaReason es el motivo del error de una petición bloqueada por un CAPTCHA
+const captchaReason = "CAPTCHA_REQUIRED"
+
+// captchaMarker identifica la página de desafío de un sistema anti-bot
+type captchaMarker struct {
+	provider string
+	header   string   // Cabecera cuya presencia delata el desafío, "" si no hay
+	body     []string // Fragmentos del cuerpo, basta con uno
+	blocked  bool     // Solo cuenta con un status de bloqueo (403, 429 o 503)
+}
+
+var captchaMarkers = []captchaMarker{
+	{provider: "cloudflare", header: "Cf-Mitigated", body: []string{"/cdn-cgi/challenge-platform/", "cf-chl-", "cf_chl_opt"}},
+	{provider: "perimeterx", body: []string{"px-captcha", "_pxCaptcha", "captcha.px-cdn.net", "client.perimeterx.net"}},
+	{provider: "datadome", header: "X-Datadome", body: []string{"captcha-delivery.com", "dd={'rt':'c'"}},
+	{provider: "recaptcha", body: []string{"www.google.com/recaptcha/", "g-recaptcha"}, blocked: true},
+	{provider: "hcaptcha", body: []string{"hcaptcha.com/1/api.js", "h-captcha"}, blocked: true},
+}
+
+// detectCaptcha devuelve el sistema anti-bot cuya página de desafío es la respuesta,
+// o "" si no lo parece. Los CAPTCHA genéricos solo cuentan en respuestas de bloqueo,
+// porque también aparecen en formularios de páginas normales.
+func detectCaptcha(statusCode int, header http.Header, body []byte) string {
+	blocked := statusCode == http.StatusForbidden || statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+	for _, marker := range captchaMarkers {
+		if marker.blocked && !blocked {
+			continue
+		}
+		if marker.header != "" && header.Get(marker.header) != "" {
+			return marker.provider
+		}
+		for _, fragment := range marker.body {
+			if bytes.Contains(body, []byte(fragment)) {
+				return marker.provider
+			}
+		}
+	}
+	return ""
+}
+
+// errCaptcha es el error de un intento que recibió una página de desafío
+type errCaptcha struct {
+	provider string
+}
+
+func (e errCaptcha) Error() string {
+	return fmt.Sprintf("response is a %s captcha challenge", e.provider)
+}
+
+type captchaKey struct{}
+
+// captchaChallenge es el último CAPTCHA recibido por los intentos de una petición
+type captchaChallenge struct {
+	provider string
+	siteKey  string
+	proxy    string // Proxy del intento, o directProxy
+}
+
+// captchaSeen registra el último CAPTCHA de una petición
+type captchaSeen struct {
+	mtx       sync.Mutex
+	challenge *captchaChallenge
+}
+
+// withCaptcha prepara el contexto de una petición para registrar sus CAPTCHA
+func withCaptcha(ctx context.Context) context.Context {
+	return context.WithValue(ctx, captchaKey{}, &captchaSeen{})
+}
+
+// captchaFrom devuelve el último CAPTCHA de la petición, nil si no hubo
+func captchaFrom(ctx context.Context) *captchaChallenge {
+	seen, ok := ctx.Value(captchaKey{}).(*captchaSeen)
+	if !ok {
+		return nil
+	}
+	seen.mtx.Lock()
+	defer seen.mtx.Unlock()
+	return seen.challenge
+}
+
+// checkCaptcha devuelve errCaptcha si la respuesta del intento a través de proxyAddr
+// es una página de desafío y la anota en la petición
+func checkCaptcha(ctx context.Context, req *pb.Request, proxyAddr string, statusCode int, header http.Header, body []byte) error {
+	provider := detectCaptcha(statusCode, header, body)
+	if provider == "" {
+		return nil
+	}
+	events.Publish(events.Event{Kind: events.CaptchaDetected, Session: req.Session, Proxy: eventProxy(proxyAddr), Host: targetHost(req.Url), Reason: provider})
+	if seen, ok := ctx.Value(captchaKey{}).(*captchaSeen); ok {
+		seen.mtx.Lock()
+		seen.challenge = &captchaChallenge{provider: provider, siteKey: captcha.SiteKey(body), proxy: proxyAddr}
+		seen.mtx.Unlock()
+	}
+	return errCaptcha{provider: provider}
+}
+
+// Proxies apartados de un host por haber recibido un CAPTCHA
+var (
+	captchaBans    = make(map[string]time.Time) // proxy|host -> fin del bloqueo
+	captchaBansMtx sync.Mutex
+)
+
+// banForHost aparta el proxy del host durante CAPTCHA_BAN_SECONDS
+func banForHost(proxyAddr, host string) {
+	if config.CaptchaBanDuration <= 0 {
+		return
+	}
+	captchaBansMtx.Lock()
+	defer captchaBansMtx.Unlock()
+	captchaBans[inFlightKey(proxyAddr, host)] = time.Now().Add(time.Duration(config.CaptchaBanDuration) * time.Second)
+}
+
+// filterBanned descarta los proxies apartados del host por un CAPTCHA reciente
+func filterBanned(host string, proxies []string) []string {
+	captchaBansMtx.Lock()
+	defer captchaBansMtx.Unlock()
+	if len(captchaBans) == 0 {
+		return proxies
+	}
+
+	now := time.Now()
+	allowed := make([]string, 0, len(proxies))
+	for _, proxyAddr := range proxies {
+		key := inFlightKey(proxyAddr, host)
+		if until, ok := captchaBans[key]; ok {
+			if now.Before(until) {
+				continue
+			}
+			delete(captchaBans, key)
+		}
+		allowed = append(allowed, proxyAddr)
+	}
+	return allowed
+}
+
+// errCaptchaRequired devuelve el error de una petición cuyos intentos terminaron en
+// CAPTCHA, con el motivo CAPTCHA_REQUIRED para que el cliente la desvíe a un
+// servicio de resolución.
+func errCaptchaRequired(provider, host string, cause error) error {
+	st := status.New(codes.FailedPrecondition, fmt.Sprintf("captcha required: %v", cause))
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   captchaReason,
+		Domain:   serviceName,
+		Metadata: map[string]string{"provider": provider, "host": strings.ToLower(host)},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// captchaKinds es el tipo de desafío que se envía al servicio según el sistema detectado
+var captchaKinds = map[string]string{
+	"cloudflare": captcha.KindTurnstile,
+	"recaptcha":  captcha.KindRecaptcha,
+	"hcaptcha":   captcha.KindHCaptcha,
+}
+
+// tokenParams es el parámetro en el que cada widget envía su token
+var tokenParams = map[string]string{
+	captcha.KindTurnstile: "cf-turnstile-response",
+	captcha.KindRecaptcha: "g-recaptcha-response",
+	captcha.KindHCaptcha:  "h-captcha-response",
+}
+
+// errNoSolver indica que la sesión no resuelve los CAPTCHA
+var errNoSolver = errors.New("captcha solving is not enabled for the session")
+
+// solveCaptcha resuelve el último CAPTCHA de la petición con el servicio configurado
+// y la repite una vez, a través del mismo proxy, con la solución
+func (s *server) solveCaptcha(ctx context.Context, req *pb.Request, userAgent string) (*fetchResult, error) {
+	session, _ := config.GetSession(req.Session)
+	challenge := captchaFrom(ctx)
+	if s.solver == nil || !session.Captcha.Solve || challenge == nil {
+		return nil, errNoSolver
+	}
+	kind, ok := captchaKinds[challenge.provider]
+	if !ok {
+		return nil, captcha.ErrUnsupported
+	}
+
+	userAgent = proxyUserAgent(ctx, req, challenge.proxy, userAgent)
+	solveCtx, cancel := context.WithTimeout(ctx, time.Duration(config.CaptchaSolveTimeout)*time.Second)
+	defer cancel()
+	start := time.Now()
+	solution, err := s.solver.Solve(solveCtx, captcha.Challenge{
+		Kind:      kind,
+		PageURL:   req.Url,
+		SiteKey:   challenge.siteKey,
+		UserAgent: userAgent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("CAPTCHA de %s resuelto en %v para %s, se repite la petición vía %s", challenge.provider, time.Since(start), req.Url, config.RedactURL(challenge.proxy))
+
+	if solution.UserAgent != "" {
+		userAgent = solution.UserAgent
+	}
+	replay := &captchaReplay{solution: solution, param: session.Captcha.TokenParam, header: session.Captcha.TokenHeader}
+	if replay.param == "" {
+		replay.param = tokenParams[kind]
+	}
+	return s.fetchWith(withCaptcha(context.WithValue(ctx, replayKey{}, replay)), req, challenge.proxy, userAgent)
+}
+
+type replayKey struct{}
+
+// captchaReplay es la solución que se añade a la petición repetida
+type captchaReplay struct {
+	solution *captcha.Solution
+	param    string
+	header   string
+}
+
+// applyCaptchaSolution añade a la petición el token y las cookies de la solución, si
+// es la repetición tras resolver un CAPTCHA
+func applyCaptchaSolution(ctx context.Context, reqObj *http.Request) {
+	replay, ok := ctx.Value(replayKey{}).(*captchaReplay)
+	if !ok {
+		return
+	}
+	for name, value := range replay.solution.Cookies {
+		reqObj.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	if replay.solution.Token == "" {
+		return
+	}
+	query := reqObj.URL.Query()
+	query.Set(replay.param, replay.solution.Token)
+	reqObj.URL.RawQuery = query.Encode()
+	if replay.header != "" {
+		reqObj.Header.Set(replay.header, replay.solution.Token)
+	}
+}
@@ -0,0 +1,78 @@
+// api/chaos.go
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+)
+
+// errChaosDrop es el error de un intento descartado por el modo caos
+var errChaosDrop = errors.New("chaos: attempt dropped by fault injection")
+
+// chaosFetcher envuelve un backend e inyecta fallos en config.ChaosPercent de los intentos
+type chaosFetcher struct {
+	next   Fetcher
+	faults []string
+}
+
+// withChaos envuelve el backend si el modo caos está habilitado
+func withChaos(next Fetcher) Fetcher {
+	if config.ChaosPercent <= 0 {
+		return next
+	}
+	var faults []string
+	for _, fault := range strings.Split(config.ChaosFaults, ",") {
+		if fault = strings.TrimSpace(fault); fault != "" {
+			faults = append(faults, fault)
+		}
+	}
+	if len(faults) == 0 {
+		return next
+	}
+	return chaosFetcher{next: next, faults: faults}
+}
+
+// Fetch - Realiza el intento con el backend real salvo que le toque un fallo
+func (f chaosFetcher) Fetch(ctx context.Context, req *pb.Request, proxyAddr, userAgent string) (*fetchResult, error) {
+	if rand.Intn(100) >= config.ChaosPercent {
+		return f.next.Fetch(ctx, req, proxyAddr, userAgent)
+	}
+
+	fault := f.faults[rand.Intn(len(f.faults))]
+	log.Printf("Caos: fallo %s en el intento vía %s para %s", fault, config.RedactURL(proxyAddr), req.Url)
+	switch fault {
+	case config.ChaosFaultDelay:
+		select {
+		case <-time.After(time.Duration(config.ChaosDelay) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return f.next.Fetch(ctx, req, proxyAddr, userAgent)
+	case config.ChaosFaultDrop:
+		return nil, errChaosDrop
+	case config.ChaosFaultCorrupt:
+		result, err := f.next.Fetch(ctx, req, proxyAddr, userAgent)
+		if err == nil {
+			corruptContent(result.content)
+		}
+		return result, err
+	}
+	return f.next.Fetch(ctx, req, proxyAddr, userAgent)
+}
+
+// corruptContent altera aleatoriamente alrededor del 1% de los bytes, al menos uno
+func corruptContent(content []byte) {
+	if len(content) == 0 {
+		return
+	}
+	for i := 0; i <= len(content)/100; i++ {
+		content[rand.Intn(len(content))] ^= byte(1 + rand.Intn(255))
+	}
+}
@@ -0,0 +1,46 @@
+// api/charset.go
+package api
+
+import (
+	"log"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// isTextual indica si el tipo de contenido admite transcodificación
+func isTextual(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		strings.HasSuffix(mediaType, "javascript")
+}
+
+// normalizeCharset detecta el charset por Content-Type o etiquetas meta y transcodifica
+// a UTF-8. El contenido guardado en disco se deja tal cual.
+func normalizeCharset(result *fetchResult) {
+	if !isTextual(result.contentType) || result.spilled != nil {
+		return
+	}
+
+	encoding, name, _ := charset.DetermineEncoding(result.content, result.contentType)
+	result.charset = name
+	if name == "utf-8" {
+		return
+	}
+
+	decoded, err := encoding.NewDecoder().Bytes(result.content)
+	if err != nil {
+		log.Printf("Error al transcodificar desde %s: %v", name, err)
+		return
+	}
+	result.content = decoded
+}
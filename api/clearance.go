@@ -0,0 +1,226 @@
+// api/clearance.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+)
+
+// clearanceCookie es la cookie con la que Cloudflare deja pasar al cliente que superó el desafío
+const clearanceCookie = "cf_clearance"
+
+// clearanceScript carga la página en el navegador con el proxy y el user-agent del
+// intento y espera a que el desafío de Cloudflare deje la cookie de paso
+const clearanceScript = `
+function main(splash, args)
+  splash:set_user_agent(args.user_agent)
+  if args.proxy_host then
+    splash:on_request(function(request)
+      request:set_proxy{host=args.proxy_host, port=args.proxy_port, username=args.proxy_user, password=args.proxy_pass, type=args.proxy_type}
+    end)
+  end
+  splash:go(args.url)
+  for _ = 1, args.polls do
+    for _, cookie in ipairs(splash:get_cookies()) do
+      if cookie.name == "cf_clearance" then
+        return {cookies = splash:get_cookies()}
+      end
+    end
+    splash:wait(1)
+  end
+  return {cookies = splash:get_cookies()}
+end`
+
+// clearance son las cookies de paso de un proxy y user-agent para un host
+type clearance struct {
+	ready   chan struct{} // Se cierra cuando termina la obtención
+	cookies []*http.Cookie
+	expires time.Time
+	err     error
+}
+
+// Cookies de paso por proxy|user-agent|host
+var (
+	clearances    = make(map[string]*clearance)
+	clearancesMtx sync.Mutex
+)
+
+func clearanceKey(proxyAddr, userAgent, host string) string {
+	return proxyAddress(proxyAddr) + "|" + userAgent + "|" + host
+}
+
+type clearanceTriedKey struct{}
+
+// usesClearance indica si ante el desafío err se debe intentar obtener las cookies
+// de paso antes de dar el intento por perdido
+func usesClearance(ctx context.Context, session string, err error) bool {
+	var challenge errCaptcha
+	if !errors.As(err, &challenge) || challenge.provider != "cloudflare" {
+		return false
+	}
+	if tried, _ := ctx.Value(clearanceTriedKey{}).(bool); tried {
+		return false
+	}
+	cfg, _ := config.GetSession(session)
+	return cfg.CloudflareClearance && !cfg.Browser
+}
+
+// applyClearance añade a la petición las cookies de paso vigentes del proxy y user-agent
+func applyClearance(reqObj *http.Request, proxyAddr, userAgent string) {
+	clearancesMtx.Lock()
+	entry, ok := clearances[clearanceKey(proxyAddr, userAgent, reqObj.URL.Host)]
+	clearancesMtx.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case <-entry.ready:
+	default:
+		return
+	}
+	if entry.err != nil || time.Now().After(entry.expires) {
+		return
+	}
+	for _, cookie := range entry.cookies {
+		reqObj.AddCookie(cookie)
+	}
+}
+
+// fetchWithClearance repite un intento que recibió el desafío de Cloudflare con las
+// cookies que obtiene el navegador a través del mismo proxy y con el mismo user-agent.
+// Las peticiones simultáneas al mismo host comparten la obtención.
+func (s *server) fetchWithClearance(ctx context.Context, fetcher Fetcher, req *pb.Request, proxyAddr, userAgent string) (*fetchResult, error) {
+	host := targetHost(req.Url)
+	key := clearanceKey(proxyAddr, userAgent, host)
+
+	clearancesMtx.Lock()
+	entry, ok := clearances[key]
+	if ok {
+		select {
+		case <-entry.ready:
+			// Las cookies que llevaba el intento no bastaron o no había: se obtienen otras
+			ok = false
+		default:
+		}
+	}
+	if !ok {
+		entry = &clearance{ready: make(chan struct{})}
+		clearances[key] = entry
+		go func() {
+			defer close(entry.ready)
+			// La carga de la página se suma a la espera del desafío
+			obtainCtx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ClearanceTimeout+15)*time.Second)
+			defer cancel()
+			entry.cookies, entry.expires, entry.err = s.obtainClearance(obtainCtx, req, proxyAddr, userAgent)
+		}()
+	}
+	clearancesMtx.Unlock()
+
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if entry.err != nil {
+		return nil, fmt.Errorf("cloudflare clearance via %s failed: %w", config.RedactURL(proxyAddr), entry.err)
+	}
+	log.Printf("Cookies de paso de Cloudflare obtenidas para %s vía %s", host, config.RedactURL(proxyAddr))
+	return fetcher.Fetch(context.WithValue(ctx, clearanceTriedKey{}, true), req, proxyAddr, userAgent)
+}
+
+// obtainClearance pide al navegador que supere el desafío y devuelve las cookies del
+// host y su caducidad, la de cf_clearance acotada por CLEARANCE_TTL_S
+func (s *server) obtainClearance(ctx context.Context, req *pb.Request, proxyAddr, userAgent string) ([]*http.Cookie, time.Time, error) {
+	if config.BrowserEndpoint == "" {
+		return nil, time.Time{}, fmt.Errorf("cloudflare clearance requires BROWSER_ENDPOINT")
+	}
+
+	args := map[string]interface{}{
+		"lua_source": clearanceScript,
+		"url":        req.Url,
+		"user_agent": userAgent,
+		"polls":      config.ClearanceTimeout,
+		"timeout":    config.ClearanceTimeout + 5,
+	}
+	if proxyAddr != directProxy {
+		target, err := s.proxyURL(req.Session, proxyAddr)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		port, err := strconv.Atoi(target.Port())
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("proxy %s has no port", config.RedactURL(proxyAddr))
+		}
+		args["proxy_host"] = target.Hostname()
+		args["proxy_port"] = port
+		args["proxy_type"] = "HTTP"
+		if target.Scheme == "socks5" {
+			args["proxy_type"] = "SOCKS5"
+		}
+		if target.User != nil {
+			password, _ := target.User.Password()
+			args["proxy_user"] = target.User.Username()
+			args["proxy_pass"] = password
+		}
+	}
+
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	reqObj, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(config.BrowserEndpoint, "/")+"/execute", bytes.NewReader(payload))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	reqObj.Header.Set("Content-Type", "application/json")
+
+	resp, err := browserClient.Do(reqObj)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("browser execute failed with status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Cookies []struct {
+			Name    string `json:"name"`
+			Value   string `json:"value"`
+			Expires string `json:"expires"`
+		} `json:"cookies"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	expires := time.Now().Add(time.Duration(config.ClearanceTTL) * time.Second)
+	var cookies []*http.Cookie
+	cleared := false
+	for _, c := range result.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+		if c.Name != clearanceCookie {
+			continue
+		}
+		cleared = true
+		if t, err := time.Parse(time.RFC3339, c.Expires); err == nil && t.Before(expires) {
+			expires = t
+		}
+	}
+	if !cleared {
+		return nil, time.Time{}, fmt.Errorf("browser did not obtain the %s cookie", clearanceCookie)
+	}
+	return cookies, expires, nil
+}
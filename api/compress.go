@@ -0,0 +1,39 @@
+// api/compress.go
+package api
+
+import (
+	pb "proxy-api/fetch"
+	"proxy-api/internal/compress"
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkContentEncoding rechaza una codificación no soportada antes de hacer la
+// petición, para no gastar un intento en una respuesta que no podría enviarse
+func checkContentEncoding(req *pb.Request) error {
+	if req.ContentEncoding != "" && !compress.Supported(req.ContentEncoding) {
+		return status.Errorf(codes.InvalidArgument, "unsupported content encoding '%s'", req.ContentEncoding)
+	}
+	return nil
+}
+
+// compressContent comprime el contenido si la petición lo pide y compensa; devuelve la
+// codificación aplicada. La codificación ya se comprobó con checkContentEncoding.
+func compressContent(req *pb.Request, result *fetchResult) (string, error) {
+	if req.ContentEncoding == "" || len(result.content) < config.MinCompressSize {
+		return "", nil
+	}
+
+	encoded, err := compress.Encode(req.ContentEncoding, result.content)
+	if err != nil {
+		return "", err
+	}
+	// El contenido ya comprimido (imágenes, zip) puede crecer; se envía tal cual
+	if len(encoded) >= len(result.content) {
+		return "", nil
+	}
+	result.content = encoded
+	return req.ContentEncoding, nil
+}
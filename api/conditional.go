@@ -0,0 +1,75 @@
+// api/conditional.go
+package api
+
+import (
+	"net/http"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/cache"
+	"proxy-api/internal/config"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// isCacheable indica si la respuesta a la petición puede guardarse en la caché de
+// respuestas; cache_control bypass la deja fuera
+func isCacheable(req *pb.Request) bool {
+	return (req.Method == "" || req.Method == http.MethodGet) && !hasMultipartBody(req) && req.Range == "" && !req.CacheControl.GetBypass()
+}
+
+// readsCache indica si la petición puede servirse desde la caché de respuestas;
+// cache_control refresh obliga a ir al destino aunque la respuesta se guarde
+func readsCache(req *pb.Request) bool {
+	return isCacheable(req) && !req.CacheControl.GetRefresh()
+}
+
+// prepareConditional devuelve la petición a enviar al destino. Si el cliente no
+// aportó validadores y hay una respuesta en caché, se revalida con los de la caché.
+func (s *server) prepareConditional(req *pb.Request) (*pb.Request, *cache.Entry) {
+	if !readsCache(req) || req.IfNoneMatch != "" || req.IfModifiedSince != "" {
+		return req, nil
+	}
+
+	entry, ok := s.responseCache.Get(cache.Key(req.Session, req.Url))
+	if !ok {
+		return req, nil
+	}
+
+	upstreamReq := proto.Clone(req).(*pb.Request)
+	upstreamReq.IfNoneMatch = entry.ETag
+	upstreamReq.IfModifiedSince = entry.LastModified
+	return upstreamReq, &entry
+}
+
+// resolveConditional sirve la caché cuando el destino confirma que sigue vigente
+// y guarda las respuestas nuevas que traen validadores, o todas las de las URL calientes.
+func (s *server) resolveConditional(req *pb.Request, result *fetchResult, cached *cache.Entry) {
+	if !isCacheable(req) {
+		return
+	}
+	key := cache.Key(req.Session, req.Url)
+
+	if result.status == http.StatusNotModified {
+		if cached != nil {
+			s.responseCache.Touch(key)
+			result.content = cached.Content
+			result.contentType = cached.ContentType
+			result.status = cached.Status
+			result.etag = cached.ETag
+			result.lastModified = cached.LastModified
+			result.fromCache = true
+		}
+		return
+	}
+
+	if result.status == http.StatusOK && !result.truncated && result.spilled == nil && (result.etag != "" || result.lastModified != "" || s.isWarm(req.Session, req.Url)) {
+		s.responseCache.Set(key, cache.Entry{
+			Content:      result.content,
+			ContentType:  result.contentType,
+			Status:       result.status,
+			ETag:         result.etag,
+			LastModified: result.lastModified,
+			Proxy:        config.RedactURL(result.proxy),
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// api/connstats.go
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+
+	pb "proxy-api/fetch"
+)
+
+// connCounters son las conexiones usadas a través de un proxy, o directamente
+type connCounters struct {
+	requests      int64 // Conexiones obtenidas, una por petición y redirección
+	reused        int64 // Conexiones keep-alive reutilizadas
+	tlsHandshakes int64 // Handshakes TLS con el destino
+	tlsResumed    int64 // Handshakes que reanudaron una sesión TLS anterior
+}
+
+var (
+	connStats    = make(map[string]*connCounters)
+	connStatsMtx sync.Mutex
+)
+
+// resumeTLSSessions guarda los tickets de sesión TLS del transporte para reanudar el
+// handshake en las conexiones nuevas con el mismo destino. Sin configuración TLS propia
+// se mantiene HTTP/2, que net/http deja de negociar al fijarla.
+func resumeTLSSessions(transport *http.Transport) *http.Transport {
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+		transport.ForceAttemptHTTP2 = true
+	}
+	if transport.TLSClientConfig.ClientSessionCache == nil {
+		transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	return transport
+}
+
+// withConnTrace añade a ctx una traza que anota en las métricas de proxyAddr si cada
+// conexión se reutiliza y si su handshake TLS reanuda una sesión
+func withConnTrace(ctx context.Context, proxyAddr string) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			recordConn(proxyAddr, func(c *connCounters) {
+				c.requests++
+				if info.Reused {
+					c.reused++
+				}
+			})
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				return
+			}
+			recordConn(proxyAddr, func(c *connCounters) {
+				c.tlsHandshakes++
+				if state.DidResume {
+					c.tlsResumed++
+				}
+			})
+		},
+	})
+}
+
+func recordConn(proxyAddr string, update func(*connCounters)) {
+	connStatsMtx.Lock()
+	defer connStatsMtx.Unlock()
+	c, ok := connStats[proxyAddr]
+	if !ok {
+		c = &connCounters{}
+		connStats[proxyAddr] = c
+	}
+	update(c)
+}
+
+// connStatsSnapshot devuelve las métricas de conexión de las peticiones directas y de
+// los proxies que siguen en el pool, descartando las de los retirados
+func (s *server) connStatsSnapshot() map[string]*pb.ConnectionStats {
+	active := map[string]bool{directProxy: true}
+	for _, proxies := range s.pool.All() {
+		for _, p := range proxies {
+			active[p.String()] = true
+		}
+	}
+
+	connStatsMtx.Lock()
+	defer connStatsMtx.Unlock()
+	stats := make(map[string]*pb.ConnectionStats, len(connStats))
+	for proxyAddr, c := range connStats {
+		if !active[proxyAddr] {
+			delete(connStats, proxyAddr)
+			continue
+		}
+		stats[proxyAddr] = &pb.ConnectionStats{
+			Requests:          c.requests,
+			ReusedConnections: c.reused,
+			NewConnections:    c.requests - c.reused,
+			TlsHandshakes:     c.tlsHandshakes,
+			TlsResumed:        c.tlsResumed,
+		}
+		if c.requests > 0 {
+			stats[proxyAddr].ReuseRate = float64(c.reused) / float64(c.requests)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,180 @@
+// api/diversity.go
+package api
+
+import (
+	"log"
+	"net"
+	"sort"
+	"sync"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/asn"
+	"proxy-api/internal/config"
+)
+
+// Subredes usadas recientemente por cada sesión, de la más antigua a la más reciente
+var (
+	recentSubnets   = make(map[string][]string)
+	recentSubnetMtx sync.Mutex
+)
+
+// subnetKey devuelve la subred /24 (IPv4) o /48 (IPv6) de un proxy
+func subnetKey(proxyAddr string) string {
+	host, _, err := net.SplitHostPort(proxyAddress(proxyAddr))
+	if err != nil {
+		return ""
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// diversityKey devuelve la clave de rango del proxy según el modo de la sesión
+func diversityKey(mode, proxyAddr string) string {
+	switch mode {
+	case config.DiversitySubnet:
+		return subnetKey(proxyAddr)
+	case config.DiversityASN:
+		return asnKey(proxyAddr)
+	}
+	return ""
+}
+
+// filterDiverse descarta los proxies de rangos usados en las últimas peticiones de la sesión.
+// Si no queda ninguno se devuelve la lista original para no bloquear la petición.
+func filterDiverse(session string, proxies []string) []string {
+	cfg, _ := config.GetSession(session)
+	if cfg.Diversity == "" || len(proxies) == 0 {
+		return proxies
+	}
+
+	recentSubnetMtx.Lock()
+	recent := make(map[string]bool, len(recentSubnets[session]))
+	for _, key := range recentSubnets[session] {
+		recent[key] = true
+	}
+	recentSubnetMtx.Unlock()
+
+	diverse := make([]string, 0, len(proxies))
+	for _, proxyAddr := range proxies {
+		if !recent[diversityKey(cfg.Diversity, proxyAddr)] {
+			diverse = append(diverse, proxyAddr)
+		}
+	}
+	if len(diverse) == 0 {
+		log.Printf("Diversidad %s: todos los proxies comparten rango con peticiones recientes", session)
+		return proxies
+	}
+	return diverse
+}
+
+// recordDiversity anota el rango del proxy que atendió la petición
+func recordDiversity(session, proxyAddr string) {
+	cfg, _ := config.GetSession(session)
+	if cfg.Diversity == "" {
+		return
+	}
+	key := diversityKey(cfg.Diversity, proxyAddr)
+	if key == "" {
+		return
+	}
+
+	window := cfg.DiversityWindow
+	if window <= 0 {
+		window = 1
+	}
+
+	recentSubnetMtx.Lock()
+	defer recentSubnetMtx.Unlock()
+	recent := append(recentSubnets[session], key)
+	if len(recent) > window {
+		recent = recent[len(recent)-window:]
+	}
+	recentSubnets[session] = recent
+}
+
+// ipKey devuelve el host del proxy, que identifica al nodo en cualquier puerto
+func ipKey(proxyAddr string) string {
+	host, _, err := net.SplitHostPort(proxyAddress(proxyAddr))
+	if err != nil {
+		return proxyAddr
+	}
+	return host
+}
+
+// spreadCandidates reordena los candidatos de una petición para que los primeros sean de
+// IPs distintas o, si la sesión tiene Diversity, de rangos distintos. Dentro de cada
+// vuelta se conserva el orden de la clasificación.
+func spreadCandidates(session string, proxies []string) []string {
+	cfg, _ := config.GetSession(session)
+	key := ipKey
+	if cfg.Diversity != "" {
+		key = func(proxyAddr string) string {
+			if k := diversityKey(cfg.Diversity, proxyAddr); k != "" {
+				return k
+			}
+			return ipKey(proxyAddr)
+		}
+	}
+
+	seen := make(map[string]int, len(proxies))
+	rounds := make(map[string]int, len(proxies))
+	spread := false
+	for _, proxyAddr := range proxies {
+		k := key(proxyAddr)
+		rounds[proxyAddr] = seen[k]
+		spread = spread || seen[k] > 0
+		seen[k]++
+	}
+	if !spread {
+		return proxies
+	}
+	sort.SliceStable(proxies, func(i, j int) bool {
+		return rounds[proxies[i]] < rounds[proxies[j]]
+	})
+	return proxies
+}
+
+// diversitySnapshot describe la variedad de IPs, subredes, AS y países del pool de cada sesión
+func (s *server) diversitySnapshot() map[string]*pb.DiversityStats {
+	out := make(map[string]*pb.DiversityStats)
+	for session, proxies := range s.pool.All() {
+		ips := make(map[string]bool)
+		subnets := make(map[string]bool)
+		asns := make(map[int]int)
+		countries := make(map[string]bool)
+		for _, p := range proxies {
+			ips[p.Host] = true
+			if subnet := subnetKey(p.String()); subnet != "" {
+				subnets[subnet] = true
+			}
+			if info, ok := asn.LookupAddress(p.Address()); ok {
+				asns[info.Number]++
+				if info.Country != "" {
+					countries[info.Country] = true
+				}
+			}
+		}
+		stats := &pb.DiversityStats{
+			Proxies:         int32(len(proxies)),
+			UniqueIps:       int32(len(ips)),
+			UniqueSubnets:   int32(len(subnets)),
+			UniqueAsns:      int32(len(asns)),
+			UniqueCountries: int32(len(countries)),
+		}
+		top := 0
+		for _, n := range asns {
+			top = max(top, n)
+		}
+		if len(proxies) > 0 {
+			stats.TopAsnShare = float64(top) / float64(len(proxies))
+		}
+		out[session] = stats
+	}
+	return out
+}
@@ -0,0 +1,229 @@
+// api/download.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// rangeResult es el resultado de la petición de un rango
+type rangeResult struct {
+	result *fetchResult
+	start  int64
+	err    error
+}
+
+// parseContentRange interpreta "bytes inicio-fin/total"; total es -1 si el destino no lo indica
+func parseContentRange(header string) (start, end, total int64, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid content range '%s'", header)
+	}
+	span, size, ok := strings.Cut(spec, "/")
+	first, last, ok2 := strings.Cut(span, "-")
+	if !ok || !ok2 {
+		return 0, 0, 0, fmt.Errorf("invalid content range '%s'", header)
+	}
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid content range '%s'", header)
+	}
+	if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+		return 0, 0, 0, fmt.Errorf("invalid content range '%s'", header)
+	}
+	total = -1
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid content range '%s'", header)
+		}
+	}
+	return start, end, total, nil
+}
+
+// fetchRange pide los bytes start-end con la cadena de fallback de la sesión,
+// repitiendo la petición si la respuesta no corresponde al rango pedido. Un 200 al
+// primer rango indica que el destino no admite rangos y se devuelve tal cual.
+func (s *server) fetchRange(ctx context.Context, req *pb.Request, start, end int64) (*fetchResult, error) {
+	rangeReq := proto.Clone(req).(*pb.Request)
+	rangeReq.Range = fmt.Sprintf("bytes=%d-%d", start, end)
+	// Cada rango cabe en un mensaje y se envía desde memoria
+	rangeReq.SpillLargeBody = false
+
+	var lastErr error
+	for attempt := 0; attempt < config.RangeAttempts; attempt++ {
+		result, err := s.fetchContent(ctx, rangeReq)
+		if err != nil {
+			if ctx.Err() != nil || stopsChain(err) {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		switch {
+		case result.status == http.StatusOK && start == 0:
+			return result, nil
+		case result.status == http.StatusRequestedRangeNotSatisfiable:
+			return result, nil
+		case result.status != http.StatusPartialContent:
+			lastErr = fmt.Errorf("unexpected status %d for range %s", result.status, rangeReq.Range)
+			continue
+		}
+
+		gotStart, gotEnd, total, err := parseContentRange(result.contentRange)
+		switch {
+		case err != nil:
+			lastErr = err
+		case gotStart != start || (gotEnd != end && gotEnd != total-1) || int64(len(result.content)) != gotEnd-gotStart+1:
+			lastErr = fmt.Errorf("range %s answered with %d bytes as '%s'", rangeReq.Range, len(result.content), result.contentRange)
+		default:
+			return result, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// Download - Descarga el fichero por rangos repartidos entre proxies y envía los trozos en orden
+func (s *server) Download(dreq *pb.DownloadRequest, stream pb.ProxyService_DownloadServer) error {
+	req := dreq.Request
+	if req == nil || req.Url == "" {
+		return fmt.Errorf("download request must contain the target request")
+	}
+	if (req.Method != "" && req.Method != http.MethodGet) || hasMultipartBody(req) {
+		return fmt.Errorf("downloads only support GET requests")
+	}
+
+	done, err := s.sessions.begin(req.Session)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	rangeSize := dreq.RangeSize
+	if rangeSize <= 0 {
+		rangeSize = config.DefaultRangeSize
+	}
+	rangeSize = min(rangeSize, config.MaxRangeSize)
+	parallel := int(dreq.Parallel)
+	if parallel <= 0 {
+		parallel = config.DefaultRangeParallel
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	first, err := s.fetchRange(ctx, req, 0, rangeSize-1)
+	if err != nil {
+		return err
+	}
+	if first.status == http.StatusOK {
+		// Sin soporte de rangos: el fichero completo llega en la primera respuesta
+		return sendContent(stream, first.content, config.RedactURL(first.proxy), rangeSize)
+	}
+	if first.status == http.StatusRequestedRangeNotSatisfiable {
+		return stream.Send(&pb.DownloadChunk{Proxy: config.RedactURL(first.proxy)})
+	}
+
+	_, _, total, _ := parseContentRange(first.contentRange)
+	if err := stream.Send(&pb.DownloadChunk{Data: first.content, TotalSize: max(total, 0), Proxy: config.RedactURL(first.proxy)}); err != nil {
+		return err
+	}
+	if total < 0 {
+		return s.downloadSequential(ctx, stream, req, int64(len(first.content)), rangeSize)
+	}
+	if total <= rangeSize {
+		return nil
+	}
+
+	// Cada rango se pide por separado; como mucho 2*parallel rangos esperan a enviarse
+	n := int((total - 1) / rangeSize)
+	results := make([]chan rangeResult, n)
+	for i := range results {
+		results[i] = make(chan rangeResult, 1)
+	}
+	window := make(chan struct{}, 2*parallel)
+	workers := make(chan struct{}, parallel)
+	go func() {
+		for i := 0; i < n; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int) {
+				defer func() { <-workers }()
+				start := rangeSize * int64(i+1)
+				end := min(start+rangeSize, total) - 1
+				result, err := s.fetchRange(ctx, req, start, end)
+				select {
+				case results[i] <- rangeResult{result: result, start: start, err: err}:
+				case <-ctx.Done():
+				}
+			}(i)
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		var r rangeResult
+		select {
+		case r = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		<-window
+		if r.err != nil {
+			return fmt.Errorf("range starting at %d failed: %w", r.start, r.err)
+		}
+		if err := stream.Send(&pb.DownloadChunk{Offset: r.start, Data: r.result.content, Proxy: config.RedactURL(r.result.proxy)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadSequential pide rangos consecutivos hasta que el destino, que no indicó el
+// tamaño total, devuelva uno incompleto
+func (s *server) downloadSequential(ctx context.Context, stream pb.ProxyService_DownloadServer, req *pb.Request, offset, rangeSize int64) error {
+	for {
+		result, err := s.fetchRange(ctx, req, offset, offset+rangeSize-1)
+		if err != nil {
+			return fmt.Errorf("range starting at %d failed: %w", offset, err)
+		}
+		if result.status == http.StatusRequestedRangeNotSatisfiable {
+			return nil
+		}
+		if err := stream.Send(&pb.DownloadChunk{Offset: offset, Data: result.content, Proxy: config.RedactURL(result.proxy)}); err != nil {
+			return err
+		}
+		offset += int64(len(result.content))
+		if int64(len(result.content)) < rangeSize {
+			return nil
+		}
+	}
+}
+
+// sendContent envía un contenido completo en trozos de como mucho chunkSize bytes
+func sendContent(stream pb.ProxyService_DownloadServer, content []byte, proxyAddr string, chunkSize int64) error {
+	total := int64(len(content))
+	for offset := int64(0); offset == 0 || offset < total; offset += chunkSize {
+		chunk := &pb.DownloadChunk{Offset: offset, Data: content[offset:min(offset+chunkSize, total)], Proxy: proxyAddr}
+		if offset == 0 {
+			chunk.TotalSize = total
+		}
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// api/dryrun.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+)
+
+// dryRun resuelve el proxy, el user-agent, las cabeceras y el uso de la caché que
+// tendría la petición, sin enviarla al destino.
+func (s *server) dryRun(ctx context.Context, req *pb.Request) (*pb.Response, error) {
+	if req.Session == "" || s.pool.Proxies(req.Session) == nil {
+		return nil, fmt.Errorf("invalid session")
+	}
+
+	upstreamReq, cached := s.prepareConditional(req)
+	userAgent := selectUserAgent(req)
+	// Sin proxy la petición sale con la identidad directa de la sesión
+	via := ""
+	if !req.Proxy {
+		via = directProxy
+		userAgent = proxyUserAgent(ctx, req, directProxy, userAgent)
+	}
+	reqObj, err := newTargetRequest(ctx, upstreamReq, via, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &pb.DryRunPlan{
+		Method:    reqObj.Method,
+		UserAgent: userAgent,
+		Headers:   make(map[string]string, len(reqObj.Header)),
+		CacheHit:  cached != nil,
+	}
+	for name, values := range reqObj.Header {
+		plan.Headers[name] = config.RedactHeader(name, strings.Join(values, ", "))
+	}
+
+	if !req.Proxy {
+		plan.Stages = []*pb.DryRunStage{{Kind: config.FallbackDirect}}
+		return &pb.Response{Proxy: "direct", Plan: plan}, nil
+	}
+
+	session, _ := config.GetSession(req.Session)
+	tried := make(map[string]struct{})
+	firstProxy := ""
+	for _, stage := range fallbackChain(req, session) {
+		planned := &pb.DryRunStage{Kind: stage.Kind, TimeoutMs: int32(stage.Timeout)}
+		if stage.Kind == config.FallbackDirect {
+			if firstProxy == "" {
+				firstProxy = "direct"
+			}
+		} else {
+			for _, proxyAddr := range s.stageProxies(stage, req.Session, targetHost(req.Url), proxyMaxAge(req), tried) {
+				planned.Proxies = append(planned.Proxies, config.RedactURL(proxyAddr))
+			}
+			if len(planned.Proxies) == 0 {
+				continue
+			}
+			if firstProxy == "" {
+				firstProxy = planned.Proxies[0]
+			}
+		}
+		plan.Stages = append(plan.Stages, planned)
+	}
+
+	return &pb.Response{Proxy: firstProxy, Plan: plan}, nil
+}
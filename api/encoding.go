@@ -0,0 +1,124 @@
+// api/encoding.go
+package api
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"proxy-api/internal/config"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// newDecoder crea el descompresor de una codificación de Content-Encoding
+type newDecoder func(r io.Reader) (io.ReadCloser, error)
+
+// Codificaciones que el servidor sabe descomprimir; brotli no, porque ni net/http ni
+// las dependencias del proyecto lo implementan
+var contentDecoders = map[string]newDecoder{
+	"gzip":    func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	"x-gzip":  func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	"deflate": newDeflateReader,
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+}
+
+// newDeflateReader admite "deflate" con la cabecera zlib del estándar y sin ella, como
+// lo envían algunos servidores
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	// Cabecera zlib: método 8 y comprobación (CMF*256 + FLG) múltiplo de 31
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// decodesBody indica si la sesión recibe los cuerpos descomprimidos (DecodeBody, por defecto)
+func decodesBody(session string) bool {
+	cfg, _ := config.GetSession(session)
+	return cfg.DecodeBody == nil || *cfg.DecodeBody
+}
+
+// manageAcceptEncoding deja en el Accept-Encoding de la sesión solo las codificaciones
+// que el servidor sabe descomprimir. Si no queda ninguna se quita la cabecera y el
+// transporte pide gzip por su cuenta. Con DecodeBody false se envía tal cual.
+func manageAcceptEncoding(header http.Header, session string) {
+	value := header.Get("Accept-Encoding")
+	if value == "" || !decodesBody(session) {
+		return
+	}
+	var kept []string
+	for _, token := range strings.Split(value, ",") {
+		token = strings.TrimSpace(token)
+		name, _, _ := strings.Cut(token, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := contentDecoders[name]; ok || name == "identity" {
+			kept = append(kept, token)
+		}
+	}
+	if len(kept) == 0 {
+		header.Del("Accept-Encoding")
+		return
+	}
+	header.Set("Accept-Encoding", strings.Join(kept, ", "))
+}
+
+// decodingBody descomprime el cuerpo al leerlo; el descompresor se crea en la primera
+// lectura para que un cuerpo vacío (HEAD, 204, 304) no dé error
+type decodingBody struct {
+	body    io.ReadCloser
+	decoder newDecoder
+	r       io.ReadCloser
+	err     error
+}
+
+func (b *decodingBody) Read(p []byte) (int, error) {
+	if b.r == nil && b.err == nil {
+		b.r, b.err = b.decoder(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.r.Read(p)
+}
+
+func (b *decodingBody) Close() error {
+	if b.r != nil {
+		b.r.Close()
+	}
+	return b.body.Close()
+}
+
+// decodeResponse descomprime el cuerpo de una respuesta que el transporte no descomprimió,
+// porque la sesión fijaba Accept-Encoding. Una codificación desconocida (un destino que
+// responde br aunque no se pidiera) se deja como está y se informa en upstream_encoding.
+func decodeResponse(resp *http.Response, session string) {
+	// Un trozo de un cuerpo comprimido no se puede descomprimir por separado
+	if resp.Uncompressed || resp.StatusCode == http.StatusPartialContent || !decodesBody(session) {
+		return
+	}
+	decoder, ok := contentDecoders[strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))]
+	if !ok {
+		return
+	}
+	resp.Body = &decodingBody{body: resp.Body, decoder: decoder}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
@@ -0,0 +1,244 @@
+// api/engine.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/audit"
+	"proxy-api/internal/cache"
+	"proxy-api/internal/captcha"
+	"proxy-api/internal/config"
+	"proxy-api/internal/pool"
+	"proxy-api/internal/proxy"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+)
+
+// Engine es el motor de proxies (pool, validación periódica y peticiones) sin
+// depender de gRPC. ServeGRPC lo expone por gRPC; otros servicios Go pueden
+// usarlo en su propio proceso a través del paquete proxyserver.
+type Engine struct {
+	srv *server
+}
+
+// NewEngine crea el motor sobre el pool indicado
+func NewEngine(proxyPool pool.ProxyPool) *Engine {
+	srv := &server{
+		pool:              proxyPool,
+		successfulProxies: make(map[string]map[string]*http.Client),
+		responseCache:     cache.New(config.CacheMaxEntries, time.Duration(config.CacheTTL)*time.Second),
+		budget:            newRetryBudget(),
+		warmSets:          make(map[string]*warmSet),
+		schedules:         make(map[string]*scheduledFetch),
+		resultSubscribers: make(map[chan *pb.ScheduledResult]map[string]bool),
+	}
+	srv.fetchers = newFetchers(srv)
+	srv.knownSessions = config.Sessions()
+
+	// El estado de health se publica por gRPC solo si se llama a ServeGRPC
+	srv.health = health.NewServer()
+	srv.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	srv.health.SetServingStatus(serviceName, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	// Un servicio desconocido lo rechaza config.Validate antes de arrancar
+	if solver, err := captcha.New(config.CaptchaSolver, config.CaptchaSolverKey); err == nil {
+		srv.solver = solver
+	}
+
+	if config.AuditLogPath != "" {
+		auditLog, err := audit.NewLogger(config.AuditLogPath, config.AuditLogMaxSizeMB, config.AuditLogMaxFiles)
+		if err != nil {
+			log.Fatalf("failed to open audit log: %v", err)
+		}
+		srv.auditLog = auditLog
+	}
+	return &Engine{srv: srv}
+}
+
+// Start abre los backends configurados y lanza en segundo plano la validación del
+// pool (o, con SHARED_POOL_DRIVER, la lectura del publicado por cmd/validator), el hot
+// set, la cola de trabajos y el bus; todo se detiene al terminar ctx
+func (e *Engine) Start(ctx context.Context) {
+	e.srv.lifetime = ctx
+	openASNDatabase()
+	openResultStore()
+
+	// Con un pool restaurado del backend se puede atender mientras se revalida
+	e.srv.openStore()
+	if e.srv.pool.Count() > 0 {
+		reloadUserAgents()
+		e.srv.markReady()
+	}
+
+	e.srv.startJobWorkers(ctx)
+	e.srv.startBus(ctx)
+	go e.srv.maintainHotSets(ctx)
+	go cleanSpilledBodies(ctx)
+	go flushUsage(ctx)
+	if config.SharedPoolDriver != "" {
+		go e.srv.followSharedPool(ctx)
+	} else {
+		go e.srv.warmUpPool(ctx)
+	}
+}
+
+// StartStatic arranca el motor con un pool fijo, sin descargar fuentes ni revalidar,
+// y lo marca como listo de inmediato. Los proxies sin fecha de validación cuentan como
+// validados al arrancar.
+func (e *Engine) StartStatic(ctx context.Context, proxies map[string][]proxy.Proxy) {
+	e.srv.lifetime = ctx
+	openASNDatabase()
+	openResultStore()
+	now := time.Now()
+	static := make(map[string][]proxy.Proxy, len(proxies))
+	for session, list := range proxies {
+		static[session] = append([]proxy.Proxy(nil), list...)
+		for i := range static[session] {
+			if static[session][i].ValidatedAt.IsZero() {
+				static[session][i].ValidatedAt = now
+			}
+		}
+	}
+	e.srv.updateProxies(static)
+	// Hasta que termine la descarga se usa DEFAULT_USER_AGENT
+	go reloadUserAgents()
+	log.Printf("Pool fijo: %d proxies", e.srv.pool.Count())
+	e.srv.markReady()
+
+	e.srv.startJobWorkers(ctx)
+	e.srv.startBus(ctx)
+	go e.srv.maintainHotSets(ctx)
+	go cleanSpilledBodies(ctx)
+	go flushUsage(ctx)
+}
+
+// UpsertSession añade o modifica una sesión en tiempo de ejecución
+func (e *Engine) UpsertSession(session config.ProxySession) {
+	config.SetSession(session)
+	e.srv.reconcileSessions()
+}
+
+// RemoveSession elimina una sesión en tiempo de ejecución drenando sus recursos
+func (e *Engine) RemoveSession(name string) {
+	config.DeleteSession(name)
+	e.srv.reconcileSessions()
+}
+
+// SetCaptchaSolver sustituye el servicio de resolución de CAPTCHA de CAPTCHA_SOLVER;
+// debe llamarse antes de Start
+func (e *Engine) SetCaptchaSolver(solver captcha.Solver) {
+	e.srv.solver = solver
+}
+
+// Ready indica si la primera validación del pool ya terminó
+func (e *Engine) Ready() bool {
+	return e.srv.ready.Load()
+}
+
+// FetchContent obtiene la petición como el RPC del mismo nombre, sin pasar por gRPC.
+// Sin interceptores, comprueba aquí la petición como el interceptor validate y su
+// destino con las listas de destinos antes de mirar la caché, para que una URL caliente
+// tampoco se sirva a un destino prohibido. Sin claves de API no hay tenants que aplicar.
+func (e *Engine) FetchContent(ctx context.Context, req *pb.Request) (*pb.Response, error) {
+	if !e.srv.ready.Load() {
+		return nil, errPoolWarming()
+	}
+	if err := validateMessage(req); err != nil {
+		return nil, err
+	}
+	if err := checkTarget(ctx, req.Url); err != nil {
+		return nil, err
+	}
+	return e.srv.FetchContent(ctx, req)
+}
+
+// RandomProxy devuelve un proxy aleatorio de la sesión
+func (e *Engine) RandomProxy(ctx context.Context, session string) (string, error) {
+	resp, err := e.srv.GetRandomProxy(ctx, &pb.ProxyRequest{Session: session})
+	if err != nil {
+		return "", err
+	}
+	if !resp.Success {
+		return "", fmt.Errorf("%s", resp.Message)
+	}
+	return resp.Proxy, nil
+}
+
+// Stats devuelve las estadísticas del pool y de las peticiones
+func (e *Engine) Stats(ctx context.Context) (*pb.StatsResponse, error) {
+	return e.srv.GetProxyStats(ctx, &pb.StatsRequest{})
+}
+
+// Service devuelve la implementación del servicio gRPC para registrarla en un
+// servidor propio
+func (e *Engine) Service() pb.ProxyServiceServer {
+	return e.srv
+}
+
+// ServeGRPC expone el motor por gRPC en config.GRPCListenAddresses hasta que ctx
+// termine o falle uno de los listeners
+func (e *Engine) ServeGRPC(ctx context.Context) error {
+	log.Println("Iniciando servidor gRPC")
+	interceptors, err := interceptorChain()
+	if err != nil {
+		return err
+	}
+	listeners, err := listenAll()
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	maxSize := 5 * 1024 * 1024
+	serverOptions := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(maxSize), // Tamaño máximo de mensaje recibido.
+		grpc.MaxSendMsgSize(maxSize), // Tamaño máximo de mensaje enviado.
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     time.Duration(config.GRPCKeepaliveMaxIdle) * time.Second,
+			Time:                  time.Duration(config.GRPCKeepaliveTime) * time.Second,
+			Timeout:               time.Duration(config.GRPCKeepaliveTimeout) * time.Second,
+			MaxConnectionAge:      time.Duration(config.GRPCMaxConnectionAge) * time.Second,
+			MaxConnectionAgeGrace: time.Duration(config.GRPCMaxConnectionAgeGrace) * time.Second,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             time.Duration(config.GRPCKeepaliveMinTime) * time.Second,
+			PermitWithoutStream: config.GRPCKeepalivePermitWithoutStream,
+		}),
+	}
+	grpcServer := grpc.NewServer(append(serverOptions, interceptors...)...)
+	pb.RegisterProxyServiceServer(grpcServer, e.srv)
+
+	// Solo health y reflection responden hasta que termine la primera validación
+	healthpb.RegisterHealthServer(grpcServer, e.srv.health)
+	reflection.Register(grpcServer)
+
+	if config.AdminAddress != "" {
+		go e.srv.serveAdmin(ctx)
+	}
+
+	serveErr := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		log.Printf("Escuchando en %s %s", lis.Addr().Network(), lis.Addr())
+		go func(lis net.Listener) {
+			serveErr <- grpcServer.Serve(lis)
+		}(lis)
+	}
+
+	select {
+	case <-ctx.Done():
+		grpcServer.GracefulStop()
+		return nil
+	case err := <-serveErr:
+		grpcServer.Stop()
+		return err
+	}
+}
@@ -0,0 +1,78 @@
+// api/events.go
+package api
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/events"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// eventProxy devuelve el host:puerto del proxy sin las credenciales de un proveedor
+func eventProxy(proxyAddr string) string {
+	address := proxyAddress(proxyAddr)
+	if _, hostPort, ok := strings.Cut(address, "@"); ok {
+		return hostPort
+	}
+	return address
+}
+
+// eventVisible indica si el tenant de la llamada puede recibir el evento: los de sus
+// sesiones y los refrescos del pool; el resto solo los tenants con Admin
+func eventVisible(ctx context.Context, event events.Event) bool {
+	if tenant := tenantFrom(ctx); tenant == nil || tenant.Admin {
+		return true
+	}
+	if event.Session == "" {
+		return event.Kind == events.PoolRefreshed
+	}
+	return tenantCanSee(ctx, event.Session)
+}
+
+// SubscribeEvents - Emite los eventos del servidor que pasan los filtros hasta que el cliente cancele
+func (s *server) SubscribeEvents(req *pb.SubscribeEventsRequest, stream pb.ProxyService_SubscribeEventsServer) error {
+	for _, kind := range req.Kinds {
+		if !slices.Contains(events.Kinds, kind) {
+			return status.Errorf(codes.InvalidArgument, "unknown event kind '%s'", kind)
+		}
+	}
+
+	ch, cancel := events.Subscribe()
+	defer cancel()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-ch:
+			if len(req.Kinds) > 0 && !slices.Contains(req.Kinds, event.Kind) {
+				continue
+			}
+			if req.Session != "" && event.Session != "" && event.Session != req.Session {
+				continue
+			}
+			if !eventVisible(ctx, event) {
+				continue
+			}
+
+			if err := stream.Send(&pb.ServerEvent{
+				Kind:      event.Kind,
+				Session:   event.Session,
+				Proxy:     event.Proxy,
+				Host:      event.Host,
+				Source:    event.Source,
+				Reason:    event.Reason,
+				Count:     int64(event.Count),
+				Timestamp: event.Timestamp.UnixMilli(),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
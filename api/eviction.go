@@ -0,0 +1,62 @@
+// api/eviction.go
+package api
+
+import (
+	"crypto/x509"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/events"
+)
+
+// classifyError asigna una categoría al error de un intento a través de un proxy
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	var certErr *x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	msg := err.Error()
+
+	switch {
+	case strings.Contains(msg, "proxyconnect"):
+		return config.ErrorProxy
+	case errors.As(err, &dnsErr) || strings.Contains(msg, "lookup"):
+		return config.ErrorDNS
+	case errors.As(err, &certErr) || errors.As(err, &hostErr) || strings.Contains(msg, "tls:") || strings.Contains(msg, "certificate"):
+		return config.ErrorTLS
+	case isTimeout(err):
+		return config.ErrorTimeout
+	case strings.Contains(msg, "connection") || strings.Contains(msg, "EOF") || strings.Contains(msg, "broken pipe"):
+		return config.ErrorConnection
+	}
+	return config.ErrorOther
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// classifyStatus asigna una categoría a una respuesta fallida del destino; vacío si no lo es
+func classifyStatus(status int) string {
+	switch {
+	case status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		return config.ErrorForbidden
+	case status >= 500:
+		return config.ErrorServer
+	}
+	return ""
+}
+
+// recordStrike anota un fallo del proxy y lo retira si supera la política de la sesión
+func (s *server) recordStrike(session, proxyAddr, category string) {
+	cfg, _ := config.GetSession(session)
+	if s.pool.Strike(session, proxyAddr, category, cfg.Eviction) {
+		log.Printf("Proxy %s retirado de %s tras fallos (%s)", proxyAddress(proxyAddr), session, category)
+		events.Publish(events.Event{Kind: events.ProxyEvicted, Session: session, Proxy: eventProxy(proxyAddr), Reason: category})
+		s.removeSuccesfulProxy(session, proxyAddr)
+	}
+}
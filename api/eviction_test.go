@@ -0,0 +1,31 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"proxy-api/internal/config"
+)
+
+// FuzzClassifyError comprueba que la categoría es conocida y no cambia al envolver el error
+func FuzzClassifyError(f *testing.F) {
+	for _, seed := range []string{
+		"proxyconnect tcp: dial tcp 1.2.3.4:8080: connect: connection refused",
+		"dial tcp: lookup example.invalid: no such host",
+		"tls: failed to verify certificate: x509: certificate signed by unknown authority",
+		"read tcp 10.0.0.1:5555->1.2.3.4:8080: read: connection reset by peer",
+		"unexpected EOF", "context deadline exceeded", "",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		category := classifyError(errors.New(input))
+		if _, ok := config.DefaultErrorWeights[category]; !ok {
+			t.Fatalf("categoría desconocida %q", category)
+		}
+		if wrapped := classifyError(fmt.Errorf("attempt: %w", errors.New(input))); wrapped != category {
+			t.Fatalf("el error envuelto da %q en lugar de %q", wrapped, category)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+// api/experiment.go
+package api
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+)
+
+type experimentKey struct{}
+
+// Nombres de las variantes de un experimento
+const (
+	variantA = "A"
+	variantB = "B"
+)
+
+// variantAssignment es la variante que le tocó a una petición
+type variantAssignment struct {
+	name    string
+	variant config.ExperimentVariant
+}
+
+// variantStats acumula los resultados de una variante
+type variantStats struct {
+	requests  int64
+	successes int64
+	latency   time.Duration // Suma de las latencias de las peticiones exitosas
+}
+
+// experimentStats son los resultados de un experimento de una sesión
+type experimentStats struct {
+	name     string
+	variants map[string]*variantStats
+}
+
+// Resultados por sesión del experimento activo
+var (
+	experiments   = make(map[string]*experimentStats)
+	experimentMtx sync.Mutex
+)
+
+// assignVariant elige la variante de la petición. Las peticiones con identidad caen
+// siempre en la misma variante; el resto se reparte al azar según Split.
+func assignVariant(req *pb.Request) *variantAssignment {
+	cfg, _ := config.GetSession(req.Session)
+	exp := cfg.Experiment
+	if exp == nil {
+		return nil
+	}
+
+	bucket := rand.Intn(100)
+	if req.Identity != "" {
+		h := fnv.New32a()
+		h.Write([]byte(exp.Name + "/" + req.Identity))
+		bucket = int(h.Sum32() % 100)
+	}
+	if bucket < exp.Split {
+		return &variantAssignment{name: variantB, variant: exp.B}
+	}
+	return &variantAssignment{name: variantA, variant: exp.A}
+}
+
+func withVariant(ctx context.Context, assignment *variantAssignment) context.Context {
+	if assignment == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, experimentKey{}, assignment)
+}
+
+// variantFrom devuelve la variante asignada a la petición del contexto, si la hay
+func variantFrom(ctx context.Context) *variantAssignment {
+	assignment, _ := ctx.Value(experimentKey{}).(*variantAssignment)
+	return assignment
+}
+
+// variantUserAgent elige el user-agent del conjunto de la variante; vacío si no tiene
+func variantUserAgent(req *pb.Request, assignment *variantAssignment) string {
+	if req.UserAgent != "" || assignment == nil || len(assignment.variant.UserAgents) == 0 {
+		return ""
+	}
+	agents := assignment.variant.UserAgents
+	return agents[rand.Intn(len(agents))]
+}
+
+// recordExperiment suma el resultado de una petición a su variante
+func recordExperiment(session string, assignment *variantAssignment, success bool, latency time.Duration) {
+	if assignment == nil {
+		return
+	}
+	cfg, _ := config.GetSession(session)
+	if cfg.Experiment == nil {
+		return
+	}
+
+	experimentMtx.Lock()
+	defer experimentMtx.Unlock()
+
+	// Un experimento nuevo en la sesión empieza sin resultados
+	stats := experiments[session]
+	if stats == nil || stats.name != cfg.Experiment.Name {
+		stats = &experimentStats{
+			name:     cfg.Experiment.Name,
+			variants: map[string]*variantStats{variantA: {}, variantB: {}},
+		}
+		experiments[session] = stats
+	}
+
+	v := stats.variants[assignment.name]
+	v.requests++
+	if success {
+		v.successes++
+		v.latency += latency
+	}
+}
+
+// experimentSnapshot devuelve la comparación de las variantes de cada sesión
+func experimentSnapshot() map[string]*pb.ExperimentStats {
+	experimentMtx.Lock()
+	defer experimentMtx.Unlock()
+
+	snapshot := make(map[string]*pb.ExperimentStats, len(experiments))
+	for session, stats := range experiments {
+		msg := &pb.ExperimentStats{Name: stats.name, Variants: make(map[string]*pb.VariantStats)}
+		for name, v := range stats.variants {
+			variant := &pb.VariantStats{Requests: v.requests, Successes: v.successes}
+			if v.requests > 0 {
+				variant.SuccessRate = float64(v.successes) / float64(v.requests)
+			}
+			if v.successes > 0 {
+				variant.AvgLatencyMs = (v.latency / time.Duration(v.successes)).Milliseconds()
+			}
+			msg.Variants[name] = variant
+		}
+		snapshot[session] = msg
+	}
+	return snapshot
+}
+
+// forgetExperiment descarta los resultados del experimento de una sesión
+func forgetExperiment(session string) {
+	experimentMtx.Lock()
+	delete(experiments, session)
+	experimentMtx.Unlock()
+}
@@ -0,0 +1,172 @@
+// api/fallback.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+)
+
+// stageProxies devuelve los proxies a intentar en la etapa, limitados por su presupuesto
+func (s *server) stageProxies(stage config.FallbackStage, session, host string, maxAge time.Duration, tried map[string]struct{}) []string {
+	var proxies []string
+	switch stage.Kind {
+	case config.FallbackSuccessful:
+		proxies = s.successfulProxyList(session)
+	case config.FallbackHot:
+		proxies = hotSet(session)
+	case config.FallbackPool:
+		proxies = s.poolProxies(session)
+		rand.Shuffle(len(proxies), func(i, j int) { proxies[i], proxies[j] = proxies[j], proxies[i] })
+	case config.FallbackProvider:
+		if stage.Provider != "" {
+			proxies = []string{stage.Provider}
+		}
+	}
+
+	// Un proxy ya intentado en una etapa anterior no se repite
+	candidates := proxies[:0]
+	for _, proxyAddr := range proxies {
+		if _, ok := tried[proxyAddr]; !ok {
+			candidates = append(candidates, proxyAddr)
+		}
+	}
+	candidates = filterIdle(host, filterBanned(host, s.pool.Available(session, s.filterStale(session, maxAge, candidates))))
+	if stage.Kind != config.FallbackHot {
+		candidates = preferResidential(session, spreadCandidates(session, filterDiverse(session, s.pool.Rank(session, candidates))))
+	}
+	candidates = filterHostIntel(host, candidates)
+	if stage.Attempts > 0 && len(candidates) > stage.Attempts {
+		candidates = candidates[:stage.Attempts]
+	}
+	for _, proxyAddr := range candidates {
+		tried[proxyAddr] = struct{}{}
+	}
+	return candidates
+}
+
+// runStage ejecuta una etapa de la cadena dentro de su límite de tiempo
+func (s *server) runStage(ctx context.Context, stage config.FallbackStage, proxies []string, req *pb.Request, userAgent string) (*fetchResult, error) {
+	if stage.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(stage.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	if stage.Kind == config.FallbackDirect {
+		return s.fetchWith(ctx, req, directProxy, proxyUserAgent(ctx, req, directProxy, userAgent))
+	}
+	// Las credenciales de las plantillas del proveedor dependen de la identidad de la petición
+	if stage.Kind == config.FallbackProvider && len(proxies) > 0 {
+		proxyAddr, oneShot := s.providerProxy(stage, req)
+		if oneShot {
+			defer s.releaseProviderProxy(req.Session, proxyAddr)
+		}
+		proxies = []string{proxyAddr}
+	}
+
+	attempt := func(ctx context.Context, proxyAddr string) (*fetchResult, error) {
+		return s.fetchWith(ctx, req, proxyAddr, proxyUserAgent(ctx, req, proxyAddr, userAgent))
+	}
+	session, _ := config.GetSession(req.Session)
+	hedgeDelay := session.HedgeDelayDuration()
+	strategy := config.StrategyHedged
+	if assignment := variantFrom(ctx); assignment != nil && assignment.variant.Strategy != "" {
+		strategy = assignment.variant.Strategy
+	}
+	// Una sesión por encima de su SLO escalona los proxies con más solapamiento
+	if sloAction(req.Session, session) == config.SLOHedge {
+		if strategy == config.StrategySequential {
+			strategy = config.StrategyHedged
+		}
+		hedgeDelay /= 2
+	}
+	switch strategy {
+	case config.StrategyRace:
+		return raceAttempts(ctx, proxies, attempt)
+	case config.StrategySequential:
+		backoff := variantFrom(ctx).variant.Backoff
+		return sequentialAttempts(ctx, proxies, time.Duration(backoff)*time.Millisecond, attempt)
+	}
+	return hedgedAttempts(ctx, proxies, hedgeDelay, attempt)
+}
+
+// fallbackChain devuelve las etapas de la petición: las peticiones sensibles a la
+// latencia prueban primero el hot set si la cadena de la sesión no lo incluye, y una
+// sesión por encima de su SLO adelanta el hot set o la etapa directa según su estrategia.
+func fallbackChain(req *pb.Request, session config.ProxySession) []config.FallbackStage {
+	chain := session.FallbackChain()
+	switch action := sloAction(req.Session, session); {
+	case action == config.SLODirect:
+		return promoteStage(chain, config.FallbackDirect)
+	case action == config.SLOHot || (req.PreferHot && session.HotSetSize > 0):
+		for _, stage := range chain {
+			if stage.Kind == config.FallbackHot {
+				return chain
+			}
+		}
+		return append([]config.FallbackStage{{Kind: config.FallbackHot}}, chain...)
+	}
+	return chain
+}
+
+// promoteStage devuelve una copia de la cadena con sus etapas del tipo kind al principio
+func promoteStage(chain []config.FallbackStage, kind string) []config.FallbackStage {
+	promoted := make([]config.FallbackStage, 0, len(chain))
+	for _, stage := range chain {
+		if stage.Kind == kind {
+			promoted = append(promoted, stage)
+		}
+	}
+	for _, stage := range chain {
+		if stage.Kind != kind {
+			promoted = append(promoted, stage)
+		}
+	}
+	return promoted
+}
+
+// runFallbackChain recorre las etapas de la sesión hasta obtener una respuesta
+func (s *server) runFallbackChain(ctx context.Context, req *pb.Request, userAgent string) (*fetchResult, error) {
+	session, _ := config.GetSession(req.Session)
+	tried := make(map[string]struct{})
+	chainStart := time.Now()
+
+	lastErr := fmt.Errorf("fallback chain for session '%s' has no stages", req.Session)
+	for i, stage := range fallbackChain(req, session) {
+		var proxies []string
+		if stage.Kind != config.FallbackDirect {
+			proxies = s.stageProxies(stage, req.Session, targetHost(req.Url), proxyMaxAge(req), tried)
+			if len(proxies) == 0 {
+				requestLog(ctx, "Etapa de fallback sin proxies, se omite", nil, "session", req.Session, "stage", i+1, "kind", stage.Kind)
+				continue
+			}
+		}
+
+		start := time.Now()
+		result, err := s.runStage(ctx, stage, proxies, req, userAgent)
+		if err == nil {
+			requestLog(ctx, "Etapa de fallback completada", nil, "session", req.Session, "stage", i+1, "kind", stage.Kind, "duration_ms", time.Since(start), "proxy", result.proxy)
+			result.stage = stage.Kind
+			recordDiversity(req.Session, result.proxy)
+			if stage.Kind != config.FallbackDirect {
+				recordSLOLatency(req.Session, time.Since(chainStart))
+			}
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if stopsChain(err) {
+			return nil, err
+		}
+
+		requestLog(ctx, "Etapa de fallback fallida", err, "session", req.Session, "stage", i+1, "kind", stage.Kind, "attempts", len(proxies))
+		lastErr = err
+	}
+	return nil, lastErr
+}
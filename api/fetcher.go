@@ -0,0 +1,354 @@
+// api/fetcher.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/events"
+	"proxy-api/internal/outbound"
+	"proxy-api/internal/rules"
+)
+
+// directProxy identifica en los resultados las peticiones sin proxy
+const directProxy = "direct"
+
+// Fetcher obtiene la respuesta de una petición con un backend concreto. proxyAddr es
+// directProxy para las peticiones sin proxy. La orquestación (cadena de fallback,
+// intentos escalonados, presupuesto de reintentos) no depende del backend, de modo
+// que puede probarse con implementaciones falsas.
+type Fetcher interface {
+	Fetch(ctx context.Context, req *pb.Request, proxyAddr, userAgent string) (*fetchResult, error)
+}
+
+// fetchers agrupa los backends del servidor
+type fetchers struct {
+	direct  Fetcher
+	proxied Fetcher
+	browser Fetcher
+}
+
+// newFetchers crea los backends por defecto del servidor, con inyección de fallos
+// si el modo caos está habilitado
+func newFetchers(s *server) fetchers {
+	return fetchers{
+		direct:  withChaos(DirectFetcher{}),
+		proxied: withChaos(ProxyFetcher{server: s}),
+		browser: withChaos(BrowserFetcher{server: s, endpoint: config.BrowserEndpoint}),
+	}
+}
+
+// fetcherFor elige el backend de la petición según la sesión y el proxy
+func (s *server) fetcherFor(req *pb.Request, proxyAddr string) Fetcher {
+	if session, _ := config.GetSession(req.Session); session.Browser {
+		return s.fetchers.browser
+	}
+	if proxyAddr == directProxy {
+		return s.fetchers.direct
+	}
+	return s.fetchers.proxied
+}
+
+// fetchWith realiza un intento, directo o a través de proxyAddr, si el presupuesto de
+// reintentos lo permite
+func (s *server) fetchWith(ctx context.Context, req *pb.Request, proxyAddr, userAgent string) (*fetchResult, error) {
+	if !allowAttempt(ctx) {
+		return nil, errAttemptDenied
+	}
+	fetcher := s.fetcherFor(req, proxyAddr)
+	result, err := fetcher.Fetch(ctx, req, proxyAddr, userAgent)
+	if err == nil || !usesClearance(ctx, req.Session, err) {
+		return result, err
+	}
+	result, err = s.fetchWithClearance(ctx, fetcher, req, proxyAddr, userAgent)
+	if err != nil && ctx.Err() == nil && proxyAddr != directProxy && !errors.As(err, new(errCaptcha)) {
+		// Sin cookies de paso el proxy queda apartado del host como ante cualquier CAPTCHA
+		banForHost(proxyAddr, targetHost(req.Url))
+		s.recordProxyResult(req.Session, proxyAddr, false)
+	}
+	return result, err
+}
+
+// DirectFetcher obtiene la petición sin proxy
+type DirectFetcher struct{}
+
+// Fetch - Realiza la petición sin proxy; un intento que vence el timeout de la sesión se
+// repite hasta config.DirectAttempts veces si el presupuesto de reintentos lo permite
+func (DirectFetcher) Fetch(ctx context.Context, req *pb.Request, proxyAddr, userAgent string) (*fetchResult, error) {
+	var lastErr error
+	for attempt := 0; attempt < config.DirectAttempts; attempt++ {
+		if attempt > 0 {
+			log.Println("Retry due to", lastErr)
+			if !allowAttempt(ctx) {
+				return nil, errAttemptDenied
+			}
+		}
+		result, err := fetchDirect(ctx, req, proxyAddr, userAgent)
+		// Con la petición viva, un DeadlineExceeded es el timeout del propio intento
+		if err == nil || ctx.Err() != nil || !(isTimeoutError(err) || errors.Is(err, context.DeadlineExceeded)) {
+			return result, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// fetchDirect realiza un intento sin proxy dentro del timeout de la sesión
+func fetchDirect(ctx context.Context, req *pb.Request, proxyAddr, userAgent string) (*fetchResult, error) {
+	if session, _ := config.GetSession(req.Session); session.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(session.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	traced, meter := withUsageMeter(withConnTrace(ctx, directProxy))
+	defer recordUsage(ctx, req.Session, directProxy, meter)
+	reqObj, err := newTargetRequest(traced, req, directProxy, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	applyClearance(reqObj, proxyAddr, userAgent)
+
+	started := time.Now()
+	resp, err := directClientFor(req.Session).Do(reqObj)
+	if err != nil {
+		captureExchange(reqObj, nil, nil, directProxy, started, err)
+		return nil, err
+	}
+	decodeResponse(resp, req.Session)
+	defer resp.Body.Close()
+
+	bodyBytes, truncated, spilled, err := readBody(ctx, resp.Body, req)
+	captureExchange(reqObj, resp, bodyBytes, directProxy, started, err)
+	if err != nil {
+		return nil, err
+	}
+	// El contenido guardado en disco solo se conserva si el intento da un resultado
+	var result *fetchResult
+	defer func() {
+		if result == nil {
+			spilled.remove()
+		}
+	}()
+
+	requestLog(ctx, "Respuesta directa", nil, "session", req.Session, "user_agent", userAgent, "status", resp.StatusCode, "proto", resp.Proto, "url", req.Url)
+	if err := checkCaptcha(ctx, req, proxyAddr, resp.StatusCode, resp.Header, bodyBytes); err != nil {
+		return nil, err
+	}
+	if verdict := checkResponse(req.Session, resp, bodyBytes); verdict != rules.Valid {
+		return nil, errRejected(verdict, resp.StatusCode)
+	}
+	result = newFetchResult(resp, bodyBytes, directProxy)
+	result.stage = config.FallbackDirect
+	result.truncated = truncated
+	result.keepSpilled(spilled)
+	result.redirects = redirectChain(reqObj)
+	return result, nil
+}
+
+// ProxyFetcher obtiene la petición a través de un proxy del pool, actualizando su
+// puntuación y retirándolo según la política de la sesión
+type ProxyFetcher struct {
+	server *server
+}
+
+// Fetch - Realiza la petición a través de proxyAddr
+func (f ProxyFetcher) Fetch(ctx context.Context, req *pb.Request, proxyAddr, userAgent string) (*fetchResult, error) {
+	s := f.server
+	host := targetHost(req.Url)
+	if !acquireHostSlot(proxyAddr, host) {
+		markProxyBusy(ctx)
+		return nil, errProxyBusy
+	}
+	defer releaseHostSlot(proxyAddr, host)
+
+	client, err := s.getHTTPClient(proxyAddr, req.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	traced, meter := withUsageMeter(withConnTrace(ctx, proxyAddr))
+	defer recordUsage(ctx, req.Session, proxyAddr, meter)
+	reqObj, err := newTargetRequest(traced, req, proxyAddr, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	applyClearance(reqObj, proxyAddr, userAgent)
+
+	started := time.Now()
+	resp, err := client.Do(reqObj)
+	if err != nil {
+		captureExchange(reqObj, nil, nil, proxyAddr, started, err)
+		// Los intentos cancelados porque otro proxy ganó no penalizan al proxy
+		if ctx.Err() == nil {
+			s.recordStrike(req.Session, proxyAddr, classifyError(err))
+			s.recordProxyResult(req.Session, proxyAddr, false)
+		}
+		return nil, err
+	}
+	decodeResponse(resp, req.Session)
+	defer resp.Body.Close()
+
+	bodyBytes, truncated, spilled, err := readBody(ctx, resp.Body, req)
+	captureExchange(reqObj, resp, bodyBytes, proxyAddr, started, err)
+	if err != nil {
+		return nil, err
+	}
+	// El contenido guardado en disco solo se conserva si el intento da un resultado
+	var result *fetchResult
+	defer func() {
+		if result == nil {
+			spilled.remove()
+		}
+	}()
+
+	requestLog(ctx, "Respuesta vía proxy", nil, "session", req.Session, "proxy", proxyAddr, "user_agent", userAgent, "status", resp.StatusCode, "proto", resp.Proto, "url", req.Url)
+	if err := checkCaptcha(ctx, req, proxyAddr, resp.StatusCode, resp.Header, bodyBytes); err != nil {
+		recordHostOutcome(host, proxyAddr, true, err)
+		if usesClearance(ctx, req.Session, err) {
+			return nil, err
+		}
+		log.Printf("Proxy %s apartado de %s: %v", config.RedactURL(proxyAddr), host, err)
+		banForHost(proxyAddr, host)
+		s.recordProxyResult(req.Session, proxyAddr, false)
+		return nil, err
+	}
+	switch checkResponse(req.Session, resp, bodyBytes) {
+	case rules.Retry:
+		s.recordProxyResult(req.Session, proxyAddr, false)
+		return nil, errRejected(rules.Retry, resp.StatusCode)
+	case rules.Poison:
+		log.Printf("Proxy %s descartado para %s por la regla de validación", config.RedactURL(proxyAddr), req.Session)
+		events.Publish(events.Event{Kind: events.ProxyEvicted, Session: req.Session, Proxy: eventProxy(proxyAddr), Host: host, Reason: rules.Poison})
+		s.removeSuccesfulProxy(req.Session, proxyAddr)
+		s.pool.Remove(req.Session, proxyAddr)
+		s.recordProxyResult(req.Session, proxyAddr, false)
+		return nil, errRejected(rules.Poison, resp.StatusCode)
+	}
+	category := classifyStatus(resp.StatusCode)
+	if category != "" {
+		s.recordStrike(req.Session, proxyAddr, category)
+	}
+	if category == config.ErrorForbidden || resp.StatusCode < 400 {
+		recordHostOutcome(host, proxyAddr, category == config.ErrorForbidden, nil)
+	}
+	s.recordProxyResult(req.Session, proxyAddr, resp.StatusCode < 400)
+	result = newFetchResult(resp, bodyBytes, proxyAddr)
+	result.truncated = truncated
+	result.keepSpilled(spilled)
+	result.redirects = redirectChain(reqObj)
+	return result, nil
+}
+
+// browserClient llama al servicio de renderizado; el límite de tiempo lo marca la sesión
+var browserClient = &http.Client{Transport: outbound.Transport(nil)}
+
+// browserRender es la petición render.html al servicio de renderizado
+type browserRender struct {
+	URL     string            `json:"url"`
+	Proxy   string            `json:"proxy,omitempty"`
+	Timeout float64           `json:"timeout,omitempty"` // s
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// BrowserFetcher obtiene el HTML renderizado por un navegador headless expuesto con la
+// API render.html de Splash, directamente o a través del proxy del intento
+type BrowserFetcher struct {
+	server   *server
+	endpoint string
+}
+
+// Fetch - Pide al navegador que cargue la página y devuelve el HTML resultante
+func (f BrowserFetcher) Fetch(ctx context.Context, req *pb.Request, proxyAddr, userAgent string) (*fetchResult, error) {
+	if f.endpoint == "" {
+		return nil, fmt.Errorf("browser fetching requires BROWSER_ENDPOINT")
+	}
+
+	render := browserRender{URL: req.Url, Headers: map[string]string{"User-Agent": userAgent}}
+	for k, v := range config.GetHeadersFromSession(req.Session) {
+		render.Headers[k] = v
+	}
+	for k, v := range localeHeaders(req.Session, userAgent) {
+		if _, ok := render.Headers[k]; !ok {
+			render.Headers[k] = v
+		}
+	}
+	if session, ok := config.GetSession(req.Session); ok && session.Timeout > 0 {
+		render.Timeout = float64(session.Timeout) / 1000
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(session.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	if proxyAddr != directProxy {
+		target, err := f.server.proxyURL(req.Session, proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+		render.Proxy = target.String()
+	}
+
+	payload, err := json.Marshal(render)
+	if err != nil {
+		return nil, err
+	}
+	reqObj, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(f.endpoint, "/")+"/render.html", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	reqObj.Header.Set("Content-Type", "application/json")
+
+	resp, err := browserClient.Do(reqObj)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// Del error de Splash basta el principio, sin leer ni guardar en disco el resto
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("browser render failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	bodyBytes, truncated, spilled, err := readBody(ctx, resp.Body, req)
+	if err != nil {
+		return nil, err
+	}
+	// El contenido guardado en disco solo se conserva si el intento da un resultado
+	var result *fetchResult
+	defer func() {
+		if result == nil {
+			spilled.remove()
+		}
+	}()
+
+	requestLog(ctx, "Respuesta del navegador", nil, "session", req.Session, "proxy", proxyAddr, "user_agent", userAgent, "url", req.Url)
+	// La página renderizada llega con status 200: solo cuentan las marcas del cuerpo
+	if err := checkCaptcha(ctx, req, proxyAddr, resp.StatusCode, nil, bodyBytes); err != nil {
+		recordHostOutcome(targetHost(req.Url), proxyAddr, true, err)
+		if proxyAddr != directProxy {
+			banForHost(proxyAddr, targetHost(req.Url))
+			f.server.recordProxyResult(req.Session, proxyAddr, false)
+		}
+		return nil, err
+	}
+	if verdict := checkResponse(req.Session, resp, bodyBytes); verdict != rules.Valid {
+		return nil, errRejected(verdict, resp.StatusCode)
+	}
+	result = newFetchResult(resp, bodyBytes, proxyAddr)
+	// La versión y Alt-Svc son las del servicio de renderizado, no las del destino
+	result.httpVersion, result.altSvc = "", ""
+	if proxyAddr == directProxy {
+		result.stage = config.FallbackDirect
+	}
+	result.truncated = truncated
+	result.keepSpilled(spilled)
+	return result, nil
+}
@@ -0,0 +1,88 @@
+// api/freshness.go
+package api
+
+import (
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/pool"
+	"proxy-api/internal/proxy"
+)
+
+// proxyMaxAge devuelve la antigüedad máxima de los proxies de la petición, 0 sin límite
+func proxyMaxAge(req *pb.Request) time.Duration {
+	if req.MaxProxyAgeS > 0 {
+		return time.Duration(req.MaxProxyAgeS) * time.Second
+	}
+	cfg, _ := config.GetSession(req.Session)
+	return time.Duration(cfg.MaxProxyAge) * time.Second
+}
+
+// isFresh indica si el proxy se validó o respondió con éxito dentro de maxAge
+func isFresh(p proxy.Proxy, score pool.Score, maxAge time.Duration, now time.Time) bool {
+	return now.Sub(p.ValidatedAt) <= maxAge || now.Sub(score.LastSuccess) <= maxAge
+}
+
+// filterStale descarta los proxies del pool de la sesión que no se han validado ni han
+// respondido con éxito dentro de maxAge. Los que no están en el pool, como los de un
+// proveedor, no tienen validación y se conservan.
+func (s *server) filterStale(session string, maxAge time.Duration, proxies []string) []string {
+	if maxAge <= 0 || len(proxies) == 0 {
+		return proxies
+	}
+
+	known := make(map[string]proxy.Proxy)
+	for _, p := range s.pool.Proxies(session) {
+		known[p.String()] = p
+	}
+	now := time.Now()
+	fresh := make([]string, 0, len(proxies))
+	for _, proxyAddr := range proxies {
+		p, ok := known[proxyAddr]
+		if ok && !isFresh(p, s.pool.Score(session, proxyAddr), maxAge, now) {
+			continue
+		}
+		fresh = append(fresh, proxyAddr)
+	}
+	return fresh
+}
+
+// freshnessSnapshot resume la antigüedad de los proxies de cada sesión
+func (s *server) freshnessSnapshot() map[string]*pb.FreshnessStats {
+	now := time.Now()
+	out := make(map[string]*pb.FreshnessStats)
+	for session, proxies := range s.pool.All() {
+		cfg, _ := config.GetSession(session)
+		maxAge := time.Duration(cfg.MaxProxyAge) * time.Second
+
+		stats := &pb.FreshnessStats{Proxies: int32(len(proxies)), LastSuccessAgeS: -1}
+		var newest, oldest, lastSuccess time.Time
+		for _, p := range proxies {
+			score := s.pool.Score(session, p.String())
+			if maxAge <= 0 || isFresh(p, score, maxAge, now) {
+				stats.FreshProxies++
+			}
+			if !p.ValidatedAt.IsZero() {
+				if p.ValidatedAt.After(newest) {
+					newest = p.ValidatedAt
+				}
+				if oldest.IsZero() || p.ValidatedAt.Before(oldest) {
+					oldest = p.ValidatedAt
+				}
+			}
+			if score.LastSuccess.After(lastSuccess) {
+				lastSuccess = score.LastSuccess
+			}
+		}
+		if !newest.IsZero() {
+			stats.NewestValidationAgeS = int64(now.Sub(newest).Seconds())
+			stats.OldestValidationAgeS = int64(now.Sub(oldest).Seconds())
+		}
+		if !lastSuccess.IsZero() {
+			stats.LastSuccessAgeS = int64(now.Sub(lastSuccess).Seconds())
+		}
+		out[session] = stats
+	}
+	return out
+}
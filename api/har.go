@@ -0,0 +1,278 @@
+// api/har.go
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+)
+
+type captureKey struct{}
+
+// capturedExchange es un intento completo (petición, respuesta y tiempos) guardado para depuración
+type capturedExchange struct {
+	started  time.Time
+	duration time.Duration
+	session  string
+	proxy    string
+
+	method     string
+	url        string
+	reqHeaders http.Header
+	reqBody    []byte
+
+	status      int
+	statusText  string
+	httpVersion string
+	respHeaders http.Header
+	respBody    []byte
+	err         string
+}
+
+// Capturas más recientes, de la más antigua a la más nueva
+var (
+	captures    []capturedExchange
+	capturesMtx sync.Mutex
+)
+
+// withCapture marca el contexto si la petición se captura, por muestreo o por petición explícita
+func withCapture(ctx context.Context, req *pb.Request) context.Context {
+	if req.Debug || (config.DebugSamplePercent > 0 && rand.Intn(100) < config.DebugSamplePercent) {
+		return context.WithValue(ctx, captureKey{}, req.Session)
+	}
+	return ctx
+}
+
+func truncateBody(body []byte) []byte {
+	if len(body) > config.DebugCaptureMaxBody {
+		body = body[:config.DebugCaptureMaxBody]
+	}
+	return append([]byte(nil), body...)
+}
+
+// captureExchange guarda el intento si la petición está marcada para captura
+func captureExchange(reqObj *http.Request, resp *http.Response, body []byte, proxyAddr string, started time.Time, fetchErr error) {
+	session, ok := reqObj.Context().Value(captureKey{}).(string)
+	if !ok || config.DebugCaptureMax <= 0 {
+		return
+	}
+
+	exchange := capturedExchange{
+		started:    started,
+		duration:   time.Since(started),
+		session:    session,
+		proxy:      config.RedactURL(proxyAddr),
+		method:     reqObj.Method,
+		url:        reqObj.URL.String(),
+		reqHeaders: reqObj.Header.Clone(),
+	}
+	if reqObj.GetBody != nil {
+		if rc, err := reqObj.GetBody(); err == nil {
+			data, _ := io.ReadAll(io.LimitReader(rc, int64(config.DebugCaptureMaxBody)))
+			rc.Close()
+			exchange.reqBody = data
+		}
+	}
+	if resp != nil {
+		exchange.status = resp.StatusCode
+		exchange.statusText = http.StatusText(resp.StatusCode)
+		exchange.httpVersion = resp.Proto
+		exchange.respHeaders = resp.Header.Clone()
+		exchange.respBody = truncateBody(body)
+	}
+	if fetchErr != nil {
+		exchange.err = fetchErr.Error()
+	}
+
+	capturesMtx.Lock()
+	defer capturesMtx.Unlock()
+	captures = append(captures, exchange)
+	if over := len(captures) - config.DebugCaptureMax; over > 0 {
+		captures = append([]capturedExchange(nil), captures[over:]...)
+	}
+}
+
+// Estructuras del formato HAR 1.2; los campos con "_" son extensiones propias
+type harLog struct {
+	Log harContent `json:"log"`
+}
+
+type harContent struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            int64       `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Session         string      `json:"_session"`
+	Proxy           string      `json:"_proxy"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+}
+
+type harBody struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harBody        `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harTimings struct {
+	Send    int64 `json:"send"`
+	Wait    int64 `json:"wait"`
+	Receive int64 `json:"receive"`
+}
+
+// harHeaders convierte las cabeceras a HAR, sin el valor de las de SENSITIVE_HEADERS
+func harHeaders(header http.Header) []harNameValue {
+	values := []harNameValue{}
+	for name, list := range header {
+		for _, value := range list {
+			values = append(values, harNameValue{Name: name, Value: config.RedactHeader(name, value)})
+		}
+	}
+	return values
+}
+
+// harEntryFrom convierte una captura en una entrada HAR; los cuerpos binarios van en base64
+func harEntryFrom(e capturedExchange) harEntry {
+	entry := harEntry{
+		StartedDateTime: e.started.Format("2006-01-02T15:04:05.000Z07:00"),
+		Time:            e.duration.Milliseconds(),
+		Request: harRequest{
+			Method:      e.method,
+			URL:         e.url,
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(e.reqHeaders),
+			QueryString: []harNameValue{},
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(e.reqBody),
+		},
+		Response: harResponse{
+			Status:      e.status,
+			StatusText:  e.statusText,
+			HTTPVersion: e.httpVersion,
+			Headers:     harHeaders(e.respHeaders),
+			Cookies:     []harNameValue{},
+			Content: harBody{
+				Size:     len(e.respBody),
+				MimeType: e.respHeaders.Get("Content-Type"),
+			},
+			RedirectURL: e.respHeaders.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(e.respBody),
+		},
+		Timings: harTimings{Send: 0, Wait: e.duration.Milliseconds(), Receive: 0},
+		Session: e.session,
+		Proxy:   e.proxy,
+		Error:   e.err,
+	}
+	if parsed, err := url.Parse(e.url); err == nil {
+		for name, list := range parsed.Query() {
+			for _, value := range list {
+				entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: value})
+			}
+		}
+	}
+	if len(e.reqBody) > 0 {
+		entry.Request.PostData = &harPostData{MimeType: e.reqHeaders.Get("Content-Type"), Text: string(e.reqBody)}
+	}
+	if utf8.Valid(e.respBody) {
+		entry.Response.Content.Text = string(e.respBody)
+	} else {
+		entry.Response.Content.Text = base64.StdEncoding.EncodeToString(e.respBody)
+		entry.Response.Content.Encoding = "base64"
+	}
+	return entry
+}
+
+// ExportHAR - Devuelve en formato HAR las peticiones capturadas que cumplen el filtro, de la más reciente a la más antigua
+func (s *server) ExportHAR(ctx context.Context, req *pb.HARRequest) (*pb.HARExport, error) {
+	capturesMtx.Lock()
+	snapshot := append([]capturedExchange(nil), captures...)
+	capturesMtx.Unlock()
+
+	entries := []harEntry{}
+	for i := len(snapshot) - 1; i >= 0; i-- {
+		e := snapshot[i]
+		if req.Session != "" && e.session != req.Session {
+			continue
+		}
+		if req.UrlContains != "" && !strings.Contains(e.url, req.UrlContains) {
+			continue
+		}
+		if req.FailuresOnly && e.err == "" && e.status < 400 {
+			continue
+		}
+		entries = append(entries, harEntryFrom(e))
+		if req.Limit > 0 && len(entries) >= int(req.Limit) {
+			break
+		}
+	}
+
+	data, err := json.MarshalIndent(harLog{Log: harContent{
+		Version: "1.2",
+		Creator: harCreator{Name: "proxy-api", Version: "1.0"},
+		Entries: entries,
+	}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &pb.HARExport{Har: data, Entries: int32(len(entries))}, nil
+}
@@ -0,0 +1,47 @@
+// api/hash.go
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	pb "proxy-api/fetch"
+)
+
+// contentHash calcula el SHA-256 del contenido si la petición lo pide; el guardado en
+// disco se lee del fichero. Si coincide con el last_hash del cliente, se vacía el
+// contenido y se indica que no ha cambiado.
+func contentHash(req *pb.Request, result *fetchResult) (string, bool, error) {
+	if !req.ContentHash && req.LastHash == "" {
+		return "", false, nil
+	}
+	if result.status == http.StatusNotModified {
+		return "", false, nil
+	}
+
+	h := sha256.New()
+	if result.spilled != nil {
+		path, _ := spilledPath(result.spilled.token)
+		file, err := os.Open(path)
+		if err != nil {
+			return "", false, err
+		}
+		defer file.Close()
+		if _, err := io.Copy(h, file); err != nil {
+			return "", false, err
+		}
+	} else {
+		h.Write(result.content)
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	if req.LastHash != "" && strings.EqualFold(req.LastHash, hash) {
+		result.spilled.remove()
+		result.content, result.spilled = nil, nil
+		return hash, true, nil
+	}
+	return hash, false, nil
+}
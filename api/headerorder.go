@@ -0,0 +1,72 @@
+// api/headerorder.go
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+
+	"proxy-api/internal/headerorder"
+	"proxy-api/internal/outbound"
+)
+
+// orderHeaders prepara el transporte para que las peticiones salgan con las cabeceras
+// en el orden indicado. Para escribir sobre la conexión descifrada, el transporte abre
+// él mismo el túnel a través de proxyURL (nil para las peticiones directas) y el TLS
+// con el destino; solo las peticiones http a un proxy http siguen yendo en forma
+// absoluta por la conexión con el proxy.
+func orderHeaders(transport *http.Transport, proxyURL *url.URL, order []string) {
+	order = headerorder.Resolve(order)
+	dial := transport.DialContext
+	plainProxy := proxyURL != nil && proxyURL.Scheme == "http"
+	proxyAddr := ""
+	if plainProxy {
+		proxyAddr = proxyURL.Host
+		if proxyURL.Port() == "" {
+			proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+		}
+	}
+
+	tunnel := func(ctx context.Context, network, address string) (net.Conn, error) {
+		if proxyURL == nil || (plainProxy && address == proxyAddr) {
+			return dial(ctx, network, address)
+		}
+		return outbound.DialVia(ctx, proxyURL, address)
+	}
+
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if plainProxy && req.URL.Scheme == "http" {
+			return proxyURL, nil
+		}
+		return nil, nil
+	}
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := tunnel(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return headerorder.Wrap(conn, order), nil
+	}
+	transport.DialTLSContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := tunnel(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		cfg := &tls.Config{}
+		if transport.TLSClientConfig != nil {
+			cfg = transport.TLSClientConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(address)
+		}
+		cfg.NextProtos = []string{"http/1.1"}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return headerorder.Wrap(tlsConn, order), nil
+	}
+}
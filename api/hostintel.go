@@ -0,0 +1,168 @@
+// api/hostintel.go
+package api
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+)
+
+// hostIntel es lo aprendido de las respuestas recientes de un host a través de proxies.
+// Los contadores se reinician cuando pasan HOST_INTEL_TTL_S segundos sin novedades.
+type hostIntel struct {
+	datacenterBlocks     int64
+	datacenterSuccesses  int64
+	residentialBlocks    int64
+	residentialSuccesses int64
+	challenge            string    // Último proveedor de CAPTCHA visto
+	cookieChallenge      time.Time // Último desafío de Cloudflare, que se supera con cookies
+	updated              time.Time
+}
+
+// blocksDatacenter indica si el host rechaza los proxies de datacenter: suficientes
+// bloqueos recientes desde ellos sin ningún éxito
+func (h *hostIntel) blocksDatacenter() bool {
+	return h.datacenterBlocks >= int64(config.HostIntelMinBlocks) && h.datacenterSuccesses == 0
+}
+
+// requiresCookies indica si el host ha pedido hace poco el desafío de Cloudflare
+func (h *hostIntel) requiresCookies() bool {
+	return !h.cookieChallenge.IsZero()
+}
+
+var (
+	hostIntels    = make(map[string]*hostIntel)
+	hostIntelsMtx sync.Mutex
+)
+
+// currentIntel devuelve el estado vigente del host, creándolo si hace falta; debe
+// llamarse con hostIntelsMtx
+func currentIntel(host string, create bool) *hostIntel {
+	h, ok := hostIntels[host]
+	if ok && time.Since(h.updated) > time.Duration(config.HostIntelTTL)*time.Second {
+		delete(hostIntels, host)
+		ok = false
+	}
+	if !ok && create {
+		h = &hostIntel{}
+		hostIntels[host] = h
+	}
+	return h
+}
+
+// recordHostOutcome anota el resultado de un intento a través de proxyAddr: blocked
+// si fue un CAPTCHA o un 403/429, err el error del intento si lo hubo
+func recordHostOutcome(host, proxyAddr string, blocked bool, err error) {
+	if config.HostIntelTTL <= 0 || host == "" || proxyAddr == directProxy {
+		return
+	}
+	datacenter := isDatacenterProxy(proxyAddr)
+
+	hostIntelsMtx.Lock()
+	defer hostIntelsMtx.Unlock()
+	h := currentIntel(strings.ToLower(host), true)
+	h.updated = time.Now()
+	switch {
+	case blocked && datacenter:
+		h.datacenterBlocks++
+	case blocked:
+		h.residentialBlocks++
+	case datacenter:
+		h.datacenterSuccesses++
+	default:
+		h.residentialSuccesses++
+	}
+	var challenge errCaptcha
+	if errors.As(err, &challenge) {
+		h.challenge = challenge.provider
+		if challenge.provider == "cloudflare" {
+			h.cookieChallenge = h.updated
+		}
+	}
+}
+
+// filterHostIntel adapta los candidatos a lo aprendido del host: sin los proxies de
+// datacenter si el host los bloquea (salvo que no quede otro), y con los que ya tienen
+// cookies de paso primero si el host las pide
+func filterHostIntel(host string, proxies []string) []string {
+	hostIntelsMtx.Lock()
+	h := currentIntel(strings.ToLower(host), false)
+	var skipDatacenter, preferCookies bool
+	if h != nil {
+		skipDatacenter, preferCookies = h.blocksDatacenter(), h.requiresCookies()
+	}
+	hostIntelsMtx.Unlock()
+
+	if skipDatacenter {
+		if residential := residentialOnly(proxies); len(residential) > 0 {
+			proxies = residential
+		}
+	}
+	if preferCookies {
+		cleared := clearedProxies(host)
+		sort.SliceStable(proxies, func(i, j int) bool {
+			return cleared[proxyAddress(proxies[i])] && !cleared[proxyAddress(proxies[j])]
+		})
+	}
+	return proxies
+}
+
+// clearedProxies devuelve las direcciones de los proxies con cookies de paso vigentes
+// para el host, con cualquier user-agent
+func clearedProxies(host string) map[string]bool {
+	clearancesMtx.Lock()
+	defer clearancesMtx.Unlock()
+	cleared := make(map[string]bool)
+	now := time.Now()
+	for key, entry := range clearances {
+		addr, rest, _ := strings.Cut(key, "|")
+		if !strings.HasSuffix(rest, "|"+host) {
+			continue
+		}
+		select {
+		case <-entry.ready:
+			if entry.err == nil && now.Before(entry.expires) {
+				cleared[addr] = true
+			}
+		default:
+		}
+	}
+	return cleared
+}
+
+// GetHostIntel - Devuelve lo aprendido de los hosts, o de uno si se indica
+func (s *server) GetHostIntel(ctx context.Context, req *pb.HostIntelRequest) (*pb.HostIntelResponse, error) {
+	host := strings.ToLower(req.Host)
+
+	hostIntelsMtx.Lock()
+	defer hostIntelsMtx.Unlock()
+	resp := &pb.HostIntelResponse{}
+	for name := range hostIntels {
+		if host != "" && name != host {
+			continue
+		}
+		h := currentIntel(name, false)
+		if h == nil {
+			continue
+		}
+		resp.Hosts = append(resp.Hosts, &pb.HostIntel{
+			Host:                 name,
+			BlocksDatacenter:     h.blocksDatacenter(),
+			RequiresCookies:      h.requiresCookies(),
+			DatacenterBlocks:     h.datacenterBlocks,
+			DatacenterSuccesses:  h.datacenterSuccesses,
+			ResidentialBlocks:    h.residentialBlocks,
+			ResidentialSuccesses: h.residentialSuccesses,
+			LastChallenge:        h.challenge,
+			Updated:              unixMilli(h.updated),
+		})
+	}
+	sort.Slice(resp.Hosts, func(i, j int) bool { return resp.Hosts[i].Host < resp.Hosts[j].Host })
+	return resp, nil
+}
@@ -0,0 +1,93 @@
+// api/hosts.go
+package api
+
+import (
+	"context"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/outbound"
+)
+
+// sessionClient es el cliente directo de una sesión con direcciones fijas por host,
+// orden de cabeceras u opciones TLS propias
+type sessionClient struct {
+	hosts  map[string]string
+	order  []string
+	tls    config.TLSOptions
+	client *http.Client
+}
+
+var (
+	sessionClients    = make(map[string]*sessionClient)
+	sessionClientsMtx sync.Mutex
+)
+
+// directClientFor devuelve el cliente de las peticiones directas de la sesión. Las
+// sesiones con Hosts, HeaderOrder o TLS tienen su propio transporte para no compartir
+// conexiones abiertas contra otra dirección del mismo host, sin reordenar o verificadas
+// de otra forma. Las sesiones con HTTP3 usan el cliente HTTP/3 solo si conecta con
+// destinos comprobados, igual que guardedTransport.
+func directClientFor(session string) *http.Client {
+	cfg, _ := config.GetSession(session)
+	if cfg.HTTP3 {
+		if client := directHTTP3Client(); client != nil {
+			return client
+		}
+	}
+	sessionClientsMtx.Lock()
+	defer sessionClientsMtx.Unlock()
+
+	if len(cfg.Hosts) == 0 && len(cfg.HeaderOrder) == 0 && cfg.TLS == (config.TLSOptions{}) {
+		delete(sessionClients, session)
+		return directClient
+	}
+	if c, ok := sessionClients[session]; ok && maps.Equal(c.hosts, cfg.Hosts) && slices.Equal(c.order, cfg.HeaderOrder) && c.tls == cfg.TLS {
+		return c.client
+	}
+
+	// Sin proxy HTTP: con UPSTREAM_PROXY la conexión es un túnel hasta la dirección fijada
+	transport := guardedTransport()
+	transport.Proxy = nil
+	if len(cfg.Hosts) > 0 {
+		hosts := make(map[string]string, len(cfg.Hosts))
+		for host, ip := range cfg.Hosts {
+			hosts[strings.ToLower(host)] = ip
+		}
+		guarded := transport.DialContext
+		// Las direcciones fijadas en la configuración no pasan por el bloqueo de destinos
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if host, port, err := net.SplitHostPort(address); err == nil {
+				if ip, ok := hosts[strings.ToLower(host)]; ok {
+					return outbound.DialContext(ctx, network, net.JoinHostPort(ip, port))
+				}
+			}
+			return guarded(ctx, network, address)
+		}
+	}
+	tlsConfig, err := sessionTLSConfig(cfg.TLS)
+	if err != nil {
+		// Validate ya lo informa; hasta que se corrija se verifica con las CA del sistema
+		log.Printf("Opciones TLS de %s ignoradas: %v", session, err)
+	}
+	transport.TLSClientConfig = tlsConfig
+	resumeTLSSessions(transport)
+	if len(cfg.HeaderOrder) > 0 {
+		orderHeaders(transport, nil, cfg.HeaderOrder)
+	}
+
+	c := &sessionClient{
+		hosts:  maps.Clone(cfg.Hosts),
+		order:  slices.Clone(cfg.HeaderOrder),
+		tls:    cfg.TLS,
+		client: &http.Client{Transport: transport, CheckRedirect: checkRedirect},
+	}
+	sessionClients[session] = c
+	return c.client
+}
@@ -0,0 +1,152 @@
+// api/hotset.go
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"proxy-api/internal/config"
+)
+
+// Hot set de cada sesión: los proxies con mejor puntuación, mantenidos calientes
+var (
+	hotSets      = make(map[string][]string) // sesión -> proxies ("esquema://ip:port")
+	hotSetMtx    sync.Mutex
+	hotRefreshed = make(map[string]time.Time) // Último mantenimiento por sesión
+)
+
+// hotSet devuelve una copia del hot set de la sesión
+func hotSet(session string) []string {
+	hotSetMtx.Lock()
+	defer hotSetMtx.Unlock()
+	return append([]string(nil), hotSets[session]...)
+}
+
+// rankHotSet elige los size proxies del pool con mejor tasa de éxito, exigiendo algún éxito
+func (s *server) rankHotSet(session string, size int) []string {
+	type ranked struct {
+		proxy       string
+		rate        float64
+		lastSuccess time.Time
+	}
+
+	var candidates []ranked
+	for _, p := range s.pool.Proxies(session) {
+		score := s.pool.Score(session, p.String())
+		if score.Successes == 0 {
+			continue
+		}
+		candidates = append(candidates, ranked{
+			proxy:       p.String(),
+			rate:        score.Rate(),
+			lastSuccess: score.LastSuccess,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].rate != candidates[j].rate {
+			return candidates[i].rate > candidates[j].rate
+		}
+		return candidates[i].lastSuccess.After(candidates[j].lastSuccess)
+	})
+
+	if len(candidates) > size {
+		candidates = candidates[:size]
+	}
+	proxies := make([]string, len(candidates))
+	for i, c := range candidates {
+		proxies[i] = c.proxy
+	}
+	return proxies
+}
+
+// warmProxy envía una petición HEAD ligera a la URL de la sesión para mantener la conexión abierta
+func (s *server) warmProxy(session string, cfg config.ProxySession, proxyAddr string) bool {
+	client, err := s.getHTTPClient(proxyAddr, session)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Timeout)*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, cfg.URL, nil)
+	if err != nil {
+		return false
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 500
+}
+
+// refreshHotSet recalcula el hot set de la sesión y lo calienta; los proxies que no responden salen del conjunto
+func (s *server) refreshHotSet(session string, cfg config.ProxySession) {
+	candidates := s.rankHotSet(session, cfg.HotSetSize)
+
+	warm := make([]bool, len(candidates))
+	var wg sync.WaitGroup
+	for i, proxyAddr := range candidates {
+		wg.Add(1)
+		go func(i int, proxyAddr string) {
+			defer wg.Done()
+			warm[i] = s.warmProxy(session, cfg, proxyAddr)
+		}(i, proxyAddr)
+	}
+	wg.Wait()
+
+	var hot []string
+	for i, proxyAddr := range candidates {
+		if warm[i] {
+			hot = append(hot, proxyAddr)
+		}
+	}
+
+	hotSetMtx.Lock()
+	hotSets[session] = hot
+	hotSetMtx.Unlock()
+	log.Printf("Hot set %s: %d de %d proxies calientes", session, len(hot), len(candidates))
+}
+
+// maintainHotSets mantiene los hot sets de las sesiones que lo tienen configurado
+func (s *server) maintainHotSets(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for name, cfg := range config.Sessions() {
+			if cfg.HotSetSize <= 0 {
+				hotSetMtx.Lock()
+				delete(hotSets, name)
+				hotSetMtx.Unlock()
+				continue
+			}
+			interval := time.Duration(cfg.HotSetInterval) * time.Millisecond
+			if interval <= 0 {
+				interval = config.DefaultHotSetInterval * time.Millisecond
+			}
+
+			hotSetMtx.Lock()
+			due := time.Since(hotRefreshed[name]) >= interval
+			if due {
+				hotRefreshed[name] = time.Now()
+			}
+			hotSetMtx.Unlock()
+			if due {
+				go s.refreshHotSet(name, cfg)
+			}
+		}
+	}
+}
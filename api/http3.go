@@ -0,0 +1,63 @@
+// api/http3.go
+package api
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"proxy-api/internal/outbound"
+)
+
+// http3Transport es el cliente HTTP/3 registrado y si conecta a través de dialChecked
+type http3Transport struct {
+	client  *http.Client
+	guarded bool
+}
+
+// http3Client es el cliente de las peticiones directas de las sesiones con HTTP3; nil
+// mientras no se registre un transporte
+var http3Client atomic.Pointer[http3Transport]
+
+// guardHTTP3 hace que el transporte conecte solo con destinos permitidos y devuelve si
+// lo ha conseguido. Sin la etiqueta http3 el servidor no conoce el transporte de quic-go.
+var guardHTTP3 = func(transport http.RoundTripper) bool {
+	return false
+}
+
+// SetHTTP3Transport registra el transporte HTTP/3 de las peticiones directas, por
+// ejemplo el http3.Transport de quic-go. Las sesiones con HTTP3 lo usan en lugar de
+// HTTP/1.1; Hosts, HeaderOrder y TLS no se aplican, porque el transporte tiene su propia
+// configuración. Compilado con la etiqueta http3, un http3.Transport sin Dial propio
+// conecta solo con las direcciones que permiten las listas de destinos; cualquier otro
+// transporte se ignora mientras haya que comprobarlas.
+func (e *Engine) SetHTTP3Transport(transport http.RoundTripper) {
+	setHTTP3Transport(transport)
+}
+
+func setHTTP3Transport(transport http.RoundTripper) {
+	if transport == nil {
+		http3Client.Store(nil)
+		return
+	}
+	guarded := guardHTTP3(transport)
+	if outbound.Upstream() != nil {
+		log.Printf("HTTP/3 no puede pasar por UPSTREAM_PROXY, que solo encadena TCP: las sesiones con HTTP3 usarán HTTP/1.1")
+	} else if !guarded && checksDials() {
+		log.Printf("El transporte HTTP/3 no comprueba los destinos: las sesiones con HTTP3 usarán HTTP/1.1 mientras BLOCK_PRIVATE_TARGETS o TARGET_DENY_HOSTS con redes estén activos")
+	}
+	http3Client.Store(&http3Transport{
+		client:  &http.Client{Transport: transport, CheckRedirect: checkRedirect},
+		guarded: guarded,
+	})
+}
+
+// directHTTP3Client devuelve el cliente HTTP/3, o nil si no hay ninguno o no puede
+// usarse sin saltarse el bloqueo de destinos o UPSTREAM_PROXY
+func directHTTP3Client() *http.Client {
+	h := http3Client.Load()
+	if h == nil || (!h.guarded && checksDials()) || outbound.Upstream() != nil {
+		return nil
+	}
+	return h.client
+}
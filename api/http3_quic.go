@@ -0,0 +1,60 @@
+//go:build http3
+
+// api/http3_quic.go
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"proxy-api/internal/outbound"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Compilado con -tags http3, el servidor trae el cliente HTTP/3 de quic-go y las
+// sesiones con HTTP3 lo usan sin necesidad de registrar un transporte
+func init() {
+	guardHTTP3 = func(transport http.RoundTripper) bool {
+		t, ok := transport.(*http3.Transport)
+		if !ok || t.Dial != nil {
+			return false
+		}
+		t.Dial = guardedQUICDial
+		return true
+	}
+	setHTTP3Transport(&http3.Transport{
+		TLSClientConfig: &tls.Config{ClientSessionCache: tls.NewLRUClientSessionCache(0)},
+	})
+}
+
+// guardedQUICDial abre la conexión QUIC con una dirección comprobada, igual que
+// guardedDial con las conexiones TCP; el SNI sigue siendo el nombre del destino. El
+// socket sale de la IP de origen configurada y cuenta en MAX_CONNECTIONS hasta que la
+// conexión se cierra.
+func guardedQUICDial(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+	return dialChecked(ctx, "udp", addr, func(ctx context.Context, _, address string) (quic.EarlyConnection, error) {
+		udpAddr, err := net.ResolveUDPAddr("udp", address)
+		if err != nil {
+			return nil, err
+		}
+		packetConn, err := outbound.ListenPacket(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := quic.DialEarly(ctx, packetConn, udpAddr, tlsCfg, cfg)
+		if err != nil {
+			packetConn.Close()
+			return nil, err
+		}
+		// quic-go no cierra un socket que no ha abierto él
+		go func() {
+			<-conn.Context().Done()
+			packetConn.Close()
+		}()
+		return conn, nil
+	})
+}
@@ -0,0 +1,27 @@
+//go:build http3
+
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGuardedQUICDialBlocksPrivateTargets(t *testing.T) {
+	defer func(block bool) { config.BlockPrivateTargets = block }(config.BlockPrivateTargets)
+	config.BlockPrivateTargets = true
+
+	if directHTTP3Client() == nil {
+		t.Fatal("el transporte de quic-go no quedó registrado")
+	}
+	_, err := guardedQUICDial(context.Background(), "127.0.0.1:443", &tls.Config{}, nil)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("error %v, se esperaba PermissionDenied", err)
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"proxy-api/internal/config"
+)
+
+// TestHTTP3ClientRequiresGuard comprueba que un transporte que no comprueba los destinos
+// solo se usa sin bloqueo de direcciones no públicas
+func TestHTTP3ClientRequiresGuard(t *testing.T) {
+	defer func(block bool) { config.BlockPrivateTargets = block }(config.BlockPrivateTargets)
+	defer http3Client.Store(http3Client.Load())
+
+	setHTTP3Transport(http.DefaultTransport)
+	config.BlockPrivateTargets = true
+	if directHTTP3Client() != nil {
+		t.Fatal("se usa un transporte HTTP/3 sin comprobar los destinos")
+	}
+	config.BlockPrivateTargets = false
+	if directHTTP3Client() == nil {
+		t.Fatal("sin bloqueo de destinos el transporte HTTP/3 debía usarse")
+	}
+}
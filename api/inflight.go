@@ -0,0 +1,87 @@
+// api/inflight.go
+package api
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+
+	"proxy-api/internal/config"
+)
+
+// errProxyBusy indica que el proxy ya tiene el máximo de peticiones en curso hacia el host
+var errProxyBusy = errors.New("proxy has too many in-flight requests to this host")
+
+// Peticiones en curso por proxy y host de destino
+var (
+	inFlight    = make(map[string]int) // proxy|host -> peticiones
+	inFlightMtx sync.Mutex
+)
+
+// targetHost devuelve el host de destino de una URL
+func targetHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func inFlightKey(proxyAddr, host string) string {
+	return proxyAddress(proxyAddr) + "|" + host
+}
+
+// acquireHostSlot reserva un hueco para una petición al host a través del proxy.
+// Devuelve false si el proxy ya alcanzó PROXY_HOST_CONCURRENCY para ese host.
+func acquireHostSlot(proxyAddr, host string) bool {
+	if config.ProxyHostConcurrency <= 0 {
+		return true
+	}
+	key := inFlightKey(proxyAddr, host)
+
+	inFlightMtx.Lock()
+	defer inFlightMtx.Unlock()
+	if inFlight[key] >= config.ProxyHostConcurrency {
+		return false
+	}
+	inFlight[key]++
+	return true
+}
+
+// releaseHostSlot libera el hueco reservado con acquireHostSlot
+func releaseHostSlot(proxyAddr, host string) {
+	if config.ProxyHostConcurrency <= 0 {
+		return
+	}
+	key := inFlightKey(proxyAddr, host)
+
+	inFlightMtx.Lock()
+	defer inFlightMtx.Unlock()
+	if inFlight[key] <= 1 {
+		delete(inFlight, key)
+		return
+	}
+	inFlight[key]--
+}
+
+// filterIdle descarta los proxies que ya están al límite de peticiones hacia el host.
+// Si todos lo están se devuelve la lista original.
+func filterIdle(host string, proxies []string) []string {
+	if config.ProxyHostConcurrency <= 0 || len(proxies) == 0 {
+		return proxies
+	}
+
+	inFlightMtx.Lock()
+	defer inFlightMtx.Unlock()
+
+	idle := make([]string, 0, len(proxies))
+	for _, proxyAddr := range proxies {
+		if inFlight[inFlightKey(proxyAddr, host)] < config.ProxyHostConcurrency {
+			idle = append(idle, proxyAddr)
+		}
+	}
+	if len(idle) == 0 {
+		return proxies
+	}
+	return idle
+}
@@ -0,0 +1,179 @@
+// api/integrity.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/events"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// maxIntegrityChecks limita las comprobaciones de integridad en curso; con todas
+// ocupadas la respuesta no se comprueba, igual que si no hubiera salido en el muestreo
+const maxIntegrityChecks = 16
+
+var integritySlots = make(chan struct{}, maxIntegrityChecks)
+
+// externalResource captura el src de los scripts e iframes de una página
+var externalResource = regexp.MustCompile(`(?i)<(?:script|iframe)\b[^>]*?\ssrc\s*=\s*["']?([^"'\s>]+)`)
+
+// checkIntegrity repite en segundo plano, para un porcentaje de las respuestas HTML
+// servidas por proxy, la petición por la vía de referencia y retira el proxy si su
+// respuesta diverge.
+func (s *server) checkIntegrity(req *pb.Request, result *fetchResult, userAgent string) {
+	session, _ := config.GetSession(req.Session)
+	check := session.Integrity
+	if check.Percent <= 0 || result.proxy == directProxy || result.fromCache || result.status != http.StatusOK || result.spilled != nil {
+		return
+	}
+	// Solo se repiten peticiones sin efectos
+	if (req.Method != "" && req.Method != http.MethodGet) || hasMultipartBody(req) {
+		return
+	}
+	// La referencia directa solo se pide si la sesión ya sale sin proxy en su cadena
+	if check.Reference == config.IntegrityDirect && !hasDirectStage(session) {
+		return
+	}
+	if sniffContentType(result.contentType, result.content) != "text/html" || rand.Intn(100) >= check.Percent {
+		return
+	}
+	select {
+	case integritySlots <- struct{}{}:
+	default:
+		return
+	}
+
+	// La respuesta sigue modificándose después (charset, compresión) y se devuelve al
+	// cliente: la comprobación trabaja sobre su propia copia
+	proxyAddr, content := result.proxy, bytes.Clone(result.content)
+	req = proto.Clone(req).(*pb.Request)
+	go func() {
+		defer func() { <-integritySlots }()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(session.Timeout)*time.Millisecond)
+		defer cancel()
+
+		reference, via := s.integrityReference(ctx, req, proxyAddr, userAgent, check.Reference)
+		if reference == nil || reference.status != http.StatusOK {
+			return
+		}
+
+		minSimilarity := check.MinSimilarity
+		if minSimilarity <= 0 {
+			minSimilarity = config.DefaultMinSimilarity
+		}
+		reason, tampered := compareContent(content, reference.content, minSimilarity)
+		if !tampered {
+			return
+		}
+
+		log.Printf("Proxy %s retirado de %s: su respuesta diverge de la obtenida vía %s (%s)", config.RedactURL(proxyAddr), req.Session, config.RedactURL(via), reason)
+		events.Publish(events.Event{Kind: events.ProxyEvicted, Session: req.Session, Proxy: eventProxy(proxyAddr), Host: targetHost(req.Url), Reason: "integrity: " + reason})
+		s.removeSuccesfulProxy(req.Session, proxyAddr)
+		s.pool.Remove(req.Session, proxyAddr)
+		s.recordProxyResult(req.Session, proxyAddr, false)
+	}()
+}
+
+// hasDirectStage indica si la cadena de fallback de la sesión incluye la etapa directa
+func hasDirectStage(session config.ProxySession) bool {
+	for _, stage := range session.FallbackChain() {
+		if stage.Kind == config.FallbackDirect {
+			return true
+		}
+	}
+	return false
+}
+
+// integrityReference obtiene la respuesta de referencia: otro proxy del pool, o la
+// petición directa si la sesión lo pide
+func (s *server) integrityReference(ctx context.Context, req *pb.Request, proxyAddr, userAgent, reference string) (*fetchResult, string) {
+	via := directProxy
+	fetcher := s.fetchers.direct
+	if reference != config.IntegrityDirect {
+		var candidates []string
+		for _, candidate := range s.pool.Available(req.Session, s.poolProxies(req.Session)) {
+			if proxyAddress(candidate) != proxyAddress(proxyAddr) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, ""
+		}
+		via = candidates[rand.Intn(len(candidates))]
+		fetcher = s.fetchers.proxied
+	}
+
+	result, err := fetcher.Fetch(ctx, req, via, userAgent)
+	if err != nil {
+		log.Printf("Comprobación de integridad de %s vía %s fallida: %v", config.RedactURL(proxyAddr), config.RedactURL(via), err)
+		return nil, ""
+	}
+	return result, via
+}
+
+// compareContent indica si la respuesta del proxy parece alterada: scripts o iframes
+// externos que no están en la referencia, o un parecido inferior al mínimo
+func compareContent(proxied, reference []byte, minSimilarity float64) (string, bool) {
+	known := make(map[string]bool)
+	for _, match := range externalResource.FindAllSubmatch(reference, -1) {
+		known[string(match[1])] = true
+	}
+	injected := make(map[string]bool)
+	for _, match := range externalResource.FindAllSubmatch(proxied, -1) {
+		if src := string(match[1]); !known[src] {
+			injected[src] = true
+		}
+	}
+	if len(injected) > 0 {
+		sources := make([]string, 0, len(injected))
+		for src := range injected {
+			sources = append(sources, src)
+		}
+		sort.Strings(sources)
+		return "recursos inyectados: " + strings.Join(sources, ", "), true
+	}
+
+	if similarity := tagSimilarity(proxied, reference); similarity < minSimilarity {
+		return fmt.Sprintf("parecido %.2f", similarity), true
+	}
+	return "", false
+}
+
+// tagSimilarity es el índice de Jaccard entre los fragmentos de ambas páginas
+// separados por etiquetas, que no depende de los saltos de línea
+func tagSimilarity(a, b []byte) float64 {
+	setA, setB := tagFragments(a), tagFragments(b)
+	if len(setA) == 0 && len(setB) == 0 {
+		return 1
+	}
+	shared := 0
+	for fragment := range setA {
+		if setB[fragment] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(setA)+len(setB)-shared)
+}
+
+// tagFragments divide la página en fragmentos terminados en '>'
+func tagFragments(content []byte) map[string]bool {
+	fragments := make(map[string]bool)
+	for _, fragment := range strings.Split(string(content), ">") {
+		if fragment = strings.TrimSpace(fragment); fragment != "" {
+			fragments[fragment] = true
+		}
+	}
+	return fragments
+}
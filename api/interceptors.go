@@ -0,0 +1,171 @@
+// api/interceptors.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// interceptor agrupa las versiones unaria y de streaming de un middleware
+type interceptor struct {
+	unary  grpc.UnaryServerInterceptor
+	stream grpc.StreamServerInterceptor
+}
+
+// Middlewares disponibles para GRPC_INTERCEPTORS
+var interceptorRegistry = map[string]interceptor{
+	"recovery":  {unary: recoveryInterceptor, stream: recoveryStreamInterceptor},
+	"logging":   {unary: loggingInterceptor, stream: loggingStreamInterceptor},
+	"metrics":   {unary: metricsInterceptor, stream: metricsStreamInterceptor},
+	"validate":  {unary: validationInterceptor, stream: validationStreamInterceptor},
+	"tenants":   {unary: tenantsInterceptor, stream: tenantsStreamInterceptor},
+	"readiness": {unary: readinessInterceptor, stream: readinessStreamInterceptor},
+}
+
+// interceptorChain construye las opciones del servidor con los middlewares configurados,
+// en orden. Un nombre desconocido es un error, y también que falte tenants con tenants
+// configurados: sin él se atenderían llamadas sin clave, sin cuotas y sin separar las
+// sesiones de cada tenant.
+func interceptorChain() ([]grpc.ServerOption, error) {
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+
+	withTenants := false
+	for _, name := range strings.Split(config.GRPCInterceptors, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		i, ok := interceptorRegistry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown interceptor %q in GRPC_INTERCEPTORS", name)
+		}
+		withTenants = withTenants || name == "tenants"
+		if i.unary != nil {
+			unary = append(unary, i.unary)
+		}
+		if i.stream != nil {
+			stream = append(stream, i.stream)
+		}
+	}
+
+	if config.TenancyEnabled() && !withTenants {
+		return nil, fmt.Errorf("TENANTS_FILE requires the tenants interceptor in GRPC_INTERCEPTORS")
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}, nil
+}
+
+// panicError registra el panic con su traza y lo convierte en un error Internal
+func panicError(method string, r interface{}) error {
+	log.Printf("Panic en %s: %v\n%s", method, r, debug.Stack())
+	return status.Errorf(codes.Internal, "internal error: %v", r)
+}
+
+func recoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(info.FullMethod, r)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func recoveryStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(info.FullMethod, r)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx = withRequestID(ctx)
+	if r, ok := req.(interface{ GetSession() string }); ok {
+		ctx = withRequestLog(ctx, r.GetSession())
+	}
+	resp, err := handler(ctx, req)
+	requestLog(ctx, "gRPC", err, "method", info.FullMethod, "client", clientIdentity(ctx), "code", status.Code(err), "duration_ms", time.Since(start))
+	return resp, err
+}
+
+func loggingStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	requestLog(ss.Context(), "gRPC stream", err, "method", info.FullMethod, "client", clientIdentity(ss.Context()), "code", status.Code(err), "duration_ms", time.Since(start))
+	return err
+}
+
+// MethodStats acumula las llamadas de un método gRPC
+type MethodStats struct {
+	Calls        int64
+	Errors       int64
+	Panics       int64
+	TotalLatency time.Duration
+}
+
+var (
+	methodStats    = make(map[string]*MethodStats)
+	methodStatsMtx sync.Mutex
+)
+
+func recordMethodStats(method string, err error, latency time.Duration) {
+	methodStatsMtx.Lock()
+	defer methodStatsMtx.Unlock()
+
+	stats, ok := methodStats[method]
+	if !ok {
+		stats = &MethodStats{}
+		methodStats[method] = stats
+	}
+	stats.Calls++
+	stats.TotalLatency += latency
+	if err != nil {
+		stats.Errors++
+		if status.Code(err) == codes.Internal && strings.HasPrefix(status.Convert(err).Message(), "internal error:") {
+			stats.Panics++
+		}
+	}
+}
+
+// methodStatsSnapshot devuelve una copia de las métricas por método
+func methodStatsSnapshot() map[string]MethodStats {
+	methodStatsMtx.Lock()
+	defer methodStatsMtx.Unlock()
+
+	snapshot := make(map[string]MethodStats, len(methodStats))
+	for method, stats := range methodStats {
+		snapshot[method] = *stats
+	}
+	return snapshot
+}
+
+func metricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	recordMethodStats(info.FullMethod, err, time.Since(start))
+	return resp, err
+}
+
+func metricsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	recordMethodStats(info.FullMethod, err, time.Since(start))
+	return err
+}
@@ -0,0 +1,45 @@
+// api/invalidate.go
+package api
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/cache"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// compileURLPattern convierte un patrón de URL en una expresión regular: "*" encaja con
+// cualquier secuencia de caracteres y el resto debe coincidir tal cual
+func compileURLPattern(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	return regexp.MustCompile("^" + strings.ReplaceAll(quoted, `\*`, ".*") + "$")
+}
+
+// InvalidateCache - Descarta de la caché las respuestas de las URL que encajan con el
+// patrón y adelanta el refresco de las URL calientes afectadas
+func (s *server) InvalidateCache(ctx context.Context, req *pb.InvalidateCacheRequest) (*pb.InvalidateCacheResponse, error) {
+	if req.UrlPattern == "" {
+		return nil, status.Error(codes.InvalidArgument, "url_pattern is required")
+	}
+	// Sin sesión se invalidan las de todos los tenants; rewriteSessions solo traduce las
+	// sesiones indicadas
+	if tenant := tenantFrom(ctx); tenant != nil && !tenant.Admin && req.Session == "" {
+		return nil, status.Errorf(codes.PermissionDenied, "tenant '%s' must name a session to invalidate", tenant.Name)
+	}
+	pattern := compileURLPattern(req.UrlPattern)
+
+	removed := s.responseCache.DeleteFunc(func(key string) bool {
+		session, rawURL := cache.SplitKey(key)
+		return (req.Session == "" || session == req.Session) && pattern.MatchString(rawURL)
+	})
+	warmed := s.refreshWarmMatching(req.Session, pattern.MatchString)
+
+	log.Printf("Caché invalidada para %s (sesión %q): %d respuestas, %d URL calientes por refrescar", req.UrlPattern, req.Session, removed, warmed)
+	return &pb.InvalidateCacheResponse{Removed: int32(removed), Warmed: int32(warmed)}, nil
+}
@@ -0,0 +1,214 @@
+// api/jobs.go
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/storage"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var errQueueDisabled = errors.New("job queue requires STORAGE_DRIVER")
+
+// startJobWorkers arranca los workers de la cola si hay backend SQL
+func (s *server) startJobWorkers(ctx context.Context) {
+	if proxyStore == nil || config.JobWorkers <= 0 {
+		return
+	}
+	for i := 0; i < config.JobWorkers; i++ {
+		go s.jobWorker(ctx)
+	}
+	go purgeJobs(ctx)
+	log.Printf("Cola de trabajos: %d workers", config.JobWorkers)
+}
+
+// purgeJobs borra cada hora los trabajos terminados o fallidos hace más de
+// JOB_RETENTION_HOURS, hasta que ctx termine
+func purgeJobs(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		cutoff := time.Now().Add(-time.Duration(config.JobRetentionHours) * time.Hour)
+		if n, err := proxyStore.DeleteJobsBefore(cutoff); err != nil {
+			log.Printf("Error al borrar los trabajos antiguos: %v", err)
+		} else if n > 0 {
+			log.Printf("Cola de trabajos: %d trabajos antiguos borrados", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// jobWorker reserva y ejecuta trabajos de la cola. Un trabajo se marca terminado solo
+// después de ejecutarse; si el worker muere antes, otro lo retoma al caducar la reserva.
+func (s *server) jobWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		// Sin pool los trabajos fallarían y gastarían sus intentos
+		if !s.ready.Load() {
+			time.Sleep(config.JobPollInterval * time.Millisecond)
+			continue
+		}
+		job, ok, err := proxyStore.ClaimJob(time.Now().Add(config.JobLease*time.Second), config.JobMaxAttempts)
+		if err != nil {
+			log.Printf("Error al reservar un trabajo: %v", err)
+		}
+		if !ok {
+			time.Sleep(config.JobPollInterval * time.Millisecond)
+			continue
+		}
+		s.runJob(job)
+	}
+}
+
+func (s *server) runJob(job storage.Job) {
+	req := &pb.Request{}
+	if err := protojson.Unmarshal([]byte(job.Request), req); err != nil {
+		s.finishJob(job.ID, storage.JobFailed, "", fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.JobLease*time.Second)
+	defer cancel()
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-client-id", "job/"+job.ID))
+
+	resp, err := s.FetchContent(ctx, req)
+	if err == nil {
+		err = offloadContent(ctx, job.ID, req, resp)
+	}
+	if err != nil {
+		log.Printf("Trabajo %s: intento %d fallido: %v", job.ID, job.Attempts, err)
+		if job.Attempts >= config.JobMaxAttempts {
+			s.finishJob(job.ID, storage.JobFailed, "", err.Error())
+			return
+		}
+		// La espera se duplica en cada intento para no insistir con un destino caído
+		delay := time.Duration(config.JobRetryDelay<<(job.Attempts-1)) * time.Millisecond
+		if err := proxyStore.RetryJob(job.ID, err.Error(), time.Now().Add(delay)); err != nil {
+			log.Printf("Error al devolver a la cola el trabajo %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	result, err := protojson.Marshal(resp)
+	if err != nil {
+		s.finishJob(job.ID, storage.JobFailed, "", err.Error())
+		return
+	}
+	s.finishJob(job.ID, storage.JobDone, string(result), "")
+}
+
+func (s *server) finishJob(id, state, result, errMsg string) {
+	if err := proxyStore.FinishJob(id, state, result, errMsg); err != nil {
+		log.Printf("Error al guardar el resultado del trabajo %s: %v", id, err)
+	}
+}
+
+// jobToProto convierte un trabajo almacenado en su mensaje
+func jobToProto(job storage.Job) *pb.Job {
+	msg := &pb.Job{
+		Id:       job.ID,
+		State:    job.State,
+		Attempts: int32(job.Attempts),
+		Error:    job.Error,
+		Created:  job.CreatedAt.UnixMilli(),
+		Updated:  job.UpdatedAt.UnixMilli(),
+		Request:  &pb.Request{},
+	}
+	protojson.Unmarshal([]byte(job.Request), msg.Request)
+	if job.Result != "" {
+		msg.Response = &pb.Response{}
+		protojson.Unmarshal([]byte(job.Result), msg.Response)
+	}
+	return msg
+}
+
+// EnqueueJobs - Encola las peticiones para procesarlas en segundo plano con garantía al-menos-una-vez
+func (s *server) EnqueueJobs(ctx context.Context, req *pb.EnqueueJobsRequest) (*pb.EnqueueJobsResponse, error) {
+	if proxyStore == nil {
+		return nil, errQueueDisabled
+	}
+
+	ids := make([]string, len(req.Requests))
+	payloads := make([]string, len(req.Requests))
+	for i, fetchReq := range req.Requests {
+		if _, exists := config.GetSession(fetchReq.Session); !exists {
+			return nil, fmt.Errorf("request %d: session '%s' not found in configuration", i, fetchReq.Session)
+		}
+		if fetchReq.WebhookUrl != "" || fetchReq.DryRun {
+			return nil, fmt.Errorf("request %d: webhook_url and dry_run are not supported in jobs", i)
+		}
+		if err := checkContentEncoding(fetchReq); err != nil {
+			return nil, fmt.Errorf("request %d: %w", i, err)
+		}
+		data, err := protojson.Marshal(fetchReq)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = newJobID()
+		payloads[i] = string(data)
+	}
+
+	if err := proxyStore.EnqueueJobs(ids, payloads); err != nil {
+		return nil, err
+	}
+	return &pb.EnqueueJobsResponse{Ids: ids}, nil
+}
+
+// GetJobResult - Devuelve el estado de un trabajo y, si terminó, su respuesta
+func (s *server) GetJobResult(ctx context.Context, req *pb.JobId) (*pb.Job, error) {
+	if proxyStore == nil {
+		return nil, errQueueDisabled
+	}
+	job, err := proxyStore.GetJob(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	resp := jobToProto(job)
+	if !tenantCanSee(ctx, resp.GetRequest().GetSession()) {
+		return nil, status.Errorf(codes.NotFound, "job '%s' not found", req.Id)
+	}
+	return resp, nil
+}
+
+// ListJobs - Lista los trabajos de la cola, del más reciente al más antiguo
+func (s *server) ListJobs(ctx context.Context, req *pb.ListJobsRequest) (*pb.JobList, error) {
+	if proxyStore == nil {
+		return nil, errQueueDisabled
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = config.DefaultJobListLimit
+	}
+	// Un tenant solo ve los trabajos de sus sesiones; se filtran antes de aplicar el
+	// límite para que no se lleven su hueco los trabajos de otros
+	var keep func(storage.Job) bool
+	if tenant := tenantFrom(ctx); tenant != nil && !tenant.Admin {
+		keep = func(job storage.Job) bool {
+			return tenantCanSee(ctx, jobToProto(job).GetRequest().GetSession())
+		}
+	}
+	// El listado no incluye el contenido; se obtiene con GetJobResult
+	jobs, err := proxyStore.ListJobs(req.State, min(limit, config.MaxJobListLimit), keep)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &pb.JobList{}
+	for _, job := range jobs {
+		list.Jobs = append(list.Jobs, jobToProto(job))
+	}
+	return list, nil
+}
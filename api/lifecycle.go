@@ -0,0 +1,134 @@
+// api/lifecycle.go
+package api
+
+import (
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/outbound"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sessionTracker lleva la cuenta de las peticiones en curso por sesión
+type sessionTracker struct {
+	mtx      sync.Mutex
+	inflight map[string]*sync.WaitGroup
+	draining map[string]bool
+}
+
+// begin registra una petición para la sesión; devuelve la función que la da por terminada
+func (t *sessionTracker) begin(session string) (func(), error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.draining[session] {
+		return nil, status.Errorf(codes.Unavailable, "session '%s' is being drained", session)
+	}
+	if t.inflight == nil {
+		t.inflight = make(map[string]*sync.WaitGroup)
+	}
+	wg, ok := t.inflight[session]
+	if !ok {
+		wg = &sync.WaitGroup{}
+		t.inflight[session] = wg
+	}
+	wg.Add(1)
+	return wg.Done, nil
+}
+
+// drain rechaza nuevas peticiones y espera a las que están en curso, como mucho timeout
+func (t *sessionTracker) drain(session string, timeout time.Duration) {
+	t.mtx.Lock()
+	if t.draining == nil {
+		t.draining = make(map[string]bool)
+	}
+	t.draining[session] = true
+	wg := t.inflight[session]
+	t.mtx.Unlock()
+
+	if wg == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("Tiempo de drenado agotado para la sesión %s, quedan peticiones en curso", session)
+	}
+}
+
+// release vuelve a admitir peticiones para la sesión
+func (t *sessionTracker) release(session string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	delete(t.draining, session)
+	delete(t.inflight, session)
+}
+
+// drainSession espera las peticiones en curso de la sesión, cierra sus transportes
+// y, si la sesión se eliminó, retira sus entradas del pool.
+func (s *server) drainSession(session string, removed bool) {
+	log.Printf("Drenando la sesión %s", session)
+	s.sessions.drain(session, config.DrainTimeout*time.Second)
+
+	s.mtx.Lock()
+	clients := s.successfulProxies[session]
+	delete(s.successfulProxies, session)
+	s.mtx.Unlock()
+
+	for _, client := range clients {
+		if transport, ok := client.Transport.(*http.Transport); ok {
+			outbound.Discard(transport)
+		}
+	}
+
+	forgetPinnedAgents(session)
+	s.pool.Forget(session)
+	forgetExperiment(session)
+	forgetSessionStats(session)
+	forgetSLO(session)
+	forgetProviderStickies(session)
+	if removed {
+		s.pool.RemoveSession(session)
+		s.forgetWarmup(session)
+	}
+
+	s.sessions.release(session)
+}
+
+// reconcileSessions drena las sesiones eliminadas o modificadas desde la última llamada
+func (s *server) reconcileSessions() {
+	s.reconcileMtx.Lock()
+	defer s.reconcileMtx.Unlock()
+
+	current := config.Sessions()
+	for name, previous := range s.knownSessions {
+		session, ok := current[name]
+		if !ok {
+			s.drainSession(name, true)
+		} else if !reflect.DeepEqual(previous, session) {
+			s.drainSession(name, false)
+		}
+	}
+
+	// Entradas del pool que ya no corresponden a ninguna sesión
+	for name := range s.pool.All() {
+		if _, ok := current[name]; !ok {
+			s.pool.RemoveSession(name)
+		}
+	}
+
+	s.knownSessions = current
+}
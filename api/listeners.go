@@ -0,0 +1,38 @@
+// api/listeners.go
+package api
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"proxy-api/internal/config"
+)
+
+// listenAll abre un listener por cada dirección configurada en GRPC_LISTEN_ADDRESSES
+func listenAll() ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, address := range strings.Split(config.GRPCListenAddresses, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+
+		network := "tcp"
+		if path, ok := strings.CutPrefix(address, "unix:"); ok {
+			network, address = "unix", path
+			// Un socket de una ejecución anterior impediría escuchar
+			os.Remove(address)
+		}
+
+		lis, err := net.Listen(network, address)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,80 @@
+// api/locale.go
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"proxy-api/internal/config"
+)
+
+// chromeVersion extrae la versión mayor de un user-agent de Chromium
+var chromeVersion = regexp.MustCompile(`Chrome/(\d+)`)
+
+// applyLocale añade las cabeceras que un navegador con el idioma de la sesión y el
+// user-agent de la petición enviaría. Las cabeceras ya presentes no se tocan, de modo
+// que las de la sesión prevalecen.
+func applyLocale(header http.Header, session, userAgent string) {
+	for name, value := range localeHeaders(session, userAgent) {
+		if header.Get(name) == "" {
+			header.Set(name, value)
+		}
+	}
+}
+
+// localeHeaders genera Accept-Language a partir del Locale de la sesión y las client
+// hints coherentes con el user-agent; vacío si la sesión no declara Locale
+func localeHeaders(session, userAgent string) map[string]string {
+	cfg, _ := config.GetSession(session)
+	if cfg.Locale == "" {
+		return nil
+	}
+
+	headers := map[string]string{"Accept-Language": acceptLanguage(cfg.Locale)}
+	// Solo los navegadores basados en Chromium envían client hints
+	match := chromeVersion.FindStringSubmatch(userAgent)
+	if match == nil || strings.Contains(userAgent, "Firefox/") {
+		return headers
+	}
+	brand := "Google Chrome"
+	if strings.Contains(userAgent, "Edg/") {
+		brand = "Microsoft Edge"
+	}
+	headers["Sec-Ch-Ua"] = `"Chromium";v="` + match[1] + `", "` + brand + `";v="` + match[1] + `", "Not-A.Brand";v="99"`
+	headers["Sec-Ch-Ua-Mobile"] = "?0"
+	if strings.Contains(userAgent, "Mobile") {
+		headers["Sec-Ch-Ua-Mobile"] = "?1"
+	}
+	if platform := uaPlatform(userAgent); platform != "" {
+		headers["Sec-Ch-Ua-Platform"] = `"` + platform + `"`
+	}
+	return headers
+}
+
+// acceptLanguage construye la cabecera como la envía un navegador con ese idioma:
+// "es-ES" da "es-ES,es;q=0.9"
+func acceptLanguage(locale string) string {
+	lang, _, hasRegion := strings.Cut(locale, "-")
+	if !hasRegion {
+		return locale
+	}
+	return locale + "," + lang + ";q=0.9"
+}
+
+// uaPlatform devuelve la plataforma de Sec-Ch-Ua-Platform que corresponde al user-agent
+func uaPlatform(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "Windows"):
+		return "Windows"
+	case strings.Contains(userAgent, "Android"):
+		return "Android"
+	case strings.Contains(userAgent, "CrOS"):
+		return "Chrome OS"
+	case strings.Contains(userAgent, "Macintosh"):
+		return "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		return "Linux"
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+// api/offload.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/objectstore"
+)
+
+// resultStore es el bucket al que se suben los contenidos de los trabajos, nil si no hay
+var resultStore objectstore.Store
+
+// openResultStore prepara el bucket de RESULT_STORE_DRIVER
+func openResultStore() {
+	if config.ResultStoreDriver == "" {
+		return
+	}
+	store, err := objectstore.Open(objectstore.Config{
+		Driver:    config.ResultStoreDriver,
+		Endpoint:  config.ResultStoreEndpoint,
+		Region:    config.ResultStoreRegion,
+		Bucket:    config.ResultStoreBucket,
+		AccessKey: config.ResultStoreAccessKey,
+		SecretKey: config.ResultStoreSecretKey,
+	})
+	if err != nil {
+		log.Fatalf("failed to open result store: %v", err)
+	}
+	resultStore = store
+	log.Printf("Contenidos de los trabajos en %s", store.URL(""))
+}
+
+// offloadContent sube el contenido de la respuesta de un trabajo al bucket y lo
+// sustituye en la respuesta por object_url y content_size. Sin bucket, o en una
+// respuesta sin contenido nuevo, no hace nada.
+func offloadContent(ctx context.Context, jobID string, req *pb.Request, resp *pb.Response) error {
+	if resultStore == nil || resp == nil || resp.NotModified {
+		return nil
+	}
+
+	// Un contenido guardado en disco se sube desde el fichero, sin cargarlo en memoria
+	var body io.ReadSeeker = bytes.NewReader(resp.Content)
+	size := int64(len(resp.Content))
+	if resp.SpillToken != "" {
+		path, err := spilledPath(resp.SpillToken)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(path)
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		body, size = file, info.Size()
+	}
+
+	key := resultKey(jobID, req, resp)
+	headers := map[string]string{
+		"Content-Type":       "application/octet-stream",
+		"X-Amz-Meta-Status":  strconv.Itoa(int(resp.Status)),
+		"X-Amz-Meta-Request": resp.RequestId,
+	}
+	if u, err := url.Parse(req.Url); err == nil {
+		headers["X-Amz-Meta-Url"] = u.String()
+	}
+	if resp.ContentEncoding != "" {
+		headers["Content-Encoding"] = resp.ContentEncoding
+	}
+	if err := resultStore.Put(ctx, key, body, size, headers); err != nil {
+		return err
+	}
+
+	resp.Content = nil
+	resp.SpillToken, resp.SpillSize, resp.SpillExpires = "", 0, 0
+	resp.ObjectUrl = resultStore.URL(key)
+	resp.ContentSize = size
+	return nil
+}
+
+// resultKey construye la clave del objeto con RESULT_STORE_KEY_TEMPLATE
+func resultKey(jobID string, req *pb.Request, resp *pb.Response) string {
+	return strings.NewReplacer(
+		"{job_id}", jobID,
+		"{session}", req.Session,
+		"{host}", targetHost(req.Url),
+		"{date}", time.Now().UTC().Format("2006-01-02"),
+		"{request_id}", resp.RequestId,
+	).Replace(config.ResultStoreKeyTemplate)
+}
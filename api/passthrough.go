@@ -0,0 +1,302 @@
+// api/passthrough.go
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/outbound"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Protocolos soportados por StreamPassthrough
+const (
+	protocolWebSocket = "websocket"
+	protocolSSE       = "sse"
+)
+
+// randomPoolProxy elige un proxy aleatorio (esquema://ip:port) del pool de la sesión
+func (s *server) randomPoolProxy(session string) (string, error) {
+	proxies := filterDiverse(session, s.poolProxies(session))
+	if len(proxies) == 0 {
+		return "", fmt.Errorf("no valid proxies available for session '%s'", session)
+	}
+	proxyAddr := proxies[rand.Intn(len(proxies))]
+	recordDiversity(session, proxyAddr)
+	return proxyAddr, nil
+}
+
+// passthroughProxy elige un proxy aleatorio del pool o "direct" si no se pidió proxy
+func (s *server) passthroughProxy(open *pb.StreamOpen) (string, error) {
+	if !open.Proxy {
+		return "direct", nil
+	}
+	return s.randomPoolProxy(open.Session)
+}
+
+// passthroughHeaders construye las cabeceras de la sesión con el user-agent que
+// corresponde a su rotación: fijo si es "static" o "proxy", aleatorio en otro caso
+func passthroughHeaders(session, proxyAddr string) http.Header {
+	headers := http.Header{}
+	cfg, _ := config.GetSession(session)
+	switch cfg.UserAgentPolicy() {
+	case config.UserAgentStatic:
+		headers.Set("User-Agent", cfg.StaticUserAgent)
+	case config.UserAgentProxy:
+		headers.Set("User-Agent", pinnedUserAgent(session, "proxy:"+proxyAddress(proxyAddr)))
+	default:
+		headers.Set("User-Agent", randomUserAgent())
+	}
+	for k, v := range config.GetHeadersFromSession(session) {
+		headers.Set(k, v)
+	}
+	applyLocale(headers, session, headers.Get("User-Agent"))
+	// Las tramas se retransmiten según llegan: sin Accept-Encoding propio, el transporte
+	// pide gzip y lo descomprime
+	headers.Del("Accept-Encoding")
+	return headers
+}
+
+// passthroughTransport crea un transporte que sale por proxyAddr
+func (s *server) passthroughTransport(session, proxyAddr string) (*http.Transport, error) {
+	var target *url.URL
+	if proxyAddr != "direct" {
+		var err error
+		if target, err = s.proxyURL(session, proxyAddr); err != nil {
+			return nil, err
+		}
+	}
+	transport := outbound.Transport(target)
+	if target == nil {
+		transport.DialContext = guardedDial(transport.DialContext)
+	}
+	cfg, _ := config.GetSession(session)
+	tlsConfig, err := sessionTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// StreamPassthrough - Abre un WebSocket o un stream SSE contra el destino y retransmite las tramas
+func (s *server) StreamPassthrough(stream pb.ProxyService_StreamPassthroughServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	open := first.Open
+	if open == nil || open.Url == "" {
+		return fmt.Errorf("first frame must contain the stream target")
+	}
+	if _, exists := config.GetSession(open.Session); !exists {
+		return fmt.Errorf("session '%s' not found in configuration", open.Session)
+	}
+	target, err := url.Parse(open.Url)
+	if err != nil || target.Hostname() == "" {
+		return status.Errorf(codes.InvalidArgument, "invalid stream url '%s'", open.Url)
+	}
+	if err := checkTargetHost(stream.Context(), target.Hostname()); err != nil {
+		return err
+	}
+
+	proxyAddr, err := s.passthroughProxy(open)
+	if err != nil {
+		return err
+	}
+
+	done, err := s.sessions.begin(open.Session)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	log.Printf("Passthrough %s: %s vía %s", open.Protocol, open.Url, proxyAddr)
+	switch open.Protocol {
+	case protocolWebSocket:
+		return s.relayWebSocket(stream, open, proxyAddr)
+	case protocolSSE:
+		return s.relaySSE(stream, open, proxyAddr)
+	default:
+		return fmt.Errorf("unsupported protocol '%s'", open.Protocol)
+	}
+}
+
+// relayWebSocket retransmite las tramas en ambos sentidos hasta que uno de los extremos cierre
+func (s *server) relayWebSocket(stream pb.ProxyService_StreamPassthroughServer, open *pb.StreamOpen, proxyAddr string) error {
+	cfg, _ := config.GetSession(open.Session)
+	tlsConfig, err := sessionTLSConfig(cfg.TLS)
+	if err != nil {
+		return err
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second, TLSClientConfig: tlsConfig}
+	if proxyAddr != "direct" {
+		target, err := s.proxyURL(open.Session, proxyAddr)
+		if err != nil {
+			return err
+		}
+		dialer.Proxy = http.ProxyURL(target)
+	} else {
+		dialer.NetDialContext = guardedDial(outbound.Dialer().DialContext)
+	}
+
+	conn, _, err := dialer.DialContext(stream.Context(), open.Url, passthroughHeaders(open.Session, proxyAddr))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Cliente -> destino; al terminar cierra la conexión para desbloquear la lectura
+	clientErr := make(chan error, 1)
+	go func() {
+		defer conn.Close()
+		for {
+			frame, err := stream.Recv()
+			if err != nil {
+				clientErr <- err
+				return
+			}
+			if frame.Closed {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				clientErr <- nil
+				return
+			}
+			messageType := websocket.TextMessage
+			if frame.Binary {
+				messageType = websocket.BinaryMessage
+			}
+			if err := conn.WriteMessage(messageType, frame.Data); err != nil {
+				clientErr <- err
+				return
+			}
+		}
+	}()
+
+	// Destino -> cliente
+	first := true
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case cerr := <-clientErr:
+				if cerr == io.EOF {
+					return nil
+				}
+				return cerr
+			default:
+			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return stream.Send(&pb.StreamFrame{Closed: true})
+			}
+			return err
+		}
+
+		frame := &pb.StreamFrame{Data: data, Binary: messageType == websocket.BinaryMessage}
+		if first {
+			frame.Proxy = proxyAddr
+			first = false
+		}
+		if err := stream.Send(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// relaySSE consume el stream de eventos del destino y envía un mensaje por evento
+func (s *server) relaySSE(stream pb.ProxyService_StreamPassthroughServer, open *pb.StreamOpen, proxyAddr string) error {
+	transport, err := s.passthroughTransport(open.Session, proxyAddr)
+	if err != nil {
+		return err
+	}
+	defer outbound.Discard(transport)
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	// El cliente puede cerrar el stream enviando una trama closed
+	go func() {
+		for {
+			frame, err := stream.Recv()
+			if err != nil || frame.Closed {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	reqObj, err := http.NewRequestWithContext(ctx, "GET", open.Url, nil)
+	if err != nil {
+		return err
+	}
+	reqObj.Header = passthroughHeaders(open.Session, proxyAddr)
+	reqObj.Header.Set("Accept", "text/event-stream")
+
+	// Sin Timeout: el stream permanece abierto mientras el destino envíe eventos
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(reqObj)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d opening event stream", resp.StatusCode)
+	}
+
+	first := true
+	event := &pb.StreamFrame{}
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// Línea vacía: fin del evento
+			if len(data) == 0 {
+				continue
+			}
+			event.Data = []byte(strings.Join(data, "\n"))
+			if first {
+				event.Proxy = proxyAddr
+				first = false
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+			event = &pb.StreamFrame{}
+			data = nil
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "event":
+			event.Event = value
+		case "id":
+			event.Id = value
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return stream.Send(&pb.StreamFrame{Closed: true})
+}
@@ -0,0 +1,155 @@
+// api/provider.go
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+)
+
+// Ids de sesión del proveedor que se conservan a la vez; al llegar al límite se descartan
+// los caducados y, si no basta, el usado hace más tiempo
+const maxProviderStickies = 10000
+
+// providerSticky es el id de sesión del proveedor asignado a una clave
+type providerSticky struct {
+	id       string
+	session  string
+	proxy    string    // URL del proxy con la plantilla expandida
+	expires  time.Time // Cero sin caducidad
+	lastUsed time.Time
+}
+
+// Ids de sesión del proveedor por sesión|plantilla|identidad, y URLs expandidas en uso
+var (
+	providerStickies = make(map[string]*providerSticky)
+	providerExpanded = make(map[string]struct{})
+	providerMtx      sync.Mutex
+)
+
+// newProviderID devuelve un id de sesión del proveedor aleatorio
+func newProviderID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// expandProvider sustituye los marcadores de la plantilla del proveedor
+func expandProvider(template, session, id string) string {
+	return strings.NewReplacer(config.ProviderIDPlaceholder, id, config.ProviderSessionPlaceholder, url.QueryEscape(session)).Replace(template)
+}
+
+// providerProxy devuelve la URL con la que se contacta al proveedor. Las plantillas con
+// {id} usan el mismo id para las peticiones con la misma identity, que el proveedor
+// atiende con la misma IP, hasta que pasa stage.StickyTTL; sin identity cada petición
+// lleva un id nuevo y, con él, otra IP. El segundo valor indica si la URL es de un solo uso.
+func (s *server) providerProxy(stage config.FallbackStage, req *pb.Request) (string, bool) {
+	template := stage.Provider
+	if !strings.Contains(template, config.ProviderIDPlaceholder) {
+		return expandProvider(template, req.Session, ""), false
+	}
+	if req.Identity == "" {
+		proxyAddr := expandProvider(template, req.Session, newProviderID())
+		providerMtx.Lock()
+		providerExpanded[proxyAddr] = struct{}{}
+		providerMtx.Unlock()
+		return proxyAddr, true
+	}
+
+	key := req.Session + "|" + template + "|" + req.Identity
+	now := time.Now()
+
+	providerMtx.Lock()
+	sticky, ok := providerStickies[key]
+	var rotated string
+	if ok && !sticky.expires.IsZero() && now.After(sticky.expires) {
+		rotated = sticky.proxy
+		delete(providerExpanded, rotated)
+		ok = false
+	}
+	var evicted []*providerSticky
+	if !ok {
+		if len(providerStickies) >= maxProviderStickies {
+			evicted = evictProviderStickies(now)
+		}
+		id := newProviderID()
+		sticky = &providerSticky{id: id, session: req.Session, proxy: expandProvider(template, req.Session, id)}
+		if stage.StickyTTL > 0 {
+			sticky.expires = now.Add(time.Duration(stage.StickyTTL) * time.Second)
+		}
+		providerStickies[key] = sticky
+		providerExpanded[sticky.proxy] = struct{}{}
+	}
+	sticky.lastUsed = now
+	proxyAddr := sticky.proxy
+	providerMtx.Unlock()
+
+	// Los clientes del id anterior y de los descartados ya no volverán a usarse
+	if rotated != "" {
+		s.removeSuccesfulProxy(req.Session, rotated)
+	}
+	for _, old := range evicted {
+		s.removeSuccesfulProxy(old.session, old.proxy)
+	}
+	return proxyAddr, false
+}
+
+// evictProviderStickies descarta los ids caducados o, si no hay ninguno, el usado hace
+// más tiempo. Se llama con providerMtx tomado.
+func evictProviderStickies(now time.Time) []*providerSticky {
+	var evicted []*providerSticky
+	oldestKey := ""
+	var oldest *providerSticky
+	for key, sticky := range providerStickies {
+		if !sticky.expires.IsZero() && now.After(sticky.expires) {
+			evicted = append(evicted, sticky)
+			delete(providerStickies, key)
+			delete(providerExpanded, sticky.proxy)
+			continue
+		}
+		if oldest == nil || sticky.lastUsed.Before(oldest.lastUsed) {
+			oldestKey, oldest = key, sticky
+		}
+	}
+	if len(evicted) == 0 && oldest != nil {
+		evicted = append(evicted, oldest)
+		delete(providerStickies, oldestKey)
+		delete(providerExpanded, oldest.proxy)
+	}
+	return evicted
+}
+
+// releaseProviderProxy descarta el cliente de una URL de un solo uso
+func (s *server) releaseProviderProxy(session, proxyAddr string) {
+	providerMtx.Lock()
+	delete(providerExpanded, proxyAddr)
+	providerMtx.Unlock()
+	s.removeSuccesfulProxy(session, proxyAddr)
+}
+
+// isProviderExpansion indica si el proxy es una plantilla de proveedor expandida, que
+// solo debe usar la identidad a la que se asignó
+func isProviderExpansion(proxyAddr string) bool {
+	providerMtx.Lock()
+	defer providerMtx.Unlock()
+	_, ok := providerExpanded[proxyAddr]
+	return ok
+}
+
+// forgetProviderStickies descarta los ids de sesión del proveedor de una sesión
+func forgetProviderStickies(session string) {
+	providerMtx.Lock()
+	defer providerMtx.Unlock()
+	for key, sticky := range providerStickies {
+		if strings.HasPrefix(key, session+"|") {
+			delete(providerStickies, key)
+			delete(providerExpanded, sticky.proxy)
+		}
+	}
+}
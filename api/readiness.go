@@ -0,0 +1,81 @@
+// api/readiness.go
+package api
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"proxy-api/internal/config"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Servicios que se atienden aunque el pool todavía se esté calentando
+var warmupExemptPrefixes = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.",
+	"/fetch.ProxyService/ImportPool",
+	"/fetch.ProxyService/WatchValidation",
+	"/fetch.ProxyService/SubscribeEvents",
+}
+
+// errPoolWarming construye el error tipado que reciben los clientes mientras
+// la primera validación sigue en curso, con una pista de reintento.
+func errPoolWarming() error {
+	st := status.New(codes.Unavailable, "proxy pool warming up, first validation pass in progress")
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(config.WarmupRetryDelay * time.Second),
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+func isWarmupExempt(fullMethod string) bool {
+	for _, prefix := range warmupExemptPrefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// warming indica si la llamada a fullMethod debe esperar a la primera validación del
+// servidor srv; los servicios que no son del motor, como health, no esperan
+func warming(srv interface{}, fullMethod string) bool {
+	s, ok := srv.(*server)
+	return ok && !s.ready.Load() && !isWarmupExempt(fullMethod)
+}
+
+// readinessInterceptor rechaza las llamadas unarias hasta que el pool esté listo
+func readinessInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if warming(info.Server, info.FullMethod) {
+		return nil, errPoolWarming()
+	}
+	return handler(ctx, req)
+}
+
+// readinessStreamInterceptor rechaza los streams, como Download, Tunnel o
+// StreamPassthrough, hasta que el pool esté listo
+func readinessStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if warming(srv, info.FullMethod) {
+		return errPoolWarming()
+	}
+	return handler(srv, ss)
+}
+
+// markReady marca el pool como listo y lo publica en el servicio de health
+func (s *server) markReady() {
+	if s.ready.Swap(true) {
+		return
+	}
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	s.health.SetServingStatus(serviceName, healthpb.HealthCheckResponse_SERVING)
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadinessStreamInterceptor(t *testing.T) {
+	s := &server{}
+
+	var called bool
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		called = true
+		return nil
+	}
+	err := readinessStreamInterceptor(s, nil, &grpc.StreamServerInfo{FullMethod: "/fetch.ProxyService/Download"}, handler)
+	if status.Code(err) != codes.Unavailable || called {
+		t.Fatalf("Download durante el calentamiento: error %v, handler llamado %v", err, called)
+	}
+	if err := readinessStreamInterceptor(s, nil, &grpc.StreamServerInfo{FullMethod: "/fetch.ProxyService/WatchValidation"}, handler); err != nil || !called {
+		t.Fatalf("WatchValidation durante el calentamiento: error %v, handler llamado %v", err, called)
+	}
+
+	s.ready.Store(true)
+	called = false
+	if err := readinessStreamInterceptor(s, nil, &grpc.StreamServerInfo{FullMethod: "/fetch.ProxyService/Download"}, handler); err != nil || !called {
+		t.Fatalf("Download con el pool listo: error %v, handler llamado %v", err, called)
+	}
+
+	// Cada motor tiene su propio estado: otro servidor sigue calentándose
+	called = false
+	err = readinessStreamInterceptor(&server{}, nil, &grpc.StreamServerInfo{FullMethod: "/fetch.ProxyService/Download"}, handler)
+	if status.Code(err) != codes.Unavailable || called {
+		t.Fatalf("Download en otro motor: error %v, handler llamado %v", err, called)
+	}
+}
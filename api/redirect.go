@@ -0,0 +1,112 @@
+// api/redirect.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/outbound"
+)
+
+// directClient se usa para las peticiones sin proxy
+var directClient = &http.Client{Transport: resumeTLSSessions(guardedTransport()), CheckRedirect: checkRedirect}
+
+// guardedTransport es el transporte directo que solo conecta con destinos permitidos
+func guardedTransport() *http.Transport {
+	transport := outbound.Transport(nil)
+	transport.DialContext = guardedDial(transport.DialContext)
+	return transport
+}
+
+type redirectKey struct{}
+
+// redirectHop es un salto de la cadena de redirecciones
+type redirectHop struct {
+	url    string
+	status int
+}
+
+// redirectTracker aplica la política de redirecciones de una petición y registra la cadena
+type redirectTracker struct {
+	follow          bool
+	maxRedirects    int
+	preserveCookies bool
+
+	mtx     sync.Mutex
+	hops    []redirectHop
+	cookies map[string]*http.Cookie
+}
+
+// withRedirectTracker asocia al contexto la política de redirecciones de la petición
+func withRedirectTracker(ctx context.Context, req *pb.Request) context.Context {
+	maxRedirects := int(req.MaxRedirects)
+	if maxRedirects <= 0 {
+		maxRedirects = config.DefaultMaxRedirects
+	}
+	return context.WithValue(ctx, redirectKey{}, &redirectTracker{
+		follow:          req.Redirect,
+		maxRedirects:    maxRedirects,
+		preserveCookies: req.PreserveCookies,
+		cookies:         make(map[string]*http.Cookie),
+	})
+}
+
+// checkRedirect decide si se sigue una redirección según la política de la petición.
+// Al ser el mismo cliente, los saltos salen siempre por el mismo proxy.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	tracker, ok := req.Context().Value(redirectKey{}).(*redirectTracker)
+	if !ok || !tracker.follow {
+		return http.ErrUseLastResponse
+	}
+
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+
+	if req.Response != nil {
+		tracker.hops = append(tracker.hops, redirectHop{
+			url:    via[len(via)-1].URL.String(),
+			status: req.Response.StatusCode,
+		})
+	}
+	if len(via) > tracker.maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", tracker.maxRedirects)
+	}
+	// Un destino permitido no puede redirigir a uno prohibido, tampoco a través de un proxy
+	if err := checkTarget(req.Context(), req.URL.String()); err != nil {
+		return err
+	}
+
+	if tracker.preserveCookies {
+		for _, prev := range via {
+			for _, cookie := range prev.Cookies() {
+				tracker.cookies[cookie.Name] = cookie
+			}
+		}
+		if req.Response != nil {
+			for _, cookie := range req.Response.Cookies() {
+				tracker.cookies[cookie.Name] = cookie
+			}
+		}
+		for _, cookie := range tracker.cookies {
+			if _, err := req.Cookie(cookie.Name); err != nil {
+				req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+			}
+		}
+	}
+	return nil
+}
+
+// redirectChain devuelve los saltos seguidos por la petición
+func redirectChain(reqObj *http.Request) []redirectHop {
+	tracker, ok := reqObj.Context().Value(redirectKey{}).(*redirectTracker)
+	if !ok {
+		return nil
+	}
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+	return append([]redirectHop(nil), tracker.hops...)
+}
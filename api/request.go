@@ -0,0 +1,176 @@
+// api/request.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/script"
+)
+
+// hasMultipartBody indica si la petición lleva un formulario multipart
+func hasMultipartBody(req *pb.Request) bool {
+	return len(req.FormFields) > 0 || len(req.Files) > 0
+}
+
+// encodeMultipart codifica los campos y ficheros de la petición como multipart/form-data
+func encodeMultipart(req *pb.Request) ([]byte, string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for _, field := range req.FormFields {
+		if err := writer.WriteField(field.Name, field.Value); err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, file := range req.Files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(file.Field), escapeQuotes(file.Filename)))
+		header.Set("Content-Type", contentType)
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(file.Content); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+func escapeQuotes(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// newTargetRequest construye la petición HTTP hacia el destino con las cabeceras de la
+// sesión; las directas (proxyAddr directProxy) llevan además las de DirectIdentity
+func newTargetRequest(ctx context.Context, req *pb.Request, proxyAddr, userAgent string) (*http.Request, error) {
+	method := req.Method
+	var body io.Reader
+	var contentType string
+
+	if hasMultipartBody(req) {
+		data, ct, err := encodeMultipart(req)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+		contentType = ct
+		if method == "" {
+			method = http.MethodPost
+		}
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	reqObj, err := http.NewRequestWithContext(withRedirectTracker(ctx, req), method, req.Url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sin keep-alive para destinos que marcan las conexiones de larga duración
+	if session, _ := config.GetSession(req.Session); session.CloseConnections {
+		reqObj.Close = true
+	}
+	reqObj.Header.Set("User-Agent", userAgent)
+	for k, v := range config.GetHeadersFromSession(req.Session) {
+		reqObj.Header.Set(k, v)
+	}
+	if proxyAddr == directProxy {
+		session, _ := config.GetSession(req.Session)
+		for k, v := range session.DirectIdentity.Headers {
+			reqObj.Header.Set(k, v)
+		}
+	}
+	applyLocale(reqObj.Header, req.Session, userAgent)
+	manageAcceptEncoding(reqObj.Header, req.Session)
+	if id := requestIDFrom(ctx); id != "" && config.RequestIDHeader != "" {
+		reqObj.Header.Set(config.RequestIDHeader, id)
+	}
+	if contentType != "" {
+		reqObj.Header.Set("Content-Type", contentType)
+	}
+	if req.IfNoneMatch != "" {
+		reqObj.Header.Set("If-None-Match", req.IfNoneMatch)
+	}
+	if req.IfModifiedSince != "" {
+		reqObj.Header.Set("If-Modified-Since", req.IfModifiedSince)
+	}
+	if req.Range != "" {
+		reqObj.Header.Set("Range", req.Range)
+	}
+
+	applyCaptchaSolution(ctx, reqObj)
+
+	if cfg, _ := config.GetSession(req.Session); cfg.Rewrite != "" {
+		if err := script.Rewrite(cfg.Rewrite, reqObj); err != nil {
+			return nil, fmt.Errorf("rewrite script for session '%s' failed: %w", req.Session, err)
+		}
+	}
+	return reqObj, nil
+}
+
+// UploadContent - Recibe la petición y el contenido de sus ficheros en trozos y la ejecuta como FetchContent
+func (s *server) UploadContent(stream pb.ProxyService_UploadContentServer) error {
+	var req *pb.Request
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if chunk.Request != nil {
+			if req != nil {
+				return fmt.Errorf("request already received")
+			}
+			req = chunk.Request
+			continue
+		}
+		if req == nil {
+			return fmt.Errorf("first chunk must contain the request")
+		}
+		if chunk.FileIndex < 0 || int(chunk.FileIndex) >= len(req.Files) {
+			return fmt.Errorf("file index %d out of range", chunk.FileIndex)
+		}
+		file := req.Files[chunk.FileIndex]
+		file.Content = append(file.Content, chunk.Data...)
+	}
+	if req == nil {
+		return fmt.Errorf("no request received")
+	}
+
+	resp, err := s.FetchContent(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
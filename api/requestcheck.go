@@ -0,0 +1,187 @@
+// api/requestcheck.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/compress"
+	"proxy-api/internal/config"
+
+	"golang.org/x/net/http/httpguts"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// requestViolations devuelve los problemas de una petición, con el campo como prefix
+func requestViolations(prefix string, req *pb.Request) []*errdetails.BadRequest_FieldViolation {
+	var violations []*errdetails.BadRequest_FieldViolation
+	fail := func(field, format string, args ...interface{}) {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       prefix + field,
+			Description: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if req.Url == "" {
+		fail("url", "url is required")
+	} else if u, err := url.Parse(req.Url); err != nil {
+		fail("url", "url does not parse: %v", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		fail("url", "scheme must be http or https, got '%s'", u.Scheme)
+	} else if u.Hostname() == "" {
+		fail("url", "url has no host")
+	}
+	if req.Session == "" {
+		fail("session", "session is required")
+	}
+
+	if req.Method != "" {
+		if !httpguts.ValidHeaderFieldName(req.Method) {
+			fail("method", "malformed method %q", req.Method)
+		} else if !methodAllowed(req.Method) {
+			fail("method", "method '%s' is not in ALLOWED_METHODS", req.Method)
+		}
+	}
+	for _, header := range []struct{ field, value string }{
+		{"user_agent", req.UserAgent},
+		{"if_none_match", req.IfNoneMatch},
+		{"if_modified_since", req.IfModifiedSince},
+		{"range", req.Range},
+	} {
+		if !httpguts.ValidHeaderFieldValue(header.value) {
+			fail(header.field, "value is not a legal header value")
+		}
+	}
+	if req.IfModifiedSince != "" {
+		if _, err := http.ParseTime(req.IfModifiedSince); err != nil {
+			fail("if_modified_since", "expected an HTTP date, got '%s'", req.IfModifiedSince)
+		}
+	}
+	if req.Range != "" && !strings.HasPrefix(req.Range, "bytes=") {
+		fail("range", "only byte ranges are supported, got '%s'", req.Range)
+	}
+
+	for i, f := range req.FormFields {
+		if f.Name == "" {
+			fail(fmt.Sprintf("form_fields[%d].name", i), "form field name is required")
+		}
+	}
+	for i, f := range req.Files {
+		if f.Field == "" {
+			fail(fmt.Sprintf("files[%d].field", i), "file field name is required")
+		}
+		if f.ContentType != "" {
+			if _, _, err := mime.ParseMediaType(f.ContentType); err != nil {
+				fail(fmt.Sprintf("files[%d].content_type", i), "malformed content type '%s'", f.ContentType)
+			}
+		}
+	}
+
+	if req.MaxRedirects < 0 {
+		fail("max_redirects", "cannot be negative, got %d", req.MaxRedirects)
+	}
+	if req.MaxBodyBytes < 0 {
+		fail("max_body_bytes", "cannot be negative, got %d", req.MaxBodyBytes)
+	}
+	if req.MaxProxyAgeS < 0 {
+		fail("max_proxy_age_s", "cannot be negative, got %d", req.MaxProxyAgeS)
+	}
+	if req.ContentEncoding != "" && !compress.Supported(req.ContentEncoding) {
+		fail("content_encoding", "unsupported content encoding '%s'", req.ContentEncoding)
+	}
+	if req.WebhookUrl != "" {
+		if err := validWebhookURL(req.WebhookUrl); err != nil {
+			fail("webhook_url", "%v", err)
+		}
+	}
+	return violations
+}
+
+// methodAllowed indica si el método está en ALLOWED_METHODS
+func methodAllowed(method string) bool {
+	for _, allowed := range strings.Split(config.AllowedMethods, ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), method) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectViolations recorre el mensaje y los anidados (las peticiones de un lote, la de
+// una petición programada o de una subida) y valida cada pb.Request
+func collectViolations(prefix string, m protoreflect.Message) []*errdetails.BadRequest_FieldViolation {
+	if req, ok := m.Interface().(*pb.Request); ok {
+		return requestViolations(prefix, req)
+	}
+	var violations []*errdetails.BadRequest_FieldViolation
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Kind() == protoreflect.MessageKind && fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				violations = append(violations, collectViolations(fmt.Sprintf("%s%s[%d].", prefix, fd.Name(), i), list.Get(i).Message())...)
+			}
+		case fd.Kind() == protoreflect.MessageKind && !fd.IsMap():
+			violations = append(violations, collectViolations(prefix+string(fd.Name())+".", v.Message())...)
+		}
+		return true
+	})
+	return violations
+}
+
+// validateMessage devuelve InvalidArgument con el detalle BadRequest si alguna petición
+// del mensaje no es válida
+func validateMessage(msg interface{}) error {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil
+	}
+	violations := collectViolations("", m.ProtoReflect())
+	if len(violations) == 0 {
+		return nil
+	}
+	descriptions := make([]string, len(violations))
+	for i, v := range violations {
+		descriptions[i] = v.Field + ": " + v.Description
+	}
+	st := status.New(codes.InvalidArgument, "invalid request: "+strings.Join(descriptions, "; "))
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// validationInterceptor rechaza las peticiones mal formadas antes de llegar al servidor
+func validationInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := validateMessage(req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// validationStream valida cada mensaje recibido por el stream
+type validationStream struct {
+	grpc.ServerStream
+}
+
+func (s *validationStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validateMessage(m)
+}
+
+func validationStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &validationStream{ServerStream: ss})
+}
@@ -0,0 +1,65 @@
+// api/requestid.go
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDHeader es la clave de metadata con la que el cliente envía el id de la
+// petición y con la que el servidor lo devuelve
+const requestIDHeader = "x-request-id"
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// withRequestID asigna a la llamada el id de petición recibido en la metadata
+// x-request-id o uno nuevo, y lo devuelve al cliente en la cabecera de respuesta. Si la
+// llamada ya tiene id lo conserva.
+func withRequestID(ctx context.Context) context.Context {
+	if requestIDFrom(ctx) != "" {
+		return ctx
+	}
+	id := incomingRequestID(ctx)
+	if id == "" {
+		id = newRequestID()
+	}
+	// Falla fuera de una llamada gRPC, como en los trabajos asíncronos, donde no hay a quién devolverlo
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id))
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFrom devuelve el id de petición de la llamada, vacío si no tiene
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// incomingRequestID devuelve el id enviado por el cliente si es válido como valor de cabecera
+func incomingRequestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	ids := md.Get(requestIDHeader)
+	if len(ids) == 0 || ids[0] == "" || len(ids[0]) > maxRequestIDLength {
+		return ""
+	}
+	for _, c := range ids[0] {
+		if c < 0x21 || c > 0x7e {
+			return ""
+		}
+	}
+	return ids[0]
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
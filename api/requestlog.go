@@ -0,0 +1,94 @@
+// api/requestlog.go
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"proxy-api/internal/config"
+)
+
+type requestLogKey struct{}
+
+// withRequestLog decide si se registra la petición de la sesión. La decisión se toma
+// una sola vez por petición, de modo que sus eventos se registran todos o ninguno.
+func withRequestLog(ctx context.Context, session string) context.Context {
+	if _, ok := ctx.Value(requestLogKey{}).(bool); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, requestLogKey{}, sampleRequest(session))
+}
+
+// sampleRequest sortea si se registra una petición según el porcentaje de la sesión
+func sampleRequest(session string) bool {
+	percent := config.RequestLogSamplePercent
+	if cfg, ok := config.GetSession(session); ok && cfg.LogSamplePercent != nil {
+		percent = *cfg.LogSamplePercent
+	}
+	return percent >= 100 || rand.Intn(100) < percent
+}
+
+// requestLog registra un evento de la petición con sus campos, pares de clave y valor.
+// Se escribe si la petición salió en el muestreo o si err no es nil y REQUEST_LOG_ERRORS
+// está activo; las peticiones sin decisión previa se sortean con el porcentaje global.
+func requestLog(ctx context.Context, msg string, err error, fields ...interface{}) {
+	if config.RequestLog == "off" {
+		return
+	}
+	sampled, ok := ctx.Value(requestLogKey{}).(bool)
+	if !ok {
+		sampled = sampleRequest("")
+	}
+	if !sampled && (err == nil || !config.RequestLogErrors) {
+		return
+	}
+	if id := requestIDFrom(ctx); id != "" {
+		fields = append([]interface{}{"request_id", id}, fields...)
+	}
+	if err != nil {
+		fields = append(fields, "error", err.Error())
+	}
+	// Las URLs de los proveedores llevan sus credenciales
+	for i := 0; i+1 < len(fields); i += 2 {
+		if proxyAddr, ok := fields[i+1].(string); ok && fields[i] == "proxy" {
+			fields[i+1] = config.RedactURL(proxyAddr)
+		}
+	}
+
+	if config.RequestLog == "json" {
+		entry := map[string]interface{}{"time": time.Now().Format(time.RFC3339Nano), "msg": msg}
+		for i := 0; i+1 < len(fields); i += 2 {
+			entry[fmt.Sprint(fields[i])] = logValue(fields[i+1])
+		}
+		line, jsonErr := json.Marshal(entry)
+		if jsonErr != nil {
+			return
+		}
+		log.Writer().Write(append(line, '\n'))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(fields); i += 2 {
+		value := fmt.Sprint(logValue(fields[i+1]))
+		if value == "" || strings.ContainsAny(value, " \"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&b, " %v=%s", fields[i], value)
+	}
+	log.Print(b.String())
+}
+
+// logValue expresa las duraciones en milisegundos para que los registros sean comparables
+func logValue(v interface{}) interface{} {
+	if d, ok := v.(time.Duration); ok {
+		return d.Milliseconds()
+	}
+	return v
+}
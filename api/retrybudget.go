@@ -0,0 +1,138 @@
+// api/retrybudget.go
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type attemptsKey struct{}
+
+var errAttemptDenied = errors.New("attempt denied by retry budget")
+
+// requestAttempts cuenta los intentos de una petición; el primero no consume presupuesto
+type requestAttempts struct {
+	count  atomic.Int32
+	denied atomic.Bool
+	busy   atomic.Int32 // Intentos no lanzados por estar el proxy ocupado
+	budget *retryBudget // Presupuesto del servidor que atiende la petición
+}
+
+// retryBudget limita los reintentos de todo el servidor a un porcentaje de las
+// peticiones, con un mínimo por segundo para que el tráfico bajo pueda reintentar.
+type retryBudget struct {
+	mtx      sync.Mutex
+	tokens   float64
+	last     time.Time
+	requests int64
+	retries  int64
+	denied   int64
+}
+
+func newRetryBudget() *retryBudget {
+	return &retryBudget{tokens: budgetCapacity()}
+}
+
+// budgetCapacity es el máximo de reintentos acumulables
+func budgetCapacity() float64 {
+	return math.Max(float64(config.RetryBudgetMinPerSecond*config.RetryBudgetWindow), 1)
+}
+
+// refill suma la reserva mínima del tiempo transcurrido; debe llamarse con mtx tomado
+func (b *retryBudget) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * float64(config.RetryBudgetMinPerSecond)
+	}
+	b.last = now
+	b.tokens = math.Min(b.tokens, budgetCapacity())
+}
+
+// deposit registra una petición nueva, que aporta su porcentaje de reintentos
+func (b *retryBudget) deposit() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.refill(time.Now())
+	b.requests++
+	b.tokens = math.Min(b.tokens+float64(config.RetryBudgetPercent)/100, budgetCapacity())
+}
+
+// withdraw consume un reintento; devuelve false si el presupuesto está agotado
+func (b *retryBudget) withdraw() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if config.RetryBudgetPercent > 0 {
+		b.refill(time.Now())
+		if b.tokens < 1 {
+			b.denied++
+			return false
+		}
+		b.tokens--
+	}
+	b.retries++
+	return true
+}
+
+func (b *retryBudget) stats() *pb.RetryBudgetStats {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.refill(time.Now())
+	return &pb.RetryBudgetStats{
+		Requests:  b.requests,
+		Retries:   b.retries,
+		Denied:    b.denied,
+		Available: int64(b.tokens),
+	}
+}
+
+// withAttempts inicia el recuento de intentos de una petición con cargo a budget
+func withAttempts(ctx context.Context, budget *retryBudget) context.Context {
+	budget.deposit()
+	return context.WithValue(ctx, attemptsKey{}, &requestAttempts{budget: budget})
+}
+
+// allowAttempt decide si se puede lanzar otro intento de la petición del contexto
+func allowAttempt(ctx context.Context) bool {
+	attempts, ok := ctx.Value(attemptsKey{}).(*requestAttempts)
+	if !ok || attempts.count.Add(1) == 1 {
+		return true
+	}
+	if attempts.budget.withdraw() {
+		return true
+	}
+	attempts.denied.Store(true)
+	return false
+}
+
+// budgetDenied indica si a la petición del contexto se le negó algún reintento
+func budgetDenied(ctx context.Context) bool {
+	attempts, ok := ctx.Value(attemptsKey{}).(*requestAttempts)
+	return ok && attempts.denied.Load()
+}
+
+// errRetryBudget devuelve el error de una petición que falló sin poder agotar sus
+// intentos, con el detalle de la cuota para que el cliente pueda distinguirlo.
+func errRetryBudget(cause error) error {
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("retry budget exhausted: %v", cause))
+	detailed, err := st.WithDetails(&errdetails.QuotaFailure{
+		Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     "retry_budget",
+			Description: fmt.Sprintf("retries are limited to %d%% of requests", config.RetryBudgetPercent),
+		}},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,90 @@
+// api/rules.go
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/rules"
+)
+
+// checkResponse comprueba el tipo de contenido y aplica la regla de validación de la
+// sesión a la respuesta
+func checkResponse(session string, resp *http.Response, body []byte) string {
+	cfg, _ := config.GetSession(session)
+	if len(cfg.ContentTypes) > 0 && resp.StatusCode >= 200 && resp.StatusCode < 300 && len(body) > 0 {
+		contentType := sniffContentType(resp.Header.Get("Content-Type"), body)
+		if !acceptedContentType(cfg.ContentTypes, contentType) {
+			log.Printf("Tipo de contenido %s no aceptado para %s", contentType, session)
+			return rules.Retry
+		}
+	}
+	if cfg.Validation == "" {
+		return rules.Valid
+	}
+
+	headers := make(map[string]string, len(resp.Header))
+	for name, values := range resp.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+	content := string(body)
+
+	verdict, err := rules.Evaluate(cfg.Validation, rules.Input{
+		Status:     resp.StatusCode,
+		Headers:    headers,
+		Body:       content,
+		NilContent: IsNilContent(content),
+	})
+	if err != nil {
+		// Una regla que falla no debe bloquear la sesión
+		log.Printf("Error al evaluar la regla de validación de %s: %v", session, err)
+		return rules.Valid
+	}
+	return verdict
+}
+
+// sniffContentType deduce el tipo MIME de la respuesta. La cabecera manda salvo que
+// el cuerpo la contradiga: HTML o XML con una cabecera de otro tipo, o JSON inválido
+// con una cabecera JSON, que es lo que dejan los proxies que inyectan páginas.
+func sniffContentType(header string, body []byte) string {
+	declared, _, _ := mime.ParseMediaType(header)
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(body))
+
+	markup := sniffed == "text/html" || sniffed == "text/xml"
+	switch {
+	case declared == "":
+		if !markup && json.Valid(body) {
+			return "application/json"
+		}
+		return sniffed
+	case markup && !strings.Contains(declared, "html") && !strings.Contains(declared, "xml"):
+		return sniffed
+	case strings.Contains(declared, "json") && !json.Valid(body):
+		return sniffed
+	}
+	return declared
+}
+
+// acceptedContentType indica si el tipo está entre los aceptados, admitiendo "tipo/*"
+func acceptedContentType(accepted []string, contentType string) bool {
+	for _, candidate := range accepted {
+		candidate, _, _ = mime.ParseMediaType(candidate)
+		if candidate == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(candidate, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// errRejected es el error de un intento cuya respuesta descartó la regla de la sesión
+func errRejected(verdict string, status int) error {
+	return fmt.Errorf("response rejected by session validation (%s, status %d)", verdict, status)
+}
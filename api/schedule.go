@@ -0,0 +1,272 @@
+// api/schedule.go
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// scheduledFetch es una petición que el servidor repite cada interval
+type scheduledFetch struct {
+	id       string
+	req      *pb.Request
+	interval time.Duration
+	webhook  string
+	tenant   string // Tenant que la creó, vacío sin tenants
+	created  time.Time
+	cancel   context.CancelFunc
+
+	mtx      sync.Mutex
+	lastRun  time.Time
+	runs     int64
+	failures int64
+}
+
+// newJobID genera un identificador aleatorio para trabajos del servidor
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (f *scheduledFetch) info() *pb.ScheduledFetch {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	info := &pb.ScheduledFetch{
+		Id:         f.id,
+		Request:    f.req,
+		IntervalMs: f.interval.Milliseconds(),
+		WebhookUrl: f.webhook,
+		Created:    f.created.UnixMilli(),
+		Runs:       f.runs,
+		Failures:   f.failures,
+	}
+	if !f.lastRun.IsZero() {
+		info.LastRun = f.lastRun.UnixMilli()
+	}
+	return info
+}
+
+// runScheduledFetch ejecuta la petición en cada tick hasta que se cancele o se pare el
+// motor. Cada ejecución se cobra al tenant que la creó.
+func (s *server) runScheduledFetch(ctx context.Context, f *scheduledFetch) {
+	// Sin tenants, las peticiones programadas se identifican en la auditoría por su id
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-client-id", "schedule/"+f.id))
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		resp, err := s.fetchForTenant(ctx, proto.Clone(f.req).(*pb.Request), 1)
+		if ctx.Err() != nil {
+			return
+		}
+
+		f.mtx.Lock()
+		f.lastRun = time.Now()
+		f.runs++
+		if err != nil {
+			f.failures++
+		}
+		f.mtx.Unlock()
+
+		result := &pb.ScheduledResult{Id: f.id, Response: resp, Timestamp: time.Now().UnixMilli()}
+		if err != nil {
+			log.Printf("Petición programada %s fallida: %v", f.id, err)
+			result.Error = err.Error()
+		}
+		s.publishResult(result)
+		if f.webhook != "" && !s.enqueueAsync(func() { deliverWebhook(s.background(), f.webhook, result) }) {
+			log.Printf("Petición programada %s: cola asíncrona llena, resultado no enviado al webhook", f.id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishResult envía el resultado sin bloquear; los suscriptores lentos pierden resultados
+func (s *server) publishResult(result *pb.ScheduledResult) {
+	s.resultSubsMtx.Lock()
+	defer s.resultSubsMtx.Unlock()
+	for ch, ids := range s.resultSubscribers {
+		if ids != nil && !ids[result.Id] {
+			continue
+		}
+		select {
+		case ch <- result:
+		default:
+		}
+	}
+}
+
+// CreateScheduledFetch - Programa una petición que el servidor repite cada interval_ms
+func (s *server) CreateScheduledFetch(ctx context.Context, req *pb.ScheduledFetchRequest) (*pb.ScheduledFetch, error) {
+	if req.Request == nil || req.Request.Url == "" {
+		return nil, status.Error(codes.InvalidArgument, "request with url is required")
+	}
+	if _, exists := config.GetSession(req.Request.Session); !exists {
+		return nil, status.Errorf(codes.InvalidArgument, "session '%s' not found in configuration", req.Request.Session)
+	}
+	if req.IntervalMs < config.MinScheduleInterval {
+		return nil, status.Errorf(codes.InvalidArgument, "interval must be at least %d ms", config.MinScheduleInterval)
+	}
+	if req.WebhookUrl != "" {
+		if err := validWebhookURL(req.WebhookUrl); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	// El trabajo sobrevive a la llamada pero conserva su tenant, su clave y su ámbito, y
+	// termina al parar el motor
+	jobCtx, cancel := context.WithCancel(detachTenant(s.background(), ctx))
+	f := &scheduledFetch{
+		id:       newJobID(),
+		req:      proto.Clone(req.Request).(*pb.Request),
+		interval: time.Duration(req.IntervalMs) * time.Millisecond,
+		webhook:  req.WebhookUrl,
+		created:  time.Now(),
+		cancel:   cancel,
+	}
+	tenant := tenantFrom(ctx)
+	if tenant != nil {
+		f.tenant = tenant.Name
+	}
+
+	s.scheduleMtx.Lock()
+	if tenant != nil && !tenant.Admin && config.TenantMaxSchedules > 0 && s.countSchedules(tenant.Name) >= config.TenantMaxSchedules {
+		s.scheduleMtx.Unlock()
+		cancel()
+		return nil, status.Errorf(codes.ResourceExhausted, "tenant '%s' already has %d scheduled fetches", tenant.Name, config.TenantMaxSchedules)
+	}
+	s.schedules[f.id] = f
+	s.scheduleMtx.Unlock()
+
+	log.Printf("Petición programada %s: %s cada %v", f.id, f.req.Url, f.interval)
+	go func() {
+		s.runScheduledFetch(jobCtx, f)
+		// Al parar el motor la petición deja de estar activa
+		s.scheduleMtx.Lock()
+		if s.schedules[f.id] == f {
+			delete(s.schedules, f.id)
+		}
+		s.scheduleMtx.Unlock()
+	}()
+	return f.info(), nil
+}
+
+// countSchedules devuelve las peticiones programadas activas del tenant; debe llamarse
+// con scheduleMtx
+func (s *server) countSchedules(tenant string) int {
+	n := 0
+	for _, f := range s.schedules {
+		if f.tenant == tenant {
+			n++
+		}
+	}
+	return n
+}
+
+// CancelScheduledFetch - Detiene una petición programada y devuelve su último estado
+func (s *server) CancelScheduledFetch(ctx context.Context, req *pb.ScheduledFetchId) (*pb.ScheduledFetch, error) {
+	s.scheduleMtx.Lock()
+	f, ok := s.schedules[req.Id]
+	if ok && !tenantCanSee(ctx, f.req.Session) {
+		ok = false
+	}
+	if ok {
+		delete(s.schedules, req.Id)
+	}
+	s.scheduleMtx.Unlock()
+
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "scheduled fetch '%s' not found", req.Id)
+	}
+	f.cancel()
+	return f.info(), nil
+}
+
+// scheduleVisible indica si el tenant de la llamada puede ver la petición programada id
+func (s *server) scheduleVisible(ctx context.Context, id string) bool {
+	if tenant := tenantFrom(ctx); tenant == nil || tenant.Admin {
+		return true
+	}
+	s.scheduleMtx.Lock()
+	f, ok := s.schedules[id]
+	s.scheduleMtx.Unlock()
+	return ok && tenantCanSee(ctx, f.req.Session)
+}
+
+// ListScheduledFetches - Devuelve las peticiones programadas activas, de la más antigua a la más reciente
+func (s *server) ListScheduledFetches(ctx context.Context, req *pb.ListScheduledFetchesRequest) (*pb.ScheduledFetchList, error) {
+	s.scheduleMtx.Lock()
+	fetches := make([]*scheduledFetch, 0, len(s.schedules))
+	for _, f := range s.schedules {
+		if tenantCanSee(ctx, f.req.Session) {
+			fetches = append(fetches, f)
+		}
+	}
+	s.scheduleMtx.Unlock()
+
+	sort.Slice(fetches, func(i, j int) bool {
+		return fetches[i].created.Before(fetches[j].created)
+	})
+
+	list := &pb.ScheduledFetchList{}
+	for _, f := range fetches {
+		list.Fetches = append(list.Fetches, f.info())
+	}
+	return list, nil
+}
+
+// SubscribeResults - Emite los resultados de las peticiones programadas hasta que el cliente cancele
+func (s *server) SubscribeResults(req *pb.SubscribeResultsRequest, stream pb.ProxyService_SubscribeResultsServer) error {
+	var ids map[string]bool
+	if len(req.Ids) > 0 {
+		ids = make(map[string]bool, len(req.Ids))
+		for _, id := range req.Ids {
+			ids[id] = true
+		}
+	}
+
+	ch := make(chan *pb.ScheduledResult, 64)
+	s.resultSubsMtx.Lock()
+	s.resultSubscribers[ch] = ids
+	s.resultSubsMtx.Unlock()
+	defer func() {
+		s.resultSubsMtx.Lock()
+		delete(s.resultSubscribers, ch)
+		s.resultSubsMtx.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case result := <-ch:
+			// Un tenant solo recibe los resultados de sus peticiones programadas, pida o no ids
+			if !s.scheduleVisible(stream.Context(), result.Id) {
+				continue
+			}
+			if err := stream.Send(result); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// api/scheduler.go
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errNoProxies = errors.New("no proxies to attempt")
+
+type attemptResult struct {
+	result *fetchResult
+	err    error
+}
+
+// attemptFunc realiza un intento de petición a través de proxyAddr
+type attemptFunc func(ctx context.Context, proxyAddr string) (*fetchResult, error)
+
+// startAttempt ejecuta un intento y envía su resultado a results. Si la petición se
+// cancela nadie lee ya el canal: el resultado se descarta en lugar de esperar.
+func startAttempt(ctx context.Context, proxyAddr string, attempt attemptFunc, results chan<- attemptResult) {
+	send := func(r attemptResult) {
+		select {
+		case results <- r:
+		case <-ctx.Done():
+		}
+	}
+	// Un panic en un intento no debe tumbar el servidor
+	defer func() {
+		if r := recover(); r != nil {
+			send(attemptResult{err: panicError("attempt via "+proxyAddr, r)})
+		}
+	}()
+	result, err := attempt(ctx, proxyAddr)
+	send(attemptResult{result: result, err: err})
+}
+
+// raceAttempts lanza un intento por proxy en paralelo y devuelve el primero exitoso, o
+// el primer error que detiene la cadena (stopsChain). Al volver cancela los intentos restantes, que abortan su lectura y descartan su
+// resultado, de modo que ninguna goroutine sobrevive a la petición.
+func raceAttempts(ctx context.Context, proxies []string, attempt attemptFunc) (*fetchResult, error) {
+	if len(proxies) == 0 {
+		return nil, errNoProxies
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, len(proxies))
+	for _, proxyAddr := range proxies {
+		go startAttempt(ctx, proxyAddr, attempt, results)
+	}
+
+	var lastErr error
+	for range proxies {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				return r.result, nil
+			}
+			if stopsChain(r.err) {
+				return nil, r.err
+			}
+			lastErr = r.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, lastErr
+}
+
+// sequentialAttempts prueba los proxies de uno en uno y espera entre intentos,
+// duplicando la espera cada vez, hasta que uno responde o falla con un error que
+// detiene la cadena.
+func sequentialAttempts(ctx context.Context, proxies []string, backoff time.Duration, attempt attemptFunc) (*fetchResult, error) {
+	if len(proxies) == 0 {
+		return nil, errNoProxies
+	}
+
+	var lastErr error
+	for i, proxyAddr := range proxies {
+		if i > 0 && backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			backoff *= 2
+		}
+		result, err := attempt(ctx, proxyAddr)
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if stopsChain(err) {
+			return nil, err
+		}
+		// Sin presupuesto no tiene sentido seguir esperando a los siguientes proxies
+		if errors.Is(err, errAttemptDenied) && lastErr != nil {
+			return nil, lastErr
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// hedgedAttempts lanza el intento por el primer proxy y solo añade el siguiente si
+// pasa delay sin respuesta o si un intento falla. Devuelve el primero exitoso, o el
+// primer error que detiene la cadena, y cancela el resto, de modo que el destino recibe una petición en el caso habitual.
+func hedgedAttempts(ctx context.Context, proxies []string, delay time.Duration, attempt attemptFunc) (*fetchResult, error) {
+	if len(proxies) == 0 {
+		return nil, errNoProxies
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, len(proxies))
+	next, pending := 0, 0
+	launch := func() {
+		go startAttempt(ctx, proxies[next], attempt, results)
+		next++
+		pending++
+	}
+
+	launch()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.result, nil
+			}
+			if stopsChain(r.err) {
+				return nil, r.err
+			}
+			lastErr = r.err
+			// Sin presupuesto, los siguientes intentos también se negarían
+			if errors.Is(r.err, errAttemptDenied) {
+				next = len(proxies)
+			}
+			if next < len(proxies) {
+				launch()
+				timer.Reset(delay)
+			}
+		case <-timer.C:
+			if next < len(proxies) {
+				launch()
+				timer.Reset(delay)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, lastErr
+}
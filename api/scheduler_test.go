@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/pool"
+
+	"go.uber.org/goleak"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// stalledAttempt no responde hasta que se cancela su contexto, como un proxy colgado
+func stalledAttempt(ctx context.Context, proxyAddr string) (*fetchResult, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestAttemptsDoNotLeak comprueba que al volver raceAttempts y hedgedAttempts no queda
+// ningún intento en curso, tanto si uno responde como si se cancela la petición
+func TestAttemptsDoNotLeak(t *testing.T) {
+	strategies := map[string]func(ctx context.Context, proxies []string, attempt attemptFunc) (*fetchResult, error){
+		"race": raceAttempts,
+		"hedged": func(ctx context.Context, proxies []string, attempt attemptFunc) (*fetchResult, error) {
+			return hedgedAttempts(ctx, proxies, time.Millisecond, attempt)
+		},
+	}
+	proxies := []string{"stalled-1", "stalled-2", "fast", "stalled-3"}
+
+	for name, run := range strategies {
+		t.Run(name+"/uno responde", func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+			result, err := run(context.Background(), proxies, func(ctx context.Context, proxyAddr string) (*fetchResult, error) {
+				if proxyAddr == "fast" {
+					return &fetchResult{proxy: proxyAddr}, nil
+				}
+				return stalledAttempt(ctx, proxyAddr)
+			})
+			if err != nil || result.proxy != "fast" {
+				t.Fatalf("resultado %+v, error %v", result, err)
+			}
+		})
+
+		t.Run(name+"/cancelada", func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if _, err := run(ctx, proxies, stalledAttempt); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("error %v, se esperaba %v", err, context.DeadlineExceeded)
+			}
+		})
+
+		t.Run(name+"/todos fallan", func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+			failure := errors.New("proxy caído")
+			_, err := run(context.Background(), proxies, func(ctx context.Context, proxyAddr string) (*fetchResult, error) {
+				return nil, failure
+			})
+			if !errors.Is(err, failure) {
+				t.Fatalf("error %v, se esperaba %v", err, failure)
+			}
+		})
+
+		t.Run(name+"/panic", func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+			_, err := run(context.Background(), proxies, func(ctx context.Context, proxyAddr string) (*fetchResult, error) {
+				panic("intento roto")
+			})
+			if err == nil {
+				t.Fatal("el panic del intento no se convirtió en error")
+			}
+		})
+	}
+}
+
+// TestAttemptsStopOnBodyTooLarge comprueba que una respuesta por encima del límite no
+// se repite con el resto de proxies
+func TestAttemptsStopOnBodyTooLarge(t *testing.T) {
+	strategies := map[string]func(ctx context.Context, proxies []string, attempt attemptFunc) (*fetchResult, error){
+		"race": raceAttempts,
+		"hedged": func(ctx context.Context, proxies []string, attempt attemptFunc) (*fetchResult, error) {
+			return hedgedAttempts(ctx, proxies, time.Hour, attempt)
+		},
+		"sequential": func(ctx context.Context, proxies []string, attempt attemptFunc) (*fetchResult, error) {
+			return sequentialAttempts(ctx, proxies, 0, attempt)
+		},
+	}
+
+	for name, run := range strategies {
+		t.Run(name, func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+			var attempts atomic.Int32
+			_, err := run(context.Background(), []string{"large", "stalled-1", "stalled-2"}, func(ctx context.Context, proxyAddr string) (*fetchResult, error) {
+				attempts.Add(1)
+				if proxyAddr == "large" {
+					return nil, errBodyTooLarge{limit: 10}
+				}
+				return stalledAttempt(ctx, proxyAddr)
+			})
+			if !stopsChain(err) || status.Code(err) != codes.FailedPrecondition {
+				t.Fatalf("error %v, se esperaba errBodyTooLarge", err)
+			}
+			if name != "race" && attempts.Load() != 1 {
+				t.Fatalf("%d intentos, se esperaba uno", attempts.Load())
+			}
+		})
+	}
+}
+
+// TestCachedClientsConcurrentAccess reproduce el patrón de FetchContent: intentos en
+// paralelo que crean y retiran los clientes de sus proxies mientras otras peticiones
+// recorren los de la sesión. Con -race detecta cualquier acceso al mapa sin el mutex.
+func TestCachedClientsConcurrentAccess(t *testing.T) {
+	const session = "test/race"
+	config.SetSession(config.ProxySession{Name: session, URL: "http://example.com"})
+	defer config.DeleteSession(session)
+
+	s := &server{pool: pool.NewMemory(), successfulProxies: make(map[string]map[string]*http.Client)}
+	proxies := []string{"http://10.0.0.1:80", "http://10.0.0.2:80", "http://10.0.0.3:80", "http://10.0.0.4:80"}
+	failure := errors.New("proxy caído")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := raceAttempts(context.Background(), proxies, func(ctx context.Context, proxyAddr string) (*fetchResult, error) {
+				if _, err := s.getHTTPClient(proxyAddr, session); err != nil {
+					return nil, err
+				}
+				s.removeSuccesfulProxy(session, proxyAddr)
+				return nil, failure
+			})
+			if !errors.Is(err, failure) {
+				t.Errorf("error %v, se esperaba %v", err, failure)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.successfulProxyList(session)
+			}
+		}()
+	}
+	wg.Wait()
+	if left := s.successfulProxyList(session); len(left) != 0 {
+		t.Fatalf("quedaron %d clientes de proxies retirados", len(left))
+	}
+}
@@ -0,0 +1,18 @@
+// api/scores.go
+package api
+
+import (
+	"proxy-api/internal/config"
+	"proxy-api/internal/pool"
+)
+
+// proxyAddress normaliza la dirección de un proxy a ip:port
+func proxyAddress(proxyAddr string) string {
+	return pool.Address(proxyAddr)
+}
+
+// recordProxyResult actualiza la puntuación del proxy tras una petición
+func (s *server) recordProxyResult(session, proxyAddr string, success bool) {
+	s.pool.RecordResult(session, proxyAddr, success)
+	storeProxyResult(session, proxyAddress(config.RedactURL(proxyAddr)), success)
+}
@@ -4,32 +4,127 @@ package api
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"math/rand"
-	"net"
 	"net/http"
 	"net/url"
 	pb "proxy-api/fetch"
+	"proxy-api/internal/audit"
+	"proxy-api/internal/cache"
+	"proxy-api/internal/captcha"
 	"proxy-api/internal/config"
+	"proxy-api/internal/events"
+	"proxy-api/internal/outbound"
+	"proxy-api/internal/pool"
 	"proxy-api/internal/proxy"
-	"proxy-api/internal/scraper"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
 )
 
-var (
-	validProxies map[string][]string
-	userAgents   []string
-)
+// poolProxies devuelve los proxies del pool de la sesión como esquema://host:puerto
+func (s *server) poolProxies(session string) []string {
+	list := s.pool.Proxies(session)
+	proxies := make([]string, len(list))
+	for i, p := range list {
+		proxies[i] = p.String()
+	}
+	return proxies
+}
+
+// proxyURL devuelve la URL con la que conectar con proxyAddr, con las credenciales
+// del pool si las tiene
+func (s *server) proxyURL(session, proxyAddr string) (*url.URL, error) {
+	if p, ok := s.pool.Lookup(session, proxyAddr); ok {
+		return p.URL(), nil
+	}
+	return url.Parse(proxyAddr)
+}
 
 type server struct {
 	pb.UnimplementedProxyServiceServer
-	successfulProxies map[string]*http.Client
+	pool              pool.ProxyPool
+	fetchers          fetchers
+	successfulProxies map[string]map[string]*http.Client // sesión -> proxy -> cliente
 	mtx               sync.RWMutex
+	auditLog          *audit.Logger
+	sessions          sessionTracker
+	responseCache     *cache.Cache
+	knownSessions     map[string]config.ProxySession
+	solver            captcha.Solver // Servicio de resolución de CAPTCHA, nil si no hay
+	reconcileMtx      sync.Mutex
+	lifetime          context.Context // Termina al parar el motor; de él cuelgan los trabajos en segundo plano
+
+	// Proxies de ImportPool que las fuentes no incluyen, por sesión y dirección
+	imported    map[string]map[string]proxy.Proxy
+	importedMtx sync.Mutex
+
+	ready  atomic.Bool    // La primera validación de proxies ya terminó
+	health *health.Server // Estado publicado por el servicio de health de ServeGRPC
+	budget *retryBudget   // Reintentos disponibles para todas las peticiones
+
+	warmSets   map[string]*warmSet // URL calientes por sesión
+	warmupsMtx sync.Mutex
+
+	schedules   map[string]*scheduledFetch // Peticiones programadas activas
+	scheduleMtx sync.Mutex
+
+	// Suscriptores a los resultados; el valor filtra por id (nil recibe todos)
+	resultSubscribers map[chan *pb.ScheduledResult]map[string]bool
+	resultSubsMtx     sync.Mutex
+
+	// Cola de las peticiones con webhook_url, atendidas por ASYNC_WORKERS workers
+	asyncQueue     chan func()
+	asyncQueueOnce sync.Once
+}
+
+// background devuelve el contexto de los trabajos que sobreviven a la llamada
+func (s *server) background() context.Context {
+	if s.lifetime == nil {
+		return context.Background()
+	}
+	return s.lifetime
+}
+
+// fetchResult es el resultado de una petición, directa o a través de un proxy
+type fetchResult struct {
+	content []byte
+	proxy   string
+	status  int
+	variant string // Variante del experimento de la sesión
+	stage   string // Etapa de la cadena de fallback que obtuvo la respuesta
+
+	contentType  string
+	charset      string
+	etag         string
+	lastModified string
+	contentRange string
+	httpVersion  string
+	altSvc       string
+	encoding     string // Content-Encoding del destino que quedó sin descomprimir
+	fromCache    bool
+	truncated    bool
+	redirects    []redirectHop
+	spilled      *spilledBody // Contenido que readBody escribió en disco; content queda vacío
+}
+
+// newFetchResult construye el resultado a partir de la respuesta del destino
+func newFetchResult(resp *http.Response, content []byte, proxyAddr string) *fetchResult {
+	return &fetchResult{
+		content:      content,
+		proxy:        proxyAddr,
+		status:       resp.StatusCode,
+		contentType:  resp.Header.Get("Content-Type"),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		httpVersion:  resp.Proto,
+		altSvc:       resp.Header.Get("Alt-Svc"),
+		contentRange: resp.Header.Get("Content-Range"),
+		encoding:     resp.Header.Get("Content-Encoding"),
+	}
 }
 
 var errorMap = map[string]struct{}{
@@ -51,7 +146,6 @@ var errorMap = map[string]struct{}{
 	"proxyconnect tcp:":         {},
 	"Temporary Redirect":        {},
 	"Internal Privoxy Error":    {},
-	"certificate":               {},
 	"bad record MAC":            {},
 	"lookup":                    {},
 }
@@ -92,48 +186,65 @@ func IsNilContent(content string) bool {
 	return false
 }
 
-func (s *server) getHTTPClient(proxyAddr string, redirect bool, session string) (*http.Client, error) {
+func (s *server) getHTTPClient(proxyAddr string, session string) (*http.Client, error) {
 	s.mtx.RLock()
-	client, ok := s.successfulProxies[proxyAddr]
+	client, ok := s.successfulProxies[session][proxyAddr]
 	s.mtx.RUnlock()
 
 	if ok {
 		return client, nil
 	}
 
-	if proxyAddr == "default" {
-		return http.DefaultClient, nil
+	cfg, err := config.GetSessionOrDefault(session)
+	if err != nil {
+		return nil, err
 	}
-
-	proxyURL, _ := url.Parse(proxyAddr)
-	client = &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(proxyURL),
-		},
-		Timeout: time.Duration(config.ProxySessions[session].Timeout) * time.Millisecond,
+	target, err := s.proxyURL(session, proxyAddr)
+	if err != nil {
+		return nil, err
 	}
-
-	if !redirect {
-		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		}
-	} else {
-		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-			return nil
-		}
+	transport := outbound.Transport(target)
+	if transport.TLSClientConfig, err = sessionTLSConfig(cfg.TLS); err != nil {
+		return nil, err
+	}
+	resumeTLSSessions(transport)
+	if len(cfg.HeaderOrder) > 0 {
+		orderHeaders(transport, target, cfg.HeaderOrder)
+	}
+	client = &http.Client{
+		Transport:     transport,
+		Timeout:       time.Duration(cfg.Timeout) * time.Millisecond,
+		CheckRedirect: checkRedirect,
 	}
 
 	s.mtx.Lock()
-	s.successfulProxies[proxyAddr] = client
+	if s.successfulProxies[session] == nil {
+		s.successfulProxies[session] = make(map[string]*http.Client)
+	}
+	// Otra petición pudo crear antes el cliente del mismo proxy
+	if existing, ok := s.successfulProxies[session][proxyAddr]; ok {
+		s.mtx.Unlock()
+		outbound.Discard(transport)
+		return existing, nil
+	}
+	s.successfulProxies[session][proxyAddr] = client
 	s.mtx.Unlock()
 
 	return client, nil
 }
 
-func (s *server) removeSuccesfulProxy(proxyAddr string) {
+func (s *server) removeSuccesfulProxy(session, proxyAddr string) {
 	s.mtx.Lock()
-	delete(s.successfulProxies, proxyAddr)
+	client := s.successfulProxies[session][proxyAddr]
+	delete(s.successfulProxies[session], proxyAddr)
 	s.mtx.Unlock()
+	// Sus conexiones inactivas no volverán a usarse
+	if client == nil {
+		return
+	}
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		outbound.Discard(transport)
+	}
 }
 
 // GetRandomProxy - Nuevo método para obtener un proxy aleatorio de una sesión específica
@@ -143,13 +254,13 @@ func (s *server) GetRandomProxy(ctx context.Context, req *pb.ProxyRequest) (*pb.
 	}
 
 	// Verificar si la sesión existe en la configuración
-	if _, exists := config.ProxySessions[req.Session]; !exists {
+	if _, exists := config.GetSession(req.Session); !exists {
 		return nil, fmt.Errorf("session '%s' not found in configuration", req.Session)
 	}
 
 	// Verificar si hay proxies válidos para esta sesión
-	proxies, exists := validProxies[req.Session]
-	if !exists || len(proxies) == 0 {
+	proxies := s.poolProxies(req.Session)
+	if len(proxies) == 0 {
 		return &pb.ProxyResponse{
 			Proxy:   "",
 			Success: false,
@@ -158,10 +269,25 @@ func (s *server) GetRandomProxy(ctx context.Context, req *pb.ProxyRequest) (*pb.
 	}
 
 	// Seleccionar un proxy aleatorio
+	proxies = filterDiverse(req.Session, proxies)
+	if cfg, _ := config.GetSession(req.Session); cfg.PreferResidential {
+		if residential := residentialOnly(proxies); len(residential) > 0 {
+			proxies = residential
+		}
+	}
 	randomIndex := rand.Intn(len(proxies))
 	selectedProxy := proxies[randomIndex]
+	recordDiversity(req.Session, selectedProxy)
 
-	log.Printf("Selected random proxy for session '%s': %s", req.Session, selectedProxy)
+	// Los proxies HTTP sin credenciales se devuelven como ip:port, como siempre
+	if p, ok := s.pool.Lookup(req.Session, selectedProxy); ok {
+		selectedProxy = p.Address()
+		if p.Scheme != "http" || p.Username != "" {
+			selectedProxy = p.URL().String()
+		}
+	}
+
+	requestLog(ctx, "Proxy aleatorio seleccionado", nil, "session", req.Session, "proxy", selectedProxy)
 
 	return &pb.ProxyResponse{
 		Proxy:   selectedProxy,
@@ -173,167 +299,293 @@ func (s *server) GetRandomProxy(ctx context.Context, req *pb.ProxyRequest) (*pb.
 // GetProxyStats - Método adicional para obtener estadísticas de proxies por sesión
 func (s *server) GetProxyStats(ctx context.Context, req *pb.StatsRequest) (*pb.StatsResponse, error) {
 	stats := make(map[string]int32)
-	
-	for session, proxies := range validProxies {
+
+	for session, proxies := range s.pool.All() {
 		stats[session] = int32(len(proxies))
 	}
 
+	methods := make(map[string]*pb.MethodStats)
+	for method, m := range methodStatsSnapshot() {
+		methods[method] = &pb.MethodStats{
+			Calls:          m.Calls,
+			Errors:         m.Errors,
+			Panics:         m.Panics,
+			TotalLatencyMs: m.TotalLatency.Milliseconds(),
+		}
+	}
+
 	return &pb.StatsResponse{
 		ProxyCountBySession: stats,
-		TotalValidProxies:   int32(getTotalProxyCount()),
+		TotalValidProxies:   int32(s.pool.Count()),
+		MethodStats:         methods,
+		Experiments:         experimentSnapshot(),
+		RetryBudget:         s.budget.stats(),
+		Sessions:            sessionStatsSnapshot(),
+		Freshness:           s.freshnessSnapshot(),
+		Sources:             sourceStatsSnapshot(),
+		Connections:         s.connStatsSnapshot(),
+		UserAgents:          userAgentStats(),
+		Diversity:           s.diversitySnapshot(),
 	}, nil
 }
 
-func getTotalProxyCount() int {
-	total := 0
-	for _, proxies := range validProxies {
-		total += len(proxies)
+// successfulProxyList devuelve una copia de los proxies con cliente en caché para la sesión
+func (s *server) successfulProxyList(session string) []string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	proxies := make([]string, 0, len(s.successfulProxies[session]))
+	for proxyAddr := range s.successfulProxies[session] {
+		// El id de una plantilla de proveedor pertenece a otra identidad
+		if !isProviderExpansion(proxyAddr) {
+			proxies = append(proxies, proxyAddr)
+		}
 	}
-	return total
+	return proxies
 }
 
-// WITHOUT PROXIES
-func (s *server) Fetch(ctx context.Context, req *pb.Request, userAgent string, redirect bool) (*pb.Response, error) {
-	client, err := s.getHTTPClient("default", redirect, req.Session)
-	if err != nil {
+func (s *server) FetchContent(ctx context.Context, req *pb.Request) (*pb.Response, error) {
+	ctx = withRequestID(ctx)
+	if err := checkContentEncoding(req); err != nil {
 		return nil, err
 	}
+	if req.WebhookUrl != "" && !req.DryRun {
+		return s.fetchAsync(ctx, req)
+	}
 
-	reqObj, err := http.NewRequestWithContext(ctx, "GET", req.Url, nil)
+	start := time.Now()
+	done, err := s.sessions.begin(req.Session)
 	if err != nil {
 		return nil, err
 	}
+	defer done()
 
-	reqObj.Header.Set("User-Agent", userAgent)
-	for k, v := range config.GetHeadersFromSession(req.Session) {
-		reqObj.Header.Set(k, v)
+	if req.DryRun {
+		resp, err := s.dryRun(ctx, req)
+		if resp != nil {
+			resp.RequestId = requestIDFrom(ctx)
+		}
+		return resp, err
 	}
 
-	resp, err := client.Do(reqObj)
-	if err != nil {
-		// Retry if there is a timeout error.
-		if ctx.Err() == context.DeadlineExceeded || isTimeoutError(err) {
-			log.Println("Retry due to", err)
-			return s.Fetch(ctx, req, userAgent, redirect)
+	ctx = withCapture(ctx, req)
+	result, warm := s.warmResult(req)
+	if !warm {
+		upstreamReq, cached := s.prepareConditional(req)
+		result, err = s.fetchContent(ctx, upstreamReq)
+		s.recordAudit(ctx, req, result, err, start)
+		if err != nil {
+			recordSessionRequest(req.Session, false, false, false, time.Since(start))
+			return nil, err
 		}
-
-		return nil, err
+		s.resolveConditional(req, result, cached)
 	}
-	defer resp.Body.Close()
+	recordSessionRequest(req.Session, true, result.fromCache, result.stage == config.FallbackDirect, time.Since(start))
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	if req.NormalizeCharset {
+		normalizeCharset(result)
+	}
+	hash, unchanged, err := contentHash(req, result)
 	if err != nil {
-		return nil, err
+		result.spilled.remove()
+		return nil, fmt.Errorf("failed to hash response body: %w", err)
 	}
-
-	log.Printf("User-Agent: %s, Status: %d, URL: %s\n", userAgent, resp.StatusCode, req.Url)
-	return &pb.Response{Content: bodyBytes}, nil
-}
-
-func (s *server) useProxyToFetch(ctx context.Context, req *pb.Request, proxyAddr string, userAgent string, redirect bool, contentChan chan []byte, errorChan chan error) {
-	client, err := s.getHTTPClient(proxyAddr, redirect, req.Session)
+	encoding, err := compressContent(req, result)
 	if err != nil {
-		errorChan <- err
-		return
+		result.spilled.remove()
+		return nil, err
 	}
-
-	reqObj, err := http.NewRequestWithContext(ctx, "GET", req.Url, nil)
+	spilled, err := spillContent(req, result)
 	if err != nil {
-		errorChan <- err
-		return
+		return nil, fmt.Errorf("failed to spill response body: %w", err)
 	}
 
-	reqObj.Header.Set("User-Agent", userAgent)
-	for k, v := range config.GetHeadersFromSession(req.Session) {
-		reqObj.Header.Set(k, v)
+	var redirects []*pb.RedirectHop
+	for _, hop := range result.redirects {
+		redirects = append(redirects, &pb.RedirectHop{Url: hop.url, Status: int32(hop.status)})
 	}
 
-	resp, err := client.Do(reqObj)
-	if err != nil {
-		s.removeSuccesfulProxy(proxyAddr) // remove the proxy from successfulProxies
-		errorChan <- err
-		return
+	resp := &pb.Response{
+		Content:          result.content,
+		Proxy:            config.RedactURL(result.proxy),
+		FallbackStage:    result.stage,
+		Charset:          result.charset,
+		Status:           int32(result.status),
+		Etag:             result.etag,
+		LastModified:     result.lastModified,
+		NotModified:      result.status == http.StatusNotModified || unchanged,
+		FromCache:        result.fromCache,
+		Truncated:        result.truncated,
+		ContentHash:      hash,
+		ContentEncoding:  encoding,
+		Variant:          result.variant,
+		ContentRange:     result.contentRange,
+		Redirects:        redirects,
+		RequestId:        requestIDFrom(ctx),
+		HttpVersion:      result.httpVersion,
+		AltSvc:           result.altSvc,
+		UpstreamEncoding: result.encoding,
 	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		errorChan <- err
-		return
+	if spilled != nil {
+		resp.SpillToken = spilled.token
+		resp.SpillSize = spilled.size
+		resp.SpillExpires = spilled.expires.UnixMilli()
 	}
-
-	log.Printf("Proxy: %s, User-Agent: %s, Status: %d, URL: %s", proxyAddr, userAgent, resp.StatusCode, req.Url)
-	contentChan <- bodyBytes
+	return resp, nil
 }
 
-func (s *server) FetchContent(ctx context.Context, req *pb.Request) (*pb.Response, error) {
-	if req.Session == "" || validProxies[req.Session] == nil {
+func (s *server) fetchContent(ctx context.Context, req *pb.Request) (*fetchResult, error) {
+	if req.Session == "" || s.pool.Proxies(req.Session) == nil {
 		return nil, fmt.Errorf("invalid session")
 	}
-
-	var redirect bool
-	if req.Redirect {
-		redirect = req.Redirect
-	} else {
-		redirect = false
+	if err := checkTarget(ctx, req.Url); err != nil {
+		return nil, err
+	}
+	if !acquireRequestSlot() {
+		return nil, errServerBusy(ctx)
+	}
+	defer releaseRequestSlot()
+
+	ctx = withRequestLog(ctx, req.Session)
+	assignment := assignVariant(req)
+	ctx = withCaptcha(withVariant(withAttempts(ctx, s.budget), assignment))
+	selectedUserAgent := variantUserAgent(req, assignment)
+	if selectedUserAgent == "" {
+		selectedUserAgent = selectUserAgent(req)
 	}
 
-	selectedUserAgent := userAgents[rand.Intn(len(userAgents))]
-
+	start := time.Now()
+	var result *fetchResult
+	var err error
 	if req.Proxy {
-		contentChan := make(chan []byte)
-		errorChan := make(chan error)
-
-		// Primero se utilizan los successfulProxies
-		s.mtx.RLock()
-		for proxyAddr := range s.successfulProxies {
-			go s.useProxyToFetch(ctx, req, "http://"+proxyAddr, selectedUserAgent, redirect, contentChan, errorChan)
+		result, err = s.runFallbackChain(ctx, req, selectedUserAgent)
+	} else {
+		result, err = s.fetchWith(ctx, req, directProxy, proxyUserAgent(ctx, req, directProxy, selectedUserAgent))
+	}
+	if err != nil && ctx.Err() == nil && captchaFrom(ctx) != nil {
+		solved, solveErr := s.solveCaptcha(ctx, req, selectedUserAgent)
+		if solveErr == nil {
+			result, err = solved, nil
+		} else if solveErr != errNoSolver {
+			log.Printf("No se pudo resolver el CAPTCHA de %s: %v", req.Url, solveErr)
 		}
-		s.mtx.RUnlock()
-
-		// Si falla, utiliza los validProxies
-		if len(contentChan) == 0 {
-			for _, proxyAddr := range validProxies[req.Session] {
-				go s.useProxyToFetch(ctx, req, "http://"+proxyAddr, selectedUserAgent, redirect, contentChan, errorChan)
-			}
+	}
+	recordExperiment(req.Session, assignment, err == nil, time.Since(start))
+	if err != nil {
+		if challenge := captchaFrom(ctx); challenge != nil && ctx.Err() == nil {
+			return nil, errCaptchaRequired(challenge.provider, targetHost(req.Url), err)
 		}
-
-		for range validProxies[req.Session] {
-			select {
-			case content := <-contentChan:
-				return &pb.Response{Content: content}, nil
-			case <-errorChan:
-				continue
-			}
+		if poolSaturated(ctx) && ctx.Err() == nil {
+			return nil, errPoolSaturated(ctx, req.Session)
 		}
-
-		return s.Fetch(ctx, req, selectedUserAgent, redirect)
+		if budgetDenied(ctx) && ctx.Err() == nil {
+			setRetryPushback(ctx, -1)
+			return nil, errRetryBudget(err)
+		}
+		return nil, err
 	}
-
-	return s.Fetch(ctx, req, selectedUserAgent, redirect)
+	if assignment != nil {
+		result.variant = assignment.name
+	}
+	s.checkIntegrity(req, result, selectedUserAgent)
+	return result, nil
 }
 
-func UpdateValidProxies(proxies map[string][]string) {
-	validProxies = proxies
+// updateProxies reemplaza el pool con los proxies de un ciclo de validación o una importación
+func (s *server) updateProxies(proxies map[string][]proxy.Proxy) {
+	s.pool.Replace(proxies)
+	saveValidProxies(proxies)
+	s.reconcileSessions()
+	events.Publish(events.Event{Kind: events.PoolRefreshed, Count: s.pool.Count()})
 }
 
-func StartGRPCServer() {
-	validProxies = proxy.GetValidProxies()
-	userAgents = scraper.ScrapeUserAgents()
+var serviceName = pb.ProxyService_ServiceDesc.ServiceName
 
-	log.Println("Iniciando servidor gRPC")
-	lis, err := net.Listen("tcp", ":5000")
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+// Ciclos de revalidación: en curso, descartados por coincidir con uno en curso y
+// pendiente porque PROXY_SOURCES_DIR cambió durante el ciclo en curso
+var (
+	validationRunning atomic.Bool
+	validationSkipped atomic.Int64
+	validationPending atomic.Bool
+)
+
+// warmUpPool realiza la primera validación y habilita el servicio al terminar;
+// después revalida el pool cada config.UpdateTime minutos, o cuando cambia
+// PROXY_SOURCES_DIR, hasta que ctx termine. Si un ciclo dura más que el intervalo, los
+// siguientes se omiten hasta que termine; un cambio de las fuentes durante el ciclo
+// lanza otro al terminar, para no validar con las fuentes antiguas hasta el siguiente.
+func (s *server) warmUpPool(ctx context.Context) {
+	sourcesChanged := watchSourcesDir(ctx)
+	reloadUserAgents()
+	// Si la primera validación falla, el bucle la reintenta con espera creciente hasta que
+	// el pool esté listo, sin esperar a UPDATE_TIME
+	retryDelay := time.Duration(config.WarmupRetryDelay) * time.Second
+	var retry <-chan time.Time
+	if proxies, err := proxy.GetValidProxies(ctx); err != nil {
+		log.Printf("Primera validación fallida, reintento en %v: %v", retryDelay, err)
+		retry = time.After(retryDelay)
+	} else {
+		s.mergeImported(ctx, proxies)
+		s.updateProxies(proxies)
+		log.Printf("Primera validación completada: %d proxies válidos", s.pool.Count())
+		s.markReady()
+	}
+
+	// La lista de user-agents se refresca en el mismo bucle, con su propio intervalo
+	var userAgentTick <-chan time.Time
+	if config.UserAgentRefreshMinutes > 0 {
+		userAgentTicker := time.NewTicker(time.Duration(config.UserAgentRefreshMinutes) * time.Minute)
+		defer userAgentTicker.Stop()
+		userAgentTick = userAgentTicker.C
 	}
 
-	maxSize := 5 * 1024 * 1024
-	grpcServer := grpc.NewServer(
-		grpc.MaxRecvMsgSize(maxSize), // Tamaño máximo de mensaje recibido.
-		grpc.MaxSendMsgSize(maxSize), // Tamaño máximo de mensaje enviado.
-	)
-	pb.RegisterProxyServiceServer(grpcServer, &server{successfulProxies: make(map[string]*http.Client)})
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	ticker := time.NewTicker(config.UpdateTime * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-userAgentTick:
+			refreshUserAgents()
+			continue
+		case <-ticker.C:
+		case <-sourcesChanged:
+			// Se marca antes de comprobar el ciclo en curso, que lo ve al terminar
+			validationPending.Store(true)
+		case <-retry:
+			retry = nil
+			if s.ready.Load() {
+				continue
+			}
+			retryDelay = min(retryDelay*2, config.UpdateTime*time.Minute)
+			retry = time.After(retryDelay)
+		}
+		if !validationRunning.CompareAndSwap(false, true) {
+			log.Printf("Ciclo de validación omitido: el anterior sigue en curso (%d omitidos)", validationSkipped.Add(1))
+			continue
+		}
+		validationPending.Store(false)
+		go s.runValidationCycles(ctx)
 	}
-}
\ No newline at end of file
+}
+
+// runValidationCycles revalida el pool y repite el ciclo mientras PROXY_SOURCES_DIR
+// haya cambiado durante el anterior. Se llama con validationRunning reservado.
+func (s *server) runValidationCycles(ctx context.Context) {
+	for {
+		if proxies, err := proxy.GetValidProxies(ctx); err == nil {
+			s.mergeImported(ctx, proxies)
+			s.updateProxies(proxies)
+			log.Printf("Proxies válidos refrescados: %d", s.pool.Count())
+			// Tras una primera validación fallida, el primer ciclo correcto deja listo el servidor
+			s.markReady()
+		} else {
+			log.Printf("Ciclo de validación fallido: %v", err)
+		}
+		validationRunning.Store(false)
+		if ctx.Err() != nil || !validationPending.Swap(false) || !validationRunning.CompareAndSwap(false, true) {
+			return
+		}
+		log.Printf("Las fuentes de proxies cambiaron durante la validación: se repite el ciclo")
+	}
+}
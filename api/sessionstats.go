@@ -0,0 +1,150 @@
+// api/sessionstats.go
+package api
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+)
+
+// Las métricas por sesión se acumulan en cubetas de un minuto; se conservan las del
+// último cuarto de hora, que es la ventana más larga
+const (
+	statsBucketWidth = time.Minute
+	statsBuckets     = 15
+	// statsSamples acota las latencias guardadas por cubeta; por encima se muestrean
+	statsSamples = 1024
+)
+
+// statsWindows son las ventanas que se informan, en cubetas
+var statsWindows = map[string]int{"1m": 1, "5m": 5, "15m": 15}
+
+// statsBucket son las peticiones de una sesión en un minuto
+type statsBucket struct {
+	minute          int64 // Minuto Unix al que corresponde la cubeta
+	requests        int64
+	successes       int64
+	cacheHits       int64
+	directFallbacks int64
+	latencies       []int64 // Muestra de latencias en milisegundos
+}
+
+// sessionMetrics es el anillo de cubetas de una sesión
+type sessionMetrics struct {
+	buckets [statsBuckets]statsBucket
+}
+
+// Métricas de peticiones por sesión
+var (
+	sessionStats    = make(map[string]*sessionMetrics)
+	sessionStatsMtx sync.Mutex
+)
+
+// recordSessionRequest anota una petición de la sesión en la cubeta del minuto actual
+func recordSessionRequest(session string, success, cacheHit, directFallback bool, latency time.Duration) {
+	if _, ok := config.GetSession(session); !ok {
+		return
+	}
+	minute := time.Now().Unix() / int64(statsBucketWidth/time.Second)
+
+	sessionStatsMtx.Lock()
+	defer sessionStatsMtx.Unlock()
+	metrics, ok := sessionStats[session]
+	if !ok {
+		metrics = &sessionMetrics{}
+		sessionStats[session] = metrics
+	}
+	bucket := &metrics.buckets[minute%statsBuckets]
+	if bucket.minute != minute {
+		*bucket = statsBucket{minute: minute}
+	}
+
+	bucket.requests++
+	if success {
+		bucket.successes++
+	}
+	if cacheHit {
+		bucket.cacheHits++
+	}
+	if directFallback {
+		bucket.directFallbacks++
+	}
+
+	// Muestreo por reservorio: cada petición tiene la misma probabilidad de quedarse
+	ms := latency.Milliseconds()
+	if len(bucket.latencies) < statsSamples {
+		bucket.latencies = append(bucket.latencies, ms)
+	} else if i := rand.Int63n(bucket.requests); i < statsSamples {
+		bucket.latencies[i] = ms
+	}
+}
+
+// forgetSessionStats descarta las métricas de una sesión eliminada o modificada
+func forgetSessionStats(session string) {
+	sessionStatsMtx.Lock()
+	defer sessionStatsMtx.Unlock()
+	delete(sessionStats, session)
+}
+
+// sessionStatsSnapshot devuelve las métricas de cada sesión por ventana
+func sessionStatsSnapshot() map[string]*pb.SessionStats {
+	minute := time.Now().Unix() / int64(statsBucketWidth/time.Second)
+
+	sessionStatsMtx.Lock()
+	defer sessionStatsMtx.Unlock()
+	out := make(map[string]*pb.SessionStats, len(sessionStats))
+	for session, metrics := range sessionStats {
+		windows := make(map[string]*pb.WindowStats, len(statsWindows))
+		for name, width := range statsWindows {
+			windows[name] = metrics.window(minute, width)
+		}
+		out[session] = &pb.SessionStats{Windows: windows, Slo: sloStatus(session)}
+	}
+	return out
+}
+
+// window agrega las cubetas de los últimos width minutos, incluido el actual
+func (m *sessionMetrics) window(minute int64, width int) *pb.WindowStats {
+	stats := &pb.WindowStats{}
+	var latencies []int64
+	for i := range m.buckets {
+		bucket := &m.buckets[i]
+		if bucket.requests == 0 || bucket.minute > minute || bucket.minute <= minute-int64(width) {
+			continue
+		}
+		stats.Requests += bucket.requests
+		stats.Successes += bucket.successes
+		stats.CacheHits += bucket.cacheHits
+		stats.DirectFallbacks += bucket.directFallbacks
+		latencies = append(latencies, bucket.latencies...)
+	}
+	if stats.Requests > 0 {
+		stats.SuccessRate = float64(stats.Successes) / float64(stats.Requests)
+	}
+	if stats.Successes > 0 {
+		stats.CacheHitRate = float64(stats.CacheHits) / float64(stats.Successes)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.P50LatencyMs = percentile(latencies, 0.50)
+	stats.P95LatencyMs = percentile(latencies, 0.95)
+	stats.P99LatencyMs = percentile(latencies, 0.99)
+	return stats
+}
+
+// percentile devuelve el percentil p de una muestra ordenada, 0 si está vacía
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,63 @@
+// api/sharedpool.go
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/poolstore"
+)
+
+// openSharedPool abre el pool compartido de SHARED_POOL_DRIVER
+func openSharedPool() (poolstore.Store, error) {
+	return poolstore.Open(poolstore.Config{
+		Driver: config.SharedPoolDriver,
+		URL:    config.SharedPoolURL,
+		Key:    config.SharedPoolKey,
+	})
+}
+
+// followSharedPool sustituye a warmUpPool cuando el pool lo valida cmd/validator: lee la
+// publicación cada config.SharedPoolPoll segundos y aplica las nuevas hasta que ctx
+// termine. El servicio se habilita con la primera publicación leída.
+func (s *server) followSharedPool(ctx context.Context) {
+	store, err := openSharedPool()
+	if err != nil {
+		log.Fatalf("failed to open shared pool: %v", err)
+	}
+	defer store.Close()
+	reloadUserAgents()
+
+	var userAgentTick <-chan time.Time
+	if config.UserAgentRefreshMinutes > 0 {
+		userAgentTicker := time.NewTicker(time.Duration(config.UserAgentRefreshMinutes) * time.Minute)
+		defer userAgentTicker.Stop()
+		userAgentTick = userAgentTicker.C
+	}
+
+	ticker := time.NewTicker(time.Duration(config.SharedPoolPoll) * time.Second)
+	defer ticker.Stop()
+	var applied time.Time
+	for {
+		snapshot, ok, err := store.Load(ctx)
+		switch {
+		case err != nil:
+			log.Printf("Error al leer el pool compartido: %v", err)
+		case ok && snapshot.PublishedAt.After(applied):
+			applied = snapshot.PublishedAt
+			s.updateProxies(snapshot.Proxies)
+			log.Printf("Pool compartido publicado por %s a las %s: %d proxies", snapshot.Publisher, snapshot.PublishedAt.Format(time.RFC3339), s.pool.Count())
+			s.markReady()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-userAgentTick:
+			refreshUserAgents()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// api/slo.go
+package api
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/events"
+)
+
+// Fracción del objetivo por debajo de la cual una sesión degradada vuelve a su
+// estrategia; evita que alterne en cada petición al rondar el límite
+const sloRecovery = 0.8
+
+// sloSample es la latencia de una petición servida por un proxy
+type sloSample struct {
+	at      time.Time
+	latency int64 // ms
+}
+
+// sloState es el seguimiento del SLO de latencia de una sesión
+type sloState struct {
+	samples  []sloSample // En orden de llegada, como mucho statsSamples
+	p95      int64
+	degraded bool
+	since    time.Time // Último cambio de estado
+}
+
+// Estado del SLO de latencia por sesión
+var (
+	sloStates = make(map[string]*sloState)
+	sloMtx    sync.Mutex
+)
+
+// sloWindow devuelve la ventana de peticiones que cuenta para el SLO de la sesión
+func sloWindow(slo config.LatencySLO) time.Duration {
+	if slo.Window <= 0 {
+		return config.DefaultSLOWindow * time.Millisecond
+	}
+	return time.Duration(slo.Window) * time.Millisecond
+}
+
+// evaluate descarta las muestras fuera de la ventana y decide si la sesión incumple
+// su SLO. Sin muestras suficientes la sesión vuelve a su estrategia, de modo que una
+// sesión que dejó de usar proxies los prueba de nuevo al cabo de la ventana.
+func (st *sloState) evaluate(session string, slo config.LatencySLO, now time.Time) {
+	cutoff := now.Add(-sloWindow(slo))
+	i := 0
+	for i < len(st.samples) && st.samples[i].at.Before(cutoff) {
+		i++
+	}
+	st.samples = st.samples[i:]
+
+	degraded := st.degraded
+	st.p95 = 0
+	if len(st.samples) < config.SLOMinSamples {
+		degraded = false
+	} else {
+		latencies := make([]int64, len(st.samples))
+		for i, sample := range st.samples {
+			latencies[i] = sample.latency
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		st.p95 = percentile(latencies, 0.95)
+		switch {
+		case st.p95 > int64(slo.P95):
+			degraded = true
+		case float64(st.p95) <= sloRecovery*float64(slo.P95):
+			degraded = false
+		}
+	}
+	if degraded == st.degraded {
+		return
+	}
+
+	st.degraded = degraded
+	st.since = now
+	if degraded {
+		log.Printf("Sesión %s: P95 de %d ms por encima del SLO de %d ms, se cambia a la estrategia %s", session, st.p95, slo.P95, sloActionName(slo))
+		events.Publish(events.Event{Kind: events.SessionDegraded, Session: session, Reason: sloActionName(slo), Count: int(st.p95)})
+	} else {
+		log.Printf("Sesión %s: latencia dentro del SLO de %d ms, se vuelve a la estrategia configurada", session, slo.P95)
+		events.Publish(events.Event{Kind: events.SessionRecovered, Session: session, Count: int(st.p95)})
+	}
+}
+
+// recordSLOLatency anota la latencia de una petición de la sesión servida por un proxy
+func recordSLOLatency(session string, latency time.Duration) {
+	cfg, ok := config.GetSession(session)
+	if !ok || cfg.SLO.P95 <= 0 {
+		return
+	}
+	now := time.Now()
+
+	sloMtx.Lock()
+	defer sloMtx.Unlock()
+	st, ok := sloStates[session]
+	if !ok {
+		st = &sloState{since: now}
+		sloStates[session] = st
+	}
+	st.samples = append(st.samples, sloSample{at: now, latency: latency.Milliseconds()})
+	if len(st.samples) > statsSamples {
+		st.samples = st.samples[len(st.samples)-statsSamples:]
+	}
+	st.evaluate(session, cfg.SLO, now)
+}
+
+// sloDegraded indica si la sesión incumple ahora su SLO de latencia
+func sloDegraded(name string, slo config.LatencySLO) bool {
+	if slo.P95 <= 0 {
+		return false
+	}
+
+	sloMtx.Lock()
+	defer sloMtx.Unlock()
+	st, ok := sloStates[name]
+	if !ok {
+		return false
+	}
+	st.evaluate(name, slo, time.Now())
+	return st.degraded
+}
+
+// sloActionName devuelve la estrategia configurada para cuando se incumple el SLO
+func sloActionName(slo config.LatencySLO) string {
+	if slo.Action == "" {
+		return config.SLOHedge
+	}
+	return slo.Action
+}
+
+// sloAction devuelve la estrategia que sigue la sesión por incumplir su SLO, vacía si
+// lo cumple. Las estrategias que la sesión no puede aplicar se sustituyen por SLOHedge.
+func sloAction(name string, session config.ProxySession) string {
+	if !sloDegraded(name, session.SLO) {
+		return ""
+	}
+	switch sloActionName(session.SLO) {
+	case config.SLOHot:
+		if session.HotSetSize > 0 {
+			return config.SLOHot
+		}
+	case config.SLODirect:
+		if hasDirectStage(session) {
+			return config.SLODirect
+		}
+	}
+	return config.SLOHedge
+}
+
+// sloStatus devuelve el estado del SLO de la sesión, nil si no lo tiene
+func sloStatus(session string) *pb.SLOStatus {
+	cfg, ok := config.GetSession(session)
+	if !ok || cfg.SLO.P95 <= 0 {
+		return nil
+	}
+	status := &pb.SLOStatus{TargetP95Ms: int64(cfg.SLO.P95), Action: sloActionName(cfg.SLO)}
+
+	sloMtx.Lock()
+	defer sloMtx.Unlock()
+	if st, ok := sloStates[session]; ok {
+		st.evaluate(session, cfg.SLO, time.Now())
+		status.P95LatencyMs = st.p95
+		status.Samples = int32(len(st.samples))
+		status.Degraded = st.degraded
+		status.Since = st.since.UnixMilli()
+	}
+	return status
+}
+
+// forgetSLO descarta el seguimiento del SLO de una sesión
+func forgetSLO(session string) {
+	sloMtx.Lock()
+	delete(sloStates, session)
+	sloMtx.Unlock()
+}
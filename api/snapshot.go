@@ -0,0 +1,286 @@
+// api/snapshot.go
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/pool"
+	"proxy-api/internal/proxy"
+)
+
+// Etiquetas asignadas a los proxies de una instantánea
+const (
+	tagCached = "cached" // Con cliente en caché tras responder correctamente
+)
+
+// SnapshotProxy es un proxy de la instantánea con su puntuación y etiquetas
+type SnapshotProxy struct {
+	Address     string       `json:"address"`
+	Proxy       *proxy.Proxy `json:"proxy,omitempty"` // Esquema, credenciales y fuentes; sin él se asume http://address
+	Successes   int64        `json:"successes,omitempty"`
+	Failures    int64        `json:"failures,omitempty"`
+	LastSuccess time.Time    `json:"last_success,omitempty"`
+	LastFailure time.Time    `json:"last_failure,omitempty"`
+	Hourly      []int64      `json:"hourly,omitempty"` // Éxitos y fallos alternos por hora del día
+	Tags        []string     `json:"tags,omitempty"`
+}
+
+// PoolSnapshot es la instantánea del pool de proxies validados
+type PoolSnapshot struct {
+	CreatedAt time.Time                  `json:"created_at"`
+	Sessions  map[string][]SnapshotProxy `json:"sessions"`
+}
+
+// exportPool construye la instantánea del pool vigente
+func (s *server) exportPool() PoolSnapshot {
+	snapshot := PoolSnapshot{
+		CreatedAt: time.Now(),
+		Sessions:  make(map[string][]SnapshotProxy),
+	}
+
+	for session, proxies := range s.pool.All() {
+		cached := make(map[string]bool)
+		for _, proxyAddr := range s.successfulProxyList(session) {
+			cached[proxyAddress(proxyAddr)] = true
+		}
+
+		entries := make([]SnapshotProxy, 0, len(proxies))
+		for _, p := range proxies {
+			address := p.Address()
+			score := s.pool.Score(session, address)
+			entry := SnapshotProxy{
+				Address:     address,
+				Proxy:       &p,
+				Successes:   score.Successes,
+				Failures:    score.Failures,
+				LastSuccess: score.LastSuccess,
+				LastFailure: score.LastFailure,
+			}
+			if score.Successes+score.Failures > 0 {
+				for _, bucket := range score.Hourly {
+					entry.Hourly = append(entry.Hourly, bucket.Successes, bucket.Failures)
+				}
+			}
+			if cached[address] {
+				entry.Tags = append(entry.Tags, tagCached)
+			}
+			entry.Tags = append(entry.Tags, asnTags(address)...)
+			p.Tags = entry.Tags
+			if score.Successes+score.Failures > 0 {
+				p.Score = float64(score.Successes+1) / float64(score.Successes+score.Failures+2)
+			}
+			entries = append(entries, entry)
+		}
+		snapshot.Sessions[session] = entries
+	}
+	return snapshot
+}
+
+// importedProxy es un proxy de la instantánea que no estaba en el pool de la sesión
+type importedProxy struct {
+	session string
+	proxy   proxy.Proxy
+	score   pool.Score
+	passed  bool
+}
+
+// importPool añade al pool los proxies de la instantánea para las sesiones configuradas.
+// Los que no estaban en el pool pasan antes la prueba de la sesión, como en un ciclo de
+// validación, y solo se añaden los que la superan. Devuelve los añadidos y los descartados.
+func (s *server) importPool(ctx context.Context, snapshot PoolSnapshot) (imported, rejected int) {
+	var candidates []*importedProxy
+	seen := make(map[string]bool)
+	for session, entries := range snapshot.Sessions {
+		if _, ok := config.GetSession(session); !ok {
+			log.Printf("Sesión %s de la instantánea no configurada, se omite", session)
+			continue
+		}
+
+		for _, entry := range entries {
+			var p proxy.Proxy
+			if entry.Proxy != nil {
+				p = *entry.Proxy
+			} else {
+				parsed, err := proxy.Parse(entry.Address)
+				if err != nil {
+					log.Printf("Proxy %s de la instantánea no válido, se omite: %v", entry.Address, err)
+					continue
+				}
+				p = parsed
+			}
+			p.Tags, p.Score = nil, 0
+
+			score := pool.Score{
+				Successes:   entry.Successes,
+				Failures:    entry.Failures,
+				LastSuccess: entry.LastSuccess,
+				LastFailure: entry.LastFailure,
+			}
+			for hour := 0; hour < len(score.Hourly) && 2*hour+1 < len(entry.Hourly); hour++ {
+				score.Hourly[hour] = pool.HourBucket{Successes: entry.Hourly[2*hour], Failures: entry.Hourly[2*hour+1]}
+			}
+			if _, known := s.pool.Lookup(session, p.String()); known {
+				s.pool.MergeScore(session, p.Address(), score)
+				continue
+			}
+			if seen[session+" "+p.String()] {
+				continue
+			}
+			seen[session+" "+p.String()] = true
+			candidates = append(candidates, &importedProxy{session: session, proxy: p, score: score})
+		}
+	}
+
+	testImported(ctx, candidates)
+	if err := ctx.Err(); err != nil {
+		return 0, 0
+	}
+
+	// El pool se lee después de las pruebas para no deshacer un ciclo que terminó entretanto
+	current := s.pool.All()
+	merged := make(map[string][]proxy.Proxy, len(current))
+	for session, proxies := range current {
+		merged[session] = append([]proxy.Proxy(nil), proxies...)
+	}
+	known := make(map[string]map[string]bool)
+	for _, c := range candidates {
+		if !c.passed {
+			rejected++
+			continue
+		}
+		if known[c.session] == nil {
+			known[c.session] = make(map[string]bool, len(merged[c.session]))
+			for _, p := range merged[c.session] {
+				known[c.session][p.String()] = true
+			}
+		}
+		s.pool.MergeScore(c.session, c.proxy.Address(), c.score)
+		s.rememberImported(c.session, c.proxy)
+		if !known[c.session][c.proxy.String()] {
+			merged[c.session] = append(merged[c.session], c.proxy)
+			known[c.session][c.proxy.String()] = true
+			imported++
+		}
+	}
+
+	s.updateProxies(merged)
+
+	// Un pool sembrado permite atender sin esperar a la primera validación
+	if imported > 0 {
+		s.markReady()
+	}
+	return imported, rejected
+}
+
+// testImported pasa a cada proxy la prueba de su sesión, repartiendo las pruebas como
+// las de un chunk de la validación
+func testImported(ctx context.Context, candidates []*importedProxy) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, proxy.ChunkSize)
+	for _, c := range candidates {
+		cfg, ok := config.GetSession(c.session)
+		if !ok || (c.proxy.IsIPv6() && cfg.ExcludeIPv6) {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(c *importedProxy) {
+			defer func() { <-slots; wg.Done() }()
+			c.passed = proxy.RunProxyTest(ctx, cfg, c.proxy)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// rememberImported guarda un proxy importado para que los ciclos de validación, que
+// solo ven los de las fuentes, lo vuelvan a probar en lugar de retirarlo del pool
+func (s *server) rememberImported(session string, p proxy.Proxy) {
+	s.importedMtx.Lock()
+	defer s.importedMtx.Unlock()
+	if s.imported == nil {
+		s.imported = make(map[string]map[string]proxy.Proxy)
+	}
+	if s.imported[session] == nil {
+		s.imported[session] = make(map[string]proxy.Proxy)
+	}
+	s.imported[session][p.String()] = p
+}
+
+// mergeImported añade a los proxies validados en un ciclo los importados que no
+// estaban entre ellos y superan otra vez la prueba de su sesión. Los que la fallan, o
+// cuya sesión ya no existe, se olvidan.
+func (s *server) mergeImported(ctx context.Context, proxies map[string][]proxy.Proxy) {
+	s.importedMtx.Lock()
+	var candidates []*importedProxy
+	for session, entries := range s.imported {
+		validated := make(map[string]bool, len(proxies[session]))
+		for _, p := range proxies[session] {
+			validated[p.String()] = true
+		}
+		for key, p := range entries {
+			if validated[key] {
+				// Las fuentes ya lo incluyen: la validación se ocupa de él
+				delete(entries, key)
+				continue
+			}
+			candidates = append(candidates, &importedProxy{session: session, proxy: p})
+		}
+	}
+	s.importedMtx.Unlock()
+	if len(candidates) == 0 {
+		return
+	}
+
+	testImported(ctx, candidates)
+	if ctx.Err() != nil {
+		return
+	}
+	kept := 0
+	s.importedMtx.Lock()
+	for _, c := range candidates {
+		if !c.passed {
+			delete(s.imported[c.session], c.proxy.String())
+			continue
+		}
+		proxies[c.session] = append(proxies[c.session], c.proxy)
+		kept++
+	}
+	for session, entries := range s.imported {
+		if len(entries) == 0 {
+			delete(s.imported, session)
+		}
+	}
+	s.importedMtx.Unlock()
+	log.Printf("Proxies importados revalidados: %d se mantienen, %d retirados", kept, len(candidates)-kept)
+}
+
+// ExportPool - Devuelve una instantánea JSON de los proxies validados con puntuaciones y etiquetas
+func (s *server) ExportPool(ctx context.Context, req *pb.ExportPoolRequest) (*pb.PoolSnapshot, error) {
+	data, err := json.MarshalIndent(s.exportPool(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PoolSnapshot{Json: data}, nil
+}
+
+// ImportPool - Incorpora al pool los proxies de una instantánea JSON
+func (s *server) ImportPool(ctx context.Context, req *pb.PoolSnapshot) (*pb.ImportPoolResponse, error) {
+	var snapshot PoolSnapshot
+	if err := json.Unmarshal(req.Json, &snapshot); err != nil {
+		return nil, fmt.Errorf("invalid pool snapshot: %w", err)
+	}
+
+	imported, rejected := s.importPool(ctx, snapshot)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	log.Printf("Instantánea importada: %d proxies nuevos, %d descartados por no superar la prueba de su sesión", imported, rejected)
+	return &pb.ImportPoolResponse{Imported: int32(imported), Rejected: int32(rejected)}, nil
+}
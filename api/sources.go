@@ -0,0 +1,39 @@
+// api/sources.go
+package api
+
+import (
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/scraper"
+)
+
+// sourceStatsSnapshot devuelve el estado de las descargas de cada fuente de proxies
+func sourceStatsSnapshot() []*pb.SourceStats {
+	health := scraper.SourceHealthSnapshot()
+	stats := make([]*pb.SourceStats, 0, len(health))
+	for _, h := range health {
+		stats = append(stats, &pb.SourceStats{
+			Url:                 h.URL,
+			Fetches:             h.Fetches,
+			Failures:            h.Failures,
+			ConsecutiveFailures: int32(h.ConsecutiveFailures),
+			LastError:           h.LastError,
+			LastFetch:           unixMilli(h.LastFetch),
+			LastSuccess:         unixMilli(h.LastSuccess),
+			SkippedUntil:        unixMilli(h.SkippedUntil),
+			Lines:               int32(h.Lines),
+			Parsed:              int32(h.Parsed),
+			Valid:               int32(h.Valid),
+		})
+	}
+	return stats
+}
+
+// unixMilli devuelve t en milisegundos Unix, 0 si es la fecha cero
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,66 @@
+// api/sourcewatch.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"proxy-api/internal/config"
+)
+
+// sourceDirPoll es el intervalo con el que se revisa PROXY_SOURCES_DIR
+const sourceDirPoll = 30 * time.Second
+
+// watchSourcesDir avisa por el canal devuelto cuando cambia algún fichero de
+// PROXY_SOURCES_DIR, para revalidar sin esperar al siguiente ciclo. Sin directorio
+// devuelve nil, un canal que nunca recibe.
+func watchSourcesDir(ctx context.Context) <-chan struct{} {
+	if config.ProxySourcesDir == "" {
+		return nil
+	}
+	changed := make(chan struct{}, 1)
+	go func() {
+		last := sourceDirState()
+		ticker := time.NewTicker(sourceDirPoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current := sourceDirState()
+			if current == last {
+				continue
+			}
+			last = current
+			log.Printf("Cambios en %s, se revalida el pool", config.ProxySourcesDir)
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changed
+}
+
+// sourceDirState resume los ficheros del directorio: nombre, tamaño y modificación
+func sourceDirState() string {
+	files, err := config.SourceDirFiles(config.ProxySourcesDir)
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%s|%d|%d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
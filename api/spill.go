@@ -0,0 +1,303 @@
+// api/spill.go
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// spillChunkSize es el tamaño de los trozos de ReadSpilledBody
+const spillChunkSize = 1 << 20
+
+// spilledBody es un contenido guardado en disco en lugar de ir en la respuesta
+type spilledBody struct {
+	token   string
+	size    int64
+	expires time.Time
+}
+
+// spillDir devuelve el directorio de los contenidos guardados
+func spillDir() string {
+	if config.SpillDir != "" {
+		return config.SpillDir
+	}
+	return filepath.Join(os.TempDir(), "proxy-api-spill")
+}
+
+// createSpill crea en SPILL_DIR el fichero de un contenido nuevo
+func createSpill() (*os.File, *spilledBody, error) {
+	if err := os.MkdirAll(spillDir(), 0o700); err != nil {
+		return nil, nil, err
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	file, err := os.OpenFile(filepath.Join(spillDir(), token), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, &spilledBody{token: token, expires: time.Now().Add(time.Duration(config.SpillTTL) * time.Second)}, nil
+}
+
+// errSpillDirFull indica que SPILL_DIR no tiene sitio para otro contenido. Como
+// errBodyTooLarge, detiene la cadena de intentos: otro proxy no lo arreglaría.
+type errSpillDirFull struct{}
+
+func (errSpillDirFull) Error() string {
+	return fmt.Sprintf("spill directory is full (SPILL_DIR_MAX_BYTES=%d)", config.SpillDirMaxBytes)
+}
+
+func (e errSpillDirFull) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, e.Error())
+}
+
+// spillRoom devuelve los bytes que puede ocupar un contenido nuevo en SPILL_DIR:
+// SPILL_MAX_BYTES, rebajado a lo que queda libre de SPILL_DIR_MAX_BYTES, y si es la
+// cuota del directorio la que lo limita. Un tamaño negativo no limita.
+func spillRoom() (room int64, dirLimited bool) {
+	room = -1
+	if config.SpillMaxBytes > 0 {
+		room = config.SpillMaxBytes
+	}
+	if config.SpillDirMaxBytes <= 0 {
+		return room, false
+	}
+	free := config.SpillDirMaxBytes - spillDirUsage()
+	if free < 0 {
+		free = 0
+	}
+	if room < 0 || free < room {
+		return free, true
+	}
+	return room, false
+}
+
+// spillDirUsage devuelve los bytes que ocupan los contenidos guardados
+func spillDirUsage() int64 {
+	entries, err := os.ReadDir(spillDir())
+	if err != nil {
+		return 0
+	}
+	var used int64
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			used += info.Size()
+		}
+	}
+	return used
+}
+
+// errSpillTooLarge es el error de un contenido que no cabe en room
+func errSpillTooLarge(room int64, dirLimited bool) error {
+	if dirLimited {
+		return errSpillDirFull{}
+	}
+	return errBodyTooLarge{limit: room}
+}
+
+// readSpilling lee r en memoria hasta superar SPILL_THRESHOLD_BYTES; a partir de ahí
+// escribe el cuerpo en un fichero de SPILL_DIR a medida que lo lee, sin retenerlo, y
+// devuelve solo los primeros bytes. spilled es nil si el cuerpo cupo en memoria. La
+// lectura se aborta al superar SPILL_MAX_BYTES o el espacio libre de SPILL_DIR_MAX_BYTES.
+func readSpilling(r io.Reader) (head []byte, spilled *spilledBody, err error) {
+	head, err = io.ReadAll(io.LimitReader(r, config.SpillThreshold+1))
+	if err != nil || int64(len(head)) <= config.SpillThreshold {
+		return head, nil, err
+	}
+
+	room, dirLimited := spillRoom()
+	if room >= 0 && int64(len(head)) > room {
+		return nil, nil, errSpillTooLarge(room, dirLimited)
+	}
+	file, spilled, err := createSpill()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to spill response body: %w", err)
+	}
+	written, err := file.Write(head)
+	n := int64(written)
+	if err == nil {
+		rest := r
+		if room >= 0 {
+			rest = io.LimitReader(r, room-n+1)
+		}
+		var copied int64
+		copied, err = io.Copy(file, rest)
+		n += copied
+		if err == nil && room >= 0 && n > room {
+			err = errSpillTooLarge(room, dirLimited)
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		spilled.remove()
+		return nil, nil, err
+	}
+	spilled.size = n
+	return head, spilled, nil
+}
+
+// keepSpilled sustituye el contenido del resultado por el que se escribió en disco, si lo hay
+func (r *fetchResult) keepSpilled(spilled *spilledBody) {
+	if spilled != nil {
+		r.content, r.spilled = nil, spilled
+	}
+}
+
+// truncate recorta el contenido guardado a size bytes
+func (b *spilledBody) truncate(size int64) error {
+	path, _ := spilledPath(b.token)
+	if err := os.Truncate(path, size); err != nil {
+		return err
+	}
+	b.size = size
+	return nil
+}
+
+// remove borra el contenido guardado; nil no hace nada
+func (b *spilledBody) remove() {
+	if b == nil {
+		return
+	}
+	path, _ := spilledPath(b.token)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error al borrar el contenido guardado %s: %v", b.token, err)
+	}
+}
+
+// spillContent deja en SPILL_DIR el contenido de la respuesta si la petición lo permite
+// y supera SPILL_THRESHOLD_BYTES, que debe quedar por debajo del límite de los mensajes
+// gRPC. El que readBody ya escribió en disco se devuelve tal cual; el que llegó en
+// memoria (de la caché o de un destino sin spill_large_body) se escribe ahora. Devuelve
+// nil si el contenido va en la respuesta.
+func spillContent(req *pb.Request, result *fetchResult) (*spilledBody, error) {
+	if result.spilled != nil {
+		return result.spilled, nil
+	}
+	if !req.SpillLargeBody || int64(len(result.content)) <= config.SpillThreshold {
+		return nil, nil
+	}
+	if room, dirLimited := spillRoom(); room >= 0 && int64(len(result.content)) > room {
+		return nil, errSpillTooLarge(room, dirLimited)
+	}
+
+	file, spilled, err := createSpill()
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Write(result.content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		spilled.remove()
+		return nil, err
+	}
+	spilled.size = int64(len(result.content))
+	result.content = nil
+	return spilled, nil
+}
+
+// spilledPath devuelve el fichero del token; el token debe ser uno generado por
+// spillContent para no salir del directorio
+func spilledPath(token string) (string, error) {
+	if b, err := hex.DecodeString(token); err != nil || len(b) != 16 {
+		return "", status.Errorf(codes.InvalidArgument, "invalid spill token '%s'", token)
+	}
+	return filepath.Join(spillDir(), token), nil
+}
+
+// ReadSpilledBody - Envía en trozos el contenido que una respuesta con spill_token dejó en disco
+func (s *server) ReadSpilledBody(req *pb.SpilledBodyRequest, stream pb.ProxyService_ReadSpilledBodyServer) error {
+	path, err := spilledPath(req.Token)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return status.Errorf(codes.NotFound, "spilled body '%s' not found or expired", req.Token)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	// El fichero sigue en disco hasta la siguiente pasada de cleanSpilledBodies
+	if spillExpired(info) {
+		return status.Errorf(codes.NotFound, "spilled body '%s' not found or expired", req.Token)
+	}
+
+	buf := make([]byte, spillChunkSize)
+	for offset := int64(0); ; {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 || offset == 0 {
+			chunk := &pb.DownloadChunk{Offset: offset, Data: buf[:n]}
+			if offset == 0 {
+				chunk.TotalSize = info.Size()
+			}
+			if sendErr := stream.Send(chunk); sendErr != nil {
+				return sendErr
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// cleanSpilledBodies borra cada minuto los contenidos guardados hace más de
+// SPILL_TTL_S, incluidos los que quedaron de una ejecución anterior, hasta que ctx termine
+func cleanSpilledBodies(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		removeExpiredSpills()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// spillExpired indica si el contenido guardado superó SPILL_TTL_S
+func spillExpired(info os.FileInfo) bool {
+	return time.Since(info.ModTime()) >= time.Duration(config.SpillTTL)*time.Second
+}
+
+func removeExpiredSpills() {
+	entries, err := os.ReadDir(spillDir())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !spillExpired(info) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(spillDir(), entry.Name())); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error al borrar el contenido guardado %s: %v", entry.Name(), err)
+		}
+	}
+}
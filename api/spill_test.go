@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+)
+
+func TestReadBodySpills(t *testing.T) {
+	defer func(dir string, threshold int64) { config.SpillDir, config.SpillThreshold = dir, threshold }(config.SpillDir, config.SpillThreshold)
+	config.SpillDir, config.SpillThreshold = t.TempDir(), 16
+
+	body := bytes.Repeat([]byte("0123456789"), 10)
+	cases := []struct {
+		name      string
+		req       *pb.Request
+		wantSize  int64 // -1 si el cuerpo queda en memoria
+		truncated bool
+		tooLarge  bool
+	}{
+		{name: "sin spill_large_body", req: &pb.Request{}, wantSize: -1},
+		{name: "completo", req: &pb.Request{SpillLargeBody: true}, wantSize: 100},
+		{name: "truncado", req: &pb.Request{SpillLargeBody: true, MaxBodyBytes: 40, TruncateBody: true}, wantSize: 40, truncated: true},
+		{name: "supera el límite", req: &pb.Request{SpillLargeBody: true, MaxBodyBytes: 40}, tooLarge: true},
+		{name: "límite bajo el umbral", req: &pb.Request{SpillLargeBody: true, MaxBodyBytes: 10, TruncateBody: true}, wantSize: -1, truncated: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, truncated, spilled, err := readBody(context.Background(), io.NopCloser(bytes.NewReader(body)), c.req)
+			if c.tooLarge {
+				if !errors.As(err, new(errBodyTooLarge)) {
+					t.Fatalf("readBody = %v, se esperaba errBodyTooLarge", err)
+				}
+				if entries, _ := os.ReadDir(config.SpillDir); len(entries) != 0 {
+					t.Fatalf("quedaron %d ficheros tras el error", len(entries))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if truncated != c.truncated {
+				t.Fatalf("truncated = %v, se esperaba %v", truncated, c.truncated)
+			}
+			if c.wantSize < 0 {
+				if spilled != nil {
+					t.Fatal("el cuerpo se guardó en disco")
+				}
+				return
+			}
+			if spilled == nil {
+				t.Fatal("el cuerpo no se guardó en disco")
+			}
+			defer spilled.remove()
+			path, _ := spilledPath(spilled.token)
+			saved, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spilled.size != c.wantSize || !bytes.Equal(saved, body[:c.wantSize]) {
+				t.Fatalf("se guardaron %d bytes (%d en el fichero), se esperaban %d", spilled.size, len(saved), c.wantSize)
+			}
+			// En memoria solo quedan los primeros bytes para las comprobaciones
+			if int64(len(data)) != config.SpillThreshold+1 {
+				t.Fatalf("quedaron %d bytes en memoria", len(data))
+			}
+		})
+	}
+}
+
+func TestReadBodySpillLimits(t *testing.T) {
+	defer func(dir string, threshold, max, dirMax int64) {
+		config.SpillDir, config.SpillThreshold, config.SpillMaxBytes, config.SpillDirMaxBytes = dir, threshold, max, dirMax
+	}(config.SpillDir, config.SpillThreshold, config.SpillMaxBytes, config.SpillDirMaxBytes)
+	config.SpillThreshold = 16
+
+	body := bytes.Repeat([]byte("0123456789"), 10)
+	cases := []struct {
+		name     string
+		max      int64
+		dirMax   int64
+		used     int // Bytes que ya ocupan otros contenidos
+		wantErr  error
+		wantSize int64
+	}{
+		{name: "cabe", max: 100, dirMax: 200, wantSize: 100},
+		{name: "supera SPILL_MAX_BYTES", max: 50, wantErr: errBodyTooLarge{}},
+		{name: "supera el espacio libre", dirMax: 150, used: 60, wantErr: errSpillDirFull{}},
+		{name: "directorio lleno", dirMax: 150, used: 150, wantErr: errSpillDirFull{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config.SpillDir, config.SpillMaxBytes, config.SpillDirMaxBytes = t.TempDir(), c.max, c.dirMax
+			if c.used > 0 {
+				if err := os.WriteFile(filepath.Join(config.SpillDir, "previo"), make([]byte, c.used), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, _, spilled, err := readBody(context.Background(), io.NopCloser(bytes.NewReader(body)), &pb.Request{SpillLargeBody: true})
+			switch c.wantErr.(type) {
+			case errBodyTooLarge:
+				if !errors.As(err, new(errBodyTooLarge)) {
+					t.Fatalf("readBody = %v, se esperaba errBodyTooLarge", err)
+				}
+			case errSpillDirFull:
+				if !errors.As(err, new(errSpillDirFull)) {
+					t.Fatalf("readBody = %v, se esperaba errSpillDirFull", err)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer spilled.remove()
+				if spilled.size != c.wantSize {
+					t.Fatalf("se guardaron %d bytes, se esperaban %d", spilled.size, c.wantSize)
+				}
+				return
+			}
+			if entries, _ := os.ReadDir(config.SpillDir); len(entries) != min(c.used, 1) {
+				t.Fatalf("quedaron %d ficheros tras el error", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// api/storage.go
+package api
+
+import (
+	"log"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/proxy"
+	"proxy-api/internal/storage"
+)
+
+// proxyStore es el backend SQL opcional; nil si no está configurado
+var proxyStore *storage.Store
+
+// openStore abre el backend configurado, guarda las sesiones y restaura el último pool
+func (s *server) openStore() {
+	if config.StorageDriver == "" {
+		return
+	}
+
+	store, err := storage.Open(config.StorageDriver, config.StorageDSN)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	proxyStore = store
+
+	if err := proxyStore.SaveSessions(config.Sessions()); err != nil {
+		log.Printf("Error al guardar las sesiones: %v", err)
+	}
+
+	proxies, err := proxyStore.LoadValidProxies()
+	if err != nil {
+		log.Printf("Error al cargar los proxies almacenados: %v", err)
+		return
+	}
+	s.pool.Replace(proxies)
+	log.Printf("Proxies restaurados desde %s: %d", config.StorageDriver, s.pool.Count())
+}
+
+// saveValidProxies persiste el pool tras un ciclo de validación
+func saveValidProxies(proxies map[string][]proxy.Proxy) {
+	if proxyStore == nil {
+		return
+	}
+	if err := proxyStore.SaveValidProxies(proxies); err != nil {
+		log.Printf("Error al guardar los proxies válidos: %v", err)
+	}
+}
+
+// storeProxyResult persiste la puntuación del proxy tras una petición
+func storeProxyResult(session, address string, success bool) {
+	if proxyStore == nil {
+		return
+	}
+	if err := proxyStore.RecordResult(session, address, success); err != nil {
+		log.Printf("Error al guardar el resultado del proxy %s: %v", address, err)
+	}
+}
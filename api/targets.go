@@ -0,0 +1,220 @@
+// api/targets.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/outbound"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Redes no públicas que no cubren los métodos de netip: "esta red", CGNAT, pruebas
+// entre redes y los bloques reservados
+var reservedTargetNets = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// targetList es una lista de destinos de TARGET_ALLOW_HOSTS o TARGET_DENY_HOSTS
+type targetList struct {
+	hosts []string
+	nets  []netip.Prefix
+}
+
+func parseTargetList(list string) targetList {
+	var t targetList
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			t.nets = append(t.nets, prefix.Masked())
+		} else if ip, err := netip.ParseAddr(entry); err == nil {
+			t.nets = append(t.nets, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+		} else {
+			t.hosts = append(t.hosts, entry)
+		}
+	}
+	return t
+}
+
+func (t targetList) empty() bool {
+	return len(t.hosts) == 0 && len(t.nets) == 0
+}
+
+// matchesHost indica si el nombre está en la lista; ".dominio" incluye los subdominios
+func (t targetList) matchesHost(host string) bool {
+	for _, entry := range t.hosts {
+		if host == entry || (strings.HasPrefix(entry, ".") && (strings.HasSuffix(host, entry) || host == entry[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t targetList) matchesIP(ip netip.Addr) bool {
+	for _, prefix := range t.nets {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches indica si el host o alguna de sus direcciones está en la lista
+func (t targetList) matches(host string, ips []netip.Addr) bool {
+	if t.matchesHost(host) {
+		return true
+	}
+	for _, ip := range ips {
+		if t.matchesIP(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// privateTargetIP indica si ip no es una dirección pública de Internet
+func privateTargetIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, prefix := range reservedTargetNets {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockedTargetIP indica si las listas o el bloqueo de direcciones no públicas rechazan ip
+func blockedTargetIP(ip netip.Addr, allow, deny targetList) bool {
+	if deny.matchesIP(ip) {
+		return true
+	}
+	return config.BlockPrivateTargets && privateTargetIP(ip) && !allow.matchesIP(ip)
+}
+
+// resolveTarget devuelve las direcciones de host, que puede ser ya una IP
+func resolveTarget(ctx context.Context, host string) ([]netip.Addr, error) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{ip.Unmap()}, nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ips {
+		ips[i] = ips[i].Unmap()
+	}
+	return ips, nil
+}
+
+// checkTargetHost aplica a host las listas de destinos y, con BLOCK_PRIVATE_TARGETS, el
+// bloqueo de direcciones no públicas. El nombre se resuelve aquí aunque la petición vaya
+// por un proxy, que podría resolverlo de otra forma.
+func checkTargetHost(ctx context.Context, host string) error {
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	allow := parseTargetList(config.TargetAllowHosts)
+	deny := parseTargetList(config.TargetDenyHosts)
+	if deny.matchesHost(host) {
+		return status.Errorf(codes.PermissionDenied, "target host '%s' is denied", host)
+	}
+	// Las redirecciones también quedan dentro de los hosts de la clave de API
+	if !scopeAllowsHost(keyScopeFrom(ctx), host) {
+		return status.Errorf(codes.PermissionDenied, "api key '%s' cannot reach host '%s'", apiKeyFrom(ctx), host)
+	}
+
+	var ips []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = []netip.Addr{ip.Unmap()}
+	} else if config.BlockPrivateTargets || len(allow.nets) > 0 || len(deny.nets) > 0 {
+		if ips, err = resolveTarget(ctx, host); err != nil {
+			return status.Errorf(codes.Unavailable, "cannot resolve target host '%s': %v", host, err)
+		}
+	}
+
+	if !allow.empty() && !allow.matches(host, ips) {
+		return status.Errorf(codes.PermissionDenied, "target host '%s' is not in the allow list", host)
+	}
+	for _, ip := range ips {
+		if blockedTargetIP(ip, allow, deny) {
+			return errBlockedTarget(host, ip)
+		}
+	}
+	return nil
+}
+
+func errBlockedTarget(host string, ip netip.Addr) error {
+	return status.Errorf(codes.PermissionDenied, "target host '%s' resolves to the blocked address %s", host, ip)
+}
+
+// checkTarget comprueba antes de pedirla que la URL sea http(s) y su host esté permitido
+func checkTarget(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return status.Errorf(codes.InvalidArgument, "invalid target url '%s'", rawURL)
+	}
+	return checkTargetHost(ctx, u.Hostname())
+}
+
+// checksDials indica si las conexiones directas deben comprobar la dirección del destino
+func checksDials() bool {
+	return config.BlockPrivateTargets || len(parseTargetList(config.TargetDenyHosts).nets) > 0
+}
+
+// guardedDial resuelve el destino y conecta con una dirección comprobada, de modo que un
+// DNS que cambie de respuesta tras la comprobación previa (DNS rebinding) no llegue a la
+// red interna. Las conexiones con el proxy corporativo no se comprueban.
+func guardedDial(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		return dialChecked(ctx, network, address, dial)
+	}
+}
+
+// dialChecked conecta con dial a la primera dirección de address que no bloquean las
+// listas de destinos; también la usa el cliente HTTP/3, cuyas conexiones no son net.Conn
+func dialChecked[C any](ctx context.Context, network, address string, dial func(ctx context.Context, network, address string) (C, error)) (C, error) {
+	var none C
+	if !checksDials() || outbound.IsUpstream(address) {
+		return dial(ctx, network, address)
+	}
+	allow := parseTargetList(config.TargetAllowHosts)
+	deny := parseTargetList(config.TargetDenyHosts)
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return none, err
+	}
+	ips, err := resolveTarget(ctx, host)
+	if err != nil {
+		return none, err
+	}
+	lastErr := fmt.Errorf("no addresses for target host '%s'", host)
+	for _, ip := range ips {
+		if blockedTargetIP(ip, allow, deny) {
+			lastErr = errBlockedTarget(host, ip)
+			continue
+		}
+		conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return none, lastErr
+}
@@ -0,0 +1,429 @@
+// api/tenants.go
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Métodos que solo pueden llamar los tenants con Admin: exponen o cambian el estado
+// compartido por todos
+var tenantAdminMethods = map[string]bool{
+	"/fetch.ProxyService/GetProxyStats":    true,
+	"/fetch.ProxyService/WatchValidation":  true,
+	"/fetch.ProxyService/QueryAuditLog":    true,
+	"/fetch.ProxyService/ExportPool":       true,
+	"/fetch.ProxyService/ImportPool":       true,
+	"/fetch.ProxyService/ExportHAR":        true,
+	"/fetch.ProxyService/GetHostIntel":     true,
+	"/fetch.ProxyService/ReloadUserAgents": true,
+}
+
+// isTenantExempt indica si el método se atiende sin clave de API: el health check y la
+// reflexión, que no exponen datos de ningún tenant
+func isTenantExempt(method string) bool {
+	return strings.HasPrefix(method, "/grpc.health.v1.Health/") || strings.HasPrefix(method, "/grpc.reflection.")
+}
+
+type tenantKey struct{}
+
+type apiKeyKey struct{}
+
+type keyScopeKey struct{}
+
+// tenantAuth es la clave de API con la que se autenticó una llamada
+type tenantAuth struct {
+	tenant *config.Tenant
+	keyID  string
+	scope  config.KeyScope
+}
+
+// apiKeyFrom devuelve el identificador de la clave de API de la llamada, vacío sin tenants
+func apiKeyFrom(ctx context.Context) string {
+	id, _ := ctx.Value(apiKeyKey{}).(string)
+	return id
+}
+
+// apiKeyID identifica una clave sin revelarla: el tenant y el principio de su SHA-256
+func apiKeyID(tenant, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return tenant + ":" + hex.EncodeToString(sum[:4])
+}
+
+// withTenant añade a ctx el tenant, la clave de la llamada y su ámbito
+func withTenant(ctx context.Context, auth *tenantAuth) context.Context {
+	ctx = context.WithValue(ctx, tenantKey{}, auth.tenant)
+	ctx = context.WithValue(ctx, apiKeyKey{}, auth.keyID)
+	return context.WithValue(ctx, keyScopeKey{}, &auth.scope)
+}
+
+// detachTenant devuelve un contexto que cuelga de base con el tenant, la clave y el
+// ámbito de la llamada ctx, para los trabajos que la sobreviven
+func detachTenant(base, ctx context.Context) context.Context {
+	tenant := tenantFrom(ctx)
+	if tenant == nil {
+		return base
+	}
+	base = context.WithValue(base, tenantKey{}, tenant)
+	base = context.WithValue(base, apiKeyKey{}, apiKeyFrom(ctx))
+	return context.WithValue(base, keyScopeKey{}, keyScopeFrom(ctx))
+}
+
+// keyScopeFrom devuelve el ámbito de la clave de API de la llamada, nil sin tenants
+func keyScopeFrom(ctx context.Context) *config.KeyScope {
+	scope, _ := ctx.Value(keyScopeKey{}).(*config.KeyScope)
+	return scope
+}
+
+// scopeAllowsHost indica si el ámbito de la clave permite el host de destino. Los hosts
+// se comparan por nombre, sin resolverlos; las IPs y redes, con los destinos que ya son IPs.
+func scopeAllowsHost(scope *config.KeyScope, host string) bool {
+	if scope == nil || len(scope.Hosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	allowed := parseTargetList(strings.Join(scope.Hosts, ","))
+	if ip, err := netip.ParseAddr(host); err == nil && allowed.matchesIP(ip.Unmap()) {
+		return true
+	}
+	return host != "" && allowed.matchesHost(host)
+}
+
+// messageTargets devuelve los hosts de destino de los mensajes que abren peticiones, nil
+// para el resto. Una URL que no se puede interpretar aporta un host vacío.
+func messageTargets(m protoreflect.Message) []string {
+	switch msg := m.Interface().(type) {
+	case *pb.Request:
+		return []string{urlHostname(msg.Url)}
+	case *pb.StreamOpen:
+		return []string{urlHostname(msg.Url)}
+	case *pb.TunnelOpen:
+		host, _, _ := net.SplitHostPort(msg.Target)
+		return []string{host}
+	case *pb.WarmupRequest:
+		hosts := make([]string, len(msg.Urls))
+		for i, rawURL := range msg.Urls {
+			hosts[i] = urlHostname(rawURL)
+		}
+		return hosts
+	}
+	return nil
+}
+
+// urlHostname devuelve el host de la URL, vacío si no se puede interpretar
+func urlHostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// tenantFrom devuelve el tenant autenticado de la llamada, nil sin tenants
+func tenantFrom(ctx context.Context) *config.Tenant {
+	tenant, _ := ctx.Value(tenantKey{}).(*config.Tenant)
+	return tenant
+}
+
+// tenantCanSee indica si el tenant de la llamada puede ver los trabajos y peticiones
+// programadas de la sesión: las de su espacio de nombres y las compartidas con él
+func tenantCanSee(ctx context.Context, session string) bool {
+	tenant := tenantFrom(ctx)
+	if tenant == nil || tenant.Admin {
+		return true
+	}
+	return strings.HasPrefix(session, tenant.Name+config.TenantSessionSeparator) || tenant.SharesSession(session)
+}
+
+// tenantUsage es el consumo de un tenant en un día UTC
+type tenantUsage struct {
+	day      string
+	requests int64
+	bytes    int64
+}
+
+var (
+	tenantUsages    = make(map[string]*tenantUsage)
+	tenantUsagesMtx sync.Mutex
+)
+
+// usageToday devuelve el consumo del día del tenant, empezando uno nuevo al cambiar de
+// día; debe llamarse con tenantUsagesMtx
+func usageToday(tenant string) *tenantUsage {
+	day := time.Now().UTC().Format("2006-01-02")
+	usage, ok := tenantUsages[tenant]
+	if !ok || usage.day != day {
+		usage = &tenantUsage{day: day}
+		tenantUsages[tenant] = usage
+	}
+	return usage
+}
+
+// chargeRequests anota n peticiones del tenant, o devuelve ResourceExhausted si
+// superan alguna de sus cuotas diarias
+func chargeRequests(tenant *config.Tenant, n int64) error {
+	tenantUsagesMtx.Lock()
+	defer tenantUsagesMtx.Unlock()
+	usage := usageToday(tenant.Name)
+	if tenant.BytesPerDay > 0 && usage.bytes >= tenant.BytesPerDay {
+		return status.Errorf(codes.ResourceExhausted, "tenant '%s' exceeded its daily bandwidth quota of %d bytes", tenant.Name, tenant.BytesPerDay)
+	}
+	if tenant.RequestsPerDay > 0 && usage.requests+n > tenant.RequestsPerDay {
+		return status.Errorf(codes.ResourceExhausted, "tenant '%s' exceeded its daily quota of %d requests", tenant.Name, tenant.RequestsPerDay)
+	}
+	usage.requests += n
+	return nil
+}
+
+// chargeBytes anota los bytes de una respuesta enviada al tenant
+func chargeBytes(tenant *config.Tenant, msg interface{}) {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return
+	}
+	size := int64(proto.Size(m))
+	tenantUsagesMtx.Lock()
+	usageToday(tenant.Name).bytes += size
+	tenantUsagesMtx.Unlock()
+}
+
+// fetchForTenant hace la petición de un trabajo en segundo plano, que no pasa por el
+// interceptor: cobra requests peticiones al tenant de ctx y los bytes de la respuesta
+func (s *server) fetchForTenant(ctx context.Context, req *pb.Request, requests int64) (*pb.Response, error) {
+	tenant := tenantFrom(ctx)
+	if tenant == nil {
+		return s.FetchContent(ctx, req)
+	}
+	if err := chargeRequests(tenant, requests); err != nil {
+		return nil, err
+	}
+	resp, err := s.FetchContent(ctx, req)
+	if err == nil {
+		chargeBytes(tenant, resp)
+	}
+	return resp, err
+}
+
+// authenticateTenant identifica el tenant por la clave de API de la metadata
+// (x-api-key o authorization: Bearer) y comprueba que puede llamar al método
+func authenticateTenant(ctx context.Context, method string) (*tenantAuth, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	key := ""
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		key = keys[0]
+	} else if auth := md.Get("authorization"); len(auth) > 0 {
+		key, _ = strings.CutPrefix(auth[0], "Bearer ")
+	}
+	if key == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing api key")
+	}
+	tenant, scope, ok := config.TenantByKey(key)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid api key")
+	}
+	if tenantAdminMethods[method] && !tenant.Admin {
+		return nil, status.Errorf(codes.PermissionDenied, "tenant '%s' cannot call %s", tenant.Name, method)
+	}
+	return &tenantAuth{tenant: &tenant, keyID: apiKeyID(tenant.Name, key), scope: scope}, nil
+}
+
+// tenantSession traduce la sesión que pide el tenant a la de su espacio de nombres:
+// "<tenant>/<sesión>" si existe, o la compartida si la tiene en SharedSessions. Una
+// clave con ámbito solo puede pedir las sesiones de su lista.
+func tenantSession(auth *tenantAuth, session string) (string, error) {
+	tenant := auth.tenant
+	if len(auth.scope.Sessions) > 0 && !slices.Contains(auth.scope.Sessions, session) {
+		return "", status.Errorf(codes.PermissionDenied, "api key '%s' cannot use session '%s'", auth.keyID, session)
+	}
+	if tenant.Admin {
+		return session, nil
+	}
+	if strings.HasPrefix(session, tenant.Name+config.TenantSessionSeparator) {
+		return session, nil
+	}
+	namespaced := tenant.Name + config.TenantSessionSeparator + session
+	if _, ok := config.GetSession(namespaced); ok {
+		return namespaced, nil
+	}
+	if tenant.SharesSession(session) {
+		return session, nil
+	}
+	return "", status.Errorf(codes.PermissionDenied, "session '%s' is not available to tenant '%s'", session, tenant.Name)
+}
+
+// rewriteSessions traduce todos los campos session del mensaje, también los de los
+// mensajes anidados (las peticiones de un lote, la de una petición programada), y
+// devuelve cuántos había. Con una clave limitada a algunos hosts, comprueba además el
+// destino de cada petición.
+func rewriteSessions(m protoreflect.Message, auth *tenantAuth) (int64, error) {
+	for _, host := range messageTargets(m) {
+		if !scopeAllowsHost(&auth.scope, host) {
+			return 0, status.Errorf(codes.PermissionDenied, "api key '%s' cannot reach host '%s'", auth.keyID, host)
+		}
+	}
+	var n int64
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Name() == "session" && fd.Kind() == protoreflect.StringKind && !fd.IsList():
+			var session string
+			if session, err = tenantSession(auth, v.String()); err != nil {
+				return false
+			}
+			m.Set(fd, protoreflect.ValueOfString(session))
+			n++
+		case fd.Kind() == protoreflect.MessageKind && fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				var nested int64
+				nested, err = rewriteSessions(list.Get(i).Message(), auth)
+				n += nested
+			}
+		case fd.Kind() == protoreflect.MessageKind && !fd.IsMap():
+			var nested int64
+			nested, err = rewriteSessions(v.Message(), auth)
+			n += nested
+		}
+		return err == nil
+	})
+	return n, err
+}
+
+// admitTenantMessage traduce las sesiones de un mensaje del tenant y cobra sus peticiones
+func admitTenantMessage(auth *tenantAuth, msg interface{}) error {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil
+	}
+	n, err := rewriteSessions(m.ProtoReflect(), auth)
+	if err != nil {
+		return err
+	}
+	return chargeRequests(auth.tenant, n)
+}
+
+// tenantsInterceptor autentica la llamada con TENANTS_FILE, limita al tenant a sus
+// sesiones y aplica sus cuotas; sin tenants no hace nada
+func tenantsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !config.TenancyEnabled() || isTenantExempt(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	auth, err := authenticateTenant(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := admitTenantMessage(auth, req); err != nil {
+		// Las cuotas son diarias: reintentar no sirve
+		if status.Code(err) == codes.ResourceExhausted {
+			setRetryPushback(ctx, -1)
+		}
+		return nil, err
+	}
+	resp, err := handler(withTenant(ctx, auth), req)
+	if err == nil {
+		chargeBytes(auth.tenant, resp)
+	}
+	return resp, err
+}
+
+// tenantStream aplica la traducción de sesiones y las cuotas a cada mensaje del stream
+type tenantStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	auth *tenantAuth
+}
+
+func (s *tenantStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *tenantStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return admitTenantMessage(s.auth, m)
+}
+
+func (s *tenantStream) SendMsg(m interface{}) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	chargeBytes(s.auth.tenant, m)
+	return nil
+}
+
+func tenantsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !config.TenancyEnabled() || isTenantExempt(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	auth, err := authenticateTenant(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	// Sin peticiones nuevas, un stream abierto se corta al agotar el ancho de banda
+	if err := chargeRequests(auth.tenant, 0); err != nil {
+		return err
+	}
+	return handler(srv, &tenantStream{ServerStream: ss, ctx: withTenant(ss.Context(), auth), auth: auth})
+}
+
+// GetTenantUsage - Devuelve el consumo del día del tenant que llama; los Admin pueden
+// pedir el de otro o, sin indicarlo, el de todos
+func (s *server) GetTenantUsage(ctx context.Context, req *pb.TenantUsageRequest) (*pb.TenantUsageResponse, error) {
+	if !config.TenancyEnabled() {
+		return nil, status.Error(codes.FailedPrecondition, "tenants are not configured")
+	}
+	caller := tenantFrom(ctx)
+	if caller == nil {
+		return nil, status.Error(codes.Unauthenticated, "missing api key")
+	}
+	name := req.Tenant
+	if !caller.Admin {
+		if name != "" && name != caller.Name {
+			return nil, status.Errorf(codes.PermissionDenied, "tenant '%s' cannot read the usage of '%s'", caller.Name, name)
+		}
+		name = caller.Name
+	}
+
+	tenantUsagesMtx.Lock()
+	defer tenantUsagesMtx.Unlock()
+	resp := &pb.TenantUsageResponse{}
+	for _, tenant := range config.Tenants() {
+		if name != "" && tenant.Name != name {
+			continue
+		}
+		usage := usageToday(tenant.Name)
+		resp.Tenants = append(resp.Tenants, &pb.TenantUsage{
+			Tenant:         tenant.Name,
+			Day:            usage.day,
+			Requests:       usage.requests,
+			Bytes:          usage.bytes,
+			RequestsPerDay: tenant.RequestsPerDay,
+			BytesPerDay:    tenant.BytesPerDay,
+		})
+	}
+	if name != "" && len(resp.Tenants) == 0 {
+		return nil, status.Errorf(codes.NotFound, "tenant '%s' not found", name)
+	}
+	sort.Slice(resp.Tenants, func(i, j int) bool { return resp.Tenants[i].Tenant < resp.Tenants[j].Tenant })
+	return resp, nil
+}
@@ -0,0 +1,39 @@
+// api/tlsconfig.go
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"proxy-api/internal/config"
+)
+
+// sessionTLSConfig construye la configuración TLS de las opciones de la sesión; nil si
+// no cambian la verificación por defecto
+func sessionTLSConfig(opts config.TLSOptions) (*tls.Config, error) {
+	if opts == (config.TLSOptions{}) {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+		ServerName:         opts.ServerName,
+	}
+	if opts.RootCAs != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(opts.RootCAs)
+		if err != nil {
+			return nil, fmt.Errorf("tls root CAs: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls root CAs '%s'", opts.RootCAs)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
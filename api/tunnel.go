@@ -0,0 +1,141 @@
+// api/tunnel.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/outbound"
+	"proxy-api/internal/proxy"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tiempo máximo para conectar con el proxy y completar el CONNECT
+const tunnelDialTimeout = 10 * time.Second
+
+// dialTunnel abre un túnel hacia target a través del proxy del pool: CONNECT para los
+// http y https y SOCKS5 para los socks5. La conexión con el proxy pasa por el bloqueo de
+// destinos, de modo que un proxy en una dirección interna no sirve de puente hacia ella.
+func dialTunnel(ctx context.Context, proxyURL *url.URL, target string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, tunnelDialTimeout)
+	defer cancel()
+	return outbound.DialViaWith(ctx, guardedDial(outbound.DialContext), proxyURL, target)
+}
+
+// tunnelProxy busca en el pool de la sesión el proxy pedido por el cliente, como
+// esquema://host:puerto o, para los http, como host:puerto
+func (s *server) tunnelProxy(session, proxyAddr string) (proxy.Proxy, error) {
+	if p, ok := s.pool.Lookup(session, proxyAddr); ok {
+		return p, nil
+	}
+	if !strings.Contains(proxyAddr, "://") {
+		if p, ok := s.pool.Lookup(session, "http://"+proxyAddr); ok {
+			return p, nil
+		}
+	}
+	return proxy.Proxy{}, status.Errorf(codes.PermissionDenied, "proxy '%s' is not in the pool of session '%s'", proxyAddr, session)
+}
+
+// Tunnel - Establece un túnel CONNECT a través de un proxy del pool y retransmite bytes en crudo
+func (s *server) Tunnel(stream pb.ProxyService_TunnelServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	open := first.Open
+	if open == nil || open.Target == "" {
+		return fmt.Errorf("first frame must contain the tunnel target")
+	}
+	if _, exists := config.GetSession(open.Session); !exists {
+		return fmt.Errorf("session '%s' not found in configuration", open.Session)
+	}
+	host, _, err := net.SplitHostPort(open.Target)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid tunnel target '%s': %v", open.Target, err)
+	}
+	if err := checkTargetHost(stream.Context(), host); err != nil {
+		return err
+	}
+
+	proxyAddr := open.Proxy
+	if proxyAddr == "" {
+		if proxyAddr, err = s.randomPoolProxy(open.Session); err != nil {
+			return err
+		}
+	}
+	p, err := s.tunnelProxy(open.Session, proxyAddr)
+	if err != nil {
+		return err
+	}
+	proxyAddr = p.Address()
+
+	done, err := s.sessions.begin(open.Session)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	conn, err := dialTunnel(stream.Context(), p.URL(), open.Target)
+	if err != nil {
+		s.recordProxyResult(open.Session, p.String(), false)
+		return err
+	}
+	defer conn.Close()
+	defer recordConnUsage(stream.Context(), open.Session, proxyAddr, conn)
+	// Si el cliente cancela, cerrar la conexión desbloquea la lectura del destino
+	defer context.AfterFunc(stream.Context(), func() { conn.Close() })()
+	log.Printf("Túnel hacia %s vía %s", open.Target, proxyAddr)
+
+	if err := stream.Send(&pb.TunnelFrame{Proxy: proxyAddr}); err != nil {
+		return err
+	}
+
+	// Cliente -> destino; al terminar el cliente se cierra el sentido de escritura
+	go func() {
+		for {
+			frame, err := stream.Recv()
+			if err != nil || frame.Closed {
+				if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+					cw.CloseWrite()
+				} else {
+					conn.Close()
+				}
+				return
+			}
+			if _, err := conn.Write(frame.Data); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	// Destino -> cliente
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if sendErr := stream.Send(&pb.TunnelFrame{Data: append([]byte(nil), buf[:n]...)}); sendErr != nil {
+				return sendErr
+			}
+		}
+		if err == io.EOF {
+			return stream.Send(&pb.TunnelFrame{Closed: true})
+		}
+		if err != nil {
+			if stream.Context().Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// api/usage.go
+package api
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/outbound"
+	"proxy-api/internal/storage"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Dimensiones por las que se reparte el tráfico
+const (
+	usageSession = "session"
+	usageProxy   = "proxy"
+	usageAPIKey  = "api_key"
+)
+
+// usageDay es el formato de los días del consumo
+const usageDay = "2006-01-02"
+
+type usageKey struct {
+	day, dimension, key string
+}
+
+type usageCounters struct {
+	requests, bytesIn, bytesOut int64
+}
+
+// usageTotals son los totales por día y dimensión; con STORAGE_DRIVER, solo lo que
+// falta por guardar
+var (
+	usageTotals = make(map[usageKey]*usageCounters)
+	usageMtx    sync.Mutex
+)
+
+// requestMeter mide los bytes de las conexiones que usa una petición, redirecciones
+// incluidas
+type requestMeter struct {
+	mtx   sync.Mutex
+	start map[*outbound.CountedConn][2]int64 // Bytes leídos y escritos al obtenerla
+}
+
+// withUsageMeter añade a ctx una traza que anota las conexiones de la petición
+func withUsageMeter(ctx context.Context) (context.Context, *requestMeter) {
+	meter := &requestMeter{start: make(map[*outbound.CountedConn][2]int64)}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn, ok := outbound.Counted(info.Conn)
+			if !ok {
+				return
+			}
+			meter.mtx.Lock()
+			defer meter.mtx.Unlock()
+			if _, seen := meter.start[conn]; !seen {
+				read, written := conn.Bytes()
+				meter.start[conn] = [2]int64{read, written}
+			}
+		},
+	}), meter
+}
+
+// bytes devuelve los bytes recibidos y enviados por la petición hasta ahora
+func (m *requestMeter) bytes() (in, out int64, used bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for conn, start := range m.start {
+		read, written := conn.Bytes()
+		in += read - start[0]
+		out += written - start[1]
+	}
+	return in, out, len(m.start) > 0
+}
+
+// recordUsage anota el tráfico de una petición a través de proxyAddr, si llegó a
+// abrir o reutilizar alguna conexión
+func recordUsage(ctx context.Context, session, proxyAddr string, meter *requestMeter) {
+	in, out, used := meter.bytes()
+	if used {
+		addUsage(ctx, session, proxyAddr, in, out)
+	}
+}
+
+// recordConnUsage anota el tráfico de una conexión propia de la petición, como un túnel
+func recordConnUsage(ctx context.Context, session, proxyAddr string, conn net.Conn) {
+	if counted, ok := outbound.Counted(conn); ok {
+		in, out := counted.Bytes()
+		addUsage(ctx, session, proxyAddr, in, out)
+	}
+}
+
+func addUsage(ctx context.Context, session, proxyAddr string, in, out int64) {
+	day := time.Now().UTC().Format(usageDay)
+	keys := []usageKey{
+		{day, usageSession, session},
+		{day, usageProxy, proxyAddress(config.RedactURL(proxyAddr))},
+	}
+	if proxyAddr == directProxy {
+		keys[1].key = directProxy
+	}
+	if id := apiKeyFrom(ctx); id != "" {
+		keys = append(keys, usageKey{day, usageAPIKey, id})
+	}
+
+	usageMtx.Lock()
+	defer usageMtx.Unlock()
+	for _, key := range keys {
+		c, ok := usageTotals[key]
+		if !ok {
+			c = &usageCounters{}
+			usageTotals[key] = c
+		}
+		c.requests++
+		c.bytesIn += in
+		c.bytesOut += out
+	}
+}
+
+// flushUsage guarda el consumo pendiente en el backend SQL cada minuto y descarta el
+// anterior a USAGE_RETENTION_DAYS, hasta que ctx termine
+func flushUsage(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			saveUsage()
+			return
+		case <-ticker.C:
+			saveUsage()
+			pruneUsage()
+		}
+	}
+}
+
+// saveUsage guarda en el backend los totales pendientes; si falla se conservan para
+// el siguiente intento
+func saveUsage() error {
+	if proxyStore == nil {
+		return nil
+	}
+	usageMtx.Lock()
+	pending := usageTotals
+	usageTotals = make(map[usageKey]*usageCounters)
+	usageMtx.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	rows := make([]storage.UsageRow, 0, len(pending))
+	for key, c := range pending {
+		rows = append(rows, storage.UsageRow{Day: key.day, Dimension: key.dimension, Key: key.key, Requests: c.requests, BytesIn: c.bytesIn, BytesOut: c.bytesOut})
+	}
+	if err := proxyStore.AddUsage(rows); err != nil {
+		log.Printf("Error al guardar el consumo: %v", err)
+		usageMtx.Lock()
+		for key, c := range pending {
+			if current, ok := usageTotals[key]; ok {
+				c.requests += current.requests
+				c.bytesIn += current.bytesIn
+				c.bytesOut += current.bytesOut
+			}
+			usageTotals[key] = c
+		}
+		usageMtx.Unlock()
+		return err
+	}
+	return nil
+}
+
+// pruneUsage descarta el consumo de los días que ya no se conservan
+func pruneUsage() {
+	cutoff := time.Now().UTC().AddDate(0, 0, -config.UsageRetentionDays).Format(usageDay)
+	if proxyStore != nil {
+		if err := proxyStore.DeleteUsageBefore(cutoff); err != nil {
+			log.Printf("Error al borrar el consumo antiguo: %v", err)
+		}
+		return
+	}
+	usageMtx.Lock()
+	defer usageMtx.Unlock()
+	for key := range usageTotals {
+		if key.day < cutoff {
+			delete(usageTotals, key)
+		}
+	}
+}
+
+// loadUsage devuelve el consumo de los días entre from y to
+func loadUsage(from, to string) ([]storage.UsageRow, error) {
+	if proxyStore != nil {
+		if err := saveUsage(); err != nil {
+			return nil, err
+		}
+		return proxyStore.LoadUsage(from, to)
+	}
+	usageMtx.Lock()
+	defer usageMtx.Unlock()
+	var rows []storage.UsageRow
+	for key, c := range usageTotals {
+		if key.day >= from && key.day <= to {
+			rows = append(rows, storage.UsageRow{Day: key.day, Dimension: key.dimension, Key: key.key, Requests: c.requests, BytesIn: c.bytesIn, BytesOut: c.bytesOut})
+		}
+	}
+	return rows, nil
+}
+
+// usageVisible indica si el tenant de la llamada puede ver la fila: sus sesiones y sus
+// claves, pero no los proxies, que comparten todos
+func usageVisible(ctx context.Context, row storage.UsageRow) bool {
+	tenant := tenantFrom(ctx)
+	if tenant == nil || tenant.Admin {
+		return true
+	}
+	switch row.Dimension {
+	case usageSession:
+		return tenantCanSee(ctx, row.Key)
+	case usageAPIKey:
+		return strings.HasPrefix(row.Key, tenant.Name+":")
+	}
+	return false
+}
+
+// GetUsage - Devuelve el tráfico por día, sesión, proxy y clave de API
+func (s *server) GetUsage(ctx context.Context, req *pb.UsageRequest) (*pb.UsageReport, error) {
+	today := time.Now().UTC().Format(usageDay)
+	from, to := req.From, req.To
+	if to == "" {
+		to = today
+	}
+	if from == "" {
+		from = to
+	}
+	for _, day := range []string{from, to} {
+		if _, err := time.Parse(usageDay, day); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid day '%s', expected YYYY-MM-DD", day)
+		}
+	}
+	if from > to {
+		return nil, status.Errorf(codes.InvalidArgument, "from '%s' is after to '%s'", from, to)
+	}
+
+	rows, err := loadUsage(from, to)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to load usage: %v", err)
+	}
+	days := make(map[string]*pb.DailyUsage)
+	for _, row := range rows {
+		if !usageVisible(ctx, row) {
+			continue
+		}
+		d, ok := days[row.Day]
+		if !ok {
+			d = &pb.DailyUsage{
+				Day:      row.Day,
+				Sessions: make(map[string]*pb.UsageCounters),
+				Proxies:  make(map[string]*pb.UsageCounters),
+				ApiKeys:  make(map[string]*pb.UsageCounters),
+			}
+			days[row.Day] = d
+		}
+		counters := &pb.UsageCounters{Requests: row.Requests, BytesIn: row.BytesIn, BytesOut: row.BytesOut}
+		switch row.Dimension {
+		case usageSession:
+			d.Sessions[row.Key] = counters
+		case usageProxy:
+			d.Proxies[row.Key] = counters
+		case usageAPIKey:
+			d.ApiKeys[row.Key] = counters
+		}
+	}
+
+	report := &pb.UsageReport{}
+	for _, d := range days {
+		report.Days = append(report.Days, d)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Day < report.Days[j].Day })
+	return report, nil
+}
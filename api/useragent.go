@@ -0,0 +1,174 @@
+// api/useragent.go
+package api
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/scraper"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// userAgents es la lista descargada de user-agents; vacía se usa DEFAULT_USER_AGENT
+var (
+	userAgents       []string
+	userAgentsReload time.Time // Última descarga con resultados
+	userAgentsFailed int       // Descargas sin resultados desde la última con ellos
+	userAgentsMtx    sync.RWMutex
+)
+
+// userAgentsRefreshing evita solapar dos descargas periódicas de la lista
+var userAgentsRefreshing atomic.Bool
+
+// pinnedAgents guarda el user-agent fijado para cada proxy o identidad de una sesión
+var (
+	pinnedAgents   = make(map[string]map[string]string) // sesión -> "proxy:" o "identity:" + clave -> user-agent
+	pinnedAgentMtx sync.Mutex
+)
+
+// randomUserAgent elige un user-agent de la lista, o DEFAULT_USER_AGENT si está vacía
+func randomUserAgent() string {
+	userAgentsMtx.RLock()
+	defer userAgentsMtx.RUnlock()
+	if len(userAgents) == 0 {
+		return config.DefaultUserAgent
+	}
+	return userAgents[rand.Intn(len(userAgents))]
+}
+
+// reloadUserAgents descarga la lista de user-agents. Una descarga sin resultados
+// conserva la lista anterior; si no había ninguna, las peticiones usan
+// DEFAULT_USER_AGENT hasta que otra descarga funcione.
+func reloadUserAgents() bool {
+	list := scraper.ScrapeUserAgents()
+
+	userAgentsMtx.Lock()
+	defer userAgentsMtx.Unlock()
+	if len(list) == 0 {
+		userAgentsFailed++
+		if len(userAgents) == 0 {
+			log.Printf("Aviso: la descarga de user-agents no devolvió ninguno, se usa DEFAULT_USER_AGENT en todas las peticiones")
+		} else {
+			log.Printf("Aviso: la descarga de user-agents no devolvió ninguno, se conservan los %d anteriores", len(userAgents))
+		}
+		return false
+	}
+	userAgents = list
+	userAgentsReload = time.Now()
+	userAgentsFailed = 0
+	return true
+}
+
+// refreshUserAgents descarga la lista en segundo plano, salvo si sigue en curso la anterior
+func refreshUserAgents() {
+	if !userAgentsRefreshing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer userAgentsRefreshing.Store(false)
+		if reloadUserAgents() {
+			log.Printf("User-agents refrescados: %d", userAgentStats().Count)
+		}
+	}()
+}
+
+// userAgentStats describe el estado de la lista de user-agents
+func userAgentStats() *pb.UserAgentStats {
+	userAgentsMtx.RLock()
+	defer userAgentsMtx.RUnlock()
+	stats := &pb.UserAgentStats{
+		Count:               int32(len(userAgents)),
+		UsingDefault:        len(userAgents) == 0,
+		LastReload:          unixMilli(userAgentsReload),
+		AgeS:                -1,
+		ConsecutiveFailures: int32(userAgentsFailed),
+	}
+	if !userAgentsReload.IsZero() {
+		stats.AgeS = int64(time.Since(userAgentsReload).Seconds())
+	}
+	return stats
+}
+
+// ReloadUserAgents - Vuelve a descargar la lista de user-agents
+func (s *server) ReloadUserAgents(ctx context.Context, req *pb.ReloadUserAgentsRequest) (*pb.UserAgentStats, error) {
+	if !reloadUserAgents() {
+		stats := userAgentStats()
+		return nil, status.Errorf(codes.Unavailable, "user-agent scrape returned no entries, keeping %d", stats.Count)
+	}
+	return userAgentStats(), nil
+}
+
+// selectUserAgent devuelve el user-agent de la petición: el indicado por el cliente o
+// el que corresponde según la rotación de la sesión. Con la rotación "proxy" es uno
+// aleatorio que proxyUserAgent sustituye en cada intento.
+func selectUserAgent(req *pb.Request) string {
+	if req.UserAgent != "" {
+		return req.UserAgent
+	}
+
+	cfg, _ := config.GetSession(req.Session)
+	switch cfg.UserAgentPolicy() {
+	case config.UserAgentStatic:
+		return cfg.StaticUserAgent
+	case config.UserAgentIdentity:
+		if req.Identity != "" {
+			return pinnedUserAgent(req.Session, "identity:"+req.Identity)
+		}
+	}
+	return randomUserAgent()
+}
+
+// proxyUserAgent devuelve el user-agent de un intento a través de proxyAddr: el fijado
+// para ese proxy si la sesión rota por proxy, o userAgent si no. El indicado por el
+// cliente y los de una variante de experimento se respetan.
+func proxyUserAgent(ctx context.Context, req *pb.Request, proxyAddr, userAgent string) string {
+	if req.UserAgent != "" {
+		return userAgent
+	}
+	cfg, _ := config.GetSession(req.Session)
+	if proxyAddr == directProxy && cfg.DirectIdentity.UserAgent != "" {
+		return cfg.DirectIdentity.UserAgent
+	}
+	if assignment := variantFrom(ctx); assignment != nil && len(assignment.variant.UserAgents) > 0 {
+		return userAgent
+	}
+	if cfg.UserAgentPolicy() != config.UserAgentProxy {
+		return userAgent
+	}
+	return pinnedUserAgent(req.Session, "proxy:"+proxyAddress(proxyAddr))
+}
+
+// pinnedUserAgent devuelve el user-agent fijado para la clave, eligiendo uno la primera vez
+func pinnedUserAgent(session, key string) string {
+	pinnedAgentMtx.Lock()
+	defer pinnedAgentMtx.Unlock()
+
+	if pinnedAgents[session] == nil {
+		pinnedAgents[session] = make(map[string]string)
+	}
+	userAgent, ok := pinnedAgents[session][key]
+	if !ok {
+		userAgent = randomUserAgent()
+		// DEFAULT_USER_AGENT no se fija, para elegir uno de la lista cuando se descargue
+		if userAgentStats().UsingDefault {
+			return userAgent
+		}
+		pinnedAgents[session][key] = userAgent
+	}
+	return userAgent
+}
+
+// forgetPinnedAgents descarta los user-agents fijados de una sesión
+func forgetPinnedAgents(session string) {
+	pinnedAgentMtx.Lock()
+	delete(pinnedAgents, session)
+	pinnedAgentMtx.Unlock()
+}
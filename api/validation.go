@@ -0,0 +1,38 @@
+// api/validation.go
+package api
+
+import (
+	pb "proxy-api/fetch"
+	"proxy-api/internal/proxy"
+)
+
+// WatchValidation - Emite el progreso de los ciclos de validación hasta que el cliente cancele
+func (s *server) WatchValidation(req *pb.WatchValidationRequest, stream pb.ProxyService_WatchValidationServer) error {
+	events, cancel := proxy.SubscribeProgress()
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case event := <-events:
+			bySession := make(map[string]int32, len(event.ValidBySession))
+			for session, count := range event.ValidBySession {
+				bySession[session] = int32(count)
+			}
+
+			if err := stream.Send(&pb.ValidationEvent{
+				Stage:           event.Stage,
+				TotalProxies:    int32(event.TotalProxies),
+				Tested:          int32(event.Tested),
+				Valid:           int32(event.Valid),
+				ValidBySession:  bySession,
+				ChunksProcessed: int32(event.ChunksProcessed),
+				ChunksTotal:     int32(event.ChunksTotal),
+				Timestamp:       event.Timestamp.UnixMilli(),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// api/warmup.go
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/cache"
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// warmURL es una URL que se refresca en la caché de respuestas
+type warmURL struct {
+	url         string
+	lastRefresh time.Time
+	refreshes   int64
+	failures    int64
+	lastError   string
+}
+
+// warmSet son las URL calientes de una sesión, refrescadas cada interval
+type warmSet struct {
+	session  string
+	tenant   string // Tenant que la registró, vacío sin tenants
+	interval time.Duration
+	cancel   context.CancelFunc
+	refresh  chan struct{} // Adelanta el siguiente refresco
+
+	mtx  sync.Mutex
+	urls []*warmURL
+}
+
+func (w *warmSet) info() *pb.WarmupSet {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	info := &pb.WarmupSet{Session: w.session, IntervalMs: w.interval.Milliseconds()}
+	for _, u := range w.urls {
+		status := &pb.WarmupURL{Url: u.url, Refreshes: u.refreshes, Failures: u.failures, LastError: u.lastError}
+		if !u.lastRefresh.IsZero() {
+			status.LastRefresh = u.lastRefresh.UnixMilli()
+		}
+		info.Urls = append(info.Urls, status)
+	}
+	return info
+}
+
+// isWarm indica si la URL es una de las calientes de la sesión
+func (s *server) isWarm(session, rawURL string) bool {
+	s.warmupsMtx.Lock()
+	w, ok := s.warmSets[session]
+	s.warmupsMtx.Unlock()
+	if !ok {
+		return false
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for _, u := range w.urls {
+		if u.url == rawURL {
+			return true
+		}
+	}
+	return false
+}
+
+// warmResult devuelve la respuesta en caché de una URL caliente, sin contactar con el
+// destino. Las peticiones con validadores propios siguen el camino normal.
+func (s *server) warmResult(req *pb.Request) (*fetchResult, bool) {
+	if !readsCache(req) || req.IfNoneMatch != "" || req.IfModifiedSince != "" || !s.isWarm(req.Session, req.Url) {
+		return nil, false
+	}
+	entry, ok := s.responseCache.Get(cache.Key(req.Session, req.Url))
+	if !ok {
+		return nil, false
+	}
+	return &fetchResult{
+		content:      entry.Content,
+		proxy:        entry.Proxy,
+		status:       entry.Status,
+		contentType:  entry.ContentType,
+		etag:         entry.ETag,
+		lastModified: entry.LastModified,
+		fromCache:    true,
+	}, true
+}
+
+// refreshWarmURL vuelve a pedir la URL a través del pool, revalidando con los
+// validadores de la caché si los hay, y guarda la respuesta
+func (s *server) refreshWarmURL(ctx context.Context, session string, u *warmURL, w *warmSet) {
+	req := &pb.Request{Url: u.url, Session: session, Proxy: true}
+	ctx = withRequestID(ctx)
+	start := time.Now()
+	upstreamReq, cached := s.prepareConditional(req)
+	var result *fetchResult
+	var err error
+	// Cada refresco cuenta como una petición del tenant que registró la URL
+	if tenant := tenantFrom(ctx); tenant != nil {
+		err = chargeRequests(tenant, 1)
+	}
+	if err == nil {
+		result, err = s.fetchContent(ctx, upstreamReq)
+		s.recordAudit(ctx, req, result, err, start)
+	}
+	if err == nil && result.status != http.StatusOK && result.status != http.StatusNotModified {
+		err = fmt.Errorf("status %d", result.status)
+	}
+
+	key := cache.Key(session, u.url)
+	switch {
+	case err != nil:
+	case result.status == http.StatusNotModified && cached != nil:
+		s.responseCache.Touch(key)
+	case result.status == http.StatusOK && !result.truncated:
+		s.responseCache.Set(key, cache.Entry{
+			Content:      result.content,
+			ContentType:  result.contentType,
+			Status:       result.status,
+			ETag:         result.etag,
+			LastModified: result.lastModified,
+			Proxy:        config.RedactURL(result.proxy),
+		})
+	default:
+		err = fmt.Errorf("unexpected response (status %d, truncated %v)", result.status, result.truncated)
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if err != nil {
+		u.failures++
+		u.lastError = err.Error()
+		log.Printf("Refresco de la URL caliente %s de %s fallido: %v", u.url, session, err)
+		return
+	}
+	u.refreshes++
+	u.lastRefresh = time.Now()
+}
+
+// runWarmSet refresca las URL de la sesión en cada tick hasta que se cancele o se pare el
+// motor. Mientras el pool no está listo no se refresca.
+func (s *server) runWarmSet(ctx context.Context, w *warmSet) {
+	// Sin tenants, los refrescos se identifican en la auditoría por la sesión
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-client-id", "warmup/"+w.session))
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if s.ready.Load() {
+			w.mtx.Lock()
+			urls := append([]*warmURL(nil), w.urls...)
+			w.mtx.Unlock()
+
+			var wg sync.WaitGroup
+			for _, u := range urls {
+				wg.Add(1)
+				go func(u *warmURL) {
+					defer wg.Done()
+					s.refreshWarmURL(ctx, w.session, u, w)
+				}(u)
+			}
+			wg.Wait()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.refresh:
+		}
+	}
+}
+
+// refreshWarmMatching adelanta el refresco de las URL calientes que cumplen match y
+// devuelve cuántas son; session vacía las busca en todas las sesiones
+func (s *server) refreshWarmMatching(session string, match func(rawURL string) bool) int {
+	s.warmupsMtx.Lock()
+	sets := make([]*warmSet, 0, len(s.warmSets))
+	for name, w := range s.warmSets {
+		if session == "" || name == session {
+			sets = append(sets, w)
+		}
+	}
+	s.warmupsMtx.Unlock()
+
+	matched := 0
+	for _, w := range sets {
+		w.mtx.Lock()
+		n := 0
+		for _, u := range w.urls {
+			if match(u.url) {
+				n++
+			}
+		}
+		w.mtx.Unlock()
+		if n == 0 {
+			continue
+		}
+		matched += n
+		select {
+		case w.refresh <- struct{}{}:
+		default:
+		}
+	}
+	return matched
+}
+
+// forgetWarmup deja de refrescar las URL calientes de la sesión
+func (s *server) forgetWarmup(session string) {
+	s.warmupsMtx.Lock()
+	w, ok := s.warmSets[session]
+	delete(s.warmSets, session)
+	s.warmupsMtx.Unlock()
+	if ok {
+		w.cancel()
+	}
+}
+
+// RegisterWarmup - Sustituye las URL que se mantienen calientes en la caché de la sesión
+func (s *server) RegisterWarmup(ctx context.Context, req *pb.WarmupRequest) (*pb.WarmupSet, error) {
+	if _, exists := config.GetSession(req.Session); !exists {
+		return nil, status.Errorf(codes.NotFound, "session '%s' not found in configuration", req.Session)
+	}
+	if len(req.Urls) == 0 {
+		s.forgetWarmup(req.Session)
+		log.Printf("URL calientes de %s eliminadas", req.Session)
+		return &pb.WarmupSet{Session: req.Session}, nil
+	}
+	if req.IntervalMs < config.MinScheduleInterval {
+		return nil, status.Errorf(codes.InvalidArgument, "interval must be at least %d ms", config.MinScheduleInterval)
+	}
+	if config.CacheMaxEntries <= 0 {
+		return nil, status.Error(codes.FailedPrecondition, "response cache is disabled (CACHE_MAX_ENTRIES)")
+	}
+
+	w := &warmSet{
+		session:  req.Session,
+		interval: time.Duration(req.IntervalMs) * time.Millisecond,
+		refresh:  make(chan struct{}, 1),
+	}
+	seen := make(map[string]bool, len(req.Urls))
+	for _, rawURL := range req.Urls {
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid warmup url '%s'", rawURL)
+		}
+		if !seen[rawURL] {
+			seen[rawURL] = true
+			w.urls = append(w.urls, &warmURL{url: rawURL})
+		}
+	}
+
+	tenant := tenantFrom(ctx)
+	if tenant != nil {
+		w.tenant = tenant.Name
+	}
+
+	// El trabajo sobrevive a la llamada pero conserva su tenant, su clave y su ámbito, y
+	// termina al parar el motor
+	jobCtx, cancel := context.WithCancel(detachTenant(s.background(), ctx))
+	w.cancel = cancel
+	s.warmupsMtx.Lock()
+	if tenant != nil && !tenant.Admin {
+		if err := s.checkWarmLimits(tenant.Name, req.Session, len(w.urls)); err != nil {
+			s.warmupsMtx.Unlock()
+			cancel()
+			return nil, err
+		}
+	}
+	previous, replaced := s.warmSets[req.Session]
+	s.warmSets[req.Session] = w
+	s.warmupsMtx.Unlock()
+	if replaced {
+		previous.cancel()
+	}
+
+	log.Printf("URL calientes de %s: %d cada %v", req.Session, len(w.urls), w.interval)
+	go func() {
+		s.runWarmSet(jobCtx, w)
+		// Al parar el motor la sesión deja de tener URL calientes
+		s.warmupsMtx.Lock()
+		if s.warmSets[w.session] == w {
+			delete(s.warmSets, w.session)
+		}
+		s.warmupsMtx.Unlock()
+	}()
+	return w.info(), nil
+}
+
+// checkWarmLimits comprueba que el tenant no supere TENANT_MAX_WARM_SETS ni
+// TENANT_MAX_WARM_URLS al registrar urls URL en session, que sustituyen a las que
+// tuviera; debe llamarse con s.warmupsMtx
+func (s *server) checkWarmLimits(tenant, session string, urls int) error {
+	sets := 1
+	for name, w := range s.warmSets {
+		if w.tenant != tenant || name == session {
+			continue
+		}
+		sets++
+		w.mtx.Lock()
+		urls += len(w.urls)
+		w.mtx.Unlock()
+	}
+	if config.TenantMaxWarmSets > 0 && sets > config.TenantMaxWarmSets {
+		return status.Errorf(codes.ResourceExhausted, "tenant '%s' cannot keep more than %d sessions warm", tenant, config.TenantMaxWarmSets)
+	}
+	if config.TenantMaxWarmURLs > 0 && urls > config.TenantMaxWarmURLs {
+		return status.Errorf(codes.ResourceExhausted, "tenant '%s' cannot keep more than %d urls warm", tenant, config.TenantMaxWarmURLs)
+	}
+	return nil
+}
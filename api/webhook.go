@@ -0,0 +1,164 @@
+// api/webhook.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// webhookClient envía los resultados con el mismo bloqueo de destinos que las peticiones
+// directas; sin política de redirecciones en el contexto, una redirección no se sigue
+var webhookClient = &http.Client{Transport: guardedTransport(), CheckRedirect: checkRedirect, Timeout: config.WebhookTimeout * time.Millisecond}
+
+// enqueueAsync encola run para un worker; devuelve false si la cola está llena o el
+// motor está parado. Los workers terminan al parar el motor y lo pendiente se descarta.
+func (s *server) enqueueAsync(run func()) bool {
+	ctx := s.background()
+	s.asyncQueueOnce.Do(func() {
+		s.asyncQueue = make(chan func(), config.AsyncQueueSize)
+		for i := 0; i < config.AsyncWorkers; i++ {
+			go func() {
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case run := <-s.asyncQueue:
+						run()
+					}
+				}
+			}()
+		}
+	})
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case s.asyncQueue <- run:
+		return true
+	default:
+		return false
+	}
+}
+
+// validWebhookURL comprueba que la URL del webhook sea http(s) absoluta
+func validWebhookURL(raw string) error {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url '%s'", raw)
+	}
+	return nil
+}
+
+// signPayload devuelve la firma HMAC-SHA256 con WEBHOOK_SECRET de "<timestamp>.<cuerpo>",
+// de modo que un envío capturado no pueda repetirse pasado un tiempo con otra fecha
+func signPayload(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(config.WebhookSecret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook envía una vez el cuerpo al webhook; devuelve si merece la pena reintentar
+func postWebhook(ctx context.Context, webhookURL string, body []byte, result *pb.ScheduledResult) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Job-Id", result.Id)
+	if config.WebhookSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		req.Header.Set("X-Signature", signPayload(timestamp, body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook responded %s", resp.Status)
+}
+
+// deliverWebhook envía el resultado al webhook, reintentando con espera exponencial
+// hasta que ctx termine
+func deliverWebhook(ctx context.Context, webhookURL string, result *pb.ScheduledResult) {
+	body, err := protojson.Marshal(result)
+	if err != nil {
+		log.Printf("Error al serializar el resultado %s para el webhook: %v", result.Id, err)
+		return
+	}
+
+	delay := config.WebhookRetryDelay * time.Millisecond
+	for attempt := 1; attempt <= config.WebhookMaxAttempts; attempt++ {
+		retry, err := postWebhook(ctx, webhookURL, body, result)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == config.WebhookMaxAttempts || ctx.Err() != nil {
+			log.Printf("Webhook %s: entrega del resultado %s abandonada tras %d intentos: %v", webhookURL, result.Id, attempt, err)
+			return
+		}
+		log.Printf("Webhook %s: intento %d del resultado %s fallido, reintento en %v: %v", webhookURL, attempt, result.Id, delay, err)
+		select {
+		case <-ctx.Done():
+			log.Printf("Webhook %s: entrega del resultado %s abandonada al parar el servidor", webhookURL, result.Id)
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// fetchAsync responde de inmediato con un id de trabajo y envía el resultado al webhook al terminar
+func (s *server) fetchAsync(ctx context.Context, req *pb.Request) (*pb.Response, error) {
+	if err := validWebhookURL(req.WebhookUrl); err != nil {
+		return nil, err
+	}
+
+	id := newJobID()
+	jobReq := proto.Clone(req).(*pb.Request)
+	jobReq.WebhookUrl = ""
+
+	// El trabajo sobrevive a la llamada y termina al parar el motor. Conserva el tenant, la
+	// clave y su ámbito, la identidad del cliente para la auditoría y el id de la petición
+	// para correlacionar sus registros.
+	jobCtx := detachTenant(s.background(), ctx)
+	jobCtx = metadata.NewIncomingContext(jobCtx, metadata.Pairs("x-client-id", clientIdentity(ctx), requestIDHeader, requestIDFrom(ctx)))
+	queued := s.enqueueAsync(func() {
+		// La petición ya se cobró al aceptarla; falta la respuesta que recibe el webhook
+		resp, err := s.fetchForTenant(jobCtx, jobReq, 0)
+		result := &pb.ScheduledResult{Id: id, Response: resp, Timestamp: time.Now().UnixMilli()}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		deliverWebhook(jobCtx, req.WebhookUrl, result)
+	})
+	if !queued {
+		return nil, errBackpressure(ctx, "async_queue", fmt.Sprintf("async queue is full (%d requests waiting)", config.AsyncQueueSize))
+	}
+
+	return &pb.Response{JobId: id, RequestId: requestIDFrom(ctx)}, nil
+}
@@ -0,0 +1,28 @@
+#!/usr/bin/env bash
+
+# Script para compilar el servidor para varias plataformas en dist/
+# Uso: ./build.sh [plataforma...]   p. ej. ./build.sh linux/arm64 windows/amd64
+# BUILD_TAGS=http3 incluye el cliente HTTP/3 de quic-go
+
+set -e
+
+PLATFORMS=("$@")
+if [ ${#PLATFORMS[@]} -eq 0 ]; then
+    PLATFORMS=(linux/amd64 linux/arm64 linux/arm darwin/amd64 darwin/arm64 windows/amd64 windows/arm64)
+fi
+
+mkdir -p dist
+
+for platform in "${PLATFORMS[@]}"; do
+    GOOS="${platform%/*}"
+    GOARCH="${platform#*/}"
+    OUT="dist/proxy-api-${GOOS}-${GOARCH}"
+    if [ "$GOOS" = "windows" ]; then
+        OUT="$OUT.exe"
+    fi
+
+    echo "Compilando $OUT..."
+    CGO_ENABLED=0 GOOS="$GOOS" GOARCH="$GOARCH" go build -trimpath -tags "${BUILD_TAGS:-}" -o "$OUT" ./cmd
+done
+
+echo "✅ Binarios generados en dist/"
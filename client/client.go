@@ -0,0 +1,157 @@
+// Package client es el SDK de Go para el servicio ProxyService.
+package client
+
+import (
+	"context"
+	"io"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/compress"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Client envuelve el cliente gRPC generado y descomprime el contenido de forma transparente
+type Client struct {
+	pb.ProxyServiceClient
+	conn *grpc.ClientConn
+
+	// Compresión pedida al servidor cuando la petición no indica ninguna; vacía la desactiva
+	ContentEncoding string
+}
+
+// ServiceConfig reparte las llamadas en round robin entre todas las direcciones que
+// resuelve el target, como las réplicas detrás de un servicio DNS headless, y reintenta
+// FetchContent cuando el servidor responde RESOURCE_EXHAUSTED por saturación, esperando
+// lo que indique en grpc-retry-pushback-ms. Las cuotas agotadas no se reintentan.
+const ServiceConfig = `{
+	"loadBalancingConfig": [{"round_robin": {}}],
+	"methodConfig": [{
+		"name": [{"service": "fetch.ProxyService", "method": "FetchContent"}],
+		"retryPolicy": {
+			"maxAttempts": 3,
+			"initialBackoff": "0.5s",
+			"maxBackoff": "5s",
+			"backoffMultiplier": 2,
+			"retryableStatusCodes": ["RESOURCE_EXHAUSTED"]
+		}
+	}]
+}`
+
+// Dial conecta con el servidor; sin opciones usa una conexión sin TLS. Con un target
+// "dns:///proxy-server:5000" que resuelve a varias réplicas, las llamadas se reparten
+// entre ellas; una opción grpc.WithDefaultServiceConfig propia sustituye ServiceConfig.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	opts = append([]grpc.DialOption{grpc.WithDefaultServiceConfig(ServiceConfig)}, opts...)
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		ProxyServiceClient: pb.NewProxyServiceClient(conn),
+		conn:               conn,
+		ContentEncoding:    compress.Zstd,
+	}, nil
+}
+
+// WithAPIKey envía la clave de API del tenant en la metadata x-api-key de cada llamada.
+// Sustituye a las opciones por defecto de Dial, así que va junto a las credenciales de
+// transporte: Dial(target, grpc.WithTransportCredentials(...), client.WithAPIKey(key))
+func WithAPIKey(key string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(apiKey(key))
+}
+
+type apiKey string
+
+func (k apiKey) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"x-api-key": string(k)}, nil
+}
+
+// RequireTransportSecurity permite la clave sin TLS, como las conexiones por defecto
+func (k apiKey) RequireTransportSecurity() bool {
+	return false
+}
+
+// FetchContent pide el contenido comprimido y lo devuelve ya descomprimido. Si la
+// respuesta trae spill_token, el contenido se lee aparte con SpilledContent. La
+// codificación por defecto se aplica a una copia: req no se modifica.
+func (c *Client) FetchContent(ctx context.Context, req *pb.Request, opts ...grpc.CallOption) (*pb.Response, error) {
+	if req.ContentEncoding == "" && c.ContentEncoding != "" {
+		req = proto.Clone(req).(*pb.Request)
+		req.ContentEncoding = c.ContentEncoding
+	}
+	resp, err := c.ProxyServiceClient.FetchContent(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if resp.SpillToken != "" {
+		return resp, nil
+	}
+	if err := DecodeContent(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SpilledContent lee con ReadSpilledBody el contenido que no cabía en la respuesta y
+// lo devuelve descomprimido
+func (c *Client) SpilledContent(ctx context.Context, resp *pb.Response) ([]byte, error) {
+	stream, err := c.ReadSpilledBody(ctx, &pb.SpilledBodyRequest{Token: resp.SpillToken})
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, 0, resp.SpillSize)
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, chunk.Data...)
+	}
+	if resp.ContentEncoding == "" {
+		return content, nil
+	}
+	return compress.Decode(resp.ContentEncoding, content)
+}
+
+// DecodeContent descomprime en su sitio el contenido de una respuesta
+func DecodeContent(resp *pb.Response) error {
+	if resp.ContentEncoding == "" {
+		return nil
+	}
+	content, err := compress.Decode(resp.ContentEncoding, resp.Content)
+	if err != nil {
+		return err
+	}
+	resp.Content = content
+	resp.ContentEncoding = ""
+	return nil
+}
+
+// Close cierra la conexión con el servidor
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// RetryDelay devuelve la espera que sugiere el servidor en el detalle RetryInfo de un
+// error, como los de saturación (RESOURCE_EXHAUSTED) o de calentamiento del pool
+// (UNAVAILABLE); false si el error no la trae
+func RetryDelay(err error) (time.Duration, bool) {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+			return info.RetryDelay.AsDuration(), true
+		}
+	}
+	return 0, false
+}
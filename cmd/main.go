@@ -1,32 +1,61 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"proxy-api/api"
+	"log"
+	"os"
+	"os/signal"
 	"proxy-api/internal/config"
-	"proxy-api/internal/proxy"
-	"time"
+	"proxy-api/proxyserver"
+	"syscall"
 )
 
 func main() {
-	// Iniciar el servidor gRPC
-	go api.StartGRPCServer()
+	checkConfig := flag.Bool("check-config", false, "validar la configuración, mostrarla y salir")
+	exportPath := flag.String("export-pool", "", "guardar la instantánea del pool de un servidor en marcha en este fichero y salir")
+	importPath := flag.String("import-pool", "", "importar en un servidor en marcha la instantánea de este fichero y salir")
+	serverAddr := flag.String("server", "localhost:5000", "dirección del servidor para -export-pool e -import-pool")
+	flag.Parse()
 
-	// Refrescar proxies al inicio
-	go reloadProxiesInBackground()
-
-	// Mantener la aplicación en ejecución
-	select {}
-}
+	// Comandos contra un servidor en marcha
+	if *exportPath != "" || *importPath != "" {
+		var err error
+		if *exportPath != "" {
+			err = exportPool(*serverAddr, *exportPath)
+		} else {
+			err = importPool(*serverAddr, *importPath)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-func reloadProxiesInBackground() {
-	for {
-		time.Sleep(config.UpdateTime * time.Minute)
+	// Validar la configuración antes de arrancar
+	if *checkConfig {
+		config.Dump(os.Stdout)
+		if err := config.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuración inválida:\n%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Configuración válida")
+		return
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Configuración inválida:\n%v", err)
+	}
+	config.Dump(log.Writer())
 
-		newProxyMap := proxy.GetValidProxies()
-		fmt.Printf("Proxies válidos refrescados: %d\n", len(newProxyMap))
+	// SIGINT o SIGTERM detienen el servidor y cancelan la validación en curso
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		// Update the valid proxies in the server
-		api.UpdateValidProxies(newProxyMap)
+	// Iniciar el motor sobre el pool en memoria y exponerlo por gRPC
+	server := proxyserver.New(proxyserver.Config{GRPC: true})
+	if err := server.Run(ctx); err != nil {
+		log.Fatalf("failed to serve: %v", err)
 	}
 }
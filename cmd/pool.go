@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	pb "proxy-api/fetch"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// poolClient conecta con un servidor en marcha para exportar o importar el pool
+func poolClient(addr string) (pb.ProxyServiceClient, func(), error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return pb.NewProxyServiceClient(conn), func() { conn.Close() }, nil
+}
+
+// exportPool guarda en path la instantánea del pool del servidor
+func exportPool(addr, path string) error {
+	client, closeConn, err := poolClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	snapshot, err := client.ExportPool(ctx, &pb.ExportPoolRequest{})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, snapshot.Json, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Instantánea del pool guardada en %s\n", path)
+	return nil
+}
+
+// importPool envía al servidor la instantánea guardada en path
+func importPool(addr, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	client, closeConn, err := poolClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	// El servidor prueba cada proxy nuevo con su sesión antes de añadirlo
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	resp, err := client.ImportPool(ctx, &pb.PoolSnapshot{Json: data})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Proxies importados: %d, descartados: %d\n", resp.Imported, resp.Rejected)
+	return nil
+}
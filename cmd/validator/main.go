@@ -0,0 +1,84 @@
+// Worker que solo descarga y valida proxies: publica el resultado de cada ciclo en el
+// pool compartido de SHARED_POOL_DRIVER, que los servidores gRPC con la misma
+// configuración siguen en lugar de validar. Así la validación, que abre miles de
+// conexiones, puede ir en máquinas distintas de las que atienden las peticiones.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/poolstore"
+	"proxy-api/pkg/pool"
+	"proxy-api/pkg/sessions"
+	"proxy-api/pkg/sources"
+)
+
+func main() {
+	once := flag.Bool("once", false, "validar y publicar una sola vez y salir")
+	flag.Parse()
+
+	if err := sessions.Validate(); err != nil {
+		log.Fatalf("Configuración inválida:\n%v", err)
+	}
+	if config.SharedPoolDriver == "" {
+		log.Fatal("SHARED_POOL_DRIVER is required")
+	}
+	store, err := poolstore.Open(poolstore.Config{
+		Driver: config.SharedPoolDriver,
+		URL:    config.SharedPoolURL,
+		Key:    config.SharedPoolKey,
+	})
+	if err != nil {
+		log.Fatalf("failed to open shared pool: %v", err)
+	}
+	defer store.Close()
+
+	// SIGINT o SIGTERM cancelan el ciclo en curso sin publicar un resultado parcial
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	publisher, _ := os.Hostname()
+	ticker := time.NewTicker(config.UpdateTime * time.Minute)
+	defer ticker.Stop()
+	for {
+		if err := validate(ctx, store, publisher); err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, err)
+			if *once {
+				os.Exit(1)
+			}
+		}
+		if *once {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// validate realiza un ciclo de validación y publica los proxies válidos
+func validate(ctx context.Context, store poolstore.Store, publisher string) error {
+	start := time.Now()
+	proxies, err := pool.Validate(ctx, pool.ValidateOptions{Sources: sources.Scrape(sources.Options{})})
+	if err != nil {
+		return err
+	}
+
+	snapshot := poolstore.Snapshot{Proxies: proxies, PublishedAt: time.Now(), Publisher: publisher}
+	if err := store.Publish(ctx, snapshot); err != nil {
+		return fmt.Errorf("failed to publish pool: %w", err)
+	}
+	log.Printf("Pool publicado en %s: %d proxies válidos en %s", config.SharedPoolDriver, snapshot.Count(), time.Since(start).Round(time.Second))
+	return nil
+}
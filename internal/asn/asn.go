@@ -0,0 +1,172 @@
+package asn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Info describe el sistema autónomo de una IP
+type Info struct {
+	Number      int
+	Description string
+	Country     string
+	Datacenter  bool
+}
+
+type ipRange struct {
+	start net.IP
+	end   net.IP
+	info  Info
+}
+
+// Sistemas autónomos de proveedores de hosting conocidos
+var datacenterASNs = map[int]bool{
+	16509: true, 14618: true, // Amazon
+	15169: true, 396982: true, // Google
+	8075:   true, // Microsoft
+	14061:  true, // DigitalOcean
+	16276:  true, // OVH
+	24940:  true, // Hetzner
+	63949:  true, // Linode
+	20473:  true, // Vultr / Choopa
+	45102:  true, // Alibaba
+	132203: true, // Tencent
+	31898:  true, // Oracle
+	51167:  true, // Contabo
+	12876:  true, // Scaleway
+	60781:  true, // Leaseweb
+	9009:   true, // M247
+	13335:  true, // Cloudflare
+}
+
+// Palabras que delatan un rango de hosting en la descripción del AS
+var datacenterKeywords = []string{"hosting", "cloud", "datacenter", "data center", "server", "vps", "colocation"}
+
+// isDatacenter indica si el AS pertenece a un proveedor de hosting
+func isDatacenter(number int, description string) bool {
+	if datacenterASNs[number] {
+		return true
+	}
+	lower := strings.ToLower(description)
+	for _, keyword := range datacenterKeywords {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// Database resuelve IPs a sistemas autónomos
+type Database struct {
+	ranges []ipRange
+}
+
+// Load lee una base de datos en formato TSV de iptoasn.com:
+// inicio_rango, fin_rango, número de AS, país y descripción.
+func Load(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db := &Database{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 5 {
+			continue
+		}
+		start, end := net.ParseIP(fields[0]), net.ParseIP(fields[1])
+		number, err := strconv.Atoi(fields[2])
+		if start == nil || end == nil || err != nil {
+			return nil, fmt.Errorf("%s:%d: malformed range", path, line)
+		}
+		if number == 0 {
+			// Rango sin AS asignado
+			continue
+		}
+		db.ranges = append(db.ranges, ipRange{
+			start: start.To16(),
+			end:   end.To16(),
+			info: Info{
+				Number:      number,
+				Country:     fields[3],
+				Description: fields[4],
+				Datacenter:  isDatacenter(number, fields[4]),
+			},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+	return db, nil
+}
+
+// Lookup devuelve el AS de la IP
+func (db *Database) Lookup(ip net.IP) (Info, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return Info{}, false
+	}
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].start, ip) > 0
+	})
+	if i == 0 {
+		return Info{}, false
+	}
+	r := db.ranges[i-1]
+	if bytes.Compare(ip, r.end) > 0 {
+		return Info{}, false
+	}
+	return r.info, true
+}
+
+// Base de datos global, cargada con Open
+var (
+	global    *Database
+	globalMtx sync.RWMutex
+)
+
+// Open carga la base de datos global
+func Open(path string) error {
+	db, err := Load(path)
+	if err != nil {
+		return err
+	}
+	globalMtx.Lock()
+	global = db
+	globalMtx.Unlock()
+	return nil
+}
+
+// LookupAddress resuelve un proxy ip:port con la base de datos global
+func LookupAddress(address string) (Info, bool) {
+	globalMtx.RLock()
+	db := global
+	globalMtx.RUnlock()
+	if db == nil {
+		return Info{}, false
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return Info{}, false
+	}
+	return db.Lookup(ip)
+}
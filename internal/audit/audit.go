@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry es un registro de auditoría de una petición
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Session   string    `json:"session"`
+	URL       string    `json:"url"`
+	Proxy     string    `json:"proxy"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	LatencyMs int64     `json:"latency_ms"`
+	Client    string    `json:"client"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Filter selecciona registros en Query; los campos vacíos no filtran
+type Filter struct {
+	Session     string
+	URLContains string
+	Proxy       string
+	Client      string
+	Status      int
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+}
+
+func (f Filter) matches(e Entry) bool {
+	if f.Session != "" && e.Session != f.Session {
+		return false
+	}
+	if f.URLContains != "" && !strings.Contains(e.URL, f.URLContains) {
+		return false
+	}
+	if f.Proxy != "" && e.Proxy != f.Proxy {
+		return false
+	}
+	if f.Client != "" && e.Client != f.Client {
+		return false
+	}
+	if f.Status != 0 && e.Status != f.Status {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Logger escribe los registros en un fichero JSONL con rotación por tamaño
+type Logger struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mtx  sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewLogger abre (o crea) el fichero de auditoría en path
+func NewLogger(path string, maxSizeMB, maxFiles int) (*Logger, error) {
+	l := &Logger{
+		path:     path,
+		maxSize:  int64(maxSizeMB) * 1024 * 1024,
+		maxFiles: maxFiles,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotatedPath devuelve el nombre del fichero rotado número n
+func (l *Logger) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// rotate desplaza los ficheros rotados y abre uno nuevo; requiere mtx tomado
+func (l *Logger) rotate() error {
+	l.file.Close()
+	os.Remove(l.rotatedPath(l.maxFiles))
+	for n := l.maxFiles - 1; n >= 1; n-- {
+		os.Rename(l.rotatedPath(n), l.rotatedPath(n+1))
+	}
+	if l.maxFiles > 0 {
+		os.Rename(l.path, l.rotatedPath(1))
+	} else {
+		os.Remove(l.path)
+	}
+	return l.open()
+}
+
+// Record añade un registro al fichero de auditoría
+func (l *Logger) Record(e Entry) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Error al serializar registro de auditoría: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.maxSize > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			log.Printf("Error al rotar el registro de auditoría: %v", err)
+			return
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("Error al escribir registro de auditoría: %v", err)
+	}
+}
+
+// openAll abre el fichero actual y los rotados. El bloqueo solo se mantiene mientras
+// se abren: los ficheros abiertos siguen siendo legibles aunque una rotación posterior
+// los renombre o los borre, y del actual se lee solo lo escrito hasta ese momento.
+func (l *Logger) openAll() (readers []io.Reader, closeAll func(), err error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	var files []*os.File
+	closeAll = func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}
+	paths := []string{l.path}
+	for n := 1; n <= l.maxFiles; n++ {
+		paths = append(paths, l.rotatedPath(n))
+	}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, file)
+		if path == l.path {
+			readers = append(readers, io.LimitReader(file, l.size))
+		} else {
+			readers = append(readers, file)
+		}
+	}
+	return readers, closeAll, nil
+}
+
+// Query devuelve los registros que cumplen el filtro, del más reciente al más antiguo
+func (l *Logger) Query(f Filter) ([]Entry, error) {
+	readers, closeAll, err := l.openAll()
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll()
+
+	var entries []Entry
+	for _, r := range readers {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var e Entry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				continue
+			}
+			if f.matches(e) {
+				entries = append(entries, e)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[:f.Limit]
+	}
+	return entries, nil
+}
+
+// Close cierra el fichero de auditoría
+func (l *Logger) Close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.file.Close()
+}
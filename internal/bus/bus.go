@@ -0,0 +1,65 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Drivers soportados
+const (
+	DriverNATS  = "nats"
+	DriverKafka = "kafka"
+)
+
+// Bus consume peticiones de un tema y publica resultados en otro
+type Bus interface {
+	// Consume entrega los mensajes del tema de peticiones a handle, de uno en uno,
+	// hasta que se cancele el contexto. En Kafka el mensaje se confirma cuando handle
+	// termina (al-menos-una-vez); NATS no confirma y un mensaje en curso cuando la
+	// instancia cae se pierde (como-mucho-una-vez).
+	Consume(ctx context.Context, handle func(data []byte)) error
+	// Publish publica un resultado en el tema de resultados
+	Publish(ctx context.Context, key string, data []byte) error
+	Close() error
+}
+
+// URL de cada driver cuando Config.URL está vacía
+var defaultURLs = map[string]string{
+	DriverNATS:  "nats://localhost:4222",
+	DriverKafka: "localhost:9092",
+}
+
+// Config describe la conexión con el bus
+type Config struct {
+	Driver       string
+	URL          string // URL de NATS o brokers de Kafka separados por comas; vacía usa defaultURLs
+	RequestTopic string
+	ResultTopic  string
+	Group        string // Grupo de consumidores que se reparte las peticiones
+}
+
+// Open conecta con el bus configurado
+func Open(cfg Config) (Bus, error) {
+	if cfg.URL == "" {
+		cfg.URL = defaultURLs[cfg.Driver]
+	}
+	switch cfg.Driver {
+	case DriverNATS:
+		return openNATS(cfg)
+	case DriverKafka:
+		return openKafka(cfg), nil
+	default:
+		return nil, fmt.Errorf("unsupported bus driver '%s'", cfg.Driver)
+	}
+}
+
+func splitBrokers(url string) []string {
+	var brokers []string
+	for _, broker := range strings.Split(url, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers
+}
@@ -0,0 +1,56 @@
+package bus
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type kafkaBus struct {
+	writer *kafka.Writer
+	cfg    Config
+}
+
+func openKafka(cfg Config) *kafkaBus {
+	return &kafkaBus{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(splitBrokers(cfg.URL)...),
+			Topic:    cfg.ResultTopic,
+			Balancer: &kafka.Hash{},
+		},
+		cfg: cfg,
+	}
+}
+
+func (b *kafkaBus) Consume(ctx context.Context, handle func(data []byte)) error {
+	// Cada consumidor del grupo recibe sus propias particiones
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: splitBrokers(b.cfg.URL),
+		GroupID: b.cfg.Group,
+		Topic:   b.cfg.RequestTopic,
+	})
+	defer reader.Close()
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		handle(msg.Value)
+		// El offset se confirma después de procesar: al-menos-una-vez
+		if err := reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+}
+
+func (b *kafkaBus) Publish(ctx context.Context, key string, data []byte) error {
+	return b.writer.WriteMessages(ctx, kafka.Message{Key: []byte(key), Value: data})
+}
+
+func (b *kafkaBus) Close() error {
+	return b.writer.Close()
+}
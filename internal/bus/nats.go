@@ -0,0 +1,54 @@
+package bus
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+)
+
+type natsBus struct {
+	conn *nats.Conn
+	cfg  Config
+}
+
+func openNATS(cfg Config) (*natsBus, error) {
+	conn, err := nats.Connect(cfg.URL, nats.Name("proxy-api"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &natsBus{conn: conn, cfg: cfg}, nil
+}
+
+// Consume usa una suscripción de NATS básico, sin JetStream: el servidor entrega cada
+// mensaje una vez y no espera confirmación, así que un mensaje recibido cuando la
+// instancia cae, o publicado mientras no hay consumidores, se pierde
+func (b *natsBus) Consume(ctx context.Context, handle func(data []byte)) error {
+	// Los consumidores del mismo grupo de cola se reparten los mensajes
+	sub, err := b.conn.QueueSubscribeSync(b.cfg.RequestTopic, b.cfg.Group)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		handle(msg.Data)
+	}
+}
+
+func (b *natsBus) Publish(ctx context.Context, key string, data []byte) error {
+	msg := nats.NewMsg(b.cfg.ResultTopic)
+	msg.Header.Set("Job-Id", key)
+	msg.Data = data
+	return b.conn.PublishMsg(msg)
+}
+
+func (b *natsBus) Close() error {
+	return b.conn.Drain()
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry es una respuesta almacenada junto a sus validadores
+type Entry struct {
+	Content      []byte
+	ContentType  string
+	Status       int
+	ETag         string
+	LastModified string
+	Proxy        string // Proxy que obtuvo la respuesta, si se conoce
+	StoredAt     time.Time
+}
+
+type item struct {
+	key   string
+	entry Entry
+}
+
+// Cache es una caché LRU de respuestas con caducidad
+type Cache struct {
+	maxEntries int
+	ttl        time.Duration
+
+	mtx   sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+// New crea una caché con capacidad para maxEntries respuestas que caducan tras ttl
+func New(maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Key construye la clave de caché de una URL para una sesión
+func Key(session, url string) string {
+	return session + "|" + url
+}
+
+// SplitKey devuelve la sesión y la URL de una clave construida con Key
+func SplitKey(key string) (session, url string) {
+	session, url, _ = strings.Cut(key, "|")
+	return session, url
+}
+
+// Get devuelve la entrada si existe y no ha caducado
+func (c *Cache) Get(key string) (Entry, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return Entry{}, false
+	}
+	it := element.Value.(*item)
+	if c.ttl > 0 && time.Since(it.entry.StoredAt) > c.ttl {
+		c.order.Remove(element)
+		delete(c.items, key)
+		return Entry{}, false
+	}
+	c.order.MoveToFront(element)
+	return it.entry, true
+}
+
+// Set guarda o reemplaza una entrada, descartando la menos usada si se supera la capacidad
+func (c *Cache) Set(key string, entry Entry) {
+	if c.maxEntries <= 0 {
+		return
+	}
+	entry.StoredAt = time.Now()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		element.Value.(*item).entry = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&item{key: key, entry: entry})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*item).key)
+	}
+}
+
+// Touch renueva la caducidad de una entrada revalidada
+func (c *Cache) Touch(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		element.Value.(*item).entry.StoredAt = time.Now()
+		c.order.MoveToFront(element)
+	}
+}
+
+// Delete elimina una entrada
+func (c *Cache) Delete(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.order.Remove(element)
+		delete(c.items, key)
+	}
+}
+
+// DeleteFunc elimina las entradas cuya clave cumple match y devuelve cuántas eran
+func (c *Cache) DeleteFunc(match func(key string) bool) int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	removed := 0
+	for key, element := range c.items {
+		if match(key) {
+			c.order.Remove(element)
+			delete(c.items, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len devuelve el número de entradas almacenadas
+func (c *Cache) Len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.order.Len()
+}
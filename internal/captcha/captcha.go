@@ -0,0 +1,192 @@
+// Package captcha resuelve los CAPTCHA que bloquean una petición a través de un
+// servicio externo. Solver es el punto de integración; 2captcha y Anti-Captcha
+// comparten la API createTask/getTaskResult y se implementan con el mismo cliente.
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"proxy-api/internal/outbound"
+)
+
+// Tipos de CAPTCHA que se pueden resolver
+const (
+	KindRecaptcha = "recaptcha" // reCAPTCHA v2
+	KindHCaptcha  = "hcaptcha"
+	KindTurnstile = "turnstile" // Cloudflare Turnstile
+)
+
+// Servicios de resolución integrados
+const (
+	ServiceTwoCaptcha  = "2captcha"
+	ServiceAntiCaptcha = "anticaptcha"
+)
+
+// ErrUnsupported indica que el servicio no sabe resolver el desafío
+var ErrUnsupported = errors.New("captcha: challenge not supported by the solver")
+
+// Challenge es el desafío que bloqueó una petición
+type Challenge struct {
+	Kind      string
+	PageURL   string
+	SiteKey   string
+	UserAgent string
+}
+
+// Solution es la respuesta del servicio: el token y, si el servicio las devuelve,
+// las cookies y el user-agent con que se obtuvo
+type Solution struct {
+	Token     string
+	Cookies   map[string]string
+	UserAgent string
+}
+
+// Solver resuelve un desafío; debe respetar la cancelación de ctx
+type Solver interface {
+	Solve(ctx context.Context, challenge Challenge) (*Solution, error)
+}
+
+// siteKeyPattern captura la clave pública del widget en la página de desafío
+var siteKeyPattern = regexp.MustCompile(`(?:data-sitekey|sitekey)\s*[=:]\s*["']([\w-]{10,})["']`)
+
+// SiteKey devuelve la clave pública del widget de la página, "" si no aparece
+func SiteKey(body []byte) string {
+	if match := siteKeyPattern.FindSubmatch(body); match != nil {
+		return string(match[1])
+	}
+	return ""
+}
+
+// New crea el cliente del servicio indicado, nil si name está vacío
+func New(name, key string) (Solver, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case ServiceTwoCaptcha:
+		return NewTwoCaptcha(key), nil
+	case ServiceAntiCaptcha:
+		return NewAntiCaptcha(key), nil
+	}
+	return nil, fmt.Errorf("unknown captcha solver '%s'", name)
+}
+
+// NewTwoCaptcha crea el cliente de 2captcha
+func NewTwoCaptcha(key string) Solver {
+	return &taskSolver{name: ServiceTwoCaptcha, endpoint: "https://api.2captcha.com", key: key}
+}
+
+// NewAntiCaptcha crea el cliente de Anti-Captcha
+func NewAntiCaptcha(key string) Solver {
+	return &taskSolver{name: ServiceAntiCaptcha, endpoint: "https://api.anti-captcha.com", key: key}
+}
+
+// pollInterval es la espera entre consultas del resultado de una tarea
+const pollInterval = 5 * time.Second
+
+var solverClient = &http.Client{Transport: outbound.Transport(nil), Timeout: 30 * time.Second}
+
+// taskSolver habla la API de tareas común a 2captcha y Anti-Captcha
+type taskSolver struct {
+	name     string
+	endpoint string
+	key      string
+}
+
+// taskTypes es el tipo de tarea sin proxy de cada desafío
+var taskTypes = map[string]string{
+	KindRecaptcha: "RecaptchaV2TaskProxyless",
+	KindHCaptcha:  "HCaptchaTaskProxyless",
+	KindTurnstile: "TurnstileTaskProxyless",
+}
+
+type taskResponse struct {
+	ErrorID          int    `json:"errorId"`
+	ErrorCode        string `json:"errorCode"`
+	ErrorDescription string `json:"errorDescription"`
+	TaskID           int64  `json:"taskId"`
+	Status           string `json:"status"`
+	Solution         struct {
+		GRecaptchaResponse string            `json:"gRecaptchaResponse"`
+		Token              string            `json:"token"`
+		Cookies            map[string]string `json:"cookies"`
+		UserAgent          string            `json:"userAgent"`
+	} `json:"solution"`
+}
+
+// Solve - Crea la tarea y consulta su resultado hasta que esté lista
+func (s *taskSolver) Solve(ctx context.Context, challenge Challenge) (*Solution, error) {
+	taskType, ok := taskTypes[challenge.Kind]
+	if !ok || challenge.SiteKey == "" {
+		return nil, ErrUnsupported
+	}
+
+	task := map[string]string{
+		"type":       taskType,
+		"websiteURL": challenge.PageURL,
+		"websiteKey": challenge.SiteKey,
+	}
+	if challenge.UserAgent != "" {
+		task["userAgent"] = challenge.UserAgent
+	}
+	created, err := s.call(ctx, "createTask", map[string]interface{}{"clientKey": s.key, "task": task})
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		result, err := s.call(ctx, "getTaskResult", map[string]interface{}{"clientKey": s.key, "taskId": created.TaskID})
+		if err != nil {
+			return nil, err
+		}
+		if result.Status != "ready" {
+			continue
+		}
+		token := result.Solution.GRecaptchaResponse
+		if token == "" {
+			token = result.Solution.Token
+		}
+		return &Solution{Token: token, Cookies: result.Solution.Cookies, UserAgent: result.Solution.UserAgent}, nil
+	}
+}
+
+// call invoca un método de la API y devuelve su respuesta, o el error que indique
+func (s *taskSolver) call(ctx context.Context, method string, payload interface{}) (*taskResponse, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := solverClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", s.name, method, err)
+	}
+	defer resp.Body.Close()
+
+	var result taskResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%s %s: invalid response (status %d): %w", s.name, method, resp.StatusCode, err)
+	}
+	if result.ErrorID != 0 {
+		return nil, fmt.Errorf("%s %s: %s %s", s.name, method, result.ErrorCode, result.ErrorDescription)
+	}
+	return &result, nil
+}
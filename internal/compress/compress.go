@@ -0,0 +1,64 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codificaciones soportadas
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Codificador y decodificador zstd compartidos; EncodeAll y DecodeAll admiten uso concurrente
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// Supported indica si la codificación es conocida
+func Supported(encoding string) bool {
+	return encoding == Gzip || encoding == Zstd
+}
+
+// Encode comprime data con la codificación indicada
+func Encode(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding '%s'", encoding)
+}
+
+// Decode descomprime data codificado con Encode
+func Decode(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case "":
+		return data, nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case Zstd:
+		return zstdDecoder.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("unsupported content encoding '%s'", encoding)
+}
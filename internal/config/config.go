@@ -4,3 +4,237 @@ package config
 const DefaultChunkSize = 20
 const DefaultSessionTimeout = 2000 //ms
 const UpdateTime = 30
+const DrainTimeout = 30 //s
+const DefaultMaxRedirects = 10
+
+// Tamaño máximo de cada cuerpo guardado en las capturas de depuración
+const DebugCaptureMaxBody = 256 * 1024
+
+// Intervalo mínimo de las peticiones programadas
+const MinScheduleInterval = 1000 //ms
+
+// Entrega de resultados a webhooks: intentos, espera inicial entre intentos y timeout de cada envío
+const WebhookMaxAttempts = 5
+const WebhookRetryDelay = 1000 //ms, se duplica en cada reintento
+const WebhookTimeout = 10000   //ms
+
+// Cola de trabajos: intentos por trabajo, plazo de reserva de un worker, espera con la
+// cola vacía, espera inicial antes de reintentar un trabajo fallido y trabajos por
+// listado por defecto y como máximo
+const JobMaxAttempts = 3
+const JobLease = 120         //s
+const JobPollInterval = 1000 //ms
+const JobRetryDelay = 5000   //ms, se duplica en cada reintento
+const DefaultJobListLimit = 100
+const MaxJobListLimit = 1000
+
+// Tamaño mínimo del contenido para comprimirlo en la respuesta
+const MinCompressSize = 1024
+
+// Descargas por rangos: tamaño por defecto y máximo de cada rango (el máximo cabe en
+// un mensaje gRPC), rangos simultáneos por defecto e intentos por rango
+const DefaultRangeSize = 1 << 20
+const MaxRangeSize = 4 << 20
+const DefaultRangeParallel = 4
+const RangeAttempts = 3
+
+// Intentos de una petición directa que vence el timeout de la sesión
+const DirectAttempts = 2
+
+// Segundos sugeridos a los clientes para reintentar mientras el pool se calienta
+const WarmupRetryDelay = 10
+
+// Registro de auditoría de las peticiones; vacío lo deshabilita
+var AuditLogPath = getEnv("AUDIT_LOG_PATH", "")
+var AuditLogMaxSizeMB = getEnvInt("AUDIT_LOG_MAX_SIZE_MB", 50)
+var AuditLogMaxFiles = getEnvInt("AUDIT_LOG_MAX_FILES", 5)
+
+// Backend SQL opcional para el estado de los proxies: "sqlite" o "postgres"; vacío lo deshabilita
+var StorageDriver = getEnv("STORAGE_DRIVER", "")
+var StorageDSN = getEnv("STORAGE_DSN", "proxy-state.db")
+
+// Pool compartido entre cmd/validator, que lo publica, y los servidores, que lo siguen en
+// lugar de validar: "file", "redis", "sqlite" o "postgres"; vacío lo deshabilita
+var SharedPoolDriver = getEnv("SHARED_POOL_DRIVER", "")
+var SharedPoolURL = getEnv("SHARED_POOL_URL", "proxy-pool.json") // Ruta del fichero, URL de Redis o cadena de conexión SQL
+var SharedPoolKey = getEnv("SHARED_POOL_KEY", "proxy-api:pool")  // Clave de la publicación en Redis y SQL
+var SharedPoolPoll = getEnvInt("SHARED_POOL_POLL_S", 30)         // Segundos entre lecturas de los servidores
+
+// Caché de respuestas usada para las peticiones condicionales
+var CacheMaxEntries = getEnvInt("CACHE_MAX_ENTRIES", 1000)
+var CacheTTL = getEnvInt("CACHE_TTL_SECONDS", 600)
+
+// Direcciones en las que escucha el servidor gRPC, separadas por comas.
+// Las que empiezan por "unix:" son sockets Unix (por ejemplo "unix:/run/proxy-api.sock").
+var GRPCListenAddresses = getEnv("GRPC_LISTEN_ADDRESSES", ":5000")
+
+// Máximo de peticiones simultáneas a un mismo host a través de un mismo proxy; 0 sin límite
+var ProxyHostConcurrency = getEnvInt("PROXY_HOST_CONCURRENCY", 0)
+
+// Registro de cada petición: "text", "json" o "off"; el porcentaje de peticiones que se
+// registran (las sesiones pueden fijar el suyo) y si los errores se registran siempre
+var RequestLog = getEnv("REQUEST_LOG", "text")
+var RequestLogSamplePercent = getEnvInt("REQUEST_LOG_SAMPLE_PERCENT", 100)
+var RequestLogErrors = getEnvBool("REQUEST_LOG_ERRORS", true)
+
+// Contenidos que no caben en un mensaje gRPC (5 MB) y que las peticiones con
+// spill_large_body reciben como token: directorio (vacío usa el temporal del sistema),
+// tamaño a partir del cual se guardan, segundos que se conservan, tamaño máximo de uno
+// y espacio que pueden ocupar entre todos (0 sin límite)
+var SpillDir = getEnv("SPILL_DIR", "")
+var SpillThreshold = int64(getEnvInt("SPILL_THRESHOLD_BYTES", 4<<20))
+var SpillTTL = getEnvInt("SPILL_TTL_S", 600)
+var SpillMaxBytes = int64(getEnvInt("SPILL_MAX_BYTES", 1<<30))
+var SpillDirMaxBytes = int64(getEnvInt("SPILL_DIR_MAX_BYTES", 10<<30))
+
+// Minutos entre descargas de la lista de user-agents; 0 la descarga solo al arrancar
+var UserAgentRefreshMinutes = getEnvInt("USER_AGENT_REFRESH_MINUTES", 360)
+
+// User-agent de las peticiones mientras la lista descargada esté vacía
+var DefaultUserAgent = getEnv("DEFAULT_USER_AGENT", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36")
+
+// Días de tráfico por sesión, proxy y clave de API que se conservan
+var UsageRetentionDays = getEnvInt("USAGE_RETENTION_DAYS", 90)
+
+// Cabecera con la que se reenvía al destino el id de la petición ("X-Request-Id"); vacía no lo envía
+var RequestIDHeader = getEnv("REQUEST_ID_HEADER", "")
+
+// Puerto de administración con pprof y expvar (por ejemplo "127.0.0.1:6060"); vacío lo
+// deshabilita. No tiene autenticación: no debe exponerse fuera de la máquina
+var AdminAddress = getEnv("ADMIN_ADDRESS", "")
+
+// Middlewares del servidor gRPC, en orden de ejecución
+var GRPCInterceptors = getEnv("GRPC_INTERCEPTORS", "recovery,logging,metrics,validate,tenants,readiness")
+
+// Métodos HTTP que pueden usar las peticiones, separados por comas
+var AllowedMethods = getEnv("ALLOWED_METHODS", "GET,HEAD,POST,PUT,PATCH,DELETE,OPTIONS")
+
+// Base de datos TSV de iptoasn.com para etiquetar proxies por ASN; vacío lo deshabilita
+var ASNDatabasePath = getEnv("ASN_DB_PATH", "")
+
+// Porcentaje de peticiones capturadas para exportarlas en HAR y peticiones capturadas que se conservan
+var DebugSamplePercent = getEnvInt("DEBUG_SAMPLE_PERCENT", 0)
+var DebugCaptureMax = getEnvInt("DEBUG_CAPTURE_MAX", 200)
+
+// Keepalive del servidor gRPC, en segundos; 0 en MAX_IDLE deja las conexiones inactivas abiertas.
+// Los pings del servidor mantienen vivas las conexiones a través de NATs intermedios.
+var GRPCKeepaliveMaxIdle = getEnvInt("GRPC_KEEPALIVE_MAX_IDLE_SECONDS", 0)
+var GRPCKeepaliveTime = getEnvInt("GRPC_KEEPALIVE_TIME_SECONDS", 60)
+var GRPCKeepaliveTimeout = getEnvInt("GRPC_KEEPALIVE_TIMEOUT_SECONDS", 20)
+
+// Vida máxima de una conexión de cliente, en segundos; 0 sin límite. Al cerrarse, los
+// clientes con balanceo vuelven a resolver el nombre y reparten la carga entre las
+// réplicas nuevas. Las llamadas en curso tienen GRPC_MAX_CONNECTION_AGE_GRACE_SECONDS para terminar
+var GRPCMaxConnectionAge = getEnvInt("GRPC_MAX_CONNECTION_AGE_SECONDS", 0)
+var GRPCMaxConnectionAgeGrace = getEnvInt("GRPC_MAX_CONNECTION_AGE_GRACE_SECONDS", 30)
+
+// Política de pings aceptados de los clientes: intervalo mínimo y si se permiten sin streams activos
+var GRPCKeepaliveMinTime = getEnvInt("GRPC_KEEPALIVE_MIN_TIME_SECONDS", 30)
+var GRPCKeepalivePermitWithoutStream = getEnvBool("GRPC_KEEPALIVE_PERMIT_WITHOUT_STREAM", true)
+
+// Secreto para firmar con HMAC-SHA256 los envíos a webhooks; vacío no firma
+var WebhookSecret = getEnv("WEBHOOK_SECRET", "")
+
+// Workers que atienden las peticiones con webhook_url y peticiones que esperan turno;
+// con la cola llena se responde ResourceExhausted
+var AsyncWorkers = getEnvInt("ASYNC_WORKERS", 16)
+var AsyncQueueSize = getEnvInt("ASYNC_QUEUE_SIZE", 1000)
+
+// Workers que procesan la cola de trabajos (requiere STORAGE_DRIVER)
+var JobWorkers = getEnvInt("JOB_WORKERS", 4)
+
+// Horas que se conservan los trabajos terminados o fallidos de la cola
+var JobRetentionHours = getEnvInt("JOB_RETENTION_HOURS", 168)
+
+// Bus de mensajes opcional para recibir peticiones y publicar resultados: "nats" o "kafka"; vacío lo deshabilita
+var BusDriver = getEnv("BUS_DRIVER", "")
+var BusURL = getEnv("BUS_URL", "") // URL de NATS o brokers de Kafka separados por comas; vacía usa la local del driver
+var BusRequestTopic = getEnv("BUS_REQUEST_TOPIC", "proxy.requests")
+var BusResultTopic = getEnv("BUS_RESULT_TOPIC", "proxy.results")
+var BusGroup = getEnv("BUS_GROUP", "proxy-api")
+var BusConsumers = getEnvInt("BUS_CONSUMERS", 4)
+
+// Bucket al que la cola de trabajos y el bus suben el contenido de las respuestas, que
+// por gRPC y en el resultado solo llevan sus metadatos: "s3" (también MinIO con
+// RESULT_STORE_ENDPOINT) o "gcs"; vacío lo deshabilita
+var ResultStoreDriver = getEnv("RESULT_STORE_DRIVER", "")
+var ResultStoreBucket = getEnv("RESULT_STORE_BUCKET", "")
+var ResultStoreEndpoint = getEnv("RESULT_STORE_ENDPOINT", "")
+var ResultStoreRegion = getEnv("RESULT_STORE_REGION", "") // Vacía usa us-east-1 en S3 y auto en GCS
+var ResultStoreAccessKey = getEnv("RESULT_STORE_ACCESS_KEY", getEnv("AWS_ACCESS_KEY_ID", ""))
+var ResultStoreSecretKey = getEnv("RESULT_STORE_SECRET_KEY", getEnv("AWS_SECRET_ACCESS_KEY", ""))
+
+// Plantilla de la clave de cada objeto; admite {job_id}, {session}, {host}, {date}
+// (AAAA-MM-DD) y {request_id}
+var ResultStoreKeyTemplate = getEnv("RESULT_STORE_KEY_TEMPLATE", "{session}/{date}/{job_id}")
+
+// Presupuesto global de reintentos: porcentaje de intentos adicionales sobre las
+// peticiones (0 sin límite) y mínimo por segundo, acumulable durante RetryBudgetWindow
+var RetryBudgetPercent = getEnvInt("RETRY_BUDGET_PERCENT", 20)
+var RetryBudgetMinPerSecond = getEnvInt("RETRY_BUDGET_MIN_PER_SECOND", 10)
+
+const RetryBudgetWindow = 10 //s
+
+// Peticiones a destinos en curso en todo el servidor (0 sin límite) y espera sugerida a
+// los clientes cuando el servidor o el pool están saturados
+var MaxInFlight = getEnvInt("MAX_IN_FLIGHT", 0)
+var BackpressureRetryDelay = getEnvInt("BACKPRESSURE_RETRY_MS", 1000)
+
+// IP de origen de las conexiones salientes en servidores con varias interfaces;
+// OUTBOUND_ADDRESS tiene prioridad sobre OUTBOUND_INTERFACE
+var OutboundAddress = getEnv("OUTBOUND_ADDRESS", "")
+var OutboundInterface = getEnv("OUTBOUND_INTERFACE", "")
+
+// Máximo de conexiones salientes abiertas a la vez (validación, peticiones, fuentes); 0
+// lo deduce del límite de descriptores del proceso. Nunca se supera ese límite.
+var MaxConnections = getEnvInt("MAX_CONNECTIONS", 0)
+
+// Proxy corporativo (http o https, con credenciales opcionales) por el que se encadena
+// todo el tráfico saliente, y hosts separados por comas que no pasan por él
+var UpstreamProxy = getEnv("UPSTREAM_PROXY", "")
+var UpstreamProxyBypass = getEnv("UPSTREAM_PROXY_BYPASS", "localhost,127.0.0.1,::1")
+
+// Destinos permitidos y prohibidos, separados por comas: hosts (".dominio" incluye los
+// subdominios), IPs o redes CIDR. Con una lista de permitidos, el resto se rechaza.
+var TargetAllowHosts = getEnv("TARGET_ALLOW_HOSTS", "")
+var TargetDenyHosts = getEnv("TARGET_DENY_HOSTS", "")
+
+// Rechaza los destinos que resuelven a direcciones privadas, de loopback, link-local
+// (metadatos de la nube incluidos) o reservadas, salvo las redes de TARGET_ALLOW_HOSTS
+var BlockPrivateTargets = getEnvBool("BLOCK_PRIVATE_TARGETS", true)
+
+// Navegador headless con la API render.html de Splash que usan las sesiones con Browser
+var BrowserEndpoint = getEnv("BROWSER_ENDPOINT", "")
+
+// Cookies de paso de Cloudflare que obtiene el navegador para las sesiones con
+// CloudflareClearance: segundos máximos de espera al desafío y de validez de las cookies
+var ClearanceTimeout = getEnvInt("CLEARANCE_TIMEOUT_S", 30)
+var ClearanceTTL = getEnvInt("CLEARANCE_TTL_S", 1800)
+
+// Segundos que un proxy que recibió un CAPTCHA deja de usarse para ese host
+var CaptchaBanDuration = getEnvInt("CAPTCHA_BAN_SECONDS", 600)
+
+// Lo aprendido de cada host a través de los proxies (bloqueo de datacenter, desafío de
+// cookies) se olvida tras HOST_INTEL_TTL_S segundos sin novedades (0 lo deshabilita);
+// HOST_INTEL_MIN_BLOCKS bloqueos desde datacenter sin éxitos marcan el host
+var HostIntelTTL = getEnvInt("HOST_INTEL_TTL_S", 1800)
+var HostIntelMinBlocks = getEnvInt("HOST_INTEL_MIN_BLOCKS", 3)
+
+// Servicio de resolución de CAPTCHA ("2captcha" o "anticaptcha", vacío lo deshabilita),
+// su clave de API y el tiempo máximo de una resolución
+var CaptchaSolver = getEnv("CAPTCHA_SOLVER", "")
+var CaptchaSolverKey = getEnv("CAPTCHA_SOLVER_KEY", "")
+var CaptchaSolveTimeout = getEnvInt("CAPTCHA_SOLVE_TIMEOUT_S", 180)
+
+// Inyección de fallos para pruebas de resiliencia: porcentaje de intentos afectados
+// (0 la deshabilita), fallos posibles separados por comas y retardo del fallo "delay"
+var ChaosPercent = getEnvInt("CHAOS_PERCENT", 0)
+var ChaosFaults = getEnv("CHAOS_FAULTS", "delay,drop,corrupt")
+var ChaosDelay = getEnvInt("CHAOS_DELAY_MS", 2000)
+
+// Fallos que puede inyectar el modo caos
+const (
+	ChaosFaultDelay   = "delay"   // Retrasa el intento CHAOS_DELAY_MS
+	ChaosFaultDrop    = "drop"    // Falla el intento sin contactar con el proxy ni el destino
+	ChaosFaultCorrupt = "corrupt" // Altera bytes del cuerpo de la respuesta
+)
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// getEnv devuelve la variable de entorno o el valor por defecto si no está definida
+func getEnv(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return def
+}
+
+// getEnvInt devuelve la variable de entorno como entero o el valor por defecto
+func getEnvInt(key string, def int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// getEnvBool devuelve la variable de entorno como booleano o el valor por defecto
+func getEnvBool(key string, def bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return def
+	}
+	return b
+}
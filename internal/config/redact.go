@@ -0,0 +1,66 @@
+package config
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Cabeceras separadas por comas cuyo valor no aparece en los logs, la configuración
+// volcada, los planes de dry-run ni las exportaciones HAR. Las contraseñas de las URLs de
+// proxies se ocultan siempre con RedactURL.
+var SensitiveHeaders = getEnv("SENSITIVE_HEADERS", "Authorization,Proxy-Authorization,Cookie,Set-Cookie,X-Api-Key,X-Auth-Token,X-Fsign")
+
+// RedactedValue sustituye el valor de las cabeceras sensibles
+const RedactedValue = "[REDACTED]"
+
+// IsSensitiveHeader indica si el valor de la cabecera debe ocultarse
+func IsSensitiveHeader(name string) bool {
+	name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	for _, sensitive := range strings.Split(SensitiveHeaders, ",") {
+		if sensitive = strings.TrimSpace(sensitive); sensitive != "" && http.CanonicalHeaderKey(sensitive) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeader devuelve el valor de la cabecera, o RedactedValue si es sensible
+func RedactHeader(name, value string) string {
+	if value != "" && IsSensitiveHeader(name) {
+		return RedactedValue
+	}
+	return value
+}
+
+// RedactHeaders devuelve una copia de las cabeceras con los valores sensibles ocultos
+func RedactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		redacted[name] = RedactHeader(name, value)
+	}
+	return redacted
+}
+
+// providerSample sustituye los marcadores de una plantilla de Provider por valores que
+// url.Parse acepta en las credenciales; providerMarkers los restaura
+var (
+	providerSample  = strings.NewReplacer(ProviderIDPlaceholder, "PROVIDER-ID", ProviderSessionPlaceholder, "PROVIDER-SESSION")
+	providerMarkers = strings.NewReplacer("PROVIDER-ID", ProviderIDPlaceholder, "PROVIDER-SESSION", ProviderSessionPlaceholder)
+)
+
+// RedactURL oculta la contraseña de una URL con credenciales, como la de un proxy o una
+// plantilla de proveedor; si no se puede interpretar se oculta entera
+func RedactURL(raw string) string {
+	if !strings.Contains(raw, "@") {
+		return raw
+	}
+	u, err := url.Parse(providerSample.Replace(raw))
+	if err != nil {
+		return RedactedValue
+	}
+	return providerMarkers.Replace(u.Redacted())
+}
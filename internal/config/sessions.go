@@ -1,10 +1,307 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
 type ProxySession struct {
-	Name    string
-	URL     string
-	Headers map[string]string
-	Timeout int
+	Name     string
+	URL      string
+	Headers  map[string]string
+	Timeout  int
+	Fallback []FallbackStage // Vacío usa DefaultFallbackChain
+
+	HedgeDelay int // ms sin respuesta antes de probar el siguiente proxy de la etapa, por defecto DefaultHedgeDelay
+
+	// Cómo se elige el user-agent de las peticiones que no lo indican: "random" (uno
+	// distinto en cada petición, por defecto), "proxy" (fijo por proxy de salida),
+	// "identity" (fijo por identidad del cliente) o "static" (siempre StaticUserAgent)
+	UserAgentRotation string
+	StaticUserAgent   string
+	PinUserAgent      bool // Equivale a UserAgentRotation "identity"; se mantiene por compatibilidad
+
+	// Identidad estable de las peticiones directas, que salen con la IP del servidor: no
+	// usan un user-agent rotado sino el suyo, para presentarse como el servicio legítimo
+	DirectIdentity DirectIdentity
+
+	// Idioma del navegador simulado ("es-ES", "en-US"): genera Accept-Language y las
+	// client hints coherentes con el user-agent, salvo las que fije Headers
+	Locale string
+
+	Diversity       string // Evitar repetir rango de IP entre peticiones consecutivas: "", "subnet" o "asn"
+	DiversityWindow int    // Peticiones recientes cuyo rango se evita, por defecto 1
+
+	PreferResidential bool // Intentar primero los proxies fuera de rangos de datacenter
+	ExcludeIPv6       bool // Descartar los proxies con dirección IPv6
+
+	Browser bool // Obtener las páginas renderizadas por el navegador de BROWSER_ENDPOINT
+
+	// Descomprimir las respuestas del destino (nil o true). El Accept-Encoding de Headers
+	// se limita a lo que el servidor sabe descomprimir; false lo envía tal cual y devuelve
+	// el cuerpo comprimido, con la codificación en upstream_encoding
+	DecodeBody *bool
+
+	// Ante un desafío de Cloudflare, obtener con el navegador las cookies de paso para el
+	// proxy y user-agent del intento y reutilizarlas en las peticiones HTTP siguientes
+	CloudflareClearance bool
+
+	// Direcciones fijas por host para las peticiones directas, como /etc/hosts: sirven
+	// para destinos con DNS geográfico o para llegar al origen detrás de una CDN
+	Hosts map[string]string
+
+	// Orden de las cabeceras en las peticiones HTTP/1.1, con la grafía indicada (los
+	// sistemas anti-bot lo usan como huella), o un preset: "chrome" o "firefox". Las
+	// cabeceras que no aparecen van detrás
+	HeaderOrder []string
+
+	// Segundos desde la validación o el último éxito de un proxy por encima de los cuales
+	// no se usa, para peticiones que no toleran proxies caducados; 0 sin límite
+	MaxProxyAge int
+
+	// Porcentaje de peticiones de la sesión que se registran, nil usa REQUEST_LOG_SAMPLE_PERCENT
+	LogSamplePercent *int
+
+	Eviction EvictionPolicy // Cuándo deja de usarse un proxy que falla
+
+	Experiment *Experiment // Reparto del tráfico entre dos estrategias, nil lo deshabilita
+
+	Integrity IntegrityCheck // Detección de proxies que alteran el HTML
+
+	Captcha CaptchaSolving // Resolución de los CAPTCHA que bloquean las peticiones
+
+	TLS TLSOptions // Verificación del certificado del destino
+
+	// Usar HTTP/3 en las peticiones directas si el motor tiene un transporte HTTP/3
+	// (proxyserver.Config.HTTP3); sin él, o a través de proxies, se usa HTTP/1.1
+	HTTP3 bool
+	// Cerrar la conexión tras cada petición (Connection: close) en lugar de reutilizarla;
+	// el handshake TLS de la siguiente se reanuda si el destino lo admite
+	CloseConnections bool
+
+	HotSetSize     int // Proxies con mejor puntuación que se mantienen calientes, 0 lo deshabilita
+	HotSetInterval int // ms entre peticiones de mantenimiento del hot set, por defecto DefaultHotSetInterval
+
+	SLO LatencySLO // Latencia objetivo de las peticiones a través de proxies
+
+	// Tipos MIME aceptados en las respuestas 2xx ("application/json", "text/*"); el tipo
+	// se deduce también del cuerpo, de modo que una página HTML inyectada por el proxy
+	// se reintenta aunque la cabecera diga JSON. Vacío acepta cualquiera
+	ContentTypes []string
+
+	MaxBodyBytes int64 // Tamaño máximo del cuerpo de la respuesta, 0 sin límite
+	TruncateBody bool  // Al superar MaxBodyBytes, truncar en lugar de abortar la lectura
+
+	// Regla (expr) que decide si una respuesta es "valid", "retry" o "poison" a partir de
+	// status, headers, body y nil_content; vacía acepta cualquier respuesta
+	Validation string
+
+	// Script Starlark con una función rewrite(req) que modifica la petición antes de
+	// enviarla (firmas, parámetros calculados); vacío no la modifica
+	Rewrite string
+}
+
+// DirectIdentity es el user-agent y las cabeceras de las peticiones directas de una sesión
+type DirectIdentity struct {
+	UserAgent string            // Vacío mantiene la rotación de la sesión
+	Headers   map[string]string // Se añaden a Headers, con prioridad sobre ellas
+}
+
+// Modos de diversidad de IP de salida
+const (
+	DiversitySubnet = "subnet" // /24 en IPv4, /48 en IPv6
+	DiversityASN    = "asn"    // Sistema autónomo, requiere ASN_DB_PATH
+)
+
+// Políticas de rotación del user-agent
+const (
+	UserAgentRandom   = "random"
+	UserAgentProxy    = "proxy"
+	UserAgentIdentity = "identity"
+	UserAgentStatic   = "static"
+)
+
+// UserAgentPolicy devuelve la política de rotación del user-agent de la sesión
+func (s ProxySession) UserAgentPolicy() string {
+	switch {
+	case s.UserAgentRotation != "":
+		return s.UserAgentRotation
+	case s.PinUserAgent:
+		return UserAgentIdentity
+	}
+	return UserAgentRandom
+}
+
+// Tipos de etapa de la cadena de fallback
+const (
+	FallbackSuccessful = "successful" // Proxies que ya respondieron para la sesión
+	FallbackPool       = "pool"       // Cualquier proxy válido de la sesión
+	FallbackProvider   = "provider"   // Proxy autenticado de un proveedor
+	FallbackDirect     = "direct"     // Sin proxy
+	FallbackHot        = "hot"        // Hot set de la sesión
+)
+
+const DefaultHotSetInterval = 30000 //ms
+
+// Categorías de error de un intento a través de un proxy
+const (
+	ErrorDNS        = "dns"        // El proxy no pudo resolver el destino
+	ErrorTimeout    = "timeout"    // Sin respuesta a tiempo
+	ErrorConnection = "connection" // Conexión rechazada o cortada
+	ErrorTLS        = "tls"        // Fallo en el handshake o certificado
+	ErrorProxy      = "proxy"      // El proxy rechazó el CONNECT o respondió mal
+	ErrorForbidden  = "forbidden"  // El destino respondió 403 o 429
+	ErrorServer     = "server"     // El destino respondió 5xx
+	ErrorOther      = "other"
+)
+
+// Peso por defecto de cada categoría: los errores de red retiran el proxy y las
+// respuestas del destino solo penalizan su puntuación
+var DefaultErrorWeights = map[string]int{
+	ErrorDNS:        1,
+	ErrorTimeout:    1,
+	ErrorConnection: 1,
+	ErrorTLS:        1,
+	ErrorProxy:      1,
+	ErrorForbidden:  0,
+	ErrorServer:     0,
+	ErrorOther:      1,
+}
+
+// EvictionPolicy decide cuándo deja de usarse un proxy que falla y cuándo se rehabilita
+type EvictionPolicy struct {
+	Strikes  int            // Peso acumulado de fallos que retira el proxy, por defecto 1
+	Window   int            // ms en los que se acumulan los fallos, 0 sin límite
+	Cooldown int            // ms que el proxy queda apartado de todas las etapas, 0 solo lo saca de los exitosos
+	Weights  map[string]int // Peso de cada categoría de error; las ausentes usan DefaultErrorWeights
+}
+
+// ErrorWeight devuelve el peso de una categoría de error según la política
+func (p EvictionPolicy) ErrorWeight(category string) int {
+	if weight, ok := p.Weights[category]; ok {
+		return weight
+	}
+	return DefaultErrorWeights[category]
+}
+
+// Estrategias de intento de las etapas con proxies
+const (
+	StrategyHedged     = "hedged"     // Un proxy y el siguiente solo tras HedgeDelay sin respuesta
+	StrategyRace       = "race"       // Todos los proxies de la etapa en paralelo
+	StrategySequential = "sequential" // Un proxy detrás de otro con espera creciente
+)
+
+const DefaultHedgeDelay = 300 //ms
+
+// Experiment reparte las peticiones de una sesión entre las variantes A y B
+type Experiment struct {
+	Name  string
+	Split int // Porcentaje de peticiones para la variante B, 0-100
+	A     ExperimentVariant
+	B     ExperimentVariant
+}
+
+// ExperimentVariant es una estrategia de petición que participa en un experimento
+type ExperimentVariant struct {
+	Strategy   string   // StrategyHedged (por defecto), StrategyRace o StrategySequential
+	Backoff    int      // ms de espera inicial entre intentos secuenciales, se duplica en cada uno
+	UserAgents []string // User-agents de la variante; vacío usa la lista global
+}
+
+// LatencySLO fija el P95 objetivo de las peticiones servidas por proxies y la
+// estrategia que adopta la sesión mientras lo incumple
+type LatencySLO struct {
+	P95    int    // ms, 0 lo deshabilita
+	Window int    // ms de peticiones que se tienen en cuenta, por defecto DefaultSLOWindow
+	Action string // SLOHedge (por defecto), SLOHot o SLODirect
+}
+
+// Estrategias de una sesión que incumple su SLO de latencia
+const (
+	SLOHedge  = "hedge"  // Escalonar los proxies con la mitad de HedgeDelay, también en las variantes secuenciales
+	SLOHot    = "hot"    // Probar primero el hot set; sin HotSetSize se comporta como SLOHedge
+	SLODirect = "direct" // Probar primero la etapa directa; si la cadena no la tiene, como SLOHedge
+)
+
+const DefaultSLOWindow = 60000 //ms
+
+// Peticiones mínimas en la ventana para evaluar el SLO
+const SLOMinSamples = 20
+
+// IntegrityCheck repite de vez en cuando una petición servida por un proxy por otra
+// vía y retira el proxy si su HTML diverge de la referencia
+type IntegrityCheck struct {
+	Percent       int     // Porcentaje de respuestas HTML comprobadas, 0 lo deshabilita
+	Reference     string  // IntegrityProxy (por defecto) o IntegrityDirect, solo con etapa directa en la cadena
+	MinSimilarity float64 // Parecido mínimo entre las etiquetas de ambas respuestas, por defecto DefaultMinSimilarity
+}
+
+// Vías de la petición de referencia de IntegrityCheck
+const (
+	IntegrityDirect = "direct" // Sin proxy
+	IntegrityProxy  = "proxy"  // Otro proxy del pool
+)
+
+const DefaultMinSimilarity = 0.8
+
+// TLSOptions ajusta la verificación TLS de las peticiones de la sesión, directas o a
+// través de proxies, para destinos cuyo certificado no supera la de Go
+type TLSOptions struct {
+	InsecureSkipVerify bool   // Aceptar cualquier certificado; un proxy podría leer y alterar el tráfico
+	RootCAs            string // Fichero PEM con CA que se aceptan además de las del sistema
+	ServerName         string // SNI que se envía y nombre contra el que se verifica el certificado
+}
+
+// CaptchaSolving habilita la resolución de los CAPTCHA con el servicio configurado y
+// decide cómo se entrega el token al repetir la petición
+type CaptchaSolving struct {
+	Solve       bool
+	TokenParam  string // Parámetro de la query con el token, por defecto el del widget (g-recaptcha-response...)
+	TokenHeader string // Cabecera con el token, además del parámetro
+}
+
+// FallbackStage es una etapa de la cadena de fallback de una sesión
+type FallbackStage struct {
+	Kind     string
+	Attempts int    // Máximo de proxies a intentar en la etapa, 0 sin límite
+	Timeout  int    // ms para la etapa completa, 0 sin límite
+	Provider string // URL del proxy (con credenciales) para las etapas provider; admite {id} y {session}
+
+	// Segundos que se mantiene el {id} del proveedor asignado a una identity antes de
+	// generar otro (y con él, otra IP); 0 lo mantiene mientras viva la sesión
+	StickyTTL int
+}
+
+// Marcadores de las plantillas de Provider: el id de sesión del proveedor, que se
+// regenera por identity, y el nombre de la sesión
+const (
+	ProviderIDPlaceholder      = "{id}"
+	ProviderSessionPlaceholder = "{session}"
+)
+
+// Cadena por defecto: successfulProxies -> validProxies -> directo
+var DefaultFallbackChain = []FallbackStage{
+	{Kind: FallbackSuccessful},
+	{Kind: FallbackPool},
+	{Kind: FallbackDirect},
+}
+
+// HedgeDelayDuration devuelve la espera entre intentos escalonados de la sesión
+func (s ProxySession) HedgeDelayDuration() time.Duration {
+	if s.HedgeDelay <= 0 {
+		return DefaultHedgeDelay * time.Millisecond
+	}
+	return time.Duration(s.HedgeDelay) * time.Millisecond
+}
+
+// FallbackChain devuelve la cadena de fallback configurada para la sesión
+func (s ProxySession) FallbackChain() []FallbackStage {
+	if len(s.Fallback) == 0 {
+		return DefaultFallbackChain
+	}
+	return s.Fallback
 }
 
 var ProxySessions = map[string]ProxySession{
@@ -34,6 +331,60 @@ var ProxySessions = map[string]ProxySession{
 	},
 }
 
+// Protege ProxySessions frente a cambios en tiempo de ejecución
+var sessionsMutex sync.RWMutex
+
 func GetHeadersFromSession(session string) map[string]string {
+	sessionsMutex.RLock()
+	defer sessionsMutex.RUnlock()
 	return ProxySessions[session].Headers
 }
+
+// GetSession devuelve la configuración de una sesión y si existe
+func GetSession(name string) (ProxySession, bool) {
+	sessionsMutex.RLock()
+	defer sessionsMutex.RUnlock()
+	session, ok := ProxySessions[name]
+	return session, ok
+}
+
+// ErrUnknownSession indica que la sesión no existe en la configuración
+var ErrUnknownSession = errors.New("unknown session")
+
+// GetSessionOrDefault devuelve la sesión con los valores por defecto aplicados,
+// o ErrUnknownSession si no existe.
+func GetSessionOrDefault(name string) (ProxySession, error) {
+	session, ok := GetSession(name)
+	if !ok {
+		return ProxySession{}, fmt.Errorf("%w '%s'", ErrUnknownSession, name)
+	}
+	if session.Timeout <= 0 {
+		session.Timeout = DefaultSessionTimeout
+	}
+	return session, nil
+}
+
+// Sessions devuelve una copia de las sesiones configuradas
+func Sessions() map[string]ProxySession {
+	sessionsMutex.RLock()
+	defer sessionsMutex.RUnlock()
+	sessions := make(map[string]ProxySession, len(ProxySessions))
+	for name, session := range ProxySessions {
+		sessions[name] = session
+	}
+	return sessions
+}
+
+// SetSession añade o reemplaza una sesión
+func SetSession(session ProxySession) {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+	ProxySessions[session.Name] = session
+}
+
+// DeleteSession elimina una sesión
+func DeleteSession(name string) {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+	delete(ProxySessions, name)
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetSessionOrDefault(t *testing.T) {
+	SetSession(ProxySession{Name: "test/sin-timeout"})
+	SetSession(ProxySession{Name: "test/con-timeout", Timeout: 500})
+	defer DeleteSession("test/sin-timeout")
+	defer DeleteSession("test/con-timeout")
+
+	cases := []struct {
+		name        string
+		session     string
+		wantTimeout int
+		wantErr     error
+	}{
+		{name: "desconocida", session: "test/no-existe", wantErr: ErrUnknownSession},
+		{name: "sin timeout", session: "test/sin-timeout", wantTimeout: DefaultSessionTimeout},
+		{name: "con timeout", session: "test/con-timeout", wantTimeout: 500},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			session, err := GetSessionOrDefault(c.session)
+			if c.wantErr != nil {
+				if !errors.Is(err, c.wantErr) {
+					t.Fatalf("error %v, se esperaba %v", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.Name != c.session || session.Timeout != c.wantTimeout {
+				t.Fatalf("sesión %s con timeout %d, se esperaba %s con %d", session.Name, session.Timeout, c.session, c.wantTimeout)
+			}
+		})
+	}
+}
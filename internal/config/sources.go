@@ -0,0 +1,206 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ProxySource es una fuente de la que se descargan proxies
+type ProxySource struct {
+	URL      string // http(s):// o file:// para una lista local
+	Protocol string // Esquema de las entradas que no lo indican: "http" (por defecto), "https" o "socks5"
+	Refresh  int    // Minutos entre descargas; antes se reutiliza la última lista, 0 descarga en cada ciclo
+	Timeout  int    // ms de la descarga, por defecto DefaultSourceTimeout
+	Parser   string // Formato de la lista: "text" (una entrada por línea, por defecto) o "json"
+	Enabled  *bool  // nil o true la descarga; false la deja configurada pero sin uso
+}
+
+const DefaultSourceTimeout = 5000 //ms
+
+// Formatos de las listas de proxies
+const (
+	SourceParserText = "text"
+	SourceParserJSON = "json" // Array de cadenas o de objetos con "proxy", o con "ip", "port" y "protocol"
+)
+
+// IsEnabled indica si la fuente se descarga
+func (s ProxySource) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+func disabled() *bool {
+	b := false
+	return &b
+}
+
+// defaultProxySources son las fuentes cuando no hay PROXY_SOURCES_FILE
+var defaultProxySources = []ProxySource{
+	{URL: "https://raw.githubusercontent.com/proxifly/free-proxy-list/main/proxies/protocols/http/data.txt", Enabled: disabled()},
+	{URL: "https://raw.githubusercontent.com/proxifly/free-proxy-list/refs/heads/main/proxies/all/data.txt", Enabled: disabled()},
+	{URL: "https://raw.githubusercontent.com/officialputuid/KangProxy/refs/heads/KangProxy/https/https.txt"},
+	{URL: "https://raw.githubusercontent.com/vakhov/fresh-proxy-list/refs/heads/master/https.txt"},
+	{URL: "https://raw.githubusercontent.com/prxchk/proxy-list/main/http.txt", Enabled: disabled()},
+	{URL: "https://raw.githubusercontent.com/vakhov/fresh-proxy-list/master/http.txt", Enabled: disabled()},
+	{URL: "https://raw.githubusercontent.com/MuRongPIG/Proxy-Master/main/http.txt", Enabled: disabled()},
+	{URL: "https://raw.githubusercontent.com/ProxyScraper/ProxyScraper/main/http.txt", Enabled: disabled()},
+}
+
+// Fichero JSON con la lista de fuentes; vacío usa las fuentes por defecto. Se vuelve a
+// leer en cada ciclo de validación, de modo que los cambios no requieren reiniciar
+var ProxySourcesFile = getEnv("PROXY_SOURCES_FILE", "")
+
+// Directorio cuyos ficheros son listas de proxies, cada uno una fuente más; los .json se
+// interpretan con el parser json. Se vigila para revalidar cuando cambia
+var ProxySourcesDir = getEnv("PROXY_SOURCES_DIR", "")
+
+var (
+	proxySources    []ProxySource
+	proxySourcesMtx sync.RWMutex
+)
+
+// ProxySources devuelve las fuentes configuradas, también las deshabilitadas
+func ProxySources() []ProxySource {
+	proxySourcesMtx.RLock()
+	defer proxySourcesMtx.RUnlock()
+	if proxySources == nil {
+		return defaultProxySources
+	}
+	return proxySources
+}
+
+// SourceByURL busca la fuente con esa URL
+func SourceByURL(rawURL string) (ProxySource, bool) {
+	for _, source := range ProxySources() {
+		if source.URL == rawURL {
+			return source, true
+		}
+	}
+	return ProxySource{}, false
+}
+
+// ReloadProxySources vuelve a leer PROXY_SOURCES_FILE y el contenido de
+// PROXY_SOURCES_DIR. Si alguno no es válido devuelve el error y se mantienen las
+// fuentes anteriores.
+func ReloadProxySources() error {
+	if ProxySourcesFile == "" && ProxySourcesDir == "" {
+		return nil
+	}
+	sources := defaultProxySources
+	if ProxySourcesFile != "" {
+		var err error
+		if sources, err = readProxySources(ProxySourcesFile); err != nil {
+			return err
+		}
+	}
+	if ProxySourcesDir != "" {
+		files, err := SourceDirFiles(ProxySourcesDir)
+		if err != nil {
+			return fmt.Errorf("proxy sources dir '%s': %v", ProxySourcesDir, err)
+		}
+		sources = append([]ProxySource(nil), sources...)
+		for _, path := range files {
+			source := ProxySource{URL: (&url.URL{Scheme: "file", Path: path}).String()}
+			if strings.EqualFold(filepath.Ext(path), ".json") {
+				source.Parser = SourceParserJSON
+			}
+			sources = append(sources, source)
+		}
+	}
+	proxySourcesMtx.Lock()
+	proxySources = sources
+	proxySourcesMtx.Unlock()
+	return nil
+}
+
+// readProxySources lee y valida un fichero de fuentes
+func readProxySources(path string) ([]ProxySource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sources []ProxySource
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return nil, fmt.Errorf("proxy sources file '%s': %v", path, err)
+	}
+	for i, source := range sources {
+		if err := validateSource(source); err != nil {
+			return nil, fmt.Errorf("proxy sources file '%s', entry %d: %v", path, i, err)
+		}
+	}
+	return sources, nil
+}
+
+// SourceDirFiles devuelve las rutas absolutas de los ficheros de listas del directorio,
+// sin los ocultos ni los subdirectorios
+func SourceDirFiles(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	return files, nil
+}
+
+// validateSource comprueba las opciones de una fuente
+func validateSource(source ProxySource) error {
+	u, err := url.Parse(source.URL)
+	switch {
+	case err != nil:
+		return fmt.Errorf("invalid source url '%s'", source.URL)
+	case u.Scheme == "file":
+		if u.Path == "" || u.Host != "" {
+			return fmt.Errorf("invalid source url '%s', expected file:///ruta", source.URL)
+		}
+	case (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		return fmt.Errorf("invalid source url '%s'", source.URL)
+	}
+	switch source.Protocol {
+	case "", "http", "https", "socks5":
+	default:
+		return fmt.Errorf("unsupported source protocol '%s'", source.Protocol)
+	}
+	switch source.Parser {
+	case "", SourceParserText, SourceParserJSON:
+	default:
+		return fmt.Errorf("unknown source parser '%s'", source.Parser)
+	}
+	if source.Refresh < 0 || source.Timeout < 0 {
+		return fmt.Errorf("source refresh and timeout cannot be negative")
+	}
+	return nil
+}
+
+// Fallos consecutivos tras los que una fuente deja de descargarse durante
+// SOURCE_BACKOFF_MINUTES; 0 no la aparta nunca
+var SourceFailureThreshold = getEnvInt("SOURCE_FAILURE_THRESHOLD", 3)
+var SourceBackoff = getEnvInt("SOURCE_BACKOFF_MINUTES", 30)
+
+// Agrupar los proxies con la misma IP en distintos puertos o esquemas y validar solo uno.
+// No conviene con proveedores que dan una IP de salida distinta en cada puerto del gateway.
+var CollapseDuplicateIPs = getEnvBool("COLLAPSE_DUPLICATE_IPS", false)
+
+// Fichero con las fuentes ya aceptadas; las que no figuran en él pasan primero por canary
+var SourceStatePath = getEnv("SOURCE_STATE_PATH", "sources.json")
+
+// Proporción mínima de proxies válidos para que una fuente nueva entre en el pool
+var CanaryPassRate = 0.05
+
+func init() {
+	// Los errores del fichero los informa Validate
+	ReloadProxySources()
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Tenant es un equipo que usa el servicio con sus propias claves de API. Sus sesiones
+// son las llamadas "<Name>/<sesión>", con su propio pool; las de SharedSessions las
+// comparte con el resto. Las cuotas son diarias (UTC) y 0 no limita.
+type Tenant struct {
+	Name           string
+	APIKeys        []string
+	ScopedKeys     []ScopedKey // Claves limitadas a algunas sesiones o destinos
+	SharedSessions []string
+	RequestsPerDay int64 // Peticiones a sesiones, contando cada una de un lote de trabajos
+	BytesPerDay    int64 // Bytes de las respuestas enviadas al cliente
+	Admin          bool  // Puede usar cualquier sesión y los RPC de administración
+}
+
+// KeyScope limita lo que puede pedir una clave de API; una lista vacía no limita
+type KeyScope struct {
+	Sessions []string // Sesiones, con el nombre que usa el tenant
+	Hosts    []string // Hosts de destino (".dominio" incluye los subdominios), IPs o redes CIDR
+}
+
+// ScopedKey es una clave de API que solo sirve para las sesiones y destinos de su ámbito
+type ScopedKey struct {
+	Key string
+	KeyScope
+}
+
+// tenantKeyEntry es el tenant de una clave y su ámbito
+type tenantKeyEntry struct {
+	tenant Tenant
+	scope  KeyScope
+}
+
+// TenantSessionSeparator separa el nombre del tenant del de la sesión
+const TenantSessionSeparator = "/"
+
+// Fichero JSON con los tenants; vacío deshabilita la autenticación por clave de API
+var TenantsFile = getEnv("TENANTS_FILE", "")
+
+// Peticiones programadas activas de cada tenant que no es Admin; 0 sin límite
+var TenantMaxSchedules = getEnvInt("TENANT_MAX_SCHEDULES", 20)
+
+// Sesiones con URL calientes y URL calientes en total de cada tenant que no es Admin; 0 sin límite
+var TenantMaxWarmSets = getEnvInt("TENANT_MAX_WARM_SETS", 5)
+var TenantMaxWarmURLs = getEnvInt("TENANT_MAX_WARM_URLS", 100)
+
+var (
+	tenants      []Tenant
+	tenantsByKey map[[sha256.Size]byte]tenantKeyEntry
+	tenantsMtx   sync.RWMutex
+)
+
+// TenancyEnabled indica si hay tenants configurados
+func TenancyEnabled() bool {
+	tenantsMtx.RLock()
+	defer tenantsMtx.RUnlock()
+	return len(tenants) > 0
+}
+
+// Tenants devuelve los tenants configurados
+func Tenants() []Tenant {
+	tenantsMtx.RLock()
+	defer tenantsMtx.RUnlock()
+	return tenants
+}
+
+// TenantByKey devuelve el tenant de una clave de API y el ámbito de la clave
+func TenantByKey(key string) (Tenant, KeyScope, bool) {
+	tenantsMtx.RLock()
+	defer tenantsMtx.RUnlock()
+	entry, ok := tenantsByKey[sha256.Sum256([]byte(key))]
+	return entry.tenant, entry.scope, ok
+}
+
+// SharesSession indica si la sesión es una de las compartidas del tenant
+func (t Tenant) SharesSession(session string) bool {
+	for _, shared := range t.SharedSessions {
+		if shared == session {
+			return true
+		}
+	}
+	return false
+}
+
+// ReloadTenants vuelve a leer TENANTS_FILE. Si no es válido devuelve el error y se
+// mantienen los tenants anteriores.
+func ReloadTenants() error {
+	if TenantsFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(TenantsFile)
+	if err != nil {
+		return err
+	}
+	var list []Tenant
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("tenants file '%s': %v", TenantsFile, err)
+	}
+	if len(list) == 0 {
+		return fmt.Errorf("tenants file '%s' has no tenants", TenantsFile)
+	}
+
+	names := make(map[string]bool)
+	byKey := make(map[[sha256.Size]byte]tenantKeyEntry)
+	for i, tenant := range list {
+		if err := validateTenant(tenant); err != nil {
+			return fmt.Errorf("tenants file '%s', entry %d: %v", TenantsFile, i, err)
+		}
+		if names[tenant.Name] {
+			return fmt.Errorf("tenants file '%s': duplicate tenant '%s'", TenantsFile, tenant.Name)
+		}
+		names[tenant.Name] = true
+		for _, key := range tenantKeys(tenant) {
+			hash := sha256.Sum256([]byte(key.Key))
+			if other, ok := byKey[hash]; ok {
+				return fmt.Errorf("tenants file '%s': tenants '%s' and '%s' share an api key", TenantsFile, other.tenant.Name, tenant.Name)
+			}
+			byKey[hash] = tenantKeyEntry{tenant: tenant, scope: key.KeyScope}
+		}
+	}
+
+	tenantsMtx.Lock()
+	tenants, tenantsByKey = list, byKey
+	tenantsMtx.Unlock()
+	return nil
+}
+
+// tenantKeys devuelve todas las claves del tenant; las de APIKeys no tienen ámbito
+func tenantKeys(tenant Tenant) []ScopedKey {
+	keys := make([]ScopedKey, 0, len(tenant.APIKeys)+len(tenant.ScopedKeys))
+	for _, key := range tenant.APIKeys {
+		keys = append(keys, ScopedKey{Key: key})
+	}
+	return append(keys, tenant.ScopedKeys...)
+}
+
+func validateTenant(tenant Tenant) error {
+	if tenant.Name == "" || strings.Contains(tenant.Name, TenantSessionSeparator) {
+		return fmt.Errorf("invalid tenant name '%s'", tenant.Name)
+	}
+	keys := tenantKeys(tenant)
+	if len(keys) == 0 {
+		return fmt.Errorf("tenant '%s' has no api keys", tenant.Name)
+	}
+	for _, key := range keys {
+		if len(key.Key) < 16 {
+			return fmt.Errorf("tenant '%s' has an api key shorter than 16 characters", tenant.Name)
+		}
+		for _, host := range key.Hosts {
+			if strings.Contains(host, "/") {
+				if _, _, err := net.ParseCIDR(host); err != nil {
+					return fmt.Errorf("tenant '%s' has a key scoped to the invalid network '%s'", tenant.Name, host)
+				}
+			}
+		}
+	}
+	if tenant.RequestsPerDay < 0 || tenant.BytesPerDay < 0 {
+		return errors.New("tenant quotas cannot be negative")
+	}
+	return nil
+}
+
+func init() {
+	// Los errores del fichero los informa Validate
+	ReloadTenants()
+}
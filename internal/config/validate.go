@@ -0,0 +1,538 @@
+package config
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"proxy-api/internal/rules"
+	"proxy-api/internal/script"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+var validFallbackKinds = map[string]bool{
+	FallbackSuccessful: true,
+	FallbackPool:       true,
+	FallbackProvider:   true,
+	FallbackDirect:     true,
+	FallbackHot:        true,
+}
+
+// localePattern acepta un idioma con región opcional: "es", "es-ES"
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// validateSession devuelve los problemas encontrados en la definición de una sesión
+func validateSession(key string, session ProxySession) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("session '%s': "+format, append([]interface{}{key}, args...)...))
+	}
+
+	if session.Name == "" {
+		fail("missing name")
+	} else if session.Name != key {
+		fail("name '%s' does not match its key", session.Name)
+	}
+
+	if session.URL == "" {
+		fail("missing URL")
+	} else if u, err := url.ParseRequestURI(session.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		fail("invalid URL '%s'", session.URL)
+	}
+
+	if session.Timeout <= 0 {
+		fail("timeout must be positive, got %d", session.Timeout)
+	}
+
+	for name, value := range session.Headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			fail("malformed header name %q", name)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			fail("malformed value for header %q", name)
+		}
+	}
+
+	if !httpguts.ValidHeaderFieldValue(session.DirectIdentity.UserAgent) {
+		fail("malformed direct identity user agent")
+	}
+	for name, value := range session.DirectIdentity.Headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			fail("malformed direct identity header name %q", name)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			fail("malformed value for direct identity header %q", name)
+		}
+	}
+
+	switch session.Diversity {
+	case "", DiversitySubnet:
+	case DiversityASN:
+		if ASNDatabasePath == "" {
+			fail("asn diversity requires ASN_DB_PATH")
+		}
+	default:
+		fail("unknown diversity mode '%s'", session.Diversity)
+	}
+
+	switch session.UserAgentRotation {
+	case "", UserAgentRandom, UserAgentProxy, UserAgentIdentity:
+	case UserAgentStatic:
+		if session.StaticUserAgent == "" {
+			fail("static user-agent rotation requires StaticUserAgent")
+		}
+	default:
+		fail("unknown user-agent rotation '%s'", session.UserAgentRotation)
+	}
+	if !httpguts.ValidHeaderFieldValue(session.StaticUserAgent) {
+		fail("malformed static user-agent %q", session.StaticUserAgent)
+	}
+
+	if session.TLS.RootCAs != "" {
+		if pem, err := os.ReadFile(session.TLS.RootCAs); err != nil {
+			fail("cannot read tls root CAs: %v", err)
+		} else if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			fail("no certificates found in tls root CAs '%s'", session.TLS.RootCAs)
+		}
+	}
+	if name := session.TLS.ServerName; name != "" && (strings.ContainsAny(name, ":/ ") || net.ParseIP(name) != nil) {
+		fail("invalid tls server name '%s'", name)
+	}
+	if session.Locale != "" && !localePattern.MatchString(session.Locale) {
+		fail("invalid locale '%s', expected a language tag like es-ES", session.Locale)
+	}
+
+	if session.Eviction.Strikes < 0 || session.Eviction.Window < 0 || session.Eviction.Cooldown < 0 {
+		fail("eviction strikes, window and cooldown cannot be negative")
+	}
+	for category, weight := range session.Eviction.Weights {
+		if _, ok := DefaultErrorWeights[category]; !ok {
+			fail("unknown eviction error category '%s'", category)
+		} else if weight < 0 {
+			fail("eviction weight for '%s' cannot be negative", category)
+		}
+	}
+	if session.HotSetSize < 0 || session.HotSetInterval < 0 {
+		fail("hot set size and interval cannot be negative")
+	}
+	if slo := session.SLO; slo.P95 < 0 || slo.Window < 0 {
+		fail("slo p95 and window cannot be negative")
+	} else if slo.Action != "" && slo.Action != SLOHedge && slo.Action != SLOHot && slo.Action != SLODirect {
+		fail("unknown slo action '%s'", slo.Action)
+	}
+	if session.Browser && BrowserEndpoint == "" {
+		fail("browser fetching requires BROWSER_ENDPOINT")
+	}
+	if session.CloudflareClearance && BrowserEndpoint == "" {
+		fail("cloudflare clearance requires BROWSER_ENDPOINT")
+	}
+	for host, ip := range session.Hosts {
+		if host == "" || strings.ContainsAny(host, ":/") {
+			fail("invalid host override '%s'", host)
+		}
+		if net.ParseIP(ip) == nil {
+			fail("invalid address '%s' for host '%s'", ip, host)
+		}
+	}
+	for _, name := range session.HeaderOrder {
+		if !httpguts.ValidHeaderFieldName(name) {
+			fail("malformed header name %q in header order", name)
+		}
+	}
+	if session.HedgeDelay < 0 {
+		fail("hedge delay cannot be negative, got %d", session.HedgeDelay)
+	}
+	if check := session.Integrity; check.Percent != 0 || check.Reference != "" || check.MinSimilarity != 0 {
+		if check.Percent < 0 || check.Percent > 100 {
+			fail("integrity percent must be between 0 and 100, got %d", check.Percent)
+		}
+		if check.Reference != "" && check.Reference != IntegrityDirect && check.Reference != IntegrityProxy {
+			fail("unknown integrity reference '%s'", check.Reference)
+		}
+		if check.MinSimilarity < 0 || check.MinSimilarity > 1 {
+			fail("integrity min similarity must be between 0 and 1, got %g", check.MinSimilarity)
+		}
+	}
+	if name := session.Captcha.TokenHeader; name != "" && !httpguts.ValidHeaderFieldName(name) {
+		fail("malformed captcha token header %q", name)
+	}
+	for _, contentType := range session.ContentTypes {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil || !strings.Contains(contentType, "/") {
+			fail("invalid content type '%s'", contentType)
+		}
+	}
+	if session.MaxProxyAge < 0 {
+		fail("max proxy age cannot be negative, got %d", session.MaxProxyAge)
+	}
+	if p := session.LogSamplePercent; p != nil && (*p < 0 || *p > 100) {
+		fail("log sample percent must be between 0 and 100, got %d", *p)
+	}
+	if session.MaxBodyBytes < 0 {
+		fail("max body bytes cannot be negative, got %d", session.MaxBodyBytes)
+	}
+
+	if session.Validation != "" {
+		if _, err := rules.Compile(session.Validation); err != nil {
+			fail("invalid validation rule: %v", err)
+		}
+	}
+
+	if session.Rewrite != "" {
+		if _, err := script.Compile(session.Rewrite); err != nil {
+			fail("invalid rewrite script: %v", err)
+		}
+	}
+
+	if exp := session.Experiment; exp != nil {
+		if exp.Split < 0 || exp.Split > 100 {
+			fail("experiment split must be between 0 and 100, got %d", exp.Split)
+		}
+		for name, variant := range map[string]ExperimentVariant{"A": exp.A, "B": exp.B} {
+			if variant.Strategy != "" && variant.Strategy != StrategyHedged && variant.Strategy != StrategyRace && variant.Strategy != StrategySequential {
+				fail("experiment variant %s has unknown strategy '%s'", name, variant.Strategy)
+			}
+			if variant.Backoff < 0 {
+				fail("experiment variant %s has negative backoff", name)
+			}
+		}
+	}
+
+	for i, stage := range session.Fallback {
+		if !validFallbackKinds[stage.Kind] {
+			fail("fallback stage %d has unknown kind '%s'", i+1, stage.Kind)
+		}
+		if stage.Kind == FallbackProvider {
+			if _, err := url.Parse(providerSample.Replace(stage.Provider)); err != nil || stage.Provider == "" {
+				fail("fallback stage %d requires a valid provider URL", i+1)
+			}
+		}
+		if stage.Attempts < 0 || stage.Timeout < 0 || stage.StickyTTL < 0 {
+			fail("fallback stage %d has negative attempts, timeout or sticky ttl", i+1)
+		}
+	}
+
+	return errs
+}
+
+// Validate comprueba la configuración efectiva y devuelve todos los problemas encontrados
+func Validate() error {
+	var errs []error
+
+	sessions := Sessions()
+	if len(sessions) == 0 {
+		errs = append(errs, errors.New("no sessions configured"))
+	}
+
+	names := make(map[string]string)
+	for key, session := range sessions {
+		errs = append(errs, validateSession(key, session)...)
+		if other, ok := names[session.Name]; ok && session.Name != "" {
+			errs = append(errs, fmt.Errorf("sessions '%s' and '%s' share the name '%s'", other, key, session.Name))
+		}
+		names[session.Name] = key
+	}
+
+	if err := ReloadProxySources(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := ReloadTenants(); err != nil {
+		errs = append(errs, err)
+	} else if TenantsFile != "" && !slices.Contains(strings.Split(strings.ReplaceAll(GRPCInterceptors, " ", ""), ","), "tenants") {
+		errs = append(errs, errors.New("TENANTS_FILE requires the tenants interceptor in GRPC_INTERCEPTORS"))
+	}
+	if SourceFailureThreshold < 0 || SourceBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("source failure threshold cannot be negative and backoff must be positive"))
+	}
+	if DefaultChunkSize <= 0 {
+		errs = append(errs, fmt.Errorf("chunk size must be positive, got %d", DefaultChunkSize))
+	}
+	if AuditLogPath != "" && (AuditLogMaxSizeMB <= 0 || AuditLogMaxFiles < 0) {
+		errs = append(errs, errors.New("audit log rotation settings must be positive"))
+	}
+	if StorageDriver != "" && StorageDriver != "sqlite" && StorageDriver != "postgres" {
+		errs = append(errs, fmt.Errorf("unsupported storage driver '%s'", StorageDriver))
+	}
+	switch SharedPoolDriver {
+	case "", "file", "redis", "sqlite", "postgres":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported shared pool driver '%s'", SharedPoolDriver))
+	}
+	if SharedPoolDriver != "" && SharedPoolPoll <= 0 {
+		errs = append(errs, fmt.Errorf("shared pool poll interval must be positive, got %d", SharedPoolPoll))
+	}
+	if BusDriver != "" && BusDriver != "nats" && BusDriver != "kafka" {
+		errs = append(errs, fmt.Errorf("unsupported bus driver '%s'", BusDriver))
+	}
+	switch ResultStoreDriver {
+	case "":
+	case "s3", "gcs":
+		if ResultStoreBucket == "" || ResultStoreAccessKey == "" || ResultStoreSecretKey == "" {
+			errs = append(errs, errors.New("result store requires RESULT_STORE_BUCKET, RESULT_STORE_ACCESS_KEY and RESULT_STORE_SECRET_KEY"))
+		}
+		if !strings.Contains(ResultStoreKeyTemplate, "{job_id}") && !strings.Contains(ResultStoreKeyTemplate, "{request_id}") {
+			errs = append(errs, errors.New("result store key template must include {job_id} or {request_id}"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported result store driver '%s'", ResultStoreDriver))
+	}
+	if strings.Trim(GRPCListenAddresses, ", ") == "" {
+		errs = append(errs, errors.New("at least one gRPC listen address is required"))
+	}
+	if AdminAddress != "" {
+		if _, _, err := net.SplitHostPort(AdminAddress); err != nil {
+			errs = append(errs, fmt.Errorf("invalid admin address '%s': %v", AdminAddress, err))
+		}
+	}
+	if OutboundAddress != "" && net.ParseIP(OutboundAddress) == nil {
+		errs = append(errs, fmt.Errorf("invalid outbound address '%s'", OutboundAddress))
+	}
+	if OutboundAddress == "" && OutboundInterface != "" {
+		if _, err := net.InterfaceByName(OutboundInterface); err != nil {
+			errs = append(errs, fmt.Errorf("outbound interface '%s': %v", OutboundInterface, err))
+		}
+	}
+	if MaxConnections < 0 {
+		errs = append(errs, fmt.Errorf("MAX_CONNECTIONS cannot be negative, got %d", MaxConnections))
+	}
+	if UpstreamProxy != "" {
+		if u, err := url.Parse(UpstreamProxy); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid upstream proxy '%s'", RedactURL(UpstreamProxy)))
+		}
+	}
+	for _, list := range []string{TargetAllowHosts, TargetDenyHosts} {
+		for _, entry := range strings.Split(list, ",") {
+			entry = strings.TrimSpace(entry)
+			if strings.Contains(entry, "/") {
+				if _, _, err := net.ParseCIDR(entry); err != nil {
+					errs = append(errs, fmt.Errorf("invalid target network '%s': %v", entry, err))
+				}
+			}
+		}
+	}
+	if BrowserEndpoint != "" {
+		if u, err := url.Parse(BrowserEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid browser endpoint '%s'", RedactURL(BrowserEndpoint)))
+		}
+	}
+	if ClearanceTimeout <= 0 || ClearanceTTL <= 0 {
+		errs = append(errs, fmt.Errorf("clearance timeout and TTL must be positive"))
+	}
+	if HostIntelTTL < 0 || HostIntelMinBlocks < 1 {
+		errs = append(errs, fmt.Errorf("host intel ttl cannot be negative and min blocks must be at least 1, got %d and %d", HostIntelTTL, HostIntelMinBlocks))
+	}
+	if CaptchaBanDuration < 0 {
+		errs = append(errs, fmt.Errorf("captcha ban duration cannot be negative, got %d", CaptchaBanDuration))
+	}
+	switch CaptchaSolver {
+	case "":
+	case "2captcha", "anticaptcha":
+		if CaptchaSolverKey == "" {
+			errs = append(errs, fmt.Errorf("captcha solver '%s' requires CAPTCHA_SOLVER_KEY", CaptchaSolver))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown captcha solver '%s'", CaptchaSolver))
+	}
+	if CaptchaSolveTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("captcha solve timeout must be positive, got %d", CaptchaSolveTimeout))
+	}
+	if ChaosPercent < 0 || ChaosPercent > 100 {
+		errs = append(errs, fmt.Errorf("chaos percent must be between 0 and 100, got %d", ChaosPercent))
+	}
+	if ChaosDelay < 0 {
+		errs = append(errs, fmt.Errorf("chaos delay cannot be negative, got %d", ChaosDelay))
+	}
+	for _, fault := range strings.Split(ChaosFaults, ",") {
+		switch strings.TrimSpace(fault) {
+		case ChaosFaultDelay, ChaosFaultDrop, ChaosFaultCorrupt, "":
+		default:
+			errs = append(errs, fmt.Errorf("unknown chaos fault '%s'", fault))
+		}
+	}
+	switch RequestLog {
+	case "text", "json", "off":
+	default:
+		errs = append(errs, fmt.Errorf("unknown request log format '%s'", RequestLog))
+	}
+	if RequestLogSamplePercent < 0 || RequestLogSamplePercent > 100 {
+		errs = append(errs, fmt.Errorf("request log sample percent must be between 0 and 100, got %d", RequestLogSamplePercent))
+	}
+	if SpillThreshold <= 0 || SpillTTL <= 0 {
+		errs = append(errs, errors.New("spill threshold and ttl must be positive"))
+	}
+	if SpillMaxBytes < 0 || SpillDirMaxBytes < 0 {
+		errs = append(errs, errors.New("spill max bytes and spill dir max bytes cannot be negative"))
+	}
+	if UserAgentRefreshMinutes < 0 {
+		errs = append(errs, fmt.Errorf("user-agent refresh minutes cannot be negative, got %d", UserAgentRefreshMinutes))
+	}
+	if DefaultUserAgent == "" || !httpguts.ValidHeaderFieldValue(DefaultUserAgent) {
+		errs = append(errs, fmt.Errorf("malformed default user-agent %q", DefaultUserAgent))
+	}
+	for _, method := range strings.Split(AllowedMethods, ",") {
+		if method = strings.TrimSpace(method); method == "" || !httpguts.ValidHeaderFieldName(method) {
+			errs = append(errs, fmt.Errorf("malformed allowed method %q", method))
+		}
+	}
+	for _, name := range strings.Split(SensitiveHeaders, ",") {
+		if name = strings.TrimSpace(name); name != "" && !httpguts.ValidHeaderFieldName(name) {
+			errs = append(errs, fmt.Errorf("malformed sensitive header name %q", name))
+		}
+	}
+	if UsageRetentionDays < 1 {
+		errs = append(errs, fmt.Errorf("usage retention days must be at least 1, got %d", UsageRetentionDays))
+	}
+	if JobRetentionHours < 1 {
+		errs = append(errs, fmt.Errorf("job retention hours must be at least 1, got %d", JobRetentionHours))
+	}
+	if RequestIDHeader != "" && !httpguts.ValidHeaderFieldName(RequestIDHeader) {
+		errs = append(errs, fmt.Errorf("malformed request id header %q", RequestIDHeader))
+	}
+	if RetryBudgetPercent < 0 || RetryBudgetMinPerSecond < 0 {
+		errs = append(errs, errors.New("retry budget settings cannot be negative"))
+	}
+	if MaxInFlight < 0 || BackpressureRetryDelay < 0 {
+		errs = append(errs, errors.New("MAX_IN_FLIGHT and BACKPRESSURE_RETRY_MS cannot be negative"))
+	}
+	if AsyncWorkers <= 0 || AsyncQueueSize < 0 {
+		errs = append(errs, fmt.Errorf("ASYNC_WORKERS must be positive and ASYNC_QUEUE_SIZE cannot be negative, got %d and %d", AsyncWorkers, AsyncQueueSize))
+	}
+	if GRPCKeepaliveMaxIdle < 0 || GRPCKeepaliveTime <= 0 || GRPCKeepaliveTimeout <= 0 || GRPCKeepaliveMinTime < 0 ||
+		GRPCMaxConnectionAge < 0 || GRPCMaxConnectionAgeGrace < 0 {
+		errs = append(errs, errors.New("gRPC keepalive settings must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Dump escribe la configuración efectiva en formato JSON, sin credenciales
+func Dump(w io.Writer) error {
+	sessions := Sessions()
+	for name, session := range sessions {
+		stages := make([]FallbackStage, len(session.FallbackChain()))
+		copy(stages, session.FallbackChain())
+		for i := range stages {
+			stages[i].Provider = RedactURL(stages[i].Provider)
+		}
+		session.Fallback = stages
+		session.Headers = RedactHeaders(session.Headers)
+		session.DirectIdentity.Headers = RedactHeaders(session.DirectIdentity.Headers)
+		sessions[name] = session
+	}
+
+	effective := map[string]interface{}{
+		"chunk_size":      DefaultChunkSize,
+		"update_minutes":  UpdateTime,
+		"drain_timeout_s": DrainTimeout,
+		"max_redirects":   DefaultMaxRedirects,
+		"audit_log_path":  AuditLogPath,
+		"storage_driver":  StorageDriver,
+		"storage_dsn":     RedactURL(StorageDSN),
+		"shared_pool": map[string]interface{}{
+			"driver": SharedPoolDriver,
+			"url":    RedactURL(SharedPoolURL),
+			"key":    SharedPoolKey,
+			"poll_s": SharedPoolPoll,
+		},
+		"result_store": map[string]interface{}{
+			"driver":       ResultStoreDriver,
+			"bucket":       ResultStoreBucket,
+			"endpoint":     ResultStoreEndpoint,
+			"region":       ResultStoreRegion,
+			"key_template": ResultStoreKeyTemplate,
+		},
+		"cache_max_entries": CacheMaxEntries,
+		"cache_ttl_s":       CacheTTL,
+		"grpc_listen":       GRPCListenAddresses,
+		"grpc_interceptors": GRPCInterceptors,
+		"allowed_methods":   AllowedMethods,
+		"tenants_file":      TenantsFile,
+		"tenants":           len(Tenants()),
+		"admin_address":     AdminAddress,
+		"grpc_keepalive": map[string]interface{}{
+			"max_idle_s":                 GRPCKeepaliveMaxIdle,
+			"time_s":                     GRPCKeepaliveTime,
+			"timeout_s":                  GRPCKeepaliveTimeout,
+			"min_time_s":                 GRPCKeepaliveMinTime,
+			"permit_without_stream":      GRPCKeepalivePermitWithoutStream,
+			"max_connection_age_s":       GRPCMaxConnectionAge,
+			"max_connection_age_grace_s": GRPCMaxConnectionAgeGrace,
+		},
+		"request_log": map[string]interface{}{
+			"format":         RequestLog,
+			"sample_percent": RequestLogSamplePercent,
+			"errors":         RequestLogErrors,
+		},
+		"request_id_header":          RequestIDHeader,
+		"usage_retention_days":       UsageRetentionDays,
+		"job_retention_hours":        JobRetentionHours,
+		"default_user_agent":         DefaultUserAgent,
+		"user_agent_refresh_minutes": UserAgentRefreshMinutes,
+		"spill": map[string]interface{}{
+			"dir":             SpillDir,
+			"threshold_bytes": SpillThreshold,
+			"ttl_s":           SpillTTL,
+			"max_bytes":       SpillMaxBytes,
+			"dir_max_bytes":   SpillDirMaxBytes,
+		},
+		"retry_budget": map[string]interface{}{
+			"percent":        RetryBudgetPercent,
+			"min_per_second": RetryBudgetMinPerSecond,
+		},
+		"backpressure": map[string]interface{}{
+			"max_in_flight":  MaxInFlight,
+			"retry_delay_ms": BackpressureRetryDelay,
+		},
+		"async": map[string]interface{}{
+			"workers":    AsyncWorkers,
+			"queue_size": AsyncQueueSize,
+		},
+		"chaos": map[string]interface{}{
+			"percent":  ChaosPercent,
+			"faults":   ChaosFaults,
+			"delay_ms": ChaosDelay,
+		},
+		"outbound_address":   OutboundAddress,
+		"outbound_interface": OutboundInterface,
+		"max_connections":    MaxConnections,
+		"upstream_proxy":     RedactURL(UpstreamProxy),
+		"upstream_bypass":    UpstreamProxyBypass,
+		"browser_endpoint":   RedactURL(BrowserEndpoint),
+		"targets": map[string]interface{}{
+			"allow":         TargetAllowHosts,
+			"deny":          TargetDenyHosts,
+			"block_private": BlockPrivateTargets,
+		},
+		"captcha_ban_s":         CaptchaBanDuration,
+		"host_intel_ttl_s":      HostIntelTTL,
+		"host_intel_min_blocks": HostIntelMinBlocks,
+		"clearance": map[string]interface{}{
+			"timeout_s": ClearanceTimeout,
+			"ttl_s":     ClearanceTTL,
+		},
+		"captcha_solver":    CaptchaSolver,
+		"captcha_solve_s":   CaptchaSolveTimeout,
+		"proxy_sources":     ProxySources(),
+		"proxy_sources_dir": ProxySourcesDir,
+		"collapse_dup_ips":  CollapseDuplicateIPs,
+		"source_health": map[string]interface{}{
+			"failure_threshold": SourceFailureThreshold,
+			"backoff_minutes":   SourceBackoff,
+		},
+		"sensitive_headers": SensitiveHeaders,
+		"sessions":          sessions,
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(effective)
+}
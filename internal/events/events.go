@@ -0,0 +1,74 @@
+// Package events reparte entre los suscriptores de SubscribeEvents lo que ocurre en el
+// servidor (proxies retirados, pool refrescado, sesiones degradadas, CAPTCHA, fuentes
+// caídas) para que los clientes reaccionen sin leer el log.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Tipos de evento
+const (
+	ProxyEvicted     = "proxy_evicted"     // Un proxy deja de usarse en una sesión
+	PoolRefreshed    = "pool_refreshed"    // Un ciclo de validación o una importación reemplazó el pool
+	SessionDegraded  = "session_degraded"  // La sesión incumple su SLO de latencia y cambia de estrategia
+	SessionRecovered = "session_recovered" // La sesión vuelve a cumplir su SLO
+	CaptchaDetected  = "captcha_detected"  // Una respuesta del destino fue una página de desafío
+	SourceFailed     = "source_failed"     // Falló la descarga de una fuente de proxies
+)
+
+// Kinds son los tipos de evento conocidos
+var Kinds = []string{ProxyEvicted, PoolRefreshed, SessionDegraded, SessionRecovered, CaptchaDetected, SourceFailed}
+
+// Event es un suceso del servidor; los campos que no aplican a su tipo van vacíos
+type Event struct {
+	Kind      string
+	Session   string
+	Proxy     string
+	Host      string // Host del destino
+	Source    string // URL de la fuente de proxies
+	Reason    string // Causa legible: categoría de error, sistema anti-bot, estrategia adoptada...
+	Count     int    // Proxies del pool, fallos seguidos de la fuente o P95 en ms, según el tipo
+	Timestamp time.Time
+}
+
+// Suscriptores a los eventos
+var (
+	subscribers    = make(map[chan Event]struct{})
+	subscribersMtx sync.Mutex
+)
+
+// Subscribe registra un canal que recibe los eventos. La función devuelta cancela la
+// suscripción y cierra el canal.
+func Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+
+	subscribersMtx.Lock()
+	subscribers[ch] = struct{}{}
+	subscribersMtx.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			subscribersMtx.Lock()
+			delete(subscribers, ch)
+			subscribersMtx.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish envía el evento sin bloquear; los suscriptores lentos pierden eventos
+func Publish(event Event) {
+	event.Timestamp = time.Now()
+
+	subscribersMtx.Lock()
+	defer subscribersMtx.Unlock()
+	for ch := range subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Benchmarks del motor en el propio proceso: selección del pool, orquestación de los
+// intentos por proxy contra destinos y proxies falsos, y validación de proxies. Se
+// ejecutan con go test -bench y dos ejecuciones se comparan con benchstat.
+package harness_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/config"
+	"proxy-api/internal/harness"
+	"proxy-api/internal/proxy"
+	"proxy-api/proxyserver"
+)
+
+// benchEnv agrupa el motor y los servicios falsos que comparten los benchmarks
+type benchEnv struct {
+	srv     *proxyserver.Server
+	target  *harness.Target
+	proxies []*harness.Proxy
+}
+
+// Sesiones de los benchmarks
+const (
+	sessionSelection = "bench-selection"
+	sessionDirect    = "bench-direct"
+	sessionHedged    = "bench-hedged"
+	sessionRace      = "bench-race"
+	sessionSequence  = "bench-sequential"
+)
+
+// Proxies ficticios del pool de selección; no se conecta con ellos
+const selectionPoolSize = 500
+
+// El motor de los benchmarks se arranca una vez y vive hasta que termina el proceso
+var (
+	sharedBench     *benchEnv
+	sharedBenchErr  error
+	sharedBenchOnce sync.Once
+)
+
+// benchSession crea la sesión de un benchmark con una sola etapa
+func benchSession(name, kind string) proxyserver.Session {
+	return proxyserver.Session{
+		Name:     name,
+		URL:      "http://example.com",
+		Timeout:  2000,
+		Fallback: []config.FallbackStage{{Kind: kind}},
+	}
+}
+
+// withStrategy fija la estrategia de intentos de la sesión con un experimento sin reparto
+func withStrategy(session proxyserver.Session, strategy string) proxyserver.Session {
+	session.Experiment = &config.Experiment{Name: session.Name, A: config.ExperimentVariant{Strategy: strategy}}
+	return session
+}
+
+// startBench arranca el motor con las sesiones y los proxies de los benchmarks
+func startBench() (*benchEnv, error) {
+	// El destino y los proxies falsos escuchan en loopback
+	config.BlockPrivateTargets = false
+	// Los registros del motor se mezclarían con las líneas de resultados que lee benchstat
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+
+	target := harness.NewTarget("bench")
+	var proxies []*harness.Proxy
+	for i := 0; i < 4; i++ {
+		proxies = append(proxies, harness.NewProxy(harness.Healthy, 0))
+	}
+
+	cfg := proxyserver.Config{
+		Pool: proxyserver.NewMemoryPool(),
+		Sessions: []proxyserver.Session{
+			benchSession(sessionSelection, config.FallbackPool),
+			benchSession(sessionDirect, config.FallbackDirect),
+			benchSession(sessionHedged, config.FallbackPool),
+			withStrategy(benchSession(sessionRace, config.FallbackPool), config.StrategyRace),
+			withStrategy(benchSession(sessionSequence, config.FallbackPool), config.StrategySequential),
+		},
+		Proxies: map[string][]string{},
+	}
+	for i := 0; i < selectionPoolSize; i++ {
+		cfg.Proxies[sessionSelection] = append(cfg.Proxies[sessionSelection], fmt.Sprintf("http://198.51.100.%d:%d", i%250+1, 8000+i))
+	}
+	for _, session := range []string{sessionDirect, sessionHedged, sessionRace, sessionSequence} {
+		for _, p := range proxies {
+			cfg.Proxies[session] = append(cfg.Proxies[session], p.URL)
+		}
+	}
+
+	srv := proxyserver.New(cfg)
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(context.Background()) }()
+	// Ready es común al proceso y TestEndToEnd ya lo deja a true: se espera a que el pool
+	// de este motor tenga proxies
+	for {
+		if _, err := srv.RandomProxy(context.Background(), sessionSelection); err == nil && srv.Ready() {
+			break
+		}
+		select {
+		case err := <-runErr:
+			return nil, fmt.Errorf("el motor no arrancó: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return &benchEnv{srv: srv, target: target, proxies: proxies}, nil
+}
+
+// bench devuelve el entorno compartido, arrancándolo en el primer benchmark, y pone a
+// cero el contador para no medir el arranque
+func bench(b *testing.B) *benchEnv {
+	sharedBenchOnce.Do(func() { sharedBench, sharedBenchErr = startBench() })
+	if sharedBenchErr != nil {
+		b.Fatal(sharedBenchErr)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	return sharedBench
+}
+
+// fetch pide el destino con la sesión indicada y falla el benchmark si no responde
+func (e *benchEnv) fetch(b *testing.B, session string, useProxy bool) {
+	resp, err := e.srv.Fetch(context.Background(), &pb.Request{
+		Url:       e.target.URL,
+		Session:   session,
+		Proxy:     useProxy,
+		UserAgent: "proxy-api-bench",
+	})
+	if err != nil {
+		b.Errorf("%s: %v", session, err)
+		return
+	}
+	if string(resp.Content) != e.target.Body {
+		b.Errorf("%s: contenido inesperado", session)
+	}
+}
+
+func BenchmarkPoolSelection(b *testing.B) {
+	e := bench(b)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.srv.RandomProxy(ctx, sessionSelection); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPoolSelectionParallel(b *testing.B) {
+	e := bench(b)
+	ctx := context.Background()
+	b.RunParallel(func(p *testing.PB) {
+		for p.Next() {
+			if _, err := e.srv.RandomProxy(ctx, sessionSelection); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkDryRunPlan(b *testing.B) {
+	e := bench(b)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		_, err := e.srv.Fetch(ctx, &pb.Request{Url: e.target.URL, Session: sessionSelection, Proxy: true, DryRun: true})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFetchDirect(b *testing.B) {
+	e := bench(b)
+	for i := 0; i < b.N; i++ {
+		e.fetch(b, sessionDirect, false)
+	}
+}
+
+func BenchmarkFetchHedged(b *testing.B) {
+	e := bench(b)
+	for i := 0; i < b.N; i++ {
+		e.fetch(b, sessionHedged, true)
+	}
+}
+
+func BenchmarkFetchRace(b *testing.B) {
+	e := bench(b)
+	for i := 0; i < b.N; i++ {
+		e.fetch(b, sessionRace, true)
+	}
+}
+
+func BenchmarkFetchSequential(b *testing.B) {
+	e := bench(b)
+	for i := 0; i < b.N; i++ {
+		e.fetch(b, sessionSequence, true)
+	}
+}
+
+func BenchmarkFetchHedgedParallel(b *testing.B) {
+	e := bench(b)
+	b.RunParallel(func(p *testing.PB) {
+		for p.Next() {
+			e.fetch(b, sessionHedged, true)
+		}
+	})
+}
+
+func BenchmarkValidation(b *testing.B) {
+	e := bench(b)
+	cfg := config.ProxySession{Name: "bench-validation", URL: e.target.URL, Timeout: 2000}
+	p, err := proxy.Parse(e.proxies[0].URL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		if !proxy.RunProxyTest(context.Background(), cfg, p) {
+			b.Fatal("el proxy no pasó la validación")
+		}
+	}
+}
+
+func BenchmarkValidationParallel(b *testing.B) {
+	e := bench(b)
+	cfg := config.ProxySession{Name: "bench-validation", URL: e.target.URL, Timeout: 2000}
+	var list []proxy.Proxy
+	for _, hp := range e.proxies {
+		p, err := proxy.Parse(hp.URL)
+		if err != nil {
+			b.Fatal(err)
+		}
+		list = append(list, p)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(p *testing.PB) {
+		i := 0
+		for p.Next() {
+			if !proxy.RunProxyTest(context.Background(), cfg, list[i%len(list)]) {
+				b.Error("el proxy no pasó la validación")
+				return
+			}
+			i++
+		}
+	})
+}
@@ -0,0 +1,640 @@
+// Pruebas de extremo a extremo: arrancan el motor con un pool fijo de proxies falsos
+// y comprueban la selección del pool, la retirada de proxies, los intentos
+// escalonados, la cancelación de las llamadas y la cadena de fallback.
+package harness_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	pb "proxy-api/fetch"
+	"proxy-api/internal/captcha"
+	"proxy-api/internal/config"
+	"proxy-api/internal/harness"
+	"proxy-api/proxyserver"
+
+	"go.uber.org/goleak"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// scenario es un caso de prueba sobre una sesión propia
+type scenario struct {
+	name    string
+	session proxyserver.Session
+	proxies []*harness.Proxy
+	check   func(ctx context.Context, env *env) error
+}
+
+// env agrupa lo que comparten los escenarios
+type env struct {
+	srv     *proxyserver.Server
+	pool    proxyserver.ProxyPool
+	target  *harness.Target
+	browser *harness.Browser
+}
+
+// fetch pide el destino con la sesión indicada
+func (e *env) fetch(ctx context.Context, session string) (*pb.Response, error) {
+	return e.srv.Fetch(ctx, &pb.Request{
+		Url:       e.target.URL,
+		Session:   session,
+		Proxy:     true,
+		UserAgent: "proxy-api-e2e",
+	})
+}
+
+// newSession crea la configuración base de un escenario
+func newSession(name string, stages ...string) proxyserver.Session {
+	session := proxyserver.Session{Name: name, URL: "http://example.com", Timeout: 2000}
+	for _, kind := range stages {
+		session.Fallback = append(session.Fallback, config.FallbackStage{Kind: kind})
+	}
+	return session
+}
+
+func scenarios() []scenario {
+	healthy := harness.NewProxy(harness.Healthy, 0)
+	slow := harness.NewProxy(harness.Slow, 2*time.Second)
+	hedged := harness.NewProxy(harness.Healthy, 0)
+	dead := harness.NewProxy(harness.Dead, 0)
+	evicted := harness.NewProxy(harness.Dead, 0)
+	banning := harness.NewProxy(harness.Banning, 0)
+	flaky := harness.NewProxy(harness.Flaky, 0)
+	injecting := harness.NewProxy(harness.Inject, 0)
+	clean := harness.NewProxy(harness.Healthy, 0)
+	tampering := harness.NewProxy(harness.Inject, 0)
+	referee := harness.NewProxy(harness.Healthy, 0)
+	ranged := harness.NewProxy(harness.Healthy, 0)
+	downloading := harness.NewProxy(harness.Healthy, 0)
+	unused := harness.NewProxy(harness.Dead, 0)
+	challenged := harness.NewProxy(harness.Captcha, 0)
+	solvable := harness.NewProxy(harness.Healthy, 0)
+	blocked := harness.NewProxy(harness.Captcha, 0)
+	gated := harness.NewProxy(harness.Solvable, 0)
+	guarded := harness.NewProxy(harness.Guarded, 0)
+	rotating := harness.NewProxy(harness.Healthy, 0)
+	warming := harness.NewProxy(harness.Healthy, 0)
+	purging := harness.NewProxy(harness.Healthy, 0)
+	stalled := []*harness.Proxy{harness.NewProxy(harness.Slow, 5*time.Second), harness.NewProxy(harness.Slow, 5*time.Second), harness.NewProxy(harness.Slow, 5*time.Second)}
+
+	hedging := newSession("e2e-hedging", config.FallbackPool)
+	hedging.HedgeDelay = 50
+
+	provider := newSession("e2e-provider")
+	provider.Fallback = []config.FallbackStage{{
+		Kind:     config.FallbackProvider,
+		Provider: "http://user-session-{id}:secreto@" + strings.TrimPrefix(rotating.URL, "http://"),
+	}}
+
+	warm := newSession("e2e-warmup", config.FallbackPool)
+	invalidated := newSession("e2e-invalidate", config.FallbackPool)
+
+	cancelled := newSession("e2e-cancel", config.FallbackPool)
+	cancelled.HedgeDelay = 20
+	cancelled.Timeout = 10000
+
+	eviction := newSession("e2e-eviction", config.FallbackPool, config.FallbackDirect)
+	eviction.Eviction = config.EvictionPolicy{Strikes: 1, Cooldown: 60000}
+
+	poison := newSession("e2e-poison", config.FallbackPool, config.FallbackDirect)
+	poison.Validation = `status == 403 ? "poison" : "valid"`
+
+	typed := newSession("e2e-content-type", config.FallbackPool)
+	typed.ContentTypes = []string{"text/plain"}
+
+	overridden := newSession("e2e-hosts", config.FallbackDirect)
+	overridden.Hosts = map[string]string{"target.e2e.invalid": "127.0.0.1"}
+
+	solving := newSession("e2e-captcha-solve", config.FallbackPool)
+	solving.Captcha = config.CaptchaSolving{Solve: true}
+
+	cleared := newSession("e2e-clearance", config.FallbackPool)
+	cleared.CloudflareClearance = true
+
+	integrity := newSession("e2e-integrity", config.FallbackPool)
+	integrity.Integrity = config.IntegrityCheck{Percent: 100}
+
+	return []scenario{
+		{
+			name:    "el pool atiende la petición",
+			session: newSession("e2e-pool", config.FallbackPool),
+			proxies: []*harness.Proxy{healthy},
+			check: func(ctx context.Context, e *env) error {
+				resp, err := e.fetch(ctx, "e2e-pool")
+				if err != nil {
+					return err
+				}
+				return expectProxy(resp, healthy)
+			},
+		},
+		{
+			name:    "un proxy lento no retrasa la respuesta",
+			session: hedging,
+			proxies: []*harness.Proxy{slow, hedged},
+			check: func(ctx context.Context, e *env) error {
+				// Con mejor puntuación, el proxy lento es el primero en probarse
+				e.pool.RecordResult("e2e-hedging", slow.URL, true)
+				start := time.Now()
+				resp, err := e.fetch(ctx, "e2e-hedging")
+				if err != nil {
+					return err
+				}
+				if elapsed := time.Since(start); elapsed > time.Second {
+					return fmt.Errorf("la respuesta tardó %v", elapsed)
+				}
+				if slow.Hits() == 0 {
+					return fmt.Errorf("el proxy lento no llegó a probarse")
+				}
+				return expectProxy(resp, hedged)
+			},
+		},
+		{
+			name:    "cancelar la llamada no deja intentos en curso",
+			session: cancelled,
+			proxies: stalled,
+			check: func(ctx context.Context, e *env) error {
+				before := goleak.IgnoreCurrent()
+				callCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+				defer cancel()
+				if _, err := e.fetch(callCtx, "e2e-cancel"); err == nil {
+					return fmt.Errorf("la petición debía cancelarse")
+				}
+				for _, p := range stalled {
+					if p.Hits() == 0 {
+						return fmt.Errorf("no se lanzaron todos los intentos antes de cancelar")
+					}
+				}
+				return expectNoLeaks(before)
+			},
+		},
+		{
+			name:    "cancelar una descarga no deja rangos en curso",
+			session: newSession("e2e-download", config.FallbackPool),
+			proxies: []*harness.Proxy{downloading},
+			check: func(ctx context.Context, e *env) error {
+				large := harness.NewTarget(strings.Repeat("0123456789abcdef", 4096))
+				defer large.Close()
+				before := goleak.IgnoreCurrent()
+				streamCtx, cancel := context.WithCancel(ctx)
+				defer cancel()
+				stream := &cancelStream{ctx: streamCtx, cancel: cancel}
+				err := e.srv.Service().Download(&pb.DownloadRequest{
+					Request:   &pb.Request{Url: large.URL, Session: "e2e-download", Proxy: true},
+					RangeSize: 1024,
+					Parallel:  4,
+				}, stream)
+				if err == nil {
+					return fmt.Errorf("la descarga debía cancelarse")
+				}
+				if stream.chunks != 1 {
+					return fmt.Errorf("se enviaron %d trozos tras cancelar", stream.chunks)
+				}
+				return expectNoLeaks(before)
+			},
+		},
+		{
+			name:    "la plantilla del proveedor mantiene el id por identidad",
+			session: provider,
+			proxies: []*harness.Proxy{rotating},
+			check: func(ctx context.Context, e *env) error {
+				used := make(map[string]string)
+				for _, identity := range []string{"a", "b", "a"} {
+					resp, err := e.srv.Fetch(ctx, &pb.Request{Url: e.target.URL, Session: "e2e-provider", Proxy: true, Identity: identity})
+					if err != nil {
+						return err
+					}
+					if strings.Contains(resp.Proxy, "{id}") {
+						return fmt.Errorf("plantilla sin expandir: %s", resp.Proxy)
+					}
+					if previous, ok := used[identity]; ok && previous != resp.Proxy {
+						return fmt.Errorf("la identidad %s cambió de id: %s y %s", identity, previous, resp.Proxy)
+					}
+					used[identity] = resp.Proxy
+				}
+				if used["a"] == used["b"] {
+					return fmt.Errorf("dos identidades comparten el id %s", used["a"])
+				}
+				return nil
+			},
+		},
+		{
+			name:    "una URL caliente se sirve desde la caché sin contactar con el destino",
+			session: warm,
+			proxies: []*harness.Proxy{warming},
+			check: func(ctx context.Context, e *env) error {
+				service := e.srv.Service()
+				if _, err := service.RegisterWarmup(ctx, &pb.WarmupRequest{Session: "e2e-warmup", Urls: []string{e.target.URL}, IntervalMs: 60000}); err != nil {
+					return err
+				}
+				defer service.RegisterWarmup(ctx, &pb.WarmupRequest{Session: "e2e-warmup"})
+
+				// El primer refresco se lanza al registrar la URL
+				if err := waitCached(ctx, e, "e2e-warmup"); err != nil {
+					return err
+				}
+
+				hits := warming.Hits()
+				resp, err := e.fetch(ctx, "e2e-warmup")
+				if err != nil {
+					return err
+				}
+				if !resp.FromCache || string(resp.Content) != e.target.Body {
+					return fmt.Errorf("la respuesta no salió de la caché (from_cache %v)", resp.FromCache)
+				}
+				if warming.Hits() != hits {
+					return fmt.Errorf("la petición llegó al destino")
+				}
+				return nil
+			},
+		},
+		{
+			name:    "bypass ignora la caché e InvalidateCache la vacía y refresca la URL caliente",
+			session: invalidated,
+			proxies: []*harness.Proxy{purging},
+			check: func(ctx context.Context, e *env) error {
+				service := e.srv.Service()
+				if _, err := service.RegisterWarmup(ctx, &pb.WarmupRequest{Session: "e2e-invalidate", Urls: []string{e.target.URL}, IntervalMs: 60000}); err != nil {
+					return err
+				}
+				defer service.RegisterWarmup(ctx, &pb.WarmupRequest{Session: "e2e-invalidate"})
+				if err := waitCached(ctx, e, "e2e-invalidate"); err != nil {
+					return err
+				}
+
+				hits := purging.Hits()
+				resp, err := e.srv.Fetch(ctx, &pb.Request{Url: e.target.URL, Session: "e2e-invalidate", Proxy: true, CacheControl: &pb.CacheControl{Bypass: true}})
+				if err != nil {
+					return err
+				}
+				if resp.FromCache || purging.Hits() == hits {
+					return fmt.Errorf("la petición con bypass no llegó al destino")
+				}
+
+				invalidation, err := service.InvalidateCache(ctx, &pb.InvalidateCacheRequest{UrlPattern: e.target.URL + "*", Session: "e2e-invalidate"})
+				if err != nil {
+					return err
+				}
+				if invalidation.Removed != 1 || invalidation.Warmed != 1 {
+					return fmt.Errorf("invalidación inesperada: %d respuestas, %d URL calientes", invalidation.Removed, invalidation.Warmed)
+				}
+				// El refresco adelantado vuelve a guardar la respuesta
+				return waitCached(ctx, e, "e2e-invalidate")
+			},
+		},
+		{
+			name:    "sin proxies que respondan se usa la etapa directa",
+			session: newSession("e2e-fallback", config.FallbackPool, config.FallbackDirect),
+			proxies: []*harness.Proxy{dead},
+			check: func(ctx context.Context, e *env) error {
+				resp, err := e.fetch(ctx, "e2e-fallback")
+				if err != nil {
+					return err
+				}
+				if resp.FallbackStage != config.FallbackDirect {
+					return fmt.Errorf("etapa %q, se esperaba %q", resp.FallbackStage, config.FallbackDirect)
+				}
+				return nil
+			},
+		},
+		{
+			name:    "un proxy caído queda apartado durante el cooldown",
+			session: eviction,
+			proxies: []*harness.Proxy{evicted},
+			check: func(ctx context.Context, e *env) error {
+				if _, err := e.fetch(ctx, "e2e-eviction"); err != nil {
+					return err
+				}
+				if available := e.pool.Available("e2e-eviction", []string{evicted.URL}); len(available) != 0 {
+					return fmt.Errorf("el proxy sigue disponible: %v", available)
+				}
+				return nil
+			},
+		},
+		{
+			name:    "un veredicto poison retira el proxy del pool",
+			session: poison,
+			proxies: []*harness.Proxy{banning},
+			check: func(ctx context.Context, e *env) error {
+				resp, err := e.fetch(ctx, "e2e-poison")
+				if err != nil {
+					return err
+				}
+				if resp.Status != 200 {
+					return fmt.Errorf("status %d", resp.Status)
+				}
+				if _, ok := e.pool.Lookup("e2e-poison", banning.URL); ok {
+					return fmt.Errorf("el proxy sigue en el pool")
+				}
+				return nil
+			},
+		},
+		{
+			name:    "una página inyectada en lugar del tipo esperado se reintenta",
+			session: typed,
+			proxies: []*harness.Proxy{injecting, clean},
+			check: func(ctx context.Context, e *env) error {
+				// El proxy que inyecta es el primero en probarse
+				e.pool.RecordResult("e2e-content-type", injecting.URL, true)
+				resp, err := e.fetch(ctx, "e2e-content-type")
+				if err != nil {
+					return err
+				}
+				if injecting.Hits() == 0 {
+					return fmt.Errorf("el proxy que inyecta no llegó a probarse")
+				}
+				return expectProxy(resp, clean)
+			},
+		},
+		{
+			name:    "un proxy que altera el HTML se retira tras compararlo con otro proxy",
+			session: integrity,
+			proxies: []*harness.Proxy{tampering, referee},
+			check: func(ctx context.Context, e *env) error {
+				// El proxy que altera el HTML es el primero en probarse
+				e.pool.RecordResult("e2e-integrity", tampering.URL, true)
+				if _, err := e.fetch(ctx, "e2e-integrity"); err != nil {
+					return err
+				}
+				// La comprobación se hace en segundo plano
+				for {
+					if _, ok := e.pool.Lookup("e2e-integrity", tampering.URL); !ok {
+						if referee.Hits() == 0 {
+							return fmt.Errorf("la referencia no se pidió a través del otro proxy")
+						}
+						return nil
+					}
+					select {
+					case <-ctx.Done():
+						return fmt.Errorf("el proxy sigue en el pool")
+					case <-time.After(10 * time.Millisecond):
+					}
+				}
+			},
+		},
+		{
+			name:    "las peticiones directas usan la dirección fijada para el host",
+			session: overridden,
+			proxies: []*harness.Proxy{unused},
+			check: func(ctx context.Context, e *env) error {
+				u, err := url.Parse(e.target.URL)
+				if err != nil {
+					return err
+				}
+				u.Host = "target.e2e.invalid:" + u.Port()
+				hits := e.target.Hits()
+				resp, err := e.srv.Fetch(ctx, &pb.Request{Url: u.String(), Session: "e2e-hosts", UserAgent: "proxy-api-e2e"})
+				if err != nil {
+					return err
+				}
+				if string(resp.Content) != e.target.Body || e.target.Hits() != hits+1 {
+					return fmt.Errorf("el destino no recibió la petición")
+				}
+				return nil
+			},
+		},
+		{
+			name:    "un CAPTCHA aparta el proxy del host y se reintenta con otro",
+			session: newSession("e2e-captcha", config.FallbackPool),
+			proxies: []*harness.Proxy{challenged, solvable},
+			check: func(ctx context.Context, e *env) error {
+				// El proxy que recibe el desafío es el primero en probarse
+				e.pool.RecordResult("e2e-captcha", challenged.URL, true)
+				e.pool.RecordResult("e2e-captcha", challenged.URL, true)
+				for i := 0; i < 2; i++ {
+					resp, err := e.fetch(ctx, "e2e-captcha")
+					if err != nil {
+						return err
+					}
+					if err := expectProxy(resp, solvable); err != nil {
+						return err
+					}
+				}
+				if hits := challenged.Hits(); hits != 1 {
+					return fmt.Errorf("el proxy con CAPTCHA recibió %d peticiones, se esperaba 1", hits)
+				}
+				return nil
+			},
+		},
+		{
+			name:    "si todos los proxies reciben un CAPTCHA el error es CAPTCHA_REQUIRED",
+			session: newSession("e2e-captcha-required", config.FallbackPool),
+			proxies: []*harness.Proxy{blocked},
+			check: func(ctx context.Context, e *env) error {
+				_, err := e.fetch(ctx, "e2e-captcha-required")
+				if err == nil {
+					return fmt.Errorf("la petición no falló")
+				}
+				for _, detail := range status.Convert(err).Details() {
+					if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == "CAPTCHA_REQUIRED" && info.Metadata["provider"] == "cloudflare" {
+						return nil
+					}
+				}
+				return fmt.Errorf("error sin el motivo CAPTCHA_REQUIRED: %v", err)
+			},
+		},
+		{
+			name:    "un CAPTCHA resuelto se reenvía con el token y devuelve el contenido",
+			session: solving,
+			proxies: []*harness.Proxy{gated},
+			check: func(ctx context.Context, e *env) error {
+				resp, err := e.fetch(ctx, "e2e-captcha-solve")
+				if err != nil {
+					return err
+				}
+				if string(resp.Content) != e.target.Body {
+					return fmt.Errorf("contenido %q", resp.Content)
+				}
+				return expectProxy(resp, gated)
+			},
+		},
+		{
+			name:    "las cookies de paso de Cloudflare se obtienen una vez y se reutilizan",
+			session: cleared,
+			proxies: []*harness.Proxy{guarded},
+			check: func(ctx context.Context, e *env) error {
+				for i := 0; i < 3; i++ {
+					resp, err := e.fetch(ctx, "e2e-clearance")
+					if err != nil {
+						return err
+					}
+					if err := expectProxy(resp, guarded); err != nil {
+						return err
+					}
+				}
+				if hits := e.browser.Hits(); hits != 1 {
+					return fmt.Errorf("el navegador recibió %d peticiones, se esperaba 1", hits)
+				}
+				if hits := guarded.Hits(); hits != 4 {
+					return fmt.Errorf("el proxy recibió %d peticiones, se esperaban 4", hits)
+				}
+				return nil
+			},
+		},
+		{
+			name:    "un rango se reenvía al destino a través del pool",
+			session: newSession("e2e-range", config.FallbackPool),
+			proxies: []*harness.Proxy{ranged},
+			check: func(ctx context.Context, e *env) error {
+				resp, err := e.srv.Fetch(ctx, &pb.Request{
+					Url:       e.target.URL,
+					Session:   "e2e-range",
+					Proxy:     true,
+					UserAgent: "proxy-api-e2e",
+					Range:     "bytes=1-2",
+				})
+				if err != nil {
+					return err
+				}
+				if resp.Status != 206 || string(resp.Content) != e.target.Body[1:3] {
+					return fmt.Errorf("status %d con contenido %q", resp.Status, resp.Content)
+				}
+				if want := fmt.Sprintf("bytes 1-2/%d", len(e.target.Body)); resp.ContentRange != want {
+					return fmt.Errorf("content range %q, se esperaba %q", resp.ContentRange, want)
+				}
+				return expectProxy(resp, ranged)
+			},
+		},
+		{
+			name:    "un proxy intermitente vuelve a usarse tras un fallo",
+			session: newSession("e2e-flaky", config.FallbackPool),
+			proxies: []*harness.Proxy{flaky},
+			check: func(ctx context.Context, e *env) error {
+				if _, err := e.fetch(ctx, "e2e-flaky"); err == nil {
+					return fmt.Errorf("el primer intento debía fallar")
+				}
+				resp, err := e.fetch(ctx, "e2e-flaky")
+				if err != nil {
+					return err
+				}
+				return expectProxy(resp, flaky)
+			},
+		},
+	}
+}
+
+// fakeSolver resuelve los reCAPTCHA de los proxies Solvable
+type fakeSolver struct{}
+
+func (fakeSolver) Solve(ctx context.Context, challenge captcha.Challenge) (*captcha.Solution, error) {
+	if challenge.Kind != captcha.KindRecaptcha || challenge.SiteKey != harness.SiteKey {
+		return nil, fmt.Errorf("desafío inesperado: %+v", challenge)
+	}
+	return &captcha.Solution{Token: harness.SolvedToken}, nil
+}
+
+// waitCached espera a que la respuesta del destino esté en la caché de la sesión; lo
+// consulta con dry_run para no contactar con el destino
+func waitCached(ctx context.Context, e *env, session string) error {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := e.srv.Fetch(ctx, &pb.Request{Url: e.target.URL, Session: session, Proxy: true, DryRun: true})
+		if err != nil {
+			return err
+		}
+		if resp.Plan.CacheHit {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("la URL caliente no se refrescó")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectNoLeaks comprueba con goleak que terminaron las goroutines creadas desde before;
+// las conexiones inactivas de los transportes y de los servidores de prueba siguen
+// abiertas a propósito
+func expectNoLeaks(before goleak.Option) error {
+	return goleak.Find(before,
+		goleak.IgnoreAnyFunction("net/http.(*persistConn).readLoop"),
+		goleak.IgnoreAnyFunction("net/http.(*persistConn).writeLoop"),
+		goleak.IgnoreAnyFunction("net/http.(*conn).serve"),
+	)
+}
+
+// cancelStream es un stream de Download que cancela la llamada al recibir el primer trozo
+type cancelStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	chunks int
+}
+
+func (s *cancelStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *cancelStream) Send(*pb.DownloadChunk) error {
+	s.chunks++
+	s.cancel()
+	return nil
+}
+
+// expectProxy comprueba que la respuesta llegó a través del proxy indicado
+func expectProxy(resp *pb.Response, p *harness.Proxy) error {
+	if resp.Proxy != p.URL {
+		return fmt.Errorf("respuesta vía %q, se esperaba %q", resp.Proxy, p.URL)
+	}
+	return nil
+}
+
+// TestEndToEnd arranca un único motor con las sesiones de todos los escenarios y
+// ejecuta cada uno como un subtest
+func TestEndToEnd(t *testing.T) {
+	target := harness.NewTarget("e2e")
+	defer target.Close()
+	browser := harness.NewBrowser()
+	defer browser.Close()
+	config.BrowserEndpoint = browser.URL
+	// El destino y los proxies de prueba escuchan en loopback
+	config.BlockPrivateTargets = false
+
+	cases := scenarios()
+	cfg := proxyserver.Config{
+		Pool:          proxyserver.NewMemoryPool(),
+		Proxies:       make(map[string][]string),
+		CaptchaSolver: fakeSolver{},
+	}
+	for _, c := range cases {
+		c.session.URL = target.URL
+		cfg.Sessions = append(cfg.Sessions, c.session)
+		for _, p := range c.proxies {
+			cfg.Proxies[c.session.Name] = append(cfg.Proxies[c.session.Name], p.URL)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := proxyserver.New(cfg)
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx) }()
+	for !srv.Ready() {
+		select {
+		case err := <-runErr:
+			t.Fatalf("el motor no arrancó: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	e := &env{srv: srv, pool: cfg.Pool, target: target, browser: browser}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				for _, p := range c.proxies {
+					p.Close()
+				}
+			}()
+			caseCtx, caseCancel := context.WithTimeout(ctx, 10*time.Second)
+			defer caseCancel()
+			if err := c.check(caseCtx, e); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Package harness levanta en el propio proceso destinos HTTP y proxies falsos con
+// distintos comportamientos para probar de extremo a extremo la selección del pool,
+// la retirada de proxies, los intentos escalonados y la cadena de fallback.
+package harness
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Behavior es el comportamiento de un proxy falso
+type Behavior string
+
+// Comportamientos de los proxies falsos
+const (
+	Healthy  Behavior = "healthy"  // Reenvía la petición al destino
+	Slow     Behavior = "slow"     // Reenvía la petición tras un retardo
+	Flaky    Behavior = "flaky"    // Corta la conexión en las peticiones impares
+	Banning  Behavior = "banning"  // Responde 403 sin contactar con el destino
+	Dead     Behavior = "dead"     // No acepta conexiones
+	Inject   Behavior = "inject"   // Responde 200 con una página HTML de anuncios
+	Captcha  Behavior = "captcha"  // Responde 403 con un desafío de Cloudflare
+	Solvable Behavior = "solvable" // Responde 403 con un reCAPTCHA salvo que la petición traiga SolvedToken
+	Guarded  Behavior = "guarded"  // Responde con el desafío de Cloudflare salvo que la petición traiga ClearanceValue
+)
+
+// SolvedToken es el token que deja pasar las peticiones de los proxies Solvable
+const SolvedToken = "harness-solved-token"
+
+// SiteKey es la clave del reCAPTCHA de los proxies Solvable
+const SiteKey = "harness-site-key-0123456789"
+
+// ClearanceValue es la cookie cf_clearance que entrega Browser y aceptan los proxies Guarded
+const ClearanceValue = "harness-clearance"
+
+// Target es un destino HTTP que cuenta las peticiones recibidas
+type Target struct {
+	URL  string
+	Body string
+	hits atomic.Int64
+	srv  *httptest.Server
+}
+
+// NewTarget arranca un destino que responde 200 con body, o 206 si se pide un rango
+func NewTarget(body string) *Target {
+	t := &Target{Body: body}
+	t.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.hits.Add(1)
+		w.Header().Set("Content-Type", "text/plain")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+	}))
+	t.URL = t.srv.URL
+	return t
+}
+
+// Hits devuelve las peticiones recibidas
+func (t *Target) Hits() int64 {
+	return t.hits.Load()
+}
+
+// Close detiene el destino
+func (t *Target) Close() {
+	t.srv.Close()
+}
+
+// Proxy es un proxy HTTP falso
+type Proxy struct {
+	URL      string // http://host:puerto
+	Behavior Behavior
+	Delay    time.Duration // Retardo de los proxies Slow
+	hits     atomic.Int64
+	srv      *httptest.Server
+}
+
+// NewProxy arranca un proxy con el comportamiento indicado; delay solo se usa con Slow
+func NewProxy(behavior Behavior, delay time.Duration) *Proxy {
+	p := &Proxy{Behavior: behavior, Delay: delay}
+	if behavior == Dead {
+		// Un puerto que se acaba de liberar rechaza las conexiones
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			panic(fmt.Sprintf("harness: %v", err))
+		}
+		p.URL = "http://" + lis.Addr().String()
+		lis.Close()
+		return p
+	}
+
+	p.srv = httptest.NewServer(http.HandlerFunc(p.serve))
+	p.URL = p.srv.URL
+	return p
+}
+
+// serve atiende una petición en forma de proxy (URL absoluta) según el comportamiento
+func (p *Proxy) serve(w http.ResponseWriter, r *http.Request) {
+	hit := p.hits.Add(1)
+
+	switch p.Behavior {
+	case Banning:
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	case Inject:
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "<html><body><script src=\"http://ads.example/ad.js\"></script></body></html>")
+		return
+	case Guarded:
+		if cookie, err := r.Cookie("cf_clearance"); err == nil && cookie.Value == ClearanceValue {
+			break
+		}
+		fallthrough
+	case Captcha:
+		w.Header().Set("Cf-Mitigated", "challenge")
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<html><head><title>Just a moment...</title></head><body><script src=\"/cdn-cgi/challenge-platform/h/b/orchestrate/chl_page/v1\"></script></body></html>")
+		return
+	case Solvable:
+		if r.URL.Query().Get("g-recaptcha-response") != SolvedToken {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "<html><body><div class=\"g-recaptcha\" data-sitekey=\"%s\"></div></body></html>", SiteKey)
+			return
+		}
+	case Flaky:
+		if hit%2 == 1 {
+			if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		}
+	case Slow:
+		select {
+		case <-time.After(p.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Connection")
+	resp, err := http.DefaultTransport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// Hits devuelve las peticiones recibidas, incluidas las que fallaron a propósito
+func (p *Proxy) Hits() int64 {
+	return p.hits.Load()
+}
+
+// Close detiene el proxy
+func (p *Proxy) Close() {
+	if p.srv != nil {
+		p.srv.CloseClientConnections()
+		p.srv.Close()
+	}
+}
+
+// Browser es un servicio de renderizado falso que implementa el endpoint execute de
+// Splash devolviendo la cookie cf_clearance
+type Browser struct {
+	URL  string
+	hits atomic.Int64
+	srv  *httptest.Server
+}
+
+// NewBrowser arranca el servicio de renderizado
+func NewBrowser() *Browser {
+	b := &Browser{}
+	b.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.hits.Add(1)
+		if r.URL.Path != "/execute" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"cookies": [{"name": "cf_clearance", "value": %q}]}`, ClearanceValue)
+	}))
+	b.URL = b.srv.URL
+	return b
+}
+
+// Hits devuelve las peticiones recibidas
+func (b *Browser) Hits() int64 {
+	return b.hits.Load()
+}
+
+// Close detiene el servicio
+func (b *Browser) Close() {
+	b.srv.Close()
+}
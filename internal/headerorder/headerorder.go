@@ -0,0 +1,163 @@
+// Package headerorder reescribe las cabeceras de las peticiones HTTP/1.1 en el orden
+// configurado. net/http las escribe siempre ordenadas alfabéticamente, y los sistemas
+// anti-bot usan el orden como huella del cliente; Conn se coloca entre el transporte
+// y la conexión (ya descifrada) y reordena el bloque de cabeceras de cada petición.
+package headerorder
+
+import (
+	"bytes"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxHeaderBytes es el tamaño a partir del cual se deja de buscar el final del bloque
+const maxHeaderBytes = 64 << 10
+
+// Presets con el orden de cabeceras de los navegadores más comunes
+var Presets = map[string][]string{
+	"chrome": {
+		"Host", "Connection", "Content-Length", "Cache-Control", "sec-ch-ua", "sec-ch-ua-mobile",
+		"sec-ch-ua-platform", "Upgrade-Insecure-Requests", "User-Agent", "Accept", "Origin",
+		"Content-Type", "Sec-Fetch-Site", "Sec-Fetch-Mode", "Sec-Fetch-User", "Sec-Fetch-Dest",
+		"Referer", "Accept-Encoding", "Accept-Language", "Cookie", "Range", "If-None-Match",
+		"If-Modified-Since",
+	},
+	"firefox": {
+		"Host", "User-Agent", "Accept", "Accept-Language", "Accept-Encoding", "Content-Type",
+		"Content-Length", "Origin", "Connection", "Referer", "Cookie", "Upgrade-Insecure-Requests",
+		"Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site", "Sec-Fetch-User", "If-Modified-Since",
+		"If-None-Match", "Range", "Priority", "TE",
+	},
+}
+
+// Resolve expande un preset ("chrome", "firefox") o devuelve la lista tal cual
+func Resolve(order []string) []string {
+	if len(order) == 1 {
+		if preset, ok := Presets[strings.ToLower(order[0])]; ok {
+			return preset
+		}
+	}
+	return order
+}
+
+// Conn reordena las cabeceras de las peticiones que se escriben en la conexión. Las
+// cabeceras de la lista van primero, en su orden y con la grafía configurada; el
+// resto las sigue en el orden en que las escribió net/http.
+type Conn struct {
+	net.Conn
+	order map[string]int
+	names []string
+
+	pending     []byte // Bloque de cabeceras incompleto
+	body        int64  // Bytes del cuerpo de la petición en curso que faltan por pasar
+	passthrough bool   // Cuerpo sin longitud conocida: el resto se escribe sin tocar
+}
+
+// Wrap envuelve conn para que las peticiones salgan con las cabeceras en order
+func Wrap(conn net.Conn, order []string) *Conn {
+	c := &Conn{Conn: conn, order: make(map[string]int, len(order)), names: order}
+	for i, name := range order {
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		if _, ok := c.order[key]; !ok {
+			c.order[key] = i
+		}
+	}
+	return c
+}
+
+// Write separa cada petición en bloque de cabeceras y cuerpo y reescribe el primero
+func (c *Conn) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		if c.passthrough {
+			if _, err := c.Conn.Write(p); err != nil {
+				return 0, err
+			}
+			break
+		}
+		if c.body > 0 {
+			n := int(min(int64(len(p)), c.body))
+			if _, err := c.Conn.Write(p[:n]); err != nil {
+				return 0, err
+			}
+			c.body -= int64(n)
+			p = p[n:]
+			continue
+		}
+
+		c.pending = append(c.pending, p...)
+		p = nil
+		end := bytes.Index(c.pending, []byte("\r\n\r\n"))
+		if end < 0 {
+			if len(c.pending) <= maxHeaderBytes {
+				break
+			}
+			// No parece HTTP/1.1: se deja de intervenir en la conexión
+			c.passthrough = true
+			p, c.pending = c.pending, nil
+			continue
+		}
+
+		head, rest := c.pending[:end+4], c.pending[end+4:]
+		reordered, body, known := c.reorder(head)
+		if _, err := c.Conn.Write(reordered); err != nil {
+			return 0, err
+		}
+		c.body, c.passthrough = body, !known
+		p, c.pending = rest, nil
+	}
+	return total, nil
+}
+
+// reorder reescribe el bloque de cabeceras y devuelve la longitud del cuerpo, o
+// known = false si el cuerpo va por trozos o no se puede determinar
+func (c *Conn) reorder(head []byte) (out []byte, body int64, known bool) {
+	lines := strings.Split(strings.TrimSuffix(string(head), "\r\n\r\n"), "\r\n")
+	type field struct {
+		line string
+		rank int
+	}
+	known = true
+	fields := make([]field, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return head, 0, false
+		}
+		key := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		switch key {
+		case "Content-Length":
+			n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return head, 0, false
+			}
+			body = n
+		case "Transfer-Encoding":
+			known = false
+		}
+
+		rank, ok := c.order[key]
+		if !ok {
+			rank = len(c.names)
+		} else {
+			line = c.names[rank] + ":" + value
+		}
+		fields = append(fields, field{line: line, rank: rank})
+	}
+
+	// Ordenación estable: las cabeceras sin posición conservan su orden relativo
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].rank < fields[j].rank })
+
+	var buf bytes.Buffer
+	buf.WriteString(lines[0])
+	buf.WriteString("\r\n")
+	for _, f := range fields {
+		buf.WriteString(f.line)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes(), body, known
+}
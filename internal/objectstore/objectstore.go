@@ -0,0 +1,193 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"proxy-api/internal/outbound"
+)
+
+// Drivers soportados
+const (
+	DriverS3  = "s3"  // Amazon S3 o un servicio compatible como MinIO
+	DriverGCS = "gcs" // Google Cloud Storage por su API compatible con S3, con claves HMAC
+)
+
+// Store guarda objetos en un bucket
+type Store interface {
+	// Put sube los size bytes de body con la clave key; headers se añaden a la petición
+	// (Content-Type, Content-Encoding, x-amz-meta-*). body se lee dos veces, una para
+	// firmar su hash y otra al enviarlo, así que un fichero se sube sin cargarlo en memoria.
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64, headers map[string]string) error
+	// URL devuelve la dirección del objeto: s3://bucket/clave o gs://bucket/clave
+	URL(key string) string
+}
+
+// Config describe la conexión con el bucket
+type Config struct {
+	Driver    string
+	Endpoint  string // Vacío usa el del proveedor; uno propio (MinIO) usa direcciones bucket en la ruta
+	Region    string // Vacía usa us-east-1 en S3 y auto en GCS
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// Open prepara el cliente del bucket configurado
+func Open(cfg Config) (Store, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("object store requires a bucket")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("object store requires access and secret keys")
+	}
+	store := &s3Store{cfg: cfg, client: &http.Client{Transport: outbound.Transport(nil), Timeout: 2 * time.Minute}}
+	switch cfg.Driver {
+	case DriverS3:
+		store.scheme = "s3"
+		if cfg.Region == "" {
+			cfg.Region = "us-east-1"
+			store.cfg.Region = cfg.Region
+		}
+		if cfg.Endpoint == "" {
+			// Direcciones virtual-hosted, las únicas que admiten los buckets nuevos de AWS
+			store.base = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", cfg.Bucket, cfg.Region)
+		}
+	case DriverGCS:
+		store.scheme = "gs"
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = "https://storage.googleapis.com"
+		}
+		if cfg.Region == "" {
+			store.cfg.Region = "auto"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported object store driver '%s'", cfg.Driver)
+	}
+	if store.base == "" {
+		endpoint, err := url.Parse(cfg.Endpoint)
+		if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+			return nil, fmt.Errorf("invalid object store endpoint '%s'", cfg.Endpoint)
+		}
+		store.base = strings.TrimRight(cfg.Endpoint, "/") + "/" + cfg.Bucket
+	}
+	return store, nil
+}
+
+// s3Store sube objetos con la API REST de S3 firmada con AWS Signature V4
+type s3Store struct {
+	cfg    Config
+	base   string // URL del bucket
+	scheme string
+	client *http.Client
+}
+
+func (s *s3Store) URL(key string) string {
+	return s.scheme + "://" + s.cfg.Bucket + "/" + key
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, headers map[string]string) error {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// NopCloser deja el cierre de body a quien lo abrió
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.base+"/"+escapePath(key), io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	signV4(req, hex.EncodeToString(hash.Sum(nil)), s.cfg.Region, s.cfg.AccessKey, s.cfg.SecretKey, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("put %s failed with status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// signV4 añade a req las cabeceras x-amz-date, x-amz-content-sha256 y Authorization de
+// AWS Signature V4 para el servicio s3. Se firman el host y todas las cabeceras de req.
+func signV4(req *http.Request, payloadHash, region, accessKey, secretKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	values := map[string]string{"host": req.URL.Host}
+	for name, v := range req.Header {
+		values[strings.ToLower(name)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath codifica la clave como la espera S3: todo salvo los caracteres no
+// reservados y las barras
+func escapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package outbound
+
+import (
+	"crypto/tls"
+	"net"
+	"sync/atomic"
+)
+
+// CountedConn cuenta los bytes leídos y escritos en una conexión saliente, antes del
+// cifrado TLS con el destino: son los que se facturan al proxy o al proveedor
+type CountedConn struct {
+	net.Conn
+	read    atomic.Int64
+	written atomic.Int64
+	release func() // Libera el hueco de ConnectionLimit
+}
+
+func (c *CountedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+func (c *CountedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+func (c *CountedConn) Close() error {
+	err := c.Conn.Close()
+	if c.release != nil {
+		c.release()
+	}
+	return err
+}
+
+// CloseWrite cierra el sentido de escritura si la conexión lo admite, o la cierra entera
+func (c *CountedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// Bytes devuelve los bytes leídos y escritos hasta ahora
+func (c *CountedConn) Bytes() (read, written int64) {
+	return c.read.Load(), c.written.Load()
+}
+
+// countedPacketConn libera el hueco de ConnectionLimit de un socket UDP al cerrarlo.
+// Conserva los métodos de *net.UDPConn, con los que quic-go usa ECN y GSO.
+type countedPacketConn struct {
+	*net.UDPConn
+	release func()
+}
+
+func (c *countedPacketConn) Close() error {
+	err := c.UDPConn.Close()
+	c.release()
+	return err
+}
+
+// Counted devuelve la conexión contada de conn, atravesando las capas TLS y de
+// túnel que la envuelven
+func Counted(conn net.Conn) (*CountedConn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *CountedConn:
+			return c, true
+		case *tls.Conn:
+			conn = c.NetConn()
+		case *bufferedConn:
+			conn = c.Conn
+		default:
+			return nil, false
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package outbound
+
+// fileLimit devuelve 0: Windows no limita los sockets por proceso con un número fijo de
+// descriptores, y en el resto de plataformas no se conoce
+func fileLimit() uint64 {
+	return 0
+}
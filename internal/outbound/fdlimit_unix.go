@@ -0,0 +1,15 @@
+//go:build unix
+
+package outbound
+
+import "syscall"
+
+// fileLimit devuelve el límite de descriptores abiertos del proceso (RLIMIT_NOFILE). El
+// runtime de Go ya sube el límite blando hasta el duro al arrancar; 0 si no se conoce.
+func fileLimit() uint64 {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0
+	}
+	return uint64(limit.Cur)
+}
@@ -0,0 +1,118 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"proxy-api/internal/config"
+)
+
+// Descriptores que se dejan libres para el servidor gRPC, sus clientes, la base de datos
+// y los ficheros; como mínimo un cuarto del límite
+const reservedFiles = 64
+
+// Tiempo que una conexión espera a que quede un hueco libre después de cerrar las
+// conexiones inactivas, antes de fallar con ErrNoConnections
+const connWait = time.Second
+
+// ErrNoConnections indica que todas las conexiones salientes permitidas están en uso
+var ErrNoConnections = errors.New("no outbound connection slot available")
+
+var (
+	connSlots     chan struct{} // nil sin límite
+	connLimit     int
+	connSlotsOnce sync.Once
+
+	// Transportes creados con Transport; sus conexiones inactivas se cierran cuando no
+	// quedan huecos
+	transports   = make(map[*http.Transport]struct{})
+	transportsMu sync.Mutex
+)
+
+// ConnectionLimit devuelve el máximo de conexiones salientes abiertas a la vez: el de
+// MAX_CONNECTIONS, rebajado si no cabe en el límite de descriptores del proceso. 0 no limita.
+func ConnectionLimit() int {
+	connSlotsOnce.Do(func() {
+		connLimit = config.MaxConnections
+		if files := fileLimit(); files > 0 {
+			reserved := files / 4
+			if reserved < reservedFiles {
+				reserved = reservedFiles
+			}
+			available := 1
+			if files > reserved {
+				available = int(files - reserved)
+			}
+			if connLimit <= 0 || connLimit > available {
+				if connLimit > available {
+					log.Printf("Aviso: MAX_CONNECTIONS=%d no cabe en el límite de %d descriptores, se usa %d", connLimit, files, available)
+				}
+				connLimit = available
+			}
+			log.Printf("Límite de descriptores: %d, conexiones salientes simultáneas: %d", files, connLimit)
+		}
+		if connLimit > 0 {
+			connSlots = make(chan struct{}, connLimit)
+		}
+	})
+	return connLimit
+}
+
+// ConnectionsInUse devuelve las conexiones salientes abiertas que ocupan el límite
+func ConnectionsInUse() int {
+	ConnectionLimit()
+	return len(connSlots)
+}
+
+// Discard cierra las conexiones inactivas de un transporte que ya no se usará y lo
+// retira de los que se recorren al buscar huecos libres
+func Discard(transport *http.Transport) {
+	transportsMu.Lock()
+	delete(transports, transport)
+	transportsMu.Unlock()
+	transport.CloseIdleConnections()
+}
+
+// closeIdleConnections cierra las conexiones inactivas de todos los transportes, que
+// liberan su hueco al cerrarse
+func closeIdleConnections() {
+	transportsMu.Lock()
+	idle := make([]*http.Transport, 0, len(transports))
+	for transport := range transports {
+		idle = append(idle, transport)
+	}
+	transportsMu.Unlock()
+	for _, transport := range idle {
+		transport.CloseIdleConnections()
+	}
+}
+
+// acquireConn reserva un hueco para otra conexión saliente. Si no queda ninguno, cierra
+// las conexiones inactivas y espera como mucho connWait a que se libere alguno; después
+// falla con ErrNoConnections, o con el error de ctx si se cancela antes.
+func acquireConn(ctx context.Context) (release func(), err error) {
+	ConnectionLimit()
+	if connSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case connSlots <- struct{}{}:
+	default:
+		closeIdleConnections()
+		timer := time.NewTimer(connWait)
+		defer timer.Stop()
+		select {
+		case connSlots <- struct{}{}:
+		case <-timer.C:
+			return nil, ErrNoConnections
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-connSlots }) }, nil
+}
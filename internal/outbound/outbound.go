@@ -0,0 +1,143 @@
+// Package outbound centraliza las conexiones salientes del servidor para que todas
+// (fuentes, validación y peticiones) salgan por la misma IP de origen y, si está
+// configurado, encadenadas a través del proxy corporativo.
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"proxy-api/internal/config"
+)
+
+var (
+	dialer     *net.Dialer
+	dialerOnce sync.Once
+)
+
+// LocalAddr resuelve la IP de origen configurada: OUTBOUND_ADDRESS o, si no, la
+// primera dirección de OUTBOUND_INTERFACE. Devuelve nil si no hay ninguna.
+func LocalAddr() (net.IP, error) {
+	if config.OutboundAddress != "" {
+		ip := net.ParseIP(config.OutboundAddress)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid outbound address '%s'", config.OutboundAddress)
+		}
+		return ip, nil
+	}
+	if config.OutboundInterface == "" {
+		return nil, nil
+	}
+
+	iface, err := net.InterfaceByName(config.OutboundInterface)
+	if err != nil {
+		return nil, fmt.Errorf("outbound interface '%s': %w", config.OutboundInterface, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("outbound interface '%s': %w", config.OutboundInterface, err)
+	}
+	// Se prefiere IPv4, que es la familia de la mayoría de proxies
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("outbound interface '%s' has no addresses", config.OutboundInterface)
+	}
+	return fallback, nil
+}
+
+// Dialer devuelve el dialer compartido, ligado a la IP de origen si está configurada
+func Dialer() *net.Dialer {
+	dialerOnce.Do(func() {
+		dialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		ip, err := LocalAddr()
+		if err != nil {
+			log.Printf("Error al resolver la IP de salida, se usa la del sistema: %v", err)
+			return
+		}
+		if ip != nil {
+			dialer.LocalAddr = &net.TCPAddr{IP: ip}
+			log.Printf("Conexiones salientes desde %s", ip)
+		}
+	})
+	return dialer
+}
+
+// DialContext abre una conexión saliente desde la IP de origen configurada. Con
+// UPSTREAM_PROXY, la conexión es un túnel CONNECT a través del proxy corporativo. La
+// conexión es un CountedConn, para medir el tráfico de cada petición, y ocupa uno de
+// los huecos de ConnectionLimit hasta que se cierra; si no queda ninguno, se cierran
+// las conexiones inactivas y, si siguen ocupados todos, falla con ErrNoConnections.
+func DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	release, err := acquireConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	u := Upstream()
+	if u == nil || address == upstreamAddress(u) || bypassed(address) {
+		conn, err = Dialer().DialContext(ctx, network, address)
+	} else {
+		conn, err = dialUpstream(ctx, u, address)
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &CountedConn{Conn: conn, release: release}, nil
+}
+
+// ListenPacket abre el socket UDP de una conexión QUIC desde la IP de origen
+// configurada. Ocupa uno de los huecos de ConnectionLimit hasta que se cierra, igual
+// que las conexiones de DialContext. UPSTREAM_PROXY solo encadena TCP: el tráfico UDP
+// no puede pasar por él, así que quien lo use debe comprobar antes Upstream.
+func ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	release, err := acquireConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	laddr := &net.UDPAddr{}
+	if ip := Dialer().LocalAddr; ip != nil {
+		laddr.IP = ip.(*net.TCPAddr).IP
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &countedPacketConn{UDPConn: conn, release: release}, nil
+}
+
+// Transport crea un transporte HTTP que sale por proxyURL, o directo si es nil.
+// Con UPSTREAM_PROXY, las peticiones directas usan el proxy corporativo y las que
+// van por proxyURL llegan a él a través de un túnel. Las conexiones inactivas se cierran
+// a los 90s, como en http.DefaultTransport, para no retener descriptores, y antes si
+// se agotan los huecos de ConnectionLimit. El transporte que deja de usarse se pasa a
+// Discard.
+func Transport(proxyURL *url.URL) *http.Transport {
+	transport := &http.Transport{DialContext: DialContext, Proxy: upstreamFor, IdleConnTimeout: 90 * time.Second, MaxIdleConns: 100}
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	transportsMu.Lock()
+	transports[transport] = struct{}{}
+	transportsMu.Unlock()
+	return transport
+}
@@ -0,0 +1,73 @@
+package outbound
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+// DialFunc abre una conexión como net.Dialer.DialContext
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// DialVia abre una conexión con address a través del proxy u: un túnel CONNECT para
+// los proxies http y https y SOCKS5 para los socks5. La conexión con el proxy sale
+// por DialContext, de modo que respeta la IP de origen y UPSTREAM_PROXY. Con u nil
+// la conexión es directa.
+func DialVia(ctx context.Context, u *url.URL, address string) (net.Conn, error) {
+	return DialViaWith(ctx, DialContext, u, address)
+}
+
+// DialViaWith es DialVia conectando con el proxy, o con address si u es nil, mediante dial
+func DialViaWith(ctx context.Context, dial DialFunc, u *url.URL, address string) (net.Conn, error) {
+	if u == nil {
+		return dial(ctx, "tcp", address)
+	}
+
+	switch u.Scheme {
+	case "socks5":
+		var auth *xproxy.Auth
+		if u.User != nil {
+			password, _ := u.User.Password()
+			auth = &xproxy.Auth{User: u.User.Username(), Password: password}
+		}
+		proxyAddr := u.Host
+		if u.Port() == "" {
+			proxyAddr = net.JoinHostPort(u.Hostname(), "1080")
+		}
+		dialer, err := xproxy.SOCKS5("tcp", proxyAddr, auth, contextDialer(dial))
+		if err != nil {
+			return nil, err
+		}
+		return dialer.(xproxy.ContextDialer).DialContext(ctx, "tcp", address)
+	case "http", "https":
+		conn, err := dial(ctx, "tcp", upstreamAddress(u))
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "https" {
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			conn = tlsConn
+		}
+		return connectTunnel(ctx, conn, u, address)
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme '%s'", u.Scheme)
+}
+
+// contextDialer adapta una DialFunc a la interfaz de dialer de x/net/proxy
+type contextDialer DialFunc
+
+func (d contextDialer) Dial(network, address string) (net.Conn, error) {
+	return d(context.Background(), network, address)
+}
+
+func (d contextDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d(ctx, network, address)
+}
@@ -0,0 +1,160 @@
+package outbound
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-api/internal/config"
+)
+
+var (
+	upstream     *url.URL
+	upstreamOnce sync.Once
+)
+
+// Upstream devuelve el proxy corporativo por el que se encadena todo el tráfico, o nil
+func Upstream() *url.URL {
+	upstreamOnce.Do(func() {
+		if config.UpstreamProxy == "" {
+			return
+		}
+		u, err := url.Parse(config.UpstreamProxy)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Printf("UPSTREAM_PROXY inválido, se conecta sin él: %s", config.UpstreamProxy)
+			return
+		}
+		upstream = u
+		log.Printf("Tráfico saliente encadenado a través de %s", u.Redacted())
+	})
+	return upstream
+}
+
+// upstreamAddress devuelve el host:puerto del proxy corporativo
+func upstreamAddress(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// bypassed indica si address (host o host:puerto) está en UPSTREAM_PROXY_BYPASS.
+// Una entrada que empieza por "." cubre también los subdominios.
+func bypassed(address string) bool {
+	host := address
+	if h, _, err := net.SplitHostPort(address); err == nil {
+		host = h
+	}
+	for _, entry := range strings.Split(config.UpstreamProxyBypass, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if host == entry || (strings.HasPrefix(entry, ".") && (strings.HasSuffix(host, entry) || host == entry[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUpstream indica si address es el proxy corporativo
+func IsUpstream(address string) bool {
+	u := Upstream()
+	return u != nil && address == upstreamAddress(u)
+}
+
+// upstreamFor devuelve el proxy corporativo para una petición directa, nil si no aplica
+func upstreamFor(req *http.Request) (*url.URL, error) {
+	u := Upstream()
+	if u == nil || bypassed(req.URL.Host) {
+		return nil, nil
+	}
+	return u, nil
+}
+
+// dialUpstream abre un túnel CONNECT hacia address a través del proxy corporativo
+func dialUpstream(ctx context.Context, u *url.URL, address string) (net.Conn, error) {
+	conn, err := Dialer().DialContext(ctx, "tcp", upstreamAddress(u))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return connectTunnel(ctx, conn, u, address)
+}
+
+// connectTunnel pide al proxy HTTP u, ya conectado en conn, un túnel CONNECT hacia address
+func connectTunnel(ctx context.Context, conn net.Conn, u *url.URL, address string) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := connectReq.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, connectReq)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s rejected CONNECT to %s: %s", u.Redacted(), address, resp.Status)
+	}
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn conserva los bytes que el lector leyó de más tras la respuesta al CONNECT
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// CloseWrite cierra el sentido de escritura si la conexión lo admite, o la cierra entera
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
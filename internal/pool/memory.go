@@ -0,0 +1,263 @@
+package pool
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/proxy"
+)
+
+// strike es un fallo de un proxy con el peso de su categoría
+type strike struct {
+	at     time.Time
+	weight int
+}
+
+// Memory es el pool en memoria de una sola instancia
+type Memory struct {
+	proxies    map[string][]proxy.Proxy // No se modifica, solo se reemplaza
+	proxiesMtx sync.RWMutex
+
+	scores   map[string]map[string]*Score // sesión -> host:puerto -> puntuación
+	scoreMtx sync.Mutex
+
+	strikes     map[string]map[string][]strike  // sesión -> host:puerto -> fallos
+	quarantined map[string]map[string]time.Time // sesión -> host:puerto -> fin del cooldown
+	evictionMtx sync.Mutex
+}
+
+// NewMemory crea un pool en memoria vacío
+func NewMemory() *Memory {
+	return &Memory{
+		proxies:     make(map[string][]proxy.Proxy),
+		scores:      make(map[string]map[string]*Score),
+		strikes:     make(map[string]map[string][]strike),
+		quarantined: make(map[string]map[string]time.Time),
+	}
+}
+
+func (m *Memory) All() map[string][]proxy.Proxy {
+	m.proxiesMtx.RLock()
+	defer m.proxiesMtx.RUnlock()
+	return m.proxies
+}
+
+func (m *Memory) Proxies(session string) []proxy.Proxy {
+	return m.All()[session]
+}
+
+func (m *Memory) Lookup(session, proxyAddr string) (proxy.Proxy, bool) {
+	for _, p := range m.Proxies(session) {
+		if p.String() == proxyAddr {
+			return p, true
+		}
+	}
+	return proxy.Proxy{}, false
+}
+
+func (m *Memory) Count() int {
+	total := 0
+	for _, proxies := range m.All() {
+		total += len(proxies)
+	}
+	return total
+}
+
+func (m *Memory) Replace(proxies map[string][]proxy.Proxy) {
+	m.proxiesMtx.Lock()
+	m.proxies = proxies
+	m.proxiesMtx.Unlock()
+}
+
+// RemoveSession sustituye el pool por una copia sin la sesión
+func (m *Memory) RemoveSession(session string) {
+	m.proxiesMtx.Lock()
+	defer m.proxiesMtx.Unlock()
+
+	if _, ok := m.proxies[session]; !ok {
+		return
+	}
+	proxies := make(map[string][]proxy.Proxy, len(m.proxies))
+	for name, list := range m.proxies {
+		if name != session {
+			proxies[name] = list
+		}
+	}
+	m.proxies = proxies
+}
+
+// Remove sustituye el pool por una copia sin el proxy en la sesión
+func (m *Memory) Remove(session, proxyAddr string) bool {
+	m.proxiesMtx.Lock()
+	defer m.proxiesMtx.Unlock()
+
+	remaining := make([]proxy.Proxy, 0, len(m.proxies[session]))
+	for _, p := range m.proxies[session] {
+		if p.String() != proxyAddr {
+			remaining = append(remaining, p)
+		}
+	}
+	if len(remaining) == len(m.proxies[session]) {
+		return false
+	}
+
+	proxies := make(map[string][]proxy.Proxy, len(m.proxies))
+	for name, list := range m.proxies {
+		proxies[name] = list
+	}
+	proxies[session] = remaining
+	m.proxies = proxies
+	return true
+}
+
+// score devuelve la puntuación del proxy, creándola si no existe; requiere scoreMtx
+func (m *Memory) score(session, address string) *Score {
+	if m.scores[session] == nil {
+		m.scores[session] = make(map[string]*Score)
+	}
+	score, ok := m.scores[session][address]
+	if !ok {
+		score = &Score{}
+		m.scores[session][address] = score
+	}
+	return score
+}
+
+func (m *Memory) RecordResult(session, proxyAddr string, success bool) {
+	m.scoreMtx.Lock()
+	defer m.scoreMtx.Unlock()
+
+	score := m.score(session, Address(proxyAddr))
+	now := time.Now()
+	if success {
+		score.Successes++
+		score.LastSuccess = now
+		score.Hourly[now.Hour()].Successes++
+	} else {
+		score.Failures++
+		score.LastFailure = now
+		score.Hourly[now.Hour()].Failures++
+	}
+}
+
+func (m *Memory) Score(session, proxyAddr string) Score {
+	m.scoreMtx.Lock()
+	defer m.scoreMtx.Unlock()
+
+	if score, ok := m.scores[session][Address(proxyAddr)]; ok {
+		return *score
+	}
+	return Score{}
+}
+
+func (m *Memory) MergeScore(session, proxyAddr string, imported Score) {
+	m.scoreMtx.Lock()
+	defer m.scoreMtx.Unlock()
+
+	score := m.score(session, Address(proxyAddr))
+	score.Successes += imported.Successes
+	score.Failures += imported.Failures
+	for hour := range score.Hourly {
+		score.Hourly[hour].Successes += imported.Hourly[hour].Successes
+		score.Hourly[hour].Failures += imported.Hourly[hour].Failures
+	}
+	if imported.LastSuccess.After(score.LastSuccess) {
+		score.LastSuccess = imported.LastSuccess
+	}
+	if imported.LastFailure.After(score.LastFailure) {
+		score.LastFailure = imported.LastFailure
+	}
+}
+
+// Rank ordena por la tasa de éxito histórica en la hora actual; los proxies sin
+// historial quedan en un punto neutro (0.5) y los empatados mantienen su orden.
+func (m *Memory) Rank(session string, proxies []string) []string {
+	hour := time.Now().Hour()
+	rates := make(map[string]float64, len(proxies))
+	for _, proxyAddr := range proxies {
+		rates[proxyAddr] = m.Score(session, proxyAddr).HourRate(hour)
+	}
+	sort.SliceStable(proxies, func(i, j int) bool {
+		return rates[proxies[i]] > rates[proxies[j]]
+	})
+	return proxies
+}
+
+func (m *Memory) Strike(session, proxyAddr, category string, policy config.EvictionPolicy) bool {
+	weight := policy.ErrorWeight(category)
+	if weight == 0 {
+		return false
+	}
+	limit := policy.Strikes
+	if limit <= 0 {
+		limit = 1
+	}
+	address := Address(proxyAddr)
+	now := time.Now()
+
+	m.evictionMtx.Lock()
+	defer m.evictionMtx.Unlock()
+
+	if m.strikes[session] == nil {
+		m.strikes[session] = make(map[string][]strike)
+	}
+	recent := m.strikes[session][address][:0]
+	for _, st := range m.strikes[session][address] {
+		if policy.Window <= 0 || now.Sub(st.at) < time.Duration(policy.Window)*time.Millisecond {
+			recent = append(recent, st)
+		}
+	}
+	recent = append(recent, strike{at: now, weight: weight})
+
+	total := 0
+	for _, st := range recent {
+		total += st.weight
+	}
+	if total < limit {
+		m.strikes[session][address] = recent
+		return false
+	}
+
+	delete(m.strikes[session], address)
+	if policy.Cooldown > 0 {
+		if m.quarantined[session] == nil {
+			m.quarantined[session] = make(map[string]time.Time)
+		}
+		m.quarantined[session][address] = now.Add(time.Duration(policy.Cooldown) * time.Millisecond)
+	}
+	return true
+}
+
+func (m *Memory) Available(session string, proxies []string) []string {
+	m.evictionMtx.Lock()
+	defer m.evictionMtx.Unlock()
+
+	if len(m.quarantined[session]) == 0 {
+		return proxies
+	}
+	now := time.Now()
+	available := proxies[:0:0]
+	for _, proxyAddr := range proxies {
+		address := Address(proxyAddr)
+		until, ok := m.quarantined[session][address]
+		if ok && now.Before(until) {
+			continue
+		}
+		if ok {
+			delete(m.quarantined[session], address)
+			log.Printf("Proxy %s rehabilitado para %s tras el cooldown", address, session)
+		}
+		available = append(available, proxyAddr)
+	}
+	return available
+}
+
+func (m *Memory) Forget(session string) {
+	m.evictionMtx.Lock()
+	delete(m.strikes, session)
+	delete(m.quarantined, session)
+	m.evictionMtx.Unlock()
+}
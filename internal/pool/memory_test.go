@@ -0,0 +1,236 @@
+package pool
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/proxy"
+)
+
+// quarantine retira el proxy de la sesión con un cooldown largo
+func quarantine(m *Memory, session, proxyAddr string) {
+	m.Strike(session, proxyAddr, config.ErrorConnection, config.EvictionPolicy{Strikes: 1, Cooldown: 60000})
+}
+
+func TestMemoryAvailable(t *testing.T) {
+	proxies := []string{"http://1.1.1.1:80", "socks5://2.2.2.2:1080", "http://3.3.3.3:8080"}
+	cases := []struct {
+		name  string
+		setup func(m *Memory)
+		want  []string
+	}{
+		{
+			name:  "sin retirados",
+			setup: func(m *Memory) {},
+			want:  proxies,
+		},
+		{
+			name:  "en cooldown",
+			setup: func(m *Memory) { quarantine(m, "s", "http://1.1.1.1:80") },
+			want:  []string{"socks5://2.2.2.2:1080", "http://3.3.3.3:8080"},
+		},
+		{
+			name:  "retirado con otro esquema",
+			setup: func(m *Memory) { quarantine(m, "s", "http://2.2.2.2:1080") },
+			want:  []string{"http://1.1.1.1:80", "http://3.3.3.3:8080"},
+		},
+		{
+			name:  "retirado en otra sesión",
+			setup: func(m *Memory) { quarantine(m, "otra", "http://1.1.1.1:80") },
+			want:  proxies,
+		},
+		{
+			name: "sin cooldown no se aparta",
+			setup: func(m *Memory) {
+				m.Strike("s", "http://1.1.1.1:80", config.ErrorConnection, config.EvictionPolicy{Strikes: 1})
+			},
+			want: proxies,
+		},
+		{
+			name: "sin llegar al límite de fallos",
+			setup: func(m *Memory) {
+				m.Strike("s", "http://1.1.1.1:80", config.ErrorConnection, config.EvictionPolicy{Strikes: 2, Cooldown: 60000})
+			},
+			want: proxies,
+		},
+		{
+			name: "cooldown cumplido",
+			setup: func(m *Memory) {
+				quarantine(m, "s", "http://1.1.1.1:80")
+				m.quarantined["s"]["1.1.1.1:80"] = time.Now().Add(-time.Second)
+			},
+			want: proxies,
+		},
+		{
+			name: "tras Forget",
+			setup: func(m *Memory) {
+				quarantine(m, "s", "http://1.1.1.1:80")
+				m.Forget("s")
+			},
+			want: proxies,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := NewMemory()
+			c.setup(m)
+			if got := m.Available("s", slices.Clone(proxies)); !slices.Equal(got, c.want) {
+				t.Fatalf("Available = %v, se esperaba %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMemoryAvailableRehabilitates(t *testing.T) {
+	m := NewMemory()
+	quarantine(m, "s", "http://1.1.1.1:80")
+	m.quarantined["s"]["1.1.1.1:80"] = time.Now().Add(-time.Second)
+	m.Available("s", []string{"http://1.1.1.1:80"})
+	if _, ok := m.quarantined["s"]["1.1.1.1:80"]; ok {
+		t.Fatal("el proxy sigue en cuarentena tras cumplir el cooldown")
+	}
+}
+
+func TestMemoryRank(t *testing.T) {
+	cases := []struct {
+		name    string
+		results map[string][]bool // proxy -> resultados anotados
+		proxies []string
+		want    []string
+	}{
+		{
+			name:    "sin historial mantiene el orden",
+			proxies: []string{"http://1.1.1.1:80", "http://2.2.2.2:80", "http://3.3.3.3:80"},
+			want:    []string{"http://1.1.1.1:80", "http://2.2.2.2:80", "http://3.3.3.3:80"},
+		},
+		{
+			name: "los que aciertan primero",
+			results: map[string][]bool{
+				"http://3.3.3.3:80": {true, true},
+				"http://2.2.2.2:80": {true},
+			},
+			proxies: []string{"http://1.1.1.1:80", "http://2.2.2.2:80", "http://3.3.3.3:80"},
+			want:    []string{"http://3.3.3.3:80", "http://2.2.2.2:80", "http://1.1.1.1:80"},
+		},
+		{
+			name: "los que fallan detrás de los que no tienen historial",
+			results: map[string][]bool{
+				"http://1.1.1.1:80": {false},
+			},
+			proxies: []string{"http://1.1.1.1:80", "http://2.2.2.2:80", "http://3.3.3.3:80"},
+			want:    []string{"http://2.2.2.2:80", "http://3.3.3.3:80", "http://1.1.1.1:80"},
+		},
+		{
+			name: "los empatados mantienen su orden",
+			results: map[string][]bool{
+				"http://1.1.1.1:80": {true, false},
+				"http://3.3.3.3:80": {false, true},
+			},
+			proxies: []string{"http://1.1.1.1:80", "http://2.2.2.2:80", "http://3.3.3.3:80"},
+			want:    []string{"http://1.1.1.1:80", "http://2.2.2.2:80", "http://3.3.3.3:80"},
+		},
+		{
+			name: "la puntuación es por host:puerto",
+			results: map[string][]bool{
+				"socks5://2.2.2.2:80": {true},
+			},
+			proxies: []string{"http://1.1.1.1:80", "http://2.2.2.2:80"},
+			want:    []string{"http://2.2.2.2:80", "http://1.1.1.1:80"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := NewMemory()
+			for proxyAddr, results := range c.results {
+				for _, success := range results {
+					m.RecordResult("s", proxyAddr, success)
+				}
+			}
+			// Los resultados de otra sesión no cuentan
+			m.RecordResult("otra", "http://1.1.1.1:80", true)
+			if got := m.Rank("s", slices.Clone(c.proxies)); !slices.Equal(got, c.want) {
+				t.Fatalf("Rank = %v, se esperaba %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRemove(t *testing.T) {
+	mustParse := func(line string) proxy.Proxy {
+		p, err := proxy.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	initial := func() map[string][]proxy.Proxy {
+		return map[string][]proxy.Proxy{
+			"s":    {mustParse("http://1.1.1.1:80"), mustParse("socks5://2.2.2.2:1080")},
+			"otra": {mustParse("http://1.1.1.1:80")},
+		}
+	}
+	cases := []struct {
+		name      string
+		session   string
+		proxyAddr string
+		removed   bool
+		want      map[string][]string
+	}{
+		{
+			name:      "presente",
+			session:   "s",
+			proxyAddr: "http://1.1.1.1:80",
+			removed:   true,
+			want:      map[string][]string{"s": {"socks5://2.2.2.2:1080"}, "otra": {"http://1.1.1.1:80"}},
+		},
+		{
+			name:      "ausente",
+			session:   "s",
+			proxyAddr: "http://9.9.9.9:80",
+			want:      map[string][]string{"s": {"http://1.1.1.1:80", "socks5://2.2.2.2:1080"}, "otra": {"http://1.1.1.1:80"}},
+		},
+		{
+			name:      "con otro esquema",
+			session:   "s",
+			proxyAddr: "http://2.2.2.2:1080",
+			want:      map[string][]string{"s": {"http://1.1.1.1:80", "socks5://2.2.2.2:1080"}, "otra": {"http://1.1.1.1:80"}},
+		},
+		{
+			name:      "sesión desconocida",
+			session:   "nueva",
+			proxyAddr: "http://1.1.1.1:80",
+			want:      map[string][]string{"s": {"http://1.1.1.1:80", "socks5://2.2.2.2:1080"}, "otra": {"http://1.1.1.1:80"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := NewMemory()
+			m.Replace(initial())
+			before := m.All()
+			if removed := m.Remove(c.session, c.proxyAddr); removed != c.removed {
+				t.Fatalf("Remove = %v, se esperaba %v", removed, c.removed)
+			}
+			for session, want := range c.want {
+				var got []string
+				for _, p := range m.Proxies(session) {
+					got = append(got, p.String())
+				}
+				if !slices.Equal(got, want) {
+					t.Fatalf("la sesión %s tiene %v, se esperaba %v", session, got, want)
+				}
+			}
+			if _, ok := m.All()["nueva"]; ok {
+				t.Fatal("Remove creó una sesión vacía")
+			}
+			// El mapa devuelto antes por All no cambia: Remove sustituye el pool por una copia
+			if len(before["s"]) != 2 {
+				t.Fatalf("Remove modificó el mapa ya devuelto: %v", before["s"])
+			}
+		})
+	}
+}
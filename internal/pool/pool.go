@@ -0,0 +1,81 @@
+// Package pool define el pool de proxies validados que consume el servidor: su
+// contenido por sesión, la puntuación de cada proxy y su retirada tras fallos.
+package pool
+
+import (
+	"strings"
+	"time"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/proxy"
+)
+
+// ProxyPool es el pool de proxies por sesión. Los proxies se identifican por
+// esquema://host:puerto (proxy.Proxy.String()); la puntuación y la retirada se
+// guardan por host:puerto.
+type ProxyPool interface {
+	// All devuelve todos los proxies por sesión; el mapa no debe modificarse
+	All() map[string][]proxy.Proxy
+	// Proxies devuelve los proxies de la sesión, nil si no tiene ninguno
+	Proxies(session string) []proxy.Proxy
+	// Lookup busca el proxy identificado por proxyAddr en la sesión
+	Lookup(session, proxyAddr string) (proxy.Proxy, bool)
+	// Count devuelve el total de proxies de todas las sesiones
+	Count() int
+	// Replace sustituye el contenido completo del pool
+	Replace(proxies map[string][]proxy.Proxy)
+	// RemoveSession quita la sesión del pool
+	RemoveSession(session string)
+	// Remove quita el proxy de la sesión; devuelve si estaba
+	Remove(session, proxyAddr string) bool
+
+	// RecordResult suma el resultado de una petición a la puntuación del proxy
+	RecordResult(session, proxyAddr string, success bool)
+	// Score devuelve una copia de la puntuación del proxy en la sesión
+	Score(session, proxyAddr string) Score
+	// MergeScore suma una puntuación importada a la existente
+	MergeScore(session, proxyAddr string, score Score)
+	// Rank ordena los proxies por su tasa de éxito en la hora actual, de forma estable
+	Rank(session string, proxies []string) []string
+
+	// Strike anota un fallo de la categoría según la política; devuelve si el proxy queda retirado
+	Strike(session, proxyAddr, category string, policy config.EvictionPolicy) bool
+	// Available descarta los proxies en cooldown y rehabilita los que lo han cumplido
+	Available(session string, proxies []string) []string
+	// Forget descarta los fallos y cooldowns de la sesión
+	Forget(session string)
+}
+
+// HourBucket acumula los resultados de un proxy en una hora del día
+type HourBucket struct {
+	Successes int64
+	Failures  int64
+}
+
+// Score acumula los resultados de un proxy para una sesión
+type Score struct {
+	Successes   int64
+	Failures    int64
+	LastSuccess time.Time
+	LastFailure time.Time
+	Hourly      [24]HourBucket // Resultados por hora del día (hora local)
+}
+
+// Rate devuelve la tasa de éxito suavizada, 0.5 sin historial
+func (s Score) Rate() float64 {
+	return float64(s.Successes+1) / float64(s.Successes+s.Failures+2)
+}
+
+// HourRate devuelve la tasa de éxito suavizada a esa hora del día
+func (s Score) HourRate(hour int) float64 {
+	bucket := s.Hourly[hour]
+	return float64(bucket.Successes+1) / float64(bucket.Successes+bucket.Failures+2)
+}
+
+// Address normaliza la dirección de un proxy a host:puerto
+func Address(proxyAddr string) string {
+	if _, address, ok := strings.Cut(proxyAddr, "://"); ok {
+		return address
+	}
+	return proxyAddr
+}
@@ -0,0 +1,52 @@
+package poolstore
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// fileStore publica el pool en un fichero JSON, por ejemplo en un volumen compartido
+type fileStore struct {
+	path string
+}
+
+// Publish escribe un fichero temporal y lo renombra, de modo que los lectores nunca ven
+// una publicación a medias
+func (s *fileStore) Publish(ctx context.Context, snapshot Snapshot) error {
+	data, err := encode(snapshot)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *fileStore) Load(ctx context.Context) (Snapshot, bool, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Snapshot{}, false, nil
+	}
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	snapshot, err := decode(data)
+	return snapshot, err == nil, err
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,83 @@
+// Package poolstore comparte el pool validado entre procesos: cmd/validator publica el
+// resultado de cada ciclo y los servidores gRPC lo leen en lugar de validar por su cuenta.
+package poolstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"proxy-api/internal/proxy"
+)
+
+// Drivers soportados
+const (
+	DriverFile     = "file"
+	DriverRedis    = "redis"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Drivers son los drivers conocidos
+var Drivers = []string{DriverFile, DriverRedis, DriverSQLite, DriverPostgres}
+
+// Snapshot es el resultado publicado de un ciclo de validación
+type Snapshot struct {
+	Proxies     map[string][]proxy.Proxy `json:"proxies"` // Proxies válidos por sesión
+	PublishedAt time.Time                `json:"published_at"`
+	Publisher   string                   `json:"publisher"` // Host del validador que lo publicó
+}
+
+// Count devuelve el total de proxies de todas las sesiones
+func (s Snapshot) Count() int {
+	total := 0
+	for _, proxies := range s.Proxies {
+		total += len(proxies)
+	}
+	return total
+}
+
+// Store guarda la última publicación del pool
+type Store interface {
+	// Publish sustituye la publicación anterior
+	Publish(ctx context.Context, snapshot Snapshot) error
+	// Load devuelve la última publicación; false si todavía no hay ninguna
+	Load(ctx context.Context) (Snapshot, bool, error)
+	Close() error
+}
+
+// Config describe dónde se comparte el pool
+type Config struct {
+	Driver string
+	URL    string // Ruta del fichero, URL de Redis o cadena de conexión SQL
+	Key    string // Clave de la publicación en Redis y SQL
+}
+
+// Open abre el almacén configurado
+func Open(cfg Config) (Store, error) {
+	switch cfg.Driver {
+	case DriverFile:
+		return &fileStore{path: cfg.URL}, nil
+	case DriverRedis:
+		return openRedis(cfg)
+	case DriverSQLite, DriverPostgres:
+		return openSQL(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported shared pool driver '%s'", cfg.Driver)
+	}
+}
+
+// encode serializa la publicación; los proxies conservan sus credenciales
+func encode(snapshot Snapshot) ([]byte, error) {
+	return json.Marshal(snapshot)
+}
+
+// decode interpreta una publicación serializada con encode
+func decode(data []byte) (Snapshot, error) {
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return Snapshot{}, fmt.Errorf("invalid shared pool snapshot: %w", err)
+	}
+	return snapshot, nil
+}
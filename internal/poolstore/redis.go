@@ -0,0 +1,46 @@
+package poolstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisStore publica el pool en una clave de Redis
+type redisStore struct {
+	client *redis.Client
+	key    string
+}
+
+func openRedis(cfg Config) (Store, error) {
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisStore{client: redis.NewClient(opts), key: cfg.Key}, nil
+}
+
+func (s *redisStore) Publish(ctx context.Context, snapshot Snapshot) error {
+	data, err := encode(snapshot)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.key, data, 0).Err()
+}
+
+func (s *redisStore) Load(ctx context.Context) (Snapshot, bool, error) {
+	data, err := s.client.Get(ctx, s.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Snapshot{}, false, nil
+	}
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	snapshot, err := decode(data)
+	return snapshot, err == nil, err
+}
+
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
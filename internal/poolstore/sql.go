@@ -0,0 +1,42 @@
+package poolstore
+
+import (
+	"context"
+
+	"proxy-api/internal/storage"
+)
+
+// sqlStore publica el pool en la base de datos SQL, en la tabla shared_pool
+type sqlStore struct {
+	store *storage.Store
+	key   string
+}
+
+func openSQL(cfg Config) (Store, error) {
+	store, err := storage.Open(cfg.Driver, cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStore{store: store, key: cfg.Key}, nil
+}
+
+func (s *sqlStore) Publish(ctx context.Context, snapshot Snapshot) error {
+	data, err := encode(snapshot)
+	if err != nil {
+		return err
+	}
+	return s.store.SaveSharedPool(s.key, data, snapshot.PublishedAt)
+}
+
+func (s *sqlStore) Load(ctx context.Context) (Snapshot, bool, error) {
+	data, ok, err := s.store.LoadSharedPool(s.key)
+	if err != nil || !ok {
+		return Snapshot{}, false, err
+	}
+	snapshot, err := decode(data)
+	return snapshot, err == nil, err
+}
+
+func (s *sqlStore) Close() error {
+	return s.store.Close()
+}
@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"proxy-api/internal/config"
+	"proxy-api/internal/scraper"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShadowProxies almacena los proxies válidos que solo proceden de fuentes en canary,
+// del último ciclo completado
+var ShadowProxies = make(map[string][]Proxy)
+
+// Fuentes aceptadas, cargadas de config.SourceStatePath
+var (
+	trustedSources     map[string]bool
+	trustedSourcesOnce sync.Once
+	trustedSourcesMtx  sync.Mutex
+)
+
+// loadTrustedSources lee las fuentes aceptadas. Sin fichero previo, todas las
+// fuentes configuradas se consideran aceptadas para no bloquear el primer arranque.
+func loadTrustedSources() {
+	trustedSources = make(map[string]bool)
+
+	data, err := os.ReadFile(config.SourceStatePath)
+	if os.IsNotExist(err) {
+		for _, source := range config.ProxySources() {
+			trustedSources[source.URL] = true
+		}
+		saveTrustedSources()
+		return
+	}
+	if err != nil {
+		log.Printf("Error al leer las fuentes aceptadas: %v", err)
+		return
+	}
+
+	var sources []string
+	if err := json.Unmarshal(data, &sources); err != nil {
+		log.Printf("Error al leer las fuentes aceptadas: %v", err)
+		return
+	}
+	for _, source := range sources {
+		trustedSources[source] = true
+	}
+}
+
+// saveTrustedSources persiste las fuentes aceptadas; requiere trustedSourcesMtx o estar en la carga inicial
+func saveTrustedSources() {
+	sources := make([]string, 0, len(trustedSources))
+	for source := range trustedSources {
+		sources = append(sources, source)
+	}
+	data, err := json.MarshalIndent(sources, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(config.SourceStatePath, data, 0644); err != nil {
+		log.Printf("Error al guardar las fuentes aceptadas: %v", err)
+	}
+}
+
+// IsCanarySource indica si la fuente todavía no ha superado la validación canary
+func IsCanarySource(source string) bool {
+	trustedSourcesOnce.Do(loadTrustedSources)
+	trustedSourcesMtx.Lock()
+	defer trustedSourcesMtx.Unlock()
+	return !trustedSources[source]
+}
+
+// promoteSource marca la fuente como aceptada
+func promoteSource(source string) {
+	trustedSourcesMtx.Lock()
+	defer trustedSourcesMtx.Unlock()
+	trustedSources[source] = true
+	saveTrustedSources()
+}
+
+// canaryCycle registra el origen de cada proxy durante un ciclo de validación y los
+// proxies que la superan, que solo se publican cuando el ciclo termina
+type canaryCycle struct {
+	origins map[string][]string // esquema://host:puerto -> fuentes
+	scraped map[string]int      // fuente canary -> proxies obtenidos
+	passed  map[string]int      // fuente canary -> proxies válidos
+	parsed  map[string]int      // fuente -> proxies interpretados
+	yield   map[string]int      // fuente -> proxies válidos para alguna sesión
+	valid   map[string][]Proxy  // sesión -> proxies válidos de fuentes aceptadas
+	shadow  map[string][]Proxy  // sesión -> proxies válidos solo de fuentes canary
+	mtx     sync.Mutex
+}
+
+// newCanaryCycle interpreta las líneas de todas las fuentes, agrupa los proxies sin
+// duplicados y devuelve la lista a validar junto con el registro de orígenes.
+func newCanaryCycle(bySource map[string][]string) (*canaryCycle, []Proxy) {
+	cycle := &canaryCycle{
+		origins: make(map[string][]string),
+		scraped: make(map[string]int),
+		passed:  make(map[string]int),
+		parsed:  make(map[string]int),
+		yield:   make(map[string]int),
+		valid:   make(map[string][]Proxy),
+		shadow:  make(map[string][]Proxy),
+	}
+
+	index := make(map[string]int)
+	var proxies []Proxy
+	for source, lines := range bySource {
+		canary := IsCanarySource(source)
+		protocol := ""
+		if cfg, ok := config.SourceByURL(source); ok {
+			protocol = cfg.Protocol
+		}
+		for _, line := range lines {
+			proxy, err := Parse(line)
+			if err != nil {
+				continue
+			}
+			// Las entradas sin esquema toman el protocolo de la fuente
+			if protocol != "" && !strings.Contains(line, "://") {
+				proxy.Scheme = protocol
+			}
+			key := proxy.String()
+			if i, seen := index[key]; seen {
+				proxies[i].Sources = append(proxies[i].Sources, source)
+			} else {
+				proxy.Sources = []string{source}
+				index[key] = len(proxies)
+				proxies = append(proxies, proxy)
+			}
+			cycle.origins[key] = append(cycle.origins[key], source)
+			cycle.parsed[source]++
+			if canary {
+				cycle.scraped[source]++
+			}
+		}
+	}
+	if config.CollapseDuplicateIPs {
+		proxies = cycle.collapseByIP(proxies)
+	}
+	return cycle, proxies
+}
+
+// collapseByIP deja un solo proxy por IP: el mismo nodo listado en varios puertos o
+// esquemas se valida una vez. Se queda el que listan más fuentes, que suma las fuentes
+// de los descartados.
+func (c *canaryCycle) collapseByIP(proxies []Proxy) []Proxy {
+	kept := make(map[string]int)
+	collapsed := proxies[:0]
+	for _, proxy := range proxies {
+		i, seen := kept[proxy.Host]
+		if !seen {
+			kept[proxy.Host] = len(collapsed)
+			collapsed = append(collapsed, proxy)
+			continue
+		}
+		winner, loser := collapsed[i], proxy
+		if len(proxy.Sources) > len(winner.Sources) {
+			winner, loser = proxy, winner
+		}
+		for _, source := range loser.Sources {
+			if !slices.Contains(winner.Sources, source) {
+				winner.Sources = append(winner.Sources, source)
+			}
+		}
+		for _, source := range c.origins[loser.String()] {
+			if !slices.Contains(c.origins[winner.String()], source) {
+				c.origins[winner.String()] = append(c.origins[winner.String()], source)
+			}
+		}
+		delete(c.origins, loser.String())
+		collapsed[i] = winner
+	}
+	if removed := len(proxies) - len(collapsed); removed > 0 {
+		log.Printf("Proxies duplicados por IP: %d agrupados, quedan %d", removed, len(collapsed))
+	}
+	return collapsed
+}
+
+// trusted indica si el proxy procede de al menos una fuente aceptada
+func (c *canaryCycle) trusted(proxy Proxy) bool {
+	for _, source := range c.origins[proxy.String()] {
+		if !IsCanarySource(source) {
+			return true
+		}
+	}
+	return false
+}
+
+// add anota un proxy válido para la sesión en el pool del ciclo que le corresponde
+func (c *canaryCycle) add(session string, proxy Proxy, trusted bool) {
+	proxy.ValidatedAt = time.Now()
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if trusted {
+		c.valid[session] = append(c.valid[session], proxy)
+	} else {
+		c.shadow[session] = append(c.shadow[session], proxy)
+	}
+}
+
+// recordPass anota que un proxy resultó válido para alguna sesión; los que solo
+// proceden de fuentes canary cuentan además para su promoción
+func (c *canaryCycle) recordPass(proxy Proxy, trusted bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, source := range c.origins[proxy.String()] {
+		c.yield[source]++
+		if _, canary := c.scraped[source]; canary && !trusted {
+			c.passed[source]++
+		}
+	}
+}
+
+// evaluate promociona las fuentes canary que superan el umbral y mueve sus
+// proxies del pool sombra al pool real del ciclo
+func (c *canaryCycle) evaluate() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for source, parsed := range c.parsed {
+		scraper.RecordYield(source, parsed, c.yield[source])
+	}
+	for source, scraped := range c.scraped {
+		rate := float64(c.passed[source]) / float64(scraped)
+		if rate < config.CanaryPassRate {
+			log.Printf("Fuente canary %s: %.1f%% válidos (%d/%d), por debajo del umbral", source, rate*100, c.passed[source], scraped)
+			continue
+		}
+
+		log.Printf("Fuente canary %s aceptada: %.1f%% válidos (%d/%d)", source, rate*100, c.passed[source], scraped)
+		promoteSource(source)
+	}
+
+	for session, proxies := range c.shadow {
+		var remaining []Proxy
+		for _, proxy := range proxies {
+			if c.trusted(proxy) {
+				c.valid[session] = append(c.valid[session], proxy)
+			} else {
+				remaining = append(remaining, proxy)
+			}
+		}
+		c.shadow[session] = remaining
+	}
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// Etapas de un ciclo de validación
+const (
+	StageStarted = "started"
+	StageScraped = "scraped"
+	StageTesting = "testing"
+	StageDone    = "done"
+)
+
+// ValidationProgress describe el estado de un ciclo de validación en curso
+type ValidationProgress struct {
+	Stage           string
+	TotalProxies    int
+	Tested          int
+	Valid           int
+	ValidBySession  map[string]int
+	ChunksProcessed int
+	ChunksTotal     int
+	Timestamp       time.Time
+}
+
+// Suscriptores al progreso de validación
+var (
+	progressSubscribers = make(map[chan ValidationProgress]struct{})
+	subscribersMutex    sync.Mutex
+)
+
+// SubscribeProgress registra un canal que recibe los eventos de progreso.
+// La función devuelta cancela la suscripción y cierra el canal.
+func SubscribeProgress() (<-chan ValidationProgress, func()) {
+	ch := make(chan ValidationProgress, 64)
+
+	subscribersMutex.Lock()
+	progressSubscribers[ch] = struct{}{}
+	subscribersMutex.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			subscribersMutex.Lock()
+			delete(progressSubscribers, ch)
+			subscribersMutex.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// ProgressBacklog devuelve los eventos pendientes de leer de cada suscriptor
+func ProgressBacklog() []int {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	backlog := make([]int, 0, len(progressSubscribers))
+	for ch := range progressSubscribers {
+		backlog = append(backlog, len(ch))
+	}
+	return backlog
+}
+
+// publishProgress envía el evento sin bloquear; los suscriptores lentos pierden eventos
+func publishProgress(event ValidationProgress) {
+	event.Timestamp = time.Now()
+
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	for ch := range progressSubscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// validCounts devuelve el total de proxies válidos del ciclo y el desglose por sesión
+func validCounts(cycle *canaryCycle) (int, map[string]int) {
+	cycle.mtx.Lock()
+	defer cycle.mtx.Unlock()
+
+	total := 0
+	bySession := make(map[string]int, len(cycle.valid))
+	for session, proxies := range cycle.valid {
+		bySession[session] = len(proxies)
+		total += len(proxies)
+	}
+	return total, bySession
+}
@@ -1,10 +1,11 @@
 package proxy
 
 import (
+	"context"
 	"log"
 	"net/http"
-	"net/url"
 	"proxy-api/internal/config"
+	"proxy-api/internal/outbound"
 	"proxy-api/internal/scraper"
 	"sync"
 	"time"
@@ -13,31 +14,28 @@ import (
 // Tamaño del chunk, idealmente esto debería venir de un archivo de configuración
 const ChunkSize = config.DefaultChunkSize
 
-// ValidProxies almacena los proxies válidos, con locking para acceso seguro
+// ValidProxies almacena los proxies válidos del último ciclo completado, con locking
+// para acceso seguro
 var (
-	ValidProxies = make(map[string][]string)
+	ValidProxies = make(map[string][]Proxy)
 	mutex        = &sync.Mutex{}
 )
 
-// Procesar un solo test de proxy
-func RunProxyTest(cfg config.ProxySession, proxy string) {
-	proxyURL, err := url.Parse("http://" + proxy)
-	if err != nil {
-		log.Printf("Error al parsear el proxy %s: %v", proxy, err)
-		return
-	}
-
+// Procesar un solo test de proxy; devuelve si el proxy es válido para la sesión. La
+// cancelación de ctx corta la petición en curso y el proxy no cuenta como válido
+func RunProxyTest(ctx context.Context, cfg config.ProxySession, proxy Proxy) bool {
+	transport := outbound.Transport(proxy.URL())
 	httpClient := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(proxyURL),
-		},
-		Timeout: time.Duration(cfg.Timeout) * time.Millisecond,
+		Transport: transport,
+		Timeout:   time.Duration(cfg.Timeout) * time.Millisecond,
 	}
+	// El cliente no se reutiliza: su conexión no debe quedar abierta tras la prueba
+	defer outbound.Discard(transport)
 
-	request, err := http.NewRequest("GET", cfg.URL, nil)
+	request, err := http.NewRequestWithContext(ctx, "GET", cfg.URL, nil)
 	if err != nil {
 		log.Printf("Error al crear la solicitud: %v", err)
-		return
+		return false
 	}
 
 	for headerName, headerValue := range cfg.Headers {
@@ -48,40 +46,56 @@ func RunProxyTest(cfg config.ProxySession, proxy string) {
 
 	resp, err := httpClient.Do(request)
 	if err != nil || (resp != nil && resp.StatusCode != 200) {
-		log.Printf("Proxy %s no válido para %s", proxy, cfg.Name)
+		if ctx.Err() == nil {
+			log.Printf("Proxy %s no válido para %s", proxy, cfg.Name)
+		}
 		if resp != nil {
 			resp.Body.Close()
 		}
-		return
+		return false
 	}
 
-	mutex.Lock()
-	ValidProxies[cfg.Name] = append(ValidProxies[cfg.Name], proxy)
-	mutex.Unlock()
-
-	if resp != nil {
-		resp.Body.Close()
-	}
+	resp.Body.Close()
+	return true
 }
 
-// Procesar todos los tests en un proxy
-func runAllTests(proxy string) {
+// Procesar todos los tests en un proxy; los proxies de fuentes canary van al pool sombra
+func runAllTests(ctx context.Context, proxy Proxy, cycle *canaryCycle) {
 	var wg sync.WaitGroup
-	wg.Add(len(config.ProxySessions))
-
-	for _, test := range config.ProxySessions {
+	sessions := config.Sessions()
+	wg.Add(len(sessions))
+
+	trusted := cycle.trusted(proxy)
+	var passedMtx sync.Mutex
+	passed := false
+	ipv6 := proxy.IsIPv6()
+	for _, test := range sessions {
 		go func(test config.ProxySession) {
 			defer wg.Done()
-			RunProxyTest(test, proxy)
+			if ipv6 && test.ExcludeIPv6 {
+				return
+			}
+			if !RunProxyTest(ctx, test, proxy) {
+				return
+			}
+
+			cycle.add(test.Name, proxy, trusted)
+
+			passedMtx.Lock()
+			passed = true
+			passedMtx.Unlock()
 		}(test)
 	}
 
 	wg.Wait()
+	if passed {
+		cycle.recordPass(proxy, trusted)
+	}
 }
 
 // Divide los proxies en chunks más manejables
-func chunkProxies(proxies []string) [][]string {
-	var chunks [][]string
+func chunkProxies(proxies []Proxy) [][]Proxy {
+	var chunks [][]Proxy
 	for i := 0; i < len(proxies); i += ChunkSize {
 		end := i + ChunkSize
 		if end > len(proxies) {
@@ -92,20 +106,97 @@ func chunkProxies(proxies []string) [][]string {
 	return chunks
 }
 
-// ValidateProxies realiza la validación de la lista de proxies
-func GetValidProxies() map[string][]string {
-	proxies := scraper.ScrapeProxies()
+// validationWorkers devuelve cuántos chunks pueden validarse a la vez sin superar
+// outbound.ConnectionLimit, con una conexión por sesión; todos si no hay límite
+func validationWorkers(chunks int) int {
+	limit := outbound.ConnectionLimit()
+	if limit <= 0 || chunks == 0 {
+		return max(chunks, 1)
+	}
+	workers := limit / max(len(config.Sessions()), 1)
+	return min(max(workers, 1), chunks)
+}
+
+// Cancelación del ciclo de validación en curso
+var (
+	cancelCycle context.CancelFunc
+	cycleMutex  sync.Mutex
+)
+
+// GetValidProxies descarga las fuentes configuradas y valida sus proxies con
+// ValidateProxies
+func GetValidProxies(ctx context.Context) (map[string][]Proxy, error) {
+	return ValidateProxies(ctx, nil)
+}
+
+// ValidateProxies valida contra las sesiones los proxies de bySource (líneas por URL de
+// origen); nil descarga las fuentes configuradas. Termina con el error de ctx si se
+// cancela, o si otro ciclo posterior lo sustituye, sin tocar el pool sombra ni devolver
+// un resultado parcial.
+func ValidateProxies(ctx context.Context, bySource map[string][]string) (map[string][]Proxy, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cycleMutex.Lock()
+	if cancelCycle != nil {
+		cancelCycle()
+	}
+	cancelCycle = cancel
+	cycleMutex.Unlock()
+
+	publishProgress(ValidationProgress{Stage: StageStarted})
+
+	if bySource == nil {
+		bySource = scraper.ScrapeProxiesBySource()
+	}
+	cycle, proxies := newCanaryCycle(bySource)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	chunks := chunkProxies(proxies)
 	var wg sync.WaitGroup
 	var progressMutex sync.Mutex
 	chunksProcessed := 0
+	tested := 0
+
+	publishProgress(ValidationProgress{Stage: StageScraped, TotalProxies: len(proxies), ChunksTotal: len(chunks)})
+
+	// Publica el progreso actual; debe llamarse con progressMutex tomado
+	report := func(stage string) {
+		valid, bySession := validCounts(cycle)
+		publishProgress(ValidationProgress{
+			Stage:           stage,
+			TotalProxies:    len(proxies),
+			Tested:          tested,
+			Valid:           valid,
+			ValidBySession:  bySession,
+			ChunksProcessed: chunksProcessed,
+			ChunksTotal:     len(chunks),
+		})
+	}
 
+	// Cada proxy abre una conexión por sesión: se procesan a la vez tantos chunks como
+	// quepan en el límite de conexiones, y el resto espera sin consumir su timeout
+	workers := make(chan struct{}, validationWorkers(len(chunks)))
 	for _, chunk := range chunks {
 		wg.Add(1)
-		go func(chunk []string) {
+		go func(chunk []Proxy) {
 			defer wg.Done()
+			select {
+			case workers <- struct{}{}:
+				defer func() { <-workers }()
+			case <-ctx.Done():
+				return
+			}
 			for _, proxy := range chunk {
-				runAllTests(proxy)
+				if ctx.Err() != nil {
+					return
+				}
+				runAllTests(ctx, proxy, cycle)
+
+				progressMutex.Lock()
+				tested++
+				report(StageTesting)
+				progressMutex.Unlock()
 			}
 
 			progressMutex.Lock()
@@ -117,12 +208,28 @@ func GetValidProxies() map[string][]string {
 	}
 
 	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		log.Printf("Validación interrumpida tras %d de %d proxies: %v", tested, len(proxies), err)
+		return nil, err
+	}
+	report(StageDone)
+	cycle.evaluate()
 
 	mutex.Lock()
 	defer mutex.Unlock()
+	// Un ciclo posterior pudo sustituirlo mientras se evaluaba: solo se publica el vigente
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ValidProxies = cycle.valid
+	ShadowProxies = cycle.shadow
+
+	// Se devuelve una copia para que los lectores no compartan el mapa con el siguiente ciclo
+	result := make(map[string][]Proxy, len(ValidProxies))
 	for site, proxies := range ValidProxies {
 		log.Printf("Sitio web: %s | Proxies: %v", site, len(proxies))
+		result[site] = append([]Proxy(nil), proxies...)
 	}
 
-	return ValidProxies
+	return result, nil
 }
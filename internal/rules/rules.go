@@ -0,0 +1,65 @@
+package rules
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Veredictos de una regla de validación
+const (
+	Valid  = "valid"  // La respuesta se acepta
+	Retry  = "retry"  // La respuesta se descarta y se intenta con otro proxy
+	Poison = "poison" // La respuesta se descarta y el proxy deja de usarse para la sesión
+)
+
+// Input son las variables disponibles en las reglas
+type Input struct {
+	Status     int               `expr:"status"`
+	Headers    map[string]string `expr:"headers"` // Nombres en minúsculas
+	Body       string            `expr:"body"`
+	NilContent bool              `expr:"nil_content"` // El cuerpo contiene un error conocido del destino
+}
+
+// Programas compilados por código fuente
+var compiled sync.Map
+
+// Compile compila una regla; el resultado debe ser un veredicto o un booleano (true es valid, false retry)
+func Compile(source string) (*vm.Program, error) {
+	if program, ok := compiled.Load(source); ok {
+		return program.(*vm.Program), nil
+	}
+	program, err := expr.Compile(source, expr.Env(Input{}))
+	if err != nil {
+		return nil, err
+	}
+	compiled.Store(source, program)
+	return program, nil
+}
+
+// Evaluate aplica la regla a la respuesta y devuelve su veredicto
+func Evaluate(source string, in Input) (string, error) {
+	program, err := Compile(source)
+	if err != nil {
+		return "", err
+	}
+	out, err := expr.Run(program, in)
+	if err != nil {
+		return "", err
+	}
+
+	switch verdict := out.(type) {
+	case bool:
+		if verdict {
+			return Valid, nil
+		}
+		return Retry, nil
+	case string:
+		if verdict == Valid || verdict == Retry || verdict == Poison {
+			return verdict, nil
+		}
+	}
+	return "", fmt.Errorf("rule returned %v, expected \"valid\", \"retry\", \"poison\" or a boolean", out)
+}
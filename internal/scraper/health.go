@@ -0,0 +1,98 @@
+package scraper
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/events"
+)
+
+// SourceHealth es el historial de descargas de una fuente
+type SourceHealth struct {
+	URL                 string
+	Fetches             int64 // Descargas intentadas
+	Failures            int64 // Descargas fallidas
+	ConsecutiveFailures int
+	LastError           string
+	LastFetch           time.Time
+	LastSuccess         time.Time
+	SkippedUntil        time.Time // Apartada tras SOURCE_FAILURE_THRESHOLD fallos seguidos
+	Lines               int       // Entradas de la última lista descargada
+	Parsed              int       // Proxies interpretados en el último ciclo
+	Valid               int       // Proxies válidos para alguna sesión en el último ciclo
+}
+
+var (
+	sourceHealth    = make(map[string]*SourceHealth)
+	sourceHealthMtx sync.Mutex
+)
+
+// health devuelve el historial de la fuente, creándolo si no existe; requiere sourceHealthMtx
+func health(url string) *SourceHealth {
+	h, ok := sourceHealth[url]
+	if !ok {
+		h = &SourceHealth{URL: url}
+		sourceHealth[url] = h
+	}
+	return h
+}
+
+// skipped indica si la fuente está apartada por fallos recientes
+func skipped(url string) bool {
+	sourceHealthMtx.Lock()
+	defer sourceHealthMtx.Unlock()
+	h, ok := sourceHealth[url]
+	return ok && time.Now().Before(h.SkippedUntil)
+}
+
+// recordFetch anota el resultado de una descarga y aparta la fuente si acumula
+// SOURCE_FAILURE_THRESHOLD fallos seguidos
+func recordFetch(url string, lines int, err error) {
+	sourceHealthMtx.Lock()
+	defer sourceHealthMtx.Unlock()
+
+	h := health(url)
+	now := time.Now()
+	h.Fetches++
+	h.LastFetch = now
+	if err == nil {
+		h.ConsecutiveFailures = 0
+		h.LastSuccess = now
+		h.Lines = lines
+		return
+	}
+
+	h.Failures++
+	h.ConsecutiveFailures++
+	h.LastError = err.Error()
+	events.Publish(events.Event{Kind: events.SourceFailed, Source: url, Reason: err.Error(), Count: h.ConsecutiveFailures})
+	if config.SourceFailureThreshold > 0 && h.ConsecutiveFailures >= config.SourceFailureThreshold {
+		h.SkippedUntil = now.Add(time.Duration(config.SourceBackoff) * time.Minute)
+		log.Printf("Fuente %s apartada %d min tras %d fallos seguidos: %v", url, config.SourceBackoff, h.ConsecutiveFailures, err)
+	}
+}
+
+// RecordYield anota cuántos proxies de la fuente se interpretaron y superaron la
+// validación en un ciclo
+func RecordYield(url string, parsed, valid int) {
+	sourceHealthMtx.Lock()
+	defer sourceHealthMtx.Unlock()
+	h := health(url)
+	h.Parsed = parsed
+	h.Valid = valid
+}
+
+// SourceHealthSnapshot devuelve una copia del historial de las fuentes, ordenado por URL
+func SourceHealthSnapshot() []SourceHealth {
+	sourceHealthMtx.Lock()
+	defer sourceHealthMtx.Unlock()
+	snapshot := make([]SourceHealth, 0, len(sourceHealth))
+	for _, h := range sourceHealth {
+		snapshot = append(snapshot, *h)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].URL < snapshot[j].URL })
+	return snapshot
+}
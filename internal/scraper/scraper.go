@@ -2,13 +2,30 @@ package scraper
 
 import (
 	"context"
-	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/outbound"
+
+	"golang.org/x/net/http/httpguts"
 )
 
+// Longitud máxima de un user-agent de la lista; las líneas más largas no son user-agents
+const maxUserAgentLength = 512
+
+// sourceClient descarga las listas de las fuentes
+var sourceClient = &http.Client{Transport: outbound.Transport(nil)}
+
+// sourceResult son las líneas obtenidas de una URL
+type sourceResult struct {
+	url   string
+	lines []string
+}
+
 type Scraper struct {
 	urls     []string
 	dataType string
@@ -22,34 +39,43 @@ func NewScraper(urls []string, dataType string) *Scraper {
 }
 
 func (s *Scraper) Scrape(ctx context.Context) []string {
-	resultChan := make(chan []string)
-	errChan := make(chan error)
+	var results []string
+	for _, lines := range s.ScrapeBySource(ctx) {
+		results = append(results, lines...)
+	}
+	return results
+}
+
+// ScrapeBySource devuelve las líneas obtenidas agrupadas por URL de origen
+func (s *Scraper) ScrapeBySource(ctx context.Context) map[string][]string {
+	resultChan := make(chan sourceResult, len(s.urls))
+	errChan := make(chan error, len(s.urls))
 
 	for _, url := range s.urls {
 		go s.fetchData(ctx, url, resultChan, errChan)
 	}
 
 	timeout := time.After(25 * time.Second)
-	var results []string
+	results := make(map[string][]string)
 	for i := 0; i < len(s.urls); i++ {
 		select {
 		case res := <-resultChan:
-			results = append(results, res...)
+			results[res.url] = append(results[res.url], res.lines...)
 		case err := <-errChan:
-			fmt.Printf("Error scraping %s data: %s\n", s.dataType, err)
+			log.Printf("Error scraping %s data: %s", s.dataType, err)
 		case <-timeout:
-			fmt.Println("Scraping timed out.")
+			log.Print("Scraping timed out.")
 			return results
 		}
 	}
 	return results
 }
 
-func (s *Scraper) fetchData(ctx context.Context, url string, resultChan chan []string, errChan chan error) {
-	fmt.Printf("Obteniendo %s de %s...\n", s.dataType, url)
+func (s *Scraper) fetchData(ctx context.Context, url string, resultChan chan sourceResult, errChan chan error) {
+	log.Printf("Obteniendo %s de %s...", s.dataType, url)
 
 	req, _ := http.NewRequest(http.MethodGet, url, nil)
-	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	resp, err := sourceClient.Do(req.WithContext(ctx))
 	if err != nil {
 		errChan <- err
 		return
@@ -62,40 +88,27 @@ func (s *Scraper) fetchData(ctx context.Context, url string, resultChan chan []s
 		return
 	}
 
-	lines := strings.Split(string(body), "\n")
 	var validLines []string
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.Count(trimmed, ":") > 1 {
-			trimmed = strings.Split(trimmed, ":")[0] + ":" + strings.Split(trimmed, ":")[1]
-		}
-		if trimmed != "" || (strings.Contains(url, "user-agents") && (!strings.Contains(trimmed, "Android") &&
-			!strings.Contains(trimmed, "iPhone") &&
-			!strings.Contains(trimmed, "iPad") &&
-			!strings.Contains(trimmed, "compatible;"))) {
-
-			validLines = append(validLines, trimmed)
-		}
+	if s.dataType == "proxies" {
+		validLines, _ = ParseProxyList(config.SourceParserText, body)
+	} else {
+		validLines = ParseUserAgents(body)
 	}
-	resultChan <- validLines
+	resultChan <- sourceResult{url: url, lines: validLines}
 }
 
-func ScrapeProxies() []string {
-	urls := []string{
-		// "https://raw.githubusercontent.com/proxifly/free-proxy-list/main/proxies/protocols/http/data.txt",
-		// "https://raw.githubusercontent.com/proxifly/free-proxy-list/refs/heads/main/proxies/all/data.txt",
-		"https://raw.githubusercontent.com/officialputuid/KangProxy/refs/heads/KangProxy/https/https.txt",
-		"https://raw.githubusercontent.com/vakhov/fresh-proxy-list/refs/heads/master/https.txt",
-		// "https://raw.githubusercontent.com/prxchk/proxy-list/main/http.txt",
-		// "https://raw.githubusercontent.com/proxifly/free-proxy-list/main/proxies/protocols/http/data.txt",
-		// "https://raw.githubusercontent.com/vakhov/fresh-proxy-list/master/http.txt",
-		// "https://raw.githubusercontent.com/MuRongPIG/Proxy-Master/main/http.txt",
-		// "https://raw.githubusercontent.com/ProxyScraper/ProxyScraper/main/http.txt",
+// ParseUserAgents devuelve los user-agents de una lista, uno por línea. Descarta las
+// líneas vacías, las demasiado largas y las que no son un valor de cabecera válido.
+func ParseUserAgents(body []byte) []string {
+	var agents []string
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || len(line) > maxUserAgentLength || !httpguts.ValidHeaderFieldValue(line) {
+			continue
+		}
+		agents = append(agents, line)
 	}
-	scraper := NewScraper(urls, "proxies")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	return scraper.Scrape(ctx)
+	return agents
 }
 
 func ScrapeUserAgents() []string {
@@ -117,7 +130,7 @@ func ScrapeUserAgents() []string {
 		}
 
 		// Si la operación falla, esperar un momento antes de volver a intentar
-		fmt.Printf("Intento %d fallido. Reintentando...\n", attempt)
+		log.Printf("Intento %d fallido. Reintentando...", attempt)
 		scraper = NewScraper(urls, "user-agents")
 		time.Sleep(2 * time.Second)
 	}
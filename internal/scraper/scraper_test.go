@@ -0,0 +1,27 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// FuzzParseUserAgent comprueba que todos los user-agents pueden enviarse como cabecera
+func FuzzParseUserAgent(f *testing.F) {
+	for _, seed := range []string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36\n" +
+			"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0\r\n\n",
+		"curl/8.0\n\n   \nWget/1.21 (linux-gnu)\n",
+		"Mozilla/5.0\x00\x7f\xff\n",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		for _, agent := range ParseUserAgents([]byte(input)) {
+			if agent == "" || agent != strings.TrimSpace(agent) || !httpguts.ValidHeaderFieldValue(agent) {
+				t.Fatalf("user-agent inválido %q", agent)
+			}
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-api/internal/config"
+)
+
+// sourceFetch es la última lista descargada de una fuente
+type sourceFetch struct {
+	lines   []string
+	fetched time.Time
+}
+
+// Última lista de cada fuente, reutilizada mientras no toque descargarla de nuevo
+var (
+	sourceCache    = make(map[string]sourceFetch)
+	sourceCacheMtx sync.Mutex
+)
+
+// ScrapeProxiesBySource obtiene los proxies de las fuentes habilitadas agrupados por
+// URL. Relee antes PROXY_SOURCES_FILE; las fuentes con Refresh reutilizan su última
+// lista hasta que vence y las apartadas por fallos seguidos se omiten.
+func ScrapeProxiesBySource() map[string][]string {
+	if err := config.ReloadProxySources(); err != nil {
+		log.Printf("Error al leer las fuentes de proxies, se mantienen las anteriores: %v", err)
+	}
+	return ScrapeSources(config.ProxySources())
+}
+
+// ScrapeSources obtiene los proxies de las fuentes indicadas agrupados por URL, con la
+// misma caché y los mismos apartados por fallos que ScrapeProxiesBySource
+func ScrapeSources(sources []config.ProxySource) map[string][]string {
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	results := make(map[string][]string)
+	for _, source := range sources {
+		if !source.IsEnabled() || skipped(source.URL) {
+			continue
+		}
+		if lines, ok := cachedSource(source); ok {
+			results[source.URL] = lines
+			continue
+		}
+
+		wg.Add(1)
+		go func(source config.ProxySource) {
+			defer wg.Done()
+			lines, err := fetchSource(source)
+			recordFetch(source.URL, len(lines), err)
+			if err != nil {
+				log.Printf("Error al obtener proxies de %s: %v", source.URL, err)
+				return
+			}
+			sourceCacheMtx.Lock()
+			sourceCache[source.URL] = sourceFetch{lines: lines, fetched: time.Now()}
+			sourceCacheMtx.Unlock()
+
+			mtx.Lock()
+			results[source.URL] = lines
+			mtx.Unlock()
+		}(source)
+	}
+	wg.Wait()
+	return results
+}
+
+// cachedSource devuelve la última lista de la fuente si su Refresh aún no ha vencido
+func cachedSource(source config.ProxySource) ([]string, bool) {
+	if source.Refresh <= 0 {
+		return nil, false
+	}
+	sourceCacheMtx.Lock()
+	defer sourceCacheMtx.Unlock()
+	cached, ok := sourceCache[source.URL]
+	if !ok || time.Since(cached.fetched) >= time.Duration(source.Refresh)*time.Minute {
+		return nil, false
+	}
+	return cached.lines, true
+}
+
+// fetchSource descarga la lista de la fuente e interpreta su formato
+func fetchSource(source config.ProxySource) ([]string, error) {
+	log.Printf("Obteniendo proxies de %s...", source.URL)
+	body, err := readSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseProxyList(source.Parser, body)
+}
+
+// ParseProxyList convierte el contenido de una fuente en líneas de proxies según su
+// formato. Las líneas se interpretan con proxy.Parse al validarlas.
+func ParseProxyList(parser string, body []byte) ([]string, error) {
+	if parser == config.SourceParserJSON {
+		return parseJSONList(body)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			lines = append(lines, trimmed)
+		}
+	}
+	return lines, nil
+}
+
+// readSource devuelve el contenido de la lista: el fichero de una fuente file:// o la
+// respuesta de una http(s)://
+func readSource(source config.ProxySource) ([]byte, error) {
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "file" {
+		return os.ReadFile(u.Path)
+	}
+
+	timeout := source.Timeout
+	if timeout <= 0 {
+		timeout = config.DefaultSourceTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sourceClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// jsonProxy es una entrada de una lista JSON de proxies
+type jsonProxy struct {
+	Proxy    string      `json:"proxy"`
+	IP       string      `json:"ip"`
+	Port     json.Number `json:"port"`
+	Protocol string      `json:"protocol"`
+}
+
+// parseJSONList convierte un array JSON de cadenas o de objetos en líneas de proxies
+func parseJSONList(body []byte) ([]string, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("invalid json proxy list: %v", err)
+	}
+
+	var lines []string
+	for _, item := range raw {
+		var line string
+		if err := json.Unmarshal(item, &line); err == nil {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+			continue
+		}
+		var entry jsonProxy
+		if err := json.Unmarshal(item, &entry); err != nil {
+			continue
+		}
+		switch {
+		case strings.TrimSpace(entry.Proxy) != "":
+			lines = append(lines, strings.TrimSpace(entry.Proxy))
+		case entry.IP != "" && entry.Port != "":
+			line := net.JoinHostPort(entry.IP, entry.Port.String())
+			if _, err := strconv.Atoi(entry.Port.String()); err != nil {
+				continue
+			}
+			if entry.Protocol != "" {
+				line = strings.ToLower(entry.Protocol) + "://" + line
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
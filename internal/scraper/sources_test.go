@@ -0,0 +1,42 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"proxy-api/internal/config"
+)
+
+// fuzzProxyList comprueba que la lista no devuelve líneas vacías ni con espacios alrededor
+func fuzzProxyList(f *testing.F, parser string, seeds []string) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		lines, err := ParseProxyList(parser, []byte(input))
+		if err != nil {
+			return
+		}
+		for _, line := range lines {
+			if line == "" || line != strings.TrimSpace(line) {
+				t.Fatalf("línea sin recortar %q", line)
+			}
+		}
+	})
+}
+
+func FuzzParseProxyListText(f *testing.F) {
+	fuzzProxyList(f, config.SourceParserText, []string{
+		"1.2.3.4:8080\n5.6.7.8:3128\r\n\n  9.9.9.9:80  \n",
+		"# lista\nhttp://1.2.3.4:80\nsocks5://5.6.7.8:1080\n",
+		"<tr><td>1.2.3.4</td><td>8080</td></tr>",
+	})
+}
+
+func FuzzParseProxyListJSON(f *testing.F) {
+	fuzzProxyList(f, config.SourceParserJSON, []string{
+		`["1.2.3.4:8080", " 5.6.7.8:3128 "]`,
+		`[{"ip": "1.2.3.4", "port": 8080, "protocol": "SOCKS5"}, {"proxy": "http://5.6.7.8:80"}]`,
+		`[{"ip": "::1", "port": "1080"}, {"ip": "1.2.3.4", "port": 1.5}, null, 3]`,
+	})
+}
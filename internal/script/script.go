@@ -0,0 +1,316 @@
+package script
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// Límite de pasos de ejecución de un script por petición
+const maxSteps = 1000000
+
+// Funciones disponibles en los scripts además de las de Starlark
+var builtins = starlark.StringDict{
+	"now":             starlark.NewBuiltin("now", now),
+	"now_ms":          starlark.NewBuiltin("now_ms", nowMs),
+	"sha256_hex":      starlark.NewBuiltin("sha256_hex", sha256Hex),
+	"md5_hex":         starlark.NewBuiltin("md5_hex", md5Hex),
+	"hmac_sha256_hex": starlark.NewBuiltin("hmac_sha256_hex", hmacSHA256Hex),
+	"hmac_sha256_b64": starlark.NewBuiltin("hmac_sha256_b64", hmacSHA256Base64),
+	"base64_encode":   starlark.NewBuiltin("base64_encode", base64Encode),
+	"url_escape":      starlark.NewBuiltin("url_escape", urlEscape),
+}
+
+func now(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return starlark.MakeInt64(time.Now().Unix()), nil
+}
+
+func nowMs(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return starlark.MakeInt64(time.Now().UnixMilli()), nil
+}
+
+func sha256Hex(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(s))
+	return starlark.String(hex.EncodeToString(sum[:])), nil
+}
+
+func md5Hex(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	sum := md5.Sum([]byte(s))
+	return starlark.String(hex.EncodeToString(sum[:])), nil
+}
+
+func hmacSHA256(fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) ([]byte, error) {
+	var key, msg string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &key, &msg); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(msg))
+	return mac.Sum(nil), nil
+}
+
+func hmacSHA256Hex(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	sum, err := hmacSHA256(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(hex.EncodeToString(sum)), nil
+}
+
+func hmacSHA256Base64(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	sum, err := hmacSHA256(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(base64.StdEncoding.EncodeToString(sum)), nil
+}
+
+func base64Encode(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	return starlark.String(base64.StdEncoding.EncodeToString([]byte(s))), nil
+}
+
+func urlEscape(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	return starlark.String(url.QueryEscape(s)), nil
+}
+
+// Función rewrite de cada script compilado, por código fuente
+var compiled sync.Map
+
+// Compile ejecuta el script y devuelve su función rewrite(req)
+func Compile(source string) (starlark.Callable, error) {
+	if fn, ok := compiled.Load(source); ok {
+		return fn.(starlark.Callable), nil
+	}
+
+	thread := &starlark.Thread{Name: "compile"}
+	thread.SetMaxExecutionSteps(maxSteps)
+	globals, err := starlark.ExecFile(thread, "rewrite.star", source, builtins)
+	if err != nil {
+		return nil, err
+	}
+	// La función se comparte entre peticiones concurrentes: los valores globales del
+	// script quedan de solo lectura
+	globals.Freeze()
+	fn, ok := globals["rewrite"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script must define rewrite(req)")
+	}
+	compiled.Store(source, fn)
+	return fn, nil
+}
+
+// toDict convierte los valores por nombre en un dict de Starlark, conservando el orden:
+// un solo valor queda como cadena y varios como lista de cadenas
+func toDict(names []string, values map[string][]string) *starlark.Dict {
+	d := starlark.NewDict(len(names))
+	for _, name := range names {
+		list := values[name]
+		if len(list) == 1 {
+			d.SetKey(starlark.String(name), starlark.String(list[0]))
+			continue
+		}
+		items := make([]starlark.Value, len(list))
+		for i, value := range list {
+			items[i] = starlark.String(value)
+		}
+		d.SetKey(starlark.String(name), starlark.NewList(items))
+	}
+	return d
+}
+
+// field es un nombre del dict headers o query con sus valores
+type field struct {
+	name   string
+	values []string
+}
+
+// fromDict lee un dict de Starlark cuyos valores son cadenas o listas de cadenas
+func fromDict(v starlark.Value, dict string) ([]field, error) {
+	d, ok := v.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("req[%q] must be a dict", dict)
+	}
+	fields := make([]field, 0, d.Len())
+	for _, item := range d.Items() {
+		name, ok := starlark.AsString(item[0])
+		if !ok {
+			return nil, fmt.Errorf("req[%q] must contain only string keys", dict)
+		}
+		values, ok := stringValues(item[1])
+		if !ok {
+			return nil, fmt.Errorf("req[%q][%q] must be a string or a list of strings", dict, name)
+		}
+		fields = append(fields, field{name: name, values: values})
+	}
+	return fields, nil
+}
+
+// stringValues lee una cadena o una lista o tupla de cadenas
+func stringValues(v starlark.Value) ([]string, bool) {
+	if s, ok := starlark.AsString(v); ok {
+		return []string{s}, true
+	}
+	var list starlark.Indexable
+	switch v := v.(type) {
+	case *starlark.List:
+		list = v
+	case starlark.Tuple:
+		list = v
+	default:
+		return nil, false
+	}
+	values := make([]string, list.Len())
+	for i := range values {
+		s, ok := starlark.AsString(list.Index(i))
+		if !ok {
+			return nil, false
+		}
+		values[i] = s
+	}
+	return values, true
+}
+
+// Rewrite llama a rewrite(req) con el método, la URL, las cabeceras y los parámetros de la
+// petición, y aplica a la petición los cambios que haga el script sobre el dict.
+func Rewrite(source string, r *http.Request) error {
+	fn, err := Compile(source)
+	if err != nil {
+		return err
+	}
+
+	var headerNames []string
+	for name := range r.Header {
+		headerNames = append(headerNames, name)
+	}
+	query := r.URL.Query()
+	var queryNames []string
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(name); err == nil && name != "" && query.Has(name) && !seen[name] {
+			seen[name] = true
+			queryNames = append(queryNames, name)
+		}
+	}
+
+	req := starlark.NewDict(5)
+	req.SetKey(starlark.String("method"), starlark.String(r.Method))
+	req.SetKey(starlark.String("url"), starlark.String(r.URL.String()))
+	req.SetKey(starlark.String("path"), starlark.String(r.URL.Path))
+	req.SetKey(starlark.String("headers"), toDict(headerNames, r.Header))
+	req.SetKey(starlark.String("query"), toDict(queryNames, query))
+	originalQuery := r.URL.RawQuery
+
+	thread := &starlark.Thread{Name: "rewrite"}
+	thread.SetMaxExecutionSteps(maxSteps)
+	if _, err := starlark.Call(thread, fn, starlark.Tuple{req}, nil); err != nil {
+		return err
+	}
+
+	get := func(field string) (starlark.Value, error) {
+		v, found, err := req.Get(starlark.String(field))
+		if err != nil || !found {
+			return nil, fmt.Errorf("req[%q] was removed", field)
+		}
+		return v, nil
+	}
+
+	// La URL completa tiene prioridad; si no cambió se reconstruyen los parámetros
+	v, err := get("url")
+	if err != nil {
+		return err
+	}
+	rawURL, _ := starlark.AsString(v)
+	if rawURL != r.URL.String() {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("invalid url from script: %w", err)
+		}
+		r.URL = u
+		r.Host = u.Host
+	} else {
+		v, err := get("query")
+		if err != nil {
+			return err
+		}
+		fields, err := fromDict(v, "query")
+		if err != nil {
+			return err
+		}
+		// Si el script no tocó los parámetros se conserva la codificación original
+		if !sameQuery(originalQuery, fields) {
+			var parts []string
+			for _, f := range fields {
+				for _, value := range f.values {
+					parts = append(parts, url.QueryEscape(f.name)+"="+url.QueryEscape(value))
+				}
+			}
+			r.URL.RawQuery = strings.Join(parts, "&")
+		}
+	}
+
+	if v, err := get("method"); err == nil {
+		if method, ok := starlark.AsString(v); ok && method != "" {
+			r.Method = method
+		}
+	}
+
+	v, err = get("headers")
+	if err != nil {
+		return err
+	}
+	fields, err := fromDict(v, "headers")
+	if err != nil {
+		return err
+	}
+	header := make(http.Header, len(fields))
+	for _, f := range fields {
+		header.Del(f.name)
+		for _, value := range f.values {
+			header.Add(f.name, value)
+		}
+	}
+	r.Header = header
+	return nil
+}
+
+// sameQuery indica si los parámetros del script coinciden con los originales
+func sameQuery(raw string, fields []field) bool {
+	query, _ := url.ParseQuery(raw)
+	if len(query) != len(fields) {
+		return false
+	}
+	for _, f := range fields {
+		if !slices.Equal(query[f.name], f.values) {
+			return false
+		}
+	}
+	return true
+}
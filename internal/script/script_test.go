@@ -0,0 +1,65 @@
+package script
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRewriteKeepsRepeatedValues(t *testing.T) {
+	source := `
+def rewrite(req):
+    req["headers"]["Accept"] = req["headers"]["Accept"] + ["text/plain"]
+    req["headers"]["X-Api-Key"] = "clave"
+    req["query"]["id"] = [v + "0" for v in req["query"]["id"]]
+`
+	r, err := http.NewRequest(http.MethodGet, "https://example.com/a?id=1&id=2&q=x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header["Accept"] = []string{"text/html", "application/json"}
+
+	if err := Rewrite(source, r); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Header.Values("Accept"), []string{"text/html", "application/json", "text/plain"}; !slices.Equal(got, want) {
+		t.Fatalf("Accept = %v, se esperaba %v", got, want)
+	}
+	if got := r.Header.Get("X-Api-Key"); got != "clave" {
+		t.Fatalf("X-Api-Key = %q", got)
+	}
+	if got, want := r.URL.RawQuery, "id=10&id=20&q=x"; got != want {
+		t.Fatalf("query = %q, se esperaba %q", got, want)
+	}
+}
+
+func TestRewriteUnchangedQueryKeepsEncoding(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "https://example.com/a?b=%7e&a=1&a=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Rewrite("def rewrite(req):\n    pass\n", r); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.URL.RawQuery, "b=%7e&a=1&a=2"; got != want {
+		t.Fatalf("query = %q, se esperaba %q", got, want)
+	}
+}
+
+func TestCompileFreezesGlobals(t *testing.T) {
+	source := `
+seen = []
+
+def rewrite(req):
+    seen.append(req["url"])
+`
+	r, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Rewrite(source, r)
+	if err == nil || !strings.Contains(err.Error(), "frozen") {
+		t.Fatalf("error %v, se esperaba que los globales fueran de solo lectura", err)
+	}
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Estados de un trabajo de la cola
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// ErrJobNotFound indica que no existe un trabajo con ese id
+var ErrJobNotFound = errors.New("job not found")
+
+// Job es un trabajo de la cola; la petición y el resultado se guardan serializados
+type Job struct {
+	ID        string
+	State     string
+	Attempts  int
+	Request   string
+	Result    string
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+const jobColumns = "id, state, attempts, request, result, error, created_at, updated_at"
+
+// Columnas de los listados: sin el resultado, que se obtiene con GetJob
+const jobListColumns = "id, state, attempts, request, '' AS result, error, created_at, updated_at"
+
+func scanJob(row interface{ Scan(...interface{}) error }) (Job, error) {
+	var j Job
+	var created, updated int64
+	if err := row.Scan(&j.ID, &j.State, &j.Attempts, &j.Request, &j.Result, &j.Error, &created, &updated); err != nil {
+		return Job{}, err
+	}
+	j.CreatedAt = time.UnixMilli(created)
+	j.UpdatedAt = time.UnixMilli(updated)
+	return j, nil
+}
+
+// EnqueueJobs añade los trabajos a la cola en estado pendiente
+func (s *Store) EnqueueJobs(ids, requests []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixMilli()
+	insert := s.rebind("INSERT INTO jobs (id, state, attempts, request, result, error, created_at, updated_at, lease_until) VALUES (?, ?, 0, ?, '', '', ?, ?, 0)")
+	for i, id := range ids {
+		if _, err := tx.Exec(insert, id, JobPending, requests[i], now, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ClaimJob reserva hasta leaseUntil el trabajo más antiguo de los pendientes cuya espera
+// entre intentos terminó y de los en curso cuyo plazo caducó (su worker murió). La
+// reserva cuenta como un intento, así que los trabajos en curso que caducan tras
+// maxAttempts intentos se marcan fallidos en vez de retomarse. Devuelve false si no
+// hay trabajos disponibles.
+func (s *Store) ClaimJob(leaseUntil time.Time, maxAttempts int) (Job, bool, error) {
+	now := time.Now().UnixMilli()
+	if err := s.exec("UPDATE jobs SET state = ?, error = ?, lease_until = 0, updated_at = ? WHERE state = ? AND lease_until < ? AND attempts >= ?",
+		JobFailed, "job lease expired", now, JobRunning, now, maxAttempts); err != nil {
+		return Job{}, false, err
+	}
+	for {
+		var id string
+		err := s.db.QueryRow(s.rebind(`SELECT id FROM jobs WHERE (state = ? OR state = ?) AND lease_until < ?
+			ORDER BY created_at LIMIT 1`), JobPending, JobRunning, now).Scan(&id)
+		if err == sql.ErrNoRows {
+			return Job{}, false, nil
+		}
+		if err != nil {
+			return Job{}, false, err
+		}
+
+		// La actualización condicional evita que dos workers reserven el mismo trabajo
+		res, err := s.db.Exec(s.rebind(`UPDATE jobs SET state = ?, attempts = attempts + 1, lease_until = ?, updated_at = ?
+			WHERE id = ? AND (state = ? OR state = ?) AND lease_until < ?`),
+			JobRunning, leaseUntil.UnixMilli(), now, id, JobPending, JobRunning, now)
+		if err != nil {
+			return Job{}, false, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+
+		job, err := s.GetJob(id)
+		return job, err == nil, err
+	}
+}
+
+// FinishJob guarda el resultado del trabajo y lo deja en el estado indicado
+func (s *Store) FinishJob(id, state, result, errMsg string) error {
+	return s.exec("UPDATE jobs SET state = ?, result = ?, error = ?, lease_until = 0, updated_at = ? WHERE id = ?",
+		state, result, errMsg, time.Now().UnixMilli(), id)
+}
+
+// RetryJob devuelve a la cola un trabajo fallido, que no se reserva antes de notBefore
+func (s *Store) RetryJob(id, errMsg string, notBefore time.Time) error {
+	return s.exec("UPDATE jobs SET state = ?, result = '', error = ?, lease_until = ?, updated_at = ? WHERE id = ?",
+		JobPending, errMsg, notBefore.UnixMilli(), time.Now().UnixMilli(), id)
+}
+
+// DeleteJobsBefore borra los trabajos terminados o fallidos antes de before y devuelve
+// cuántos borró
+func (s *Store) DeleteJobsBefore(before time.Time) (int64, error) {
+	res, err := s.db.Exec(s.rebind("DELETE FROM jobs WHERE (state = ? OR state = ?) AND updated_at < ?"),
+		JobDone, JobFailed, before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetJob devuelve un trabajo por su id
+func (s *Store) GetJob(id string) (Job, error) {
+	job, err := scanJob(s.db.QueryRow(s.rebind("SELECT "+jobColumns+" FROM jobs WHERE id = ?"), id))
+	if err == sql.ErrNoRows {
+		return Job{}, ErrJobNotFound
+	}
+	return job, err
+}
+
+// ListJobs devuelve como mucho limit trabajos del estado indicado (todos si está vacío)
+// que cumplan keep (todos si es nil), del más reciente al más antiguo y sin su
+// resultado. El límite se aplica tras keep, recorriendo la tabla hasta completarlo.
+func (s *Store) ListJobs(state string, limit int, keep func(Job) bool) ([]Job, error) {
+	query := "SELECT " + jobListColumns + " FROM jobs"
+	var args []interface{}
+	if state != "" {
+		query += " WHERE state = ?"
+		args = append(args, state)
+	}
+	query += " ORDER BY created_at DESC"
+	if keep == nil {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+
+	rows, err := s.db.Query(s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for len(jobs) < limit && rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		if keep == nil || keep(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxy-api/internal/audit"
+	"proxy-api/internal/config"
+	"proxy-api/internal/proxy"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// Drivers soportados
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS proxies (
+		session TEXT NOT NULL,
+		address TEXT NOT NULL,
+		validated_at BIGINT NOT NULL,
+		PRIMARY KEY (session, address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS proxy_scores (
+		session TEXT NOT NULL,
+		address TEXT NOT NULL,
+		successes BIGINT NOT NULL DEFAULT 0,
+		failures BIGINT NOT NULL DEFAULT 0,
+		last_success_at BIGINT NOT NULL DEFAULT 0,
+		last_failure_at BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (session, address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS sessions (
+		name TEXT PRIMARY KEY,
+		definition TEXT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		ts BIGINT NOT NULL,
+		session TEXT NOT NULL,
+		url TEXT NOT NULL,
+		proxy TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		bytes BIGINT NOT NULL,
+		latency_ms BIGINT NOT NULL,
+		client TEXT NOT NULL,
+		error TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_ts ON audit_log (ts)`,
+	`CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		state TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		request TEXT NOT NULL,
+		result TEXT NOT NULL,
+		error TEXT NOT NULL,
+		created_at BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL,
+		lease_until BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS jobs_state ON jobs (state, created_at)`,
+	`CREATE TABLE IF NOT EXISTS shared_pool (
+		key TEXT PRIMARY KEY,
+		snapshot TEXT NOT NULL,
+		published_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS usage (
+		day TEXT NOT NULL,
+		dimension TEXT NOT NULL,
+		key TEXT NOT NULL,
+		requests BIGINT NOT NULL DEFAULT 0,
+		bytes_in BIGINT NOT NULL DEFAULT 0,
+		bytes_out BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (day, dimension, key)
+	)`,
+}
+
+// Store persiste el estado de los proxies en una base de datos SQL
+type Store struct {
+	db     *sql.DB
+	driver string
+}
+
+// Open abre la base de datos y crea el esquema si no existe
+func Open(driver, dsn string) (*Store, error) {
+	var sqlDriver string
+	switch driver {
+	case DriverSQLite:
+		sqlDriver = "sqlite"
+	case DriverPostgres:
+		sqlDriver = "pgx"
+	default:
+		return nil, fmt.Errorf("unsupported storage driver '%s'", driver)
+	}
+
+	db, err := sql.Open(sqlDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == DriverSQLite {
+		// SQLite no admite escrituras concurrentes
+		db.SetMaxOpenConns(1)
+	}
+
+	s := &Store{db: db, driver: driver}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// rebind adapta los marcadores ? al formato $n de Postgres
+func (s *Store) rebind(query string) string {
+	if s.driver != DriverPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *Store) exec(query string, args ...interface{}) error {
+	_, err := s.db.Exec(s.rebind(query), args...)
+	return err
+}
+
+// SaveValidProxies reemplaza los proxies válidos almacenados por los del último ciclo.
+// Cada proxy se guarda como su URL, con credenciales.
+func (s *Store) SaveValidProxies(proxies map[string][]proxy.Proxy) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM proxies"); err != nil {
+		return err
+	}
+	now := time.Now()
+	insert := s.rebind("INSERT INTO proxies (session, address, validated_at) VALUES (?, ?, ?) ON CONFLICT (session, address) DO NOTHING")
+	for session, list := range proxies {
+		for _, p := range list {
+			validatedAt := p.ValidatedAt
+			if validatedAt.IsZero() {
+				validatedAt = now
+			}
+			if _, err := tx.Exec(insert, session, p.URL().String(), validatedAt.UnixMilli()); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadValidProxies devuelve los proxies válidos almacenados, agrupados por sesión
+func (s *Store) LoadValidProxies() (map[string][]proxy.Proxy, error) {
+	rows, err := s.db.Query("SELECT session, address, validated_at FROM proxies")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	proxies := make(map[string][]proxy.Proxy)
+	for rows.Next() {
+		var session, address string
+		var validatedAt int64
+		if err := rows.Scan(&session, &address, &validatedAt); err != nil {
+			return nil, err
+		}
+		p, err := proxy.Parse(address)
+		if err != nil {
+			continue
+		}
+		p.ValidatedAt = time.UnixMilli(validatedAt)
+		proxies[session] = append(proxies[session], p)
+	}
+	return proxies, rows.Err()
+}
+
+// RecordResult actualiza la puntuación de un proxy tras una petición
+func (s *Store) RecordResult(session, address string, success bool) error {
+	now := time.Now().UnixMilli()
+	if success {
+		return s.exec(`INSERT INTO proxy_scores (session, address, successes, last_success_at) VALUES (?, ?, 1, ?)
+			ON CONFLICT (session, address) DO UPDATE SET successes = proxy_scores.successes + 1, last_success_at = excluded.last_success_at`,
+			session, address, now)
+	}
+	return s.exec(`INSERT INTO proxy_scores (session, address, failures, last_failure_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT (session, address) DO UPDATE SET failures = proxy_scores.failures + 1, last_failure_at = excluded.last_failure_at`,
+		session, address, now)
+}
+
+// WorkedSince devuelve los proxies con alguna petición exitosa para la sesión desde since
+func (s *Store) WorkedSince(session string, since time.Time) ([]string, error) {
+	rows, err := s.db.Query(s.rebind("SELECT address FROM proxy_scores WHERE session = ? AND last_success_at >= ? ORDER BY last_success_at DESC"),
+		session, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addresses []string
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+// SaveSessions guarda las definiciones de sesión vigentes
+func (s *Store) SaveSessions(sessions map[string]config.ProxySession) error {
+	now := time.Now().UnixMilli()
+	for name, session := range sessions {
+		definition, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+		if err := s.exec(`INSERT INTO sessions (name, definition, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT (name) DO UPDATE SET definition = excluded.definition, updated_at = excluded.updated_at`,
+			name, string(definition), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveSharedPool sustituye la publicación del pool compartido guardada con esa clave
+func (s *Store) SaveSharedPool(key string, snapshot []byte, publishedAt time.Time) error {
+	return s.exec(`INSERT INTO shared_pool (key, snapshot, published_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET snapshot = excluded.snapshot, published_at = excluded.published_at`,
+		key, string(snapshot), publishedAt.UnixMilli())
+}
+
+// LoadSharedPool devuelve la publicación del pool compartido guardada con esa clave;
+// false si no hay ninguna
+func (s *Store) LoadSharedPool(key string) ([]byte, bool, error) {
+	var snapshot string
+	err := s.db.QueryRow(s.rebind("SELECT snapshot FROM shared_pool WHERE key = ?"), key).Scan(&snapshot)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return []byte(snapshot), true, nil
+}
+
+// RecordAudit guarda un registro de auditoría
+func (s *Store) RecordAudit(e audit.Entry) error {
+	return s.exec(`INSERT INTO audit_log (ts, session, url, proxy, status, bytes, latency_ms, client, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UnixMilli(), e.Session, e.URL, e.Proxy, e.Status, e.Bytes, e.LatencyMs, e.Client, e.Error)
+}
+
+// QueryAudit devuelve los registros de auditoría que cumplen el filtro, del más reciente al más antiguo
+func (s *Store) QueryAudit(f audit.Filter) ([]audit.Entry, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+
+	if f.Session != "" {
+		add("session = ?", f.Session)
+	}
+	if f.URLContains != "" {
+		add("url LIKE ?", "%"+f.URLContains+"%")
+	}
+	if f.Proxy != "" {
+		add("proxy = ?", f.Proxy)
+	}
+	if f.Client != "" {
+		add("client = ?", f.Client)
+	}
+	if f.Status != 0 {
+		add("status = ?", f.Status)
+	}
+	if !f.Since.IsZero() {
+		add("ts >= ?", f.Since.UnixMilli())
+	}
+	if !f.Until.IsZero() {
+		add("ts <= ?", f.Until.UnixMilli())
+	}
+
+	query := "SELECT ts, session, url, proxy, status, bytes, latency_ms, client, error FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY ts DESC"
+	if f.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(f.Limit)
+	}
+
+	rows, err := s.db.Query(s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []audit.Entry
+	for rows.Next() {
+		var e audit.Entry
+		var ts int64
+		if err := rows.Scan(&ts, &e.Session, &e.URL, &e.Proxy, &e.Status, &e.Bytes, &e.LatencyMs, &e.Client, &e.Error); err != nil {
+			return nil, err
+		}
+		e.Time = time.UnixMilli(ts)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Close cierra la conexión con la base de datos
+func (s *Store) Close() error {
+	return s.db.Close()
+}
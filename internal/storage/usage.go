@@ -0,0 +1,55 @@
+package storage
+
+// UsageRow es el tráfico de un día UTC para una clave de una dimensión (sesión, proxy o
+// clave de API)
+type UsageRow struct {
+	Day       string // AAAA-MM-DD
+	Dimension string
+	Key       string
+	Requests  int64
+	BytesIn   int64
+	BytesOut  int64
+}
+
+// AddUsage suma las filas a los totales guardados
+func (s *Store) AddUsage(rows []UsageRow) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsert := s.rebind(`INSERT INTO usage (day, dimension, key, requests, bytes_in, bytes_out) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (day, dimension, key) DO UPDATE SET requests = usage.requests + excluded.requests,
+		bytes_in = usage.bytes_in + excluded.bytes_in, bytes_out = usage.bytes_out + excluded.bytes_out`)
+	for _, r := range rows {
+		if _, err := tx.Exec(upsert, r.Day, r.Dimension, r.Key, r.Requests, r.BytesIn, r.BytesOut); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadUsage devuelve las filas de los días entre from y to, ambos incluidos
+func (s *Store) LoadUsage(from, to string) ([]UsageRow, error) {
+	rows, err := s.db.Query(s.rebind("SELECT day, dimension, key, requests, bytes_in, bytes_out FROM usage WHERE day >= ? AND day <= ? ORDER BY day"), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []UsageRow
+	for rows.Next() {
+		var r UsageRow
+		if err := rows.Scan(&r.Day, &r.Dimension, &r.Key, &r.Requests, &r.BytesIn, &r.BytesOut); err != nil {
+			return nil, err
+		}
+		usage = append(usage, r)
+	}
+	return usage, rows.Err()
+}
+
+// DeleteUsageBefore borra las filas de los días anteriores a day
+func (s *Store) DeleteUsageBefore(day string) error {
+	return s.exec("DELETE FROM usage WHERE day < ?", day)
+}
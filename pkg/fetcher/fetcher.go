@@ -0,0 +1,100 @@
+// Package fetcher expone el motor que atiende las peticiones a través del pool: cadena
+// de fallback, intentos escalonados, caché y el resto de políticas de las sesiones de
+// pkg/sessions. proxyserver lo usa para el servidor completo.
+package fetcher
+
+import (
+	"context"
+	"net/http"
+
+	"proxy-api/api"
+	pb "proxy-api/fetch"
+	"proxy-api/internal/captcha"
+	"proxy-api/pkg/pool"
+)
+
+// Fetcher obtiene el contenido de una petición
+type Fetcher interface {
+	Fetch(ctx context.Context, req *pb.Request) (*pb.Response, error)
+}
+
+// CaptchaSolver resuelve los CAPTCHA de las sesiones con Captcha.Solve
+type CaptchaSolver = captcha.Solver
+
+// Options configura el motor; el resto de ajustes se leen del entorno
+type Options struct {
+	Pool pool.ProxyPool // nil usa el pool en memoria
+
+	// Servicio de resolución de CAPTCHA propio; nil usa el de CAPTCHA_SOLVER, si hay
+	CaptchaSolver CaptchaSolver
+	// Transporte HTTP/3 para las peticiones directas de las sesiones con HTTP3, por
+	// ejemplo &http3.Transport{} de quic-go; nil usa el de quic-go si se compila con la
+	// etiqueta http3 y si no las deja en HTTP/1.1
+	HTTP3 http.RoundTripper
+}
+
+// Engine es el motor de peticiones. Solo puede haber uno por proceso.
+type Engine struct {
+	engine *api.Engine
+}
+
+var _ Fetcher = (*Engine)(nil)
+
+// New crea el motor; Start o StartStatic lo ponen en marcha
+func New(opts Options) *Engine {
+	if opts.Pool == nil {
+		opts.Pool = pool.NewMemory()
+	}
+	engine := api.NewEngine(opts.Pool)
+	if opts.CaptchaSolver != nil {
+		engine.SetCaptchaSolver(opts.CaptchaSolver)
+	}
+	if opts.HTTP3 != nil {
+		engine.SetHTTP3Transport(opts.HTTP3)
+	}
+	return &Engine{engine: engine}
+}
+
+// Start abre los backends configurados y lanza en segundo plano la validación periódica
+// del pool y los procesos del motor; todo se detiene al terminar ctx
+func (e *Engine) Start(ctx context.Context) {
+	e.engine.Start(ctx)
+}
+
+// StartStatic arranca el motor con un pool fijo por sesión, sin descargar fuentes ni
+// revalidar, y lo deja listo de inmediato
+func (e *Engine) StartStatic(ctx context.Context, proxies map[string][]pool.Proxy) {
+	e.engine.StartStatic(ctx, proxies)
+}
+
+// Ready indica si el pool ya puede atender peticiones; hasta entonces Fetch devuelve
+// Unavailable
+func (e *Engine) Ready() bool {
+	return e.engine.Ready()
+}
+
+// Fetch obtiene la petición igual que el RPC FetchContent
+func (e *Engine) Fetch(ctx context.Context, req *pb.Request) (*pb.Response, error) {
+	return e.engine.FetchContent(ctx, req)
+}
+
+// RandomProxy devuelve un proxy aleatorio del pool de la sesión
+func (e *Engine) RandomProxy(ctx context.Context, session string) (string, error) {
+	return e.engine.RandomProxy(ctx, session)
+}
+
+// Stats devuelve las estadísticas del pool y de las peticiones
+func (e *Engine) Stats(ctx context.Context) (*pb.StatsResponse, error) {
+	return e.engine.Stats(ctx)
+}
+
+// Service devuelve la implementación del servicio gRPC para registrarla en un servidor
+// propio
+func (e *Engine) Service() pb.ProxyServiceServer {
+	return e.engine.Service()
+}
+
+// ServeGRPC expone el motor por gRPC en GRPC_LISTEN_ADDRESSES hasta que ctx termine
+func (e *Engine) ServeGRPC(ctx context.Context) error {
+	return e.engine.ServeGRPC(ctx)
+}
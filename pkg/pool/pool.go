@@ -0,0 +1,88 @@
+// Package pool expone el pool de proxies validados y su validación: el almacén que
+// consume el motor de pkg/fetcher y el ciclo que prueba los proxies de las fuentes
+// contra cada sesión de pkg/sessions.
+package pool
+
+import (
+	"context"
+
+	"proxy-api/internal/config"
+	"proxy-api/internal/pool"
+	"proxy-api/internal/proxy"
+)
+
+// Proxy es un proxy del pool, identificado por esquema://host:puerto
+type Proxy = proxy.Proxy
+
+// ProxyPool es el almacén del pool por sesión, con la puntuación y la retirada de cada
+// proxy. Puede implementarse sobre otro backend y pasarse a fetcher.Options.
+type ProxyPool = pool.ProxyPool
+
+// Score acumula los resultados de un proxy para una sesión
+type Score = pool.Score
+
+// HourBucket acumula los resultados de un proxy en una hora del día
+type HourBucket = pool.HourBucket
+
+// Progress describe el estado de un ciclo de validación en curso
+type Progress = proxy.ValidationProgress
+
+// Etapas de un ciclo de validación
+const (
+	StageStarted = proxy.StageStarted
+	StageScraped = proxy.StageScraped
+	StageTesting = proxy.StageTesting
+	StageDone    = proxy.StageDone
+)
+
+// NewMemory crea el pool en memoria que se usa por defecto
+func NewMemory() ProxyPool {
+	return pool.NewMemory()
+}
+
+// Parse interpreta una línea de proxy: host:puerto, usuario:contraseña@host:puerto o
+// una URL con esquema
+func Parse(line string) (Proxy, error) {
+	return proxy.Parse(line)
+}
+
+// ValidateOptions configura un ciclo de Validate
+type ValidateOptions struct {
+	// Líneas de proxies por URL de origen, como las devuelve sources.Scrape; nil
+	// descarga las fuentes configuradas
+	Sources map[string][]string
+	// Progress recibe el progreso del ciclo; los eventos se pierden si no se atienden a
+	// tiempo
+	Progress func(Progress)
+}
+
+// Validate prueba cada proxy contra las sesiones registradas y devuelve los válidos por
+// sesión. Un ciclo posterior, en este proceso, cancela el anterior; la cancelación de ctx
+// termina con su error sin devolver un resultado parcial.
+func Validate(ctx context.Context, opts ValidateOptions) (map[string][]Proxy, error) {
+	if opts.Progress == nil {
+		return proxy.ValidateProxies(ctx, opts.Sources)
+	}
+
+	ch, cancel := proxy.SubscribeProgress()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range ch {
+			opts.Progress(event)
+		}
+	}()
+	proxies, err := proxy.ValidateProxies(ctx, opts.Sources)
+	cancel()
+	<-done
+	return proxies, err
+}
+
+// Test prueba un proxy contra la URL de la sesión
+func Test(ctx context.Context, session string, p Proxy) (bool, error) {
+	cfg, err := config.GetSessionOrDefault(session)
+	if err != nil {
+		return false, err
+	}
+	return proxy.RunProxyTest(ctx, cfg, p), nil
+}
@@ -0,0 +1,85 @@
+// Package sessions expone la configuración de las sesiones: el sitio contra el que se
+// validan los proxies y cómo se atienden sus peticiones. Las sesiones registradas aquí
+// son las que usan la validación de pkg/pool y el motor de pkg/fetcher del mismo proceso.
+package sessions
+
+import (
+	"proxy-api/internal/config"
+)
+
+// Session es la configuración de una sesión
+type Session = config.ProxySession
+
+// Tipos de la configuración de una sesión
+type (
+	FallbackStage  = config.FallbackStage
+	EvictionPolicy = config.EvictionPolicy
+	Experiment     = config.Experiment
+	LatencySLO     = config.LatencySLO
+	IntegrityCheck = config.IntegrityCheck
+	TLSOptions     = config.TLSOptions
+	CaptchaSolving = config.CaptchaSolving
+	DirectIdentity = config.DirectIdentity
+)
+
+// Etapas de la cadena de fallback
+const (
+	FallbackSuccessful = config.FallbackSuccessful
+	FallbackPool       = config.FallbackPool
+	FallbackProvider   = config.FallbackProvider
+	FallbackDirect     = config.FallbackDirect
+	FallbackHot        = config.FallbackHot
+)
+
+// Estrategias de reparto de los intentos dentro de una etapa
+const (
+	StrategyHedged     = config.StrategyHedged
+	StrategyRace       = config.StrategyRace
+	StrategySequential = config.StrategySequential
+)
+
+// Options controla cómo Register incorpora las sesiones
+type Options struct {
+	// Replace descarta antes las sesiones que no están en la lista, incluidas las
+	// configuradas por defecto
+	Replace bool
+}
+
+// Register añade las sesiones o sustituye las que tienen el mismo nombre
+func Register(opts Options, sessions ...Session) {
+	if opts.Replace {
+		keep := make(map[string]bool, len(sessions))
+		for _, session := range sessions {
+			keep[session.Name] = true
+		}
+		for name := range config.Sessions() {
+			if !keep[name] {
+				config.DeleteSession(name)
+			}
+		}
+	}
+	for _, session := range sessions {
+		config.SetSession(session)
+	}
+}
+
+// Get devuelve la sesión con ese nombre
+func Get(name string) (Session, bool) {
+	return config.GetSession(name)
+}
+
+// All devuelve una copia de las sesiones registradas por nombre
+func All() map[string]Session {
+	return config.Sessions()
+}
+
+// Remove quita la sesión
+func Remove(name string) {
+	config.DeleteSession(name)
+}
+
+// Validate comprueba las sesiones y el resto de la configuración; el error enumera
+// todos los problemas encontrados
+func Validate() error {
+	return config.Validate()
+}
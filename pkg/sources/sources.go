@@ -0,0 +1,44 @@
+// Package sources descarga las listas de proxies de las fuentes y las interpreta. El
+// resultado, líneas agrupadas por URL de origen, es la entrada de pool.Validate.
+package sources
+
+import (
+	"proxy-api/internal/config"
+	"proxy-api/internal/scraper"
+)
+
+// Source es una fuente de la que se descargan proxies
+type Source = config.ProxySource
+
+// Formatos de las listas de proxies
+const (
+	ParserText = config.SourceParserText
+	ParserJSON = config.SourceParserJSON
+)
+
+// Options selecciona las fuentes que descarga Scrape
+type Options struct {
+	// Fuentes a descargar; nil usa las configuradas (PROXY_SOURCES_FILE,
+	// PROXY_SOURCES_DIR o las fuentes por defecto), releídas en cada llamada
+	Sources []Source
+}
+
+// Scrape descarga las fuentes habilitadas y devuelve sus líneas de proxies agrupadas
+// por URL. Las fuentes con Refresh reutilizan su última lista hasta que vence y las
+// apartadas por fallos seguidos se omiten.
+func Scrape(opts Options) map[string][]string {
+	if opts.Sources == nil {
+		return scraper.ScrapeProxiesBySource()
+	}
+	return scraper.ScrapeSources(opts.Sources)
+}
+
+// Configured devuelve las fuentes configuradas
+func Configured() []Source {
+	return config.ProxySources()
+}
+
+// Parse convierte el contenido de una lista en líneas de proxies según su formato
+func Parse(parser string, body []byte) ([]string, error) {
+	return scraper.ParseProxyList(parser, body)
+}
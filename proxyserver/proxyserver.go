@@ -0,0 +1,130 @@
+// Package proxyserver integra el motor de proxies en otro servicio Go, en su propio
+// proceso y sin necesidad de gRPC.
+package proxyserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	pb "proxy-api/fetch"
+	"proxy-api/pkg/fetcher"
+	"proxy-api/pkg/pool"
+	"proxy-api/pkg/sessions"
+)
+
+// Session es la configuración de una sesión
+type Session = sessions.Session
+
+// ProxyPool es el almacén del pool de proxies validados
+type ProxyPool = pool.ProxyPool
+
+// CaptchaSolver resuelve los CAPTCHA de las sesiones con Captcha.Solve
+type CaptchaSolver = fetcher.CaptchaSolver
+
+// NewMemoryPool crea el pool en memoria que se usa por defecto
+func NewMemoryPool() ProxyPool {
+	return pool.NewMemory()
+}
+
+// Config configura el servidor embebido; el resto de ajustes se leen del entorno
+type Config struct {
+	Sessions []Session // Sesiones que se añaden o sustituyen a las configuradas
+	Pool     ProxyPool // nil usa el pool en memoria
+	GRPC     bool      // Exponer además el servicio gRPC en GRPC_LISTEN_ADDRESSES
+
+	// Servicio de resolución de CAPTCHA propio; nil usa el de CAPTCHA_SOLVER, si hay
+	CaptchaSolver CaptchaSolver
+	// Transporte HTTP/3 para las peticiones directas de las sesiones con HTTP3, por
+	// ejemplo &http3.Transport{} de quic-go; nil usa el de quic-go si se compila con la
+	// etiqueta http3 y si no las deja en HTTP/1.1
+	HTTP3 http.RoundTripper
+
+	// Pool fijo por sesión (host:puerto o URL con esquema); si no es nil no se descargan
+	// fuentes ni se revalida, y el motor queda listo al arrancar
+	Proxies map[string][]string
+}
+
+// Server es el motor de proxies embebido
+type Server struct {
+	cfg    Config
+	engine *fetcher.Engine
+}
+
+// New registra las sesiones de cfg y crea el motor; Run lo pone en marcha
+func New(cfg Config) *Server {
+	sessions.Register(sessions.Options{}, cfg.Sessions...)
+	engine := fetcher.New(fetcher.Options{
+		Pool:          cfg.Pool,
+		CaptchaSolver: cfg.CaptchaSolver,
+		HTTP3:         cfg.HTTP3,
+	})
+	return &Server{cfg: cfg, engine: engine}
+}
+
+// Run valida la configuración, arranca la validación del pool y los procesos en
+// segundo plano y bloquea hasta que ctx termine o falle el servidor gRPC
+func (s *Server) Run(ctx context.Context) error {
+	if err := sessions.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if s.cfg.Proxies != nil {
+		proxies, err := parseProxies(s.cfg.Proxies)
+		if err != nil {
+			return err
+		}
+		s.engine.StartStatic(ctx, proxies)
+	} else {
+		s.engine.Start(ctx)
+	}
+
+	if s.cfg.GRPC {
+		return s.engine.ServeGRPC(ctx)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// Ready indica si la primera validación del pool ya terminó; hasta entonces Fetch
+// devuelve Unavailable
+func (s *Server) Ready() bool {
+	return s.engine.Ready()
+}
+
+// Fetch obtiene la petición igual que el RPC FetchContent
+func (s *Server) Fetch(ctx context.Context, req *pb.Request) (*pb.Response, error) {
+	return s.engine.Fetch(ctx, req)
+}
+
+// RandomProxy devuelve un proxy aleatorio del pool de la sesión
+func (s *Server) RandomProxy(ctx context.Context, session string) (string, error) {
+	return s.engine.RandomProxy(ctx, session)
+}
+
+// Stats devuelve las estadísticas del pool y de las peticiones
+func (s *Server) Stats(ctx context.Context) (*pb.StatsResponse, error) {
+	return s.engine.Stats(ctx)
+}
+
+// Service devuelve la implementación del servicio gRPC, con el resto de RPC del motor
+func (s *Server) Service() pb.ProxyServiceServer {
+	return s.engine.Service()
+}
+
+// parseProxies interpreta el pool fijo de la configuración
+func parseProxies(lines map[string][]string) (map[string][]pool.Proxy, error) {
+	proxies := make(map[string][]pool.Proxy, len(lines))
+	for session, list := range lines {
+		for _, line := range list {
+			p, err := pool.Parse(line)
+			if err != nil {
+				return nil, fmt.Errorf("session '%s': invalid proxy '%s': %w", session, line, err)
+			}
+			proxies[session] = append(proxies[session], p)
+		}
+	}
+	return proxies, nil
+}